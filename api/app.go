@@ -13,8 +13,12 @@ import (
 	"github.com/unrolled/secure"
 
 	"github.com/news-ai/api-v1/auth"
+	"github.com/news-ai/api-v1/billing"
+	apiControllers "github.com/news-ai/api-v1/controllers"
 	"github.com/news-ai/api-v1/db"
 	"github.com/news-ai/api-v1/middleware"
+	apiModels "github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/repositories"
 	"github.com/news-ai/api-v1/routes"
 	apiSearch "github.com/news-ai/api-v1/search"
 	"github.com/news-ai/api-v1/utils"
@@ -28,11 +32,26 @@ import (
 
 func main() {
 	// Setup database & URL
-	db.InitDB()
+	err := db.InitDB()
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	apiControllers.SetStore(repositories.NewPostgresStore(db.DB, db.ReadDB))
 	utils.InitURL()
 	apiSearch.InitializeElasticSearch()
 	search.InitializeElasticSearch()
-	err := auth.SetupAuthStore()
+	err = auth.SetupAuthStore()
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	err = billing.SetupPaymentProvider()
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	err = apiModels.SetupTrustedProxies()
 	if err != nil {
 		log.Printf("%v", err)
 		return
@@ -73,10 +92,19 @@ func main() {
 	router.Handler("GET", "/api/auth", CSRF(auth.PasswordLoginPageHandler()))
 	router.Handler("POST", "/api/auth/userlogin", CSRF(auth.PasswordLoginHandler()))
 
+	// Second step of the password login
+	router.Handler("GET", "/api/auth/two-factor", CSRF(auth.TwoFactorPageHandler()))
+	router.Handler("POST", "/api/auth/usertwofactor", CSRF(auth.TwoFactorHandler()))
+
 	// Forget password
 	router.Handler("GET", "/api/auth/forget", CSRF(auth.ForgetPasswordPageHandler()))
 	router.Handler("POST", "/api/auth/userforget", CSRF(auth.ForgetPasswordHandler()))
 
+	// Magic link login
+	router.Handler("GET", "/api/auth/magic-link", CSRF(auth.MagicLinkPageHandler()))
+	router.Handler("POST", "/api/auth/usermagiclink", CSRF(auth.MagicLinkHandler()))
+	router.Handler("GET", "/api/auth/magic", auth.MagicLinkLoginHandler())
+
 	// Change password
 	router.Handler("GET", "/api/auth/changepassword", CSRF(auth.ChangePasswordPageHandler()))
 	router.Handler("POST", "/api/auth/userchange", CSRF(auth.ChangePasswordHandler()))
@@ -101,11 +129,22 @@ func main() {
 	router.GET("/api/auth/remove-gmail", auth.RemoveGmailHandler)
 	router.GET("/api/auth/googlecallback", auth.GoogleCallbackHandler)
 
+	// OpenID Connect providers, from OIDC_PROVIDERS
+	router.GET("/api/auth/oidc/:provider", auth.OIDCLoginHandler)
+	router.GET("/api/auth/oidc/:provider/callback", auth.OIDCCallbackHandler)
+
 	// Login with Outlook
 	router.GET("/api/auth/outlook", auth.OutlookLoginHandler)
 	router.GET("/api/auth/remove-outlook", auth.RemoveOutlookHandler)
 	router.GET("/api/auth/outlookcallback", auth.OutlookCallbackHandler)
 
+	// Access and refresh tokens for the Authorization header
+	router.Handler("POST", "/api/auth/token", auth.TokenHandler())
+
+	// Admin impersonation
+	router.Handler("POST", "/api/auth/impersonate", CSRF(auth.ImpersonateHandler()))
+	router.Handler("POST", "/api/auth/stop-impersonating", CSRF(auth.StopImpersonatingHandler()))
+
 	// Logout user
 	router.GET("/api/auth/logout", auth.LogoutHandler)
 
@@ -127,13 +166,18 @@ func main() {
 	router.Handler("POST", "/api/billing/confirmation", auth.ChoosePlanHandler())
 	router.Handler("POST", "/api/billing/switch-confirmation", auth.ChooseSwitchPlanHandler())
 	router.Handler("POST", "/api/billing/receipt", auth.ConfirmPlanHandler())
+	router.Handler("POST", "/api/billing/switch-receipt", auth.ConfirmSwitchPlanHandler())
 
 	// Cancel plan method
 	router.Handler("GET", "/api/billing/cancel", CSRF(auth.CancelPlanPageHandler()))
+	router.Handler("POST", "/api/billing/cancel", CSRF(auth.CancelPlanHandler()))
 
 	// Optional checks
 	router.Handler("POST", "/api/billing/check-coupon", auth.CheckCouponValid())
 
+	// Stripe subscription events
+	router.POST("/api/billing/webhooks/stripe", routes.StripeWebhookHandler)
+
 	// Main billing page for a user
 	router.Handler("GET", "/api/billing", CSRF(auth.BillingPageHandler()))
 
@@ -148,19 +192,48 @@ func main() {
 	router.GET("/api/users", routes.UsersHandler)
 	router.GET("/api/users/:id", routes.UserHandler)
 	router.PATCH("/api/users/:id", routes.UserHandler)
+	router.DELETE("/api/users/:id", routes.UserHandler)
 	router.GET("/api/users/:id/:action", routes.UserActionHandler)
 	router.POST("/api/users/:id/:action", routes.UserActionHandler)
+	router.DELETE("/api/users/:id/api-keys/:keyid", routes.UserApiKeyHandler)
+	router.DELETE("/api/users/:id/sessions", routes.UserSessionsHandler)
+	router.DELETE("/api/users/:id/sessions/:sessionid", routes.UserSessionHandler)
+
+	router.GET("/api/search/users", routes.UserSearchHandler)
+
+	router.GET("/api/audit", routes.AuditEventsHandler)
+
+	router.POST("/api/tokens/cleanup", routes.TokensCleanupHandler)
+
+	router.GET("/api/signup-reviews", routes.SignupReviewsHandler)
+	router.POST("/api/signup-reviews/:id/:action", routes.SignupReviewActionHandler)
+
+	router.GET("/api/plans", routes.PlansHandler)
+	router.POST("/api/plans", routes.PlansHandler)
+	router.GET("/api/plans/:id", routes.PlanHandler)
+	router.PATCH("/api/plans/:id", routes.PlanHandler)
+	router.DELETE("/api/plans/:id", routes.PlanHandler)
+
+	router.GET("/api/entitlement-overrides", routes.EntitlementOverridesHandler)
+	router.POST("/api/entitlement-overrides", routes.EntitlementOverridesHandler)
+	router.DELETE("/api/entitlement-overrides/:id", routes.EntitlementOverrideHandler)
 
 	router.GET("/api/agencies", routes.AgenciesHandler)
 	router.GET("/api/agencies/:id", routes.AgencyHandler)
+	router.DELETE("/api/agencies/:id", routes.AgencyHandler)
+	router.POST("/api/agencies/:id/:action", routes.AgencyActionHandler)
 
 	router.GET("/api/clients", routes.ClientsHandler)
 	router.GET("/api/clients/:id", routes.ClientHandler)
+	router.DELETE("/api/clients/:id", routes.ClientHandler)
+	router.POST("/api/clients/:id/:action", routes.ClientActionHandler)
 
 	router.GET("/api/teams", routes.TeamsHandler)
 	router.POST("/api/teams", routes.TeamsHandler)
 	router.GET("/api/teams/:id", routes.TeamHandler)
+	router.DELETE("/api/teams/:id", routes.TeamHandler)
 	router.GET("/api/teams/:id/:action", routes.TeamActionHandler)
+	router.POST("/api/teams/:id/:action", routes.TeamActionHandler)
 
 	router.GET("/api/invites", routes.InvitesHandler)
 	router.POST("/api/invites", routes.InvitesHandler)
@@ -4,34 +4,21 @@ import (
 	"net/http"
 
 	"github.com/news-ai/api-v1/controllers"
-
-	"github.com/news-ai/web/utilities"
+	"github.com/news-ai/api-v1/models"
 )
 
-func BasicAuthLogin(w http.ResponseWriter, r *http.Request, apiKey string) bool {
-	// Generate a random state that we identify the user with
-	state := utilities.RandToken()
-
-	// Save the session for each of the users
-	session, _ := store.Get(r, "sess")
-	session.Values["state"] = state
-	session.Save(r, w)
-
-	user, err := controllers.GetUserFromApiKey(apiKey)
-	if err != nil {
-		return false
-	}
-
-	session.Values["id"] = user.Id
-	session.Values["email"] = user.Data.Email
-	session.Save(r, w)
-
-	return true
+// BasicAuthLogin checks an API key sent as the basic auth username. It no
+// longer writes a session: the key has to be sent with every request, and
+// its scopes only apply to that request.
+func BasicAuthLogin(w http.ResponseWriter, r *http.Request, apiKey string) (models.UserPostgres, *models.ApiKey, error) {
+	return controllers.GetUserByApiKey(apiKey)
 }
 
 func BasicAuthLogout(w http.ResponseWriter, r *http.Request) {
 	session, _ := store.Get(r, "sess")
+	endSessionRecord(session)
 	delete(session.Values, "state")
 	delete(session.Values, "email")
+	delete(session.Values, "impersonatorid")
 	session.Save(r, w)
 }
@@ -31,8 +31,23 @@ func SetupAuthStore() error {
 	if err != nil {
 		return err
 	}
-	googleOauthConfig.RedirectURL = utils.APIURL + "/auth/googlecallback"
-	return nil
+	gmailOauthConfig.RedirectURL = utils.APIURL + "/auth/googlecallback"
+
+	err = setupTokenKey()
+	if err != nil {
+		return err
+	}
+
+	err = setupLoginProviders()
+	if err != nil {
+		return err
+	}
+
+	err = setupSignupScreening()
+	if err != nil {
+		return err
+	}
+	return setupThrottle()
 }
 
 // Gets the email of the current user that is logged in
@@ -65,13 +80,15 @@ func GetCurrentUserId(r *http.Request) (int64, error) {
 
 func LogoutHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	session, _ := store.Get(r, "sess")
+	endSessionRecord(session)
 	delete(session.Values, "state")
 	delete(session.Values, "id")
 	delete(session.Values, "email")
+	delete(session.Values, "impersonatorid")
 	session.Save(r, w)
 
-	if r.URL.Query().Get("next") != "" {
-		http.Redirect(w, r, r.URL.Query().Get("next"), 302)
+	if next := queryNext(r); next != "" {
+		http.Redirect(w, r, next, 302)
 		return
 	}
 
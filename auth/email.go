@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+)
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridPersonalization struct {
+	To []sendGridAddress `json:"to"`
+}
+
+type sendGridMail struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+}
+
+/*
+* Private methods
+ */
+
+// Sends a plain text email from support through the SendGrid API, for the
+// account emails that are not templated in the emails package.
+func sendEmail(email string, subject string, body string) error {
+	apiKey := os.Getenv("SENDGRID_API_KEY")
+	if apiKey == "" {
+		return errors.New("SENDGRID_API_KEY is not set, email not sent to " + email)
+	}
+
+	message := sendGridMail{
+		Personalizations: []sendGridPersonalization{{To: []sendGridAddress{{Email: email}}}},
+		From:             sendGridAddress{Email: "support@newsai.co"},
+		Subject:          subject,
+		Content:          []sendGridContent{{Type: "text/plain", Value: body}},
+	}
+
+	messageJson, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	req, _ := http.NewRequest("POST", "https://api.sendgrid.com/v3/mail/send", bytes.NewReader(messageJson))
+	req.Header.Add("Authorization", "Bearer "+apiKey)
+	req.Header.Add("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return errors.New("Email to " + email + " failed with " + resp.Status)
+	}
+	return nil
+}
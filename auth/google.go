@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
 
 	"golang.org/x/net/context"
@@ -19,23 +18,11 @@ import (
 	apiModels "github.com/news-ai/api-v1/models"
 
 	tabulaeControllers "github.com/news-ai/tabulae-v1/controllers"
-	"github.com/news-ai/tabulae-v1/emails"
 
 	"github.com/news-ai/web/utilities"
 )
 
 var (
-	googleOauthConfig = &oauth2.Config{
-		RedirectURL:  "https://tabulae.newsai.org/api/auth/googlecallback",
-		ClientID:     os.Getenv("GOOGLEAUTHKEY"),
-		ClientSecret: os.Getenv("GOOGLEAUTHSECRET"),
-		Scopes: []string{
-			"https://www.googleapis.com/auth/userinfo.profile",
-			"https://www.googleapis.com/auth/userinfo.email",
-		},
-		Endpoint: google.Endpoint,
-	}
-
 	gmailOauthConfig = &oauth2.Config{
 		RedirectURL:  "https://tabulae.newsai.org/api/auth/googlecallback",
 		ClientID:     os.Getenv("GOOGLEAUTHKEY"),
@@ -53,32 +40,17 @@ var (
 
 // Handler to redirect user to the Google OAuth2 page
 func GoogleLoginHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	// Generate a random state that we identify the user with
-	state := utilities.RandToken()
-
 	// Save the session for each of the users
 	session, err := store.Get(r, "sess")
 	if err != nil {
 		log.Printf("%v", err)
 	}
 
-	session.Values["state"] = state
 	session.Values["gmail"] = "no"
 	session.Values["gmail_email"] = ""
 
-	if r.URL.Query().Get("next") != "" {
-		session.Values["next"] = r.URL.Query().Get("next")
-	}
-
-	err = session.Save(r, w)
-	if err != nil {
-		log.Printf("%v", err)
-	}
-
-	// Redirect the user to the login page
-	url := googleOauthConfig.AuthCodeURL(state)
-	http.Redirect(w, r, url, 302)
-	return
+	provider, _ := loginProviders.Get(googleProvider)
+	startProviderLogin(w, r, session, provider)
 }
 
 // Handler to redirect user to the Google OAuth2 page
@@ -94,8 +66,8 @@ func RemoveGmailHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Par
 	user.Data.Gmail = false
 	// apiControllers.SaveUser(c, r, &user)
 
-	if r.URL.Query().Get("next") != "" {
-		returnURL := r.URL.Query().Get("next")
+	if queryNext(r) != "" {
+		returnURL := queryNext(r)
 		if err != nil {
 			http.Redirect(w, r, returnURL, 302)
 			return
@@ -129,8 +101,8 @@ func GmailLoginHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 	session.Values["gmail"] = "yes"
 	session.Values["gmail_email"] = user.Data.Email
 
-	if r.URL.Query().Get("next") != "" {
-		session.Values["next"] = r.URL.Query().Get("next")
+	if queryNext(r) != "" {
+		session.Values["next"] = queryNext(r)
 	}
 
 	err = session.Save(r, w)
@@ -143,7 +115,9 @@ func GmailLoginHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 	http.Redirect(w, r, url, 302)
 }
 
-// Handler to get information when callback comes back from Google
+// Handler to get information when callback comes back from Google. Logins
+// are checked as OpenID Connect; connecting Gmail still goes through the
+// plain OAuth2 flow, for the offline Gmail scopes.
 func GoogleCallbackHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	session, err := store.Get(r, "sess")
 	if err != nil {
@@ -152,6 +126,12 @@ func GoogleCallbackHandler(w http.ResponseWriter, r *http.Request, _ httprouter.
 		return
 	}
 
+	if session.Values["gmail"] != "yes" {
+		provider, _ := loginProviders.Get(googleProvider)
+		finishProviderLogin(w, r, session, provider)
+		return
+	}
+
 	if r.URL.Query().Get("state") != session.Values["state"] {
 		log.Printf("%v", "no state match; possible csrf OR cookies not enabled")
 		fmt.Fprintln(w, "no state match; possible csrf OR cookies not enabled")
@@ -159,7 +139,7 @@ func GoogleCallbackHandler(w http.ResponseWriter, r *http.Request, _ httprouter.
 	}
 
 	ctx := context.Background()
-	tkn, err := googleOauthConfig.Exchange(ctx, r.URL.Query().Get("code"))
+	tkn, err := gmailOauthConfig.Exchange(ctx, r.URL.Query().Get("code"))
 
 	if err != nil {
 		log.Printf("%v", "there was an issue getting your token")
@@ -191,6 +171,12 @@ func GoogleCallbackHandler(w http.ResponseWriter, r *http.Request, _ httprouter.
 		return
 	}
 
+	if session.Values["gmail_email"].(string) != googleUser.Email {
+		log.Printf("%v", "Tried to login with email "+googleUser.Email+" for user "+session.Values["gmail_email"].(string))
+		http.Redirect(w, r, "https://tabulae.newsai.co/settings", 302)
+		return
+	}
+
 	newUser := apiModels.User{}
 	newUser.Email = googleUser.Email
 	newUser.GoogleId = googleUser.ID
@@ -204,63 +190,10 @@ func GoogleCallbackHandler(w http.ResponseWriter, r *http.Request, _ httprouter.
 	newUser.RefreshToken = tkn.RefreshToken
 	newUser.AccessToken = tkn.AccessToken
 	newUser.GoogleCode = r.URL.Query().Get("code")
-	if session.Values["gmail"] == "yes" {
-		newUser.Gmail = true
-		newUser.Outlook = false
-		newUser.ExternalEmail = false
-
-		if session.Values["gmail_email"].(string) != googleUser.Email {
-			log.Printf("%v", "Tried to login with email "+googleUser.Email+" for user "+session.Values["gmail_email"].(string))
-			http.Redirect(w, r, "https://tabulae.newsai.co/settings", 302)
-			return
-		}
-	}
+	newUser.Gmail = true
+	newUser.Outlook = false
+	newUser.ExternalEmail = false
 
 	user, _, _ := tabulaeControllers.RegisterUser(r, newUser)
-
-	session.Values["email"] = googleUser.Email
-	session.Values["id"] = newUser.Id
-	session.Save(r, w)
-
-	if user.Data.IsActive {
-		if session.Values["next"] != nil {
-			returnURL := session.Values["next"].(string)
-			u, err := url.Parse(returnURL)
-			if err != nil {
-				http.Redirect(w, r, returnURL, 302)
-				return
-			}
-
-			if user.Data.LastLoggedIn.IsZero() {
-				q := u.Query()
-				q.Set("firstTimeUser", "true")
-				u.RawQuery = q.Encode()
-
-				err = emails.AddUserToTabulaeTrialList(user.Data)
-				if err != nil {
-					// Redirect user back to login page
-					log.Printf("%v", "Welcome email was not sent for "+user.Data.Email)
-					log.Printf("%v", err)
-				}
-
-				user.ConfirmLoggedIn()
-			}
-			http.Redirect(w, r, u.String(), 302)
-			return
-		}
-	} else {
-		if user.Data.LastLoggedIn.IsZero() {
-			err = emails.AddUserToTabulaeTrialList(user.Data)
-			if err != nil {
-				// Redirect user back to login page
-				log.Printf("%v", "Welcome email was not sent for "+user.Data.Email)
-				log.Printf("%v", err)
-			}
-		}
-		http.Redirect(w, r, "/api/billing/plans/trial", 302)
-		return
-	}
-
-	http.Redirect(w, r, "/", 302)
-	return
+	completeProviderLogin(w, r, session, user)
 }
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	apiControllers "github.com/news-ai/api-v1/controllers"
+
+	nError "github.com/news-ai/web/errors"
+)
+
+/*
+* Private methods
+ */
+
+// Impersonation swaps the email in the session, so it only makes sense
+// for requests that were authenticated by that session.
+func isSessionUser(r *http.Request) bool {
+	email, err := GetCurrentUserEmail(r)
+	if err != nil {
+		return false
+	}
+
+	user, err := apiControllers.GetCurrentUser(r)
+	return err == nil && user.Data.Email == email
+}
+
+func redirectAfterImpersonation(w http.ResponseWriter, r *http.Request) {
+	if next := queryNext(r); next != "" {
+		http.Redirect(w, r, next, 302)
+		return
+	}
+	http.Redirect(w, r, "https://tabulae.newsai.co/", 302)
+}
+
+/*
+* Public methods
+ */
+
+// GetImpersonatorId returns the admin impersonating the session's user.
+func GetImpersonatorId(r *http.Request) (int64, error) {
+	session, err := store.Get(r, "sess")
+	if err != nil {
+		return 0, errors.New("No user logged in")
+	}
+
+	impersonatorId, ok := session.Values["impersonatorid"].(int64)
+	if !ok {
+		return 0, errors.New("Not impersonating a user")
+	}
+
+	return impersonatorId, nil
+}
+
+// EndSession logs the session out, for when it can no longer be trusted.
+func EndSession(w http.ResponseWriter, r *http.Request) {
+	session, _ := store.Get(r, "sess")
+	endSessionRecord(session)
+	delete(session.Values, "state")
+	delete(session.Values, "id")
+	delete(session.Values, "email")
+	delete(session.Values, "impersonatorid")
+	session.Save(r, w)
+}
+
+// ImpersonateHandler lets an admin see the API as the user in ?id. The
+// session keeps the admin's id, which every audit event records until
+// StopImpersonatingHandler is called.
+func ImpersonateHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isSessionUser(r) {
+			w.Header().Set("Content-Type", "application/json")
+			nError.ReturnError(w, http.StatusForbidden, "Impersonation error", "Impersonation needs a logged in session")
+			return
+		}
+
+		user, err := apiControllers.StartImpersonation(r, r.FormValue("id"))
+		if err != nil {
+			log.Printf("%v", err)
+			w.Header().Set("Content-Type", "application/json")
+			nError.ReturnError(w, http.StatusForbidden, "Impersonation error", err.Error())
+			return
+		}
+
+		currentUser, _ := apiControllers.GetCurrentUser(r)
+
+		session, _ := store.Get(r, "sess")
+		session.Values["impersonatorid"] = currentUser.Id
+		session.Values["email"] = user.Data.Email
+		session.Save(r, w)
+
+		redirectAfterImpersonation(w, r)
+	}
+}
+
+func StopImpersonatingHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isSessionUser(r) {
+			w.Header().Set("Content-Type", "application/json")
+			nError.ReturnError(w, http.StatusForbidden, "Impersonation error", "Impersonation needs a logged in session")
+			return
+		}
+
+		admin, err := apiControllers.StopImpersonation(r)
+		if err != nil {
+			log.Printf("%v", err)
+			w.Header().Set("Content-Type", "application/json")
+			nError.ReturnError(w, http.StatusBadRequest, "Impersonation error", err.Error())
+			return
+		}
+
+		session, _ := store.Get(r, "sess")
+		session.Values["email"] = admin.Data.Email
+		delete(session.Values, "impersonatorid")
+		session.Save(r, w)
+
+		redirectAfterImpersonation(w, r)
+	}
+}
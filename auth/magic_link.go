@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/gorilla/csrf"
+
+	apiControllers "github.com/news-ai/api-v1/controllers"
+	apiModels "github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/utils"
+)
+
+/*
+* Private methods
+ */
+
+func sendMagicLink(email string, code string, next string) error {
+	link := utils.APIURL + "/auth/magic?code=" + url.QueryEscape(code)
+	if next != "" {
+		link += "&next=" + url.QueryEscape(next)
+	}
+
+	body := "Hi,\n\nClick the link below to log into your NewsAI account. It works once, for the next 15 minutes.\n\n" +
+		link + "\n\n" +
+		"If you did not ask for this link, you can ignore this email.\n\nThe NewsAI team"
+
+	return sendEmail(email, "Your NewsAI login link", body)
+}
+
+/*
+* Public methods
+ */
+
+func MagicLinkPageHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, err := apiControllers.GetCurrentUser(r)
+
+		if next := queryNext(r); next != "" {
+			session, _ := store.Get(r, "sess")
+			session.Values["next"] = next
+			session.Save(r, w)
+
+			// If there is a next and the user has been logged in
+			if err == nil {
+				http.Redirect(w, r, next, 302)
+				return
+			}
+		}
+
+		// If there is no next and the user is logged in
+		if err == nil {
+			http.Redirect(w, r, "https://tabulae.newsai.co/", 302)
+			return
+		}
+
+		data := map[string]interface{}{
+			csrf.TemplateTag: csrf.TemplateField(r),
+		}
+
+		t := template.New("magic-link.html")
+		t, _ = t.ParseFiles("auth/magic-link.html")
+		t.Execute(w, data)
+	}
+}
+
+// MagicLinkHandler emails a one-time login link. The answer is the same
+// whether or not there is an account for the email, so the form can't be
+// used to find out who has one.
+func MagicLinkHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := strings.ToLower(r.FormValue("email"))
+
+		validEmail, err := mail.ParseAddress(email)
+		if err != nil {
+			invalidEmailAlert := url.QueryEscape("The email you entered is not valid!")
+			http.Redirect(w, r, "/api/auth?success=false&message="+invalidEmailAlert, 302)
+			return
+		}
+
+		// Every request can send an email, so all of them are counted
+		err = checkThrottle(r, throttleMagicLink, validEmail.Address)
+		if err != nil {
+			http.Redirect(w, r, "/api/auth?success=false&message="+url.QueryEscape(err.Error()), 302)
+			return
+		}
+		recordThrottleFailure(r, throttleMagicLink, validEmail.Address)
+
+		sentMessage := url.QueryEscape("If there is an account for this email, we sent it a login link!")
+
+		user, err := apiControllers.GetUserByEmail(validEmail.Address)
+		if err != nil || user.Data.IsBanned || apiControllers.UserAwaitingReview(user) {
+			http.Redirect(w, r, "/api/auth?success=true&message="+sentMessage, 302)
+			return
+		}
+
+		code, err := apiControllers.CreateUserToken(user.Id, apiModels.UserTokenMagicLink)
+		if err == nil {
+			session, _ := store.Get(r, "sess")
+			err = sendMagicLink(user.Data.Email, code, sessionNext(session))
+		}
+		if err != nil {
+			log.Printf("%v", "Login link was not sent for "+validEmail.Address)
+			log.Printf("%v", err)
+			linkErr := url.QueryEscape("Could not send a login link. We'll fix this soon!")
+			http.Redirect(w, r, "/api/auth?success=false&message="+linkErr, 302)
+			return
+		}
+
+		http.Redirect(w, r, "/api/auth?success=true&message="+sentMessage, 302)
+	}
+}
+
+// MagicLinkLoginHandler logs in whoever opened the link, the same way a
+// password login does: two-factor still applies, and the user is sent on
+// to next or to the trial page.
+func MagicLinkLoginHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invalidLink := url.QueryEscape("Your login link is invalid or has expired!")
+
+		// Links are only counted per ip, since a wrong link does not tell
+		// us whose account it was meant for
+		err := checkThrottle(r, throttleMagicLink, "")
+		if err != nil {
+			http.Redirect(w, r, "/api/auth?success=false&message="+url.QueryEscape(err.Error()), 302)
+			return
+		}
+
+		user, err := apiControllers.LoginWithToken(r, r.URL.Query().Get("code"))
+		if err != nil {
+			recordThrottleFailure(r, throttleMagicLink, "")
+			http.Redirect(w, r, "/api/auth?success=false&message="+invalidLink, 302)
+			return
+		}
+
+		if user.Data.IsBanned {
+			http.Redirect(w, r, "/api/auth?success=false&message="+invalidLink, 302)
+			return
+		}
+
+		// The link may be opened in another browser than the one that
+		// asked for it
+		session, _ := store.Get(r, "sess")
+		if next := queryNext(r); next != "" {
+			session.Values["next"] = next
+		}
+		session.Save(r, w)
+
+		if apiControllers.UserRequiresTwoFactor(user) {
+			startTwoFactorChallenge(w, r, session, user)
+			return
+		}
+
+		completePasswordLogin(w, r, session, user)
+	}
+}
@@ -0,0 +1,334 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/gorilla/sessions"
+	"github.com/julienschmidt/httprouter"
+
+	apiControllers "github.com/news-ai/api-v1/controllers"
+	apiModels "github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/oidc"
+	"github.com/news-ai/api-v1/repositories"
+	"github.com/news-ai/api-v1/utils"
+
+	tabulaeControllers "github.com/news-ai/tabulae-v1/controllers"
+	"github.com/news-ai/tabulae-v1/emails"
+)
+
+// Google logins go through the same registry as the providers configured
+// with OIDC_PROVIDERS.
+const googleProvider = "google"
+
+var loginProviders = oidc.NewRegistry()
+
+var errIdentityNotLinked = errors.New("Identity is not linked to the account with its email")
+
+/*
+* Private methods
+ */
+
+func setupLoginProviders() error {
+	loginProviders.Register(oidc.NewProvider(oidc.Config{
+		Name:            googleProvider,
+		Issuer:          "https://accounts.google.com",
+		AcceptedIssuers: []string{"accounts.google.com"},
+		ClientID:        os.Getenv("GOOGLEAUTHKEY"),
+		ClientSecret:    os.Getenv("GOOGLEAUTHSECRET"),
+		RedirectURL:     utils.APIURL + "/auth/googlecallback",
+		MapUser: func(user *apiModels.User, identity oidc.Identity, token oidc.Token) {
+			user.GoogleId = identity.Subject
+			user.TokenType = token.TokenType
+			user.GoogleExpiresIn = token.Expiry
+			user.RefreshToken = token.RefreshToken
+			user.AccessToken = token.AccessToken
+		},
+	}))
+
+	configs, err := oidc.ConfigsFromEnv()
+	if err != nil {
+		return err
+	}
+	for _, config := range configs {
+		if config.Name == googleProvider {
+			return errors.New("OIDC provider google is built in")
+		}
+		config.RedirectURL = utils.APIURL + "/auth/oidc/" + config.Name + "/callback"
+		loginProviders.Register(oidc.NewProvider(config))
+	}
+	return nil
+}
+
+func clearProviderLogin(session *sessions.Session) {
+	delete(session.Values, "oidcprovider")
+	delete(session.Values, "oidcnonce")
+	delete(session.Values, "oidcverifier")
+}
+
+// Keeps the identity of a provider login whose email belongs to an
+// account it is not linked to, until the user logs into that account.
+func startIdentityLink(session *sessions.Session, user apiModels.UserPostgres, issuer string, subject string) {
+	session.Values["linkuserid"] = user.Id
+	session.Values["linkissuer"] = issuer
+	session.Values["linksubject"] = subject
+}
+
+// Links the identity kept by startIdentityLink once its account logged in
+// another way, which proves the user owns it.
+func finishIdentityLink(session *sessions.Session, user apiModels.UserPostgres) {
+	userId, _ := session.Values["linkuserid"].(int64)
+	issuer, _ := session.Values["linkissuer"].(string)
+	subject, _ := session.Values["linksubject"].(string)
+
+	delete(session.Values, "linkuserid")
+	delete(session.Values, "linkissuer")
+	delete(session.Values, "linksubject")
+
+	if userId == 0 || userId != user.Id || issuer == "" || subject == "" {
+		return
+	}
+
+	err := apiControllers.LinkUserIdentity(user.Id, issuer, subject)
+	if err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// Finds the user an identity belongs to. The email the provider sends is
+// only trusted for new accounts: an existing account has to be linked to
+// the identity first, by logging into it some other way.
+func providerLoginUser(r *http.Request, session *sessions.Session, provider *oidc.Provider, identity oidc.Identity, newUser apiModels.User) (apiModels.UserPostgres, error) {
+	user, err := apiControllers.GetUserByIdentity(provider.Issuer(), identity.Subject)
+	if err != nil && err != repositories.ErrNotFound {
+		return apiModels.UserPostgres{}, err
+	}
+
+	if err == repositories.ErrNotFound {
+		existingUser, err := apiControllers.GetUserByEmail(newUser.Email)
+		if err != nil {
+			return apiControllers.RegisterUserWithIdentity(newUser, provider.Issuer(), identity.Subject)
+		}
+
+		// Only someone already logged into the account can connect the
+		// provider to it here
+		currentUser, err := apiControllers.GetCurrentUser(r)
+		if err != nil || currentUser.Id != existingUser.Id {
+			startIdentityLink(session, existingUser, provider.Issuer(), identity.Subject)
+			return apiModels.UserPostgres{}, errIdentityNotLinked
+		}
+
+		err = apiControllers.LinkUserIdentity(existingUser.Id, provider.Issuer(), identity.Subject)
+		if err != nil {
+			return apiModels.UserPostgres{}, err
+		}
+		user = existingUser
+	}
+
+	// Saves what the provider sent, like its tokens, on the linked
+	// account, even if the email there is not the one it sent
+	newUser.Email = user.Data.Email
+	user, _, _ = tabulaeControllers.RegisterUser(r, newUser)
+	if user.Data.Email == "" {
+		return apiModels.UserPostgres{}, errors.New("Could not log you in. We'll fix this soon!")
+	}
+	return user, nil
+}
+
+// Sends the user to the provider, keeping what the callback needs to
+// check the answer in the session.
+func startProviderLogin(w http.ResponseWriter, r *http.Request, session *sessions.Session, provider *oidc.Provider) {
+	login, err := oidc.NewLoginState()
+	if err == nil {
+		var authURL string
+		authURL, err = provider.AuthCodeURL(login, nil)
+		if err == nil {
+			session.Values["state"] = login.State
+			session.Values["oidcprovider"] = provider.Name()
+			session.Values["oidcnonce"] = login.Nonce
+			session.Values["oidcverifier"] = login.Verifier
+
+			if next := queryNext(r); next != "" {
+				session.Values["next"] = next
+			}
+
+			err = session.Save(r, w)
+			if err != nil {
+				log.Printf("%v", err)
+			}
+
+			http.Redirect(w, r, authURL, 302)
+			return
+		}
+	}
+
+	log.Printf("%v", err)
+	providerErr := url.QueryEscape("Could not reach your identity provider. Please try again later.")
+	http.Redirect(w, r, "/api/auth?success=false&message="+providerErr, 302)
+}
+
+func finishProviderLogin(w http.ResponseWriter, r *http.Request, session *sessions.Session, provider *oidc.Provider) {
+	login := oidc.LoginState{}
+	login.State, _ = session.Values["state"].(string)
+	login.Nonce, _ = session.Values["oidcnonce"].(string)
+	login.Verifier, _ = session.Values["oidcverifier"].(string)
+	providerName, _ := session.Values["oidcprovider"].(string)
+
+	clearProviderLogin(session)
+	session.Save(r, w)
+
+	if login.State == "" || r.URL.Query().Get("state") != login.State || providerName != provider.Name() {
+		log.Printf("%v", "no state match; possible csrf OR cookies not enabled")
+		fmt.Fprintln(w, "no state match; possible csrf OR cookies not enabled")
+		return
+	}
+
+	if r.URL.Query().Get("error") != "" {
+		log.Printf("%v", provider.Name()+" login failed: "+r.URL.Query().Get("error"))
+		loginErr := url.QueryEscape("Your identity provider did not log you in.")
+		http.Redirect(w, r, "/api/auth?success=false&message="+loginErr, 302)
+		return
+	}
+
+	identity, token, err := provider.Exchange(r.URL.Query().Get("code"), login)
+	if err != nil {
+		log.Printf("%v", err)
+		fmt.Fprintln(w, "there was an issue getting your token")
+		return
+	}
+
+	newUser, err := provider.MapUser(identity, token)
+	if err != nil {
+		log.Printf("%v", err)
+		http.Redirect(w, r, "/api/auth?success=false&message="+url.QueryEscape(err.Error()), 302)
+		return
+	}
+	newUser.IsActive = false
+
+	user, err := providerLoginUser(r, session, provider, identity, newUser)
+	if err == errIdentityNotLinked {
+		session.Save(r, w)
+		linkMessage := url.QueryEscape("You already have an account with this email. Log in with your password or a login link to connect it to " + provider.Name() + ".")
+		http.Redirect(w, r, "/api/auth?success=false&message="+linkMessage, 302)
+		return
+	}
+	if err == apiControllers.ErrIdentityLinked {
+		http.Redirect(w, r, "/api/auth?success=false&message="+url.QueryEscape(err.Error()), 302)
+		return
+	}
+	if err != nil {
+		log.Printf("%v", err)
+		registerErr := url.QueryEscape("Could not log you in. We'll fix this soon!")
+		http.Redirect(w, r, "/api/auth?success=false&message="+registerErr, 302)
+		return
+	}
+
+	if user.Data.IsBanned || apiControllers.UserAwaitingReview(user) {
+		loginErr := url.QueryEscape("This account can not log in.")
+		http.Redirect(w, r, "/api/auth?success=false&message="+loginErr, 302)
+		return
+	}
+
+	// Same second step as a password login
+	if apiControllers.UserRequiresTwoFactor(user) {
+		startTwoFactorChallenge(w, r, session, user)
+		return
+	}
+
+	completeProviderLogin(w, r, session, user)
+}
+
+// Logs in a user who came back from Google or another provider, and sends
+// them on like a password login. New users get the welcome email.
+func completeProviderLogin(w http.ResponseWriter, r *http.Request, session *sessions.Session, user apiModels.UserPostgres) {
+	session.Values["id"] = user.Id
+	loginSession(w, r, session, user.Data.Email)
+
+	if user.Data.IsActive {
+		if returnURL := sessionNext(session); returnURL != "" {
+			u, err := url.Parse(returnURL)
+			if err != nil {
+				http.Redirect(w, r, returnURL, 302)
+				return
+			}
+
+			if user.Data.LastLoggedIn.IsZero() {
+				q := u.Query()
+				q.Set("firstTimeUser", "true")
+				u.RawQuery = q.Encode()
+
+				err = emails.AddUserToTabulaeTrialList(user.Data)
+				if err != nil {
+					// Redirect user back to login page
+					log.Printf("%v", "Welcome email was not sent for "+user.Data.Email)
+					log.Printf("%v", err)
+				}
+
+				user.ConfirmLoggedIn()
+			}
+			http.Redirect(w, r, u.String(), 302)
+			return
+		}
+	} else {
+		if user.Data.LastLoggedIn.IsZero() {
+			err := emails.AddUserToTabulaeTrialList(user.Data)
+			if err != nil {
+				// Redirect user back to login page
+				log.Printf("%v", "Welcome email was not sent for "+user.Data.Email)
+				log.Printf("%v", err)
+			}
+		}
+		http.Redirect(w, r, "/api/billing/plans/trial", 302)
+		return
+	}
+
+	http.Redirect(w, r, "/", 302)
+}
+
+func getLoginProvider(w http.ResponseWriter, r *http.Request, name string) (*oidc.Provider, bool) {
+	provider, ok := loginProviders.Get(name)
+	if !ok {
+		http.NotFound(w, r)
+	}
+	return provider, ok
+}
+
+/*
+* Public methods
+ */
+
+// Handler to redirect user to the login page of the provider in the path
+func OIDCLoginHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	provider, ok := getLoginProvider(w, r, ps.ByName("provider"))
+	if !ok {
+		return
+	}
+
+	session, err := store.Get(r, "sess")
+	if err != nil {
+		log.Printf("%v", err)
+	}
+
+	startProviderLogin(w, r, session, provider)
+}
+
+// Handler for when the provider sends the user back
+func OIDCCallbackHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	provider, ok := getLoginProvider(w, r, ps.ByName("provider"))
+	if !ok {
+		return
+	}
+
+	session, err := store.Get(r, "sess")
+	if err != nil {
+		log.Printf("%v", err)
+		fmt.Fprintln(w, "aborted")
+		return
+	}
+
+	finishProviderLogin(w, r, session, provider)
+}
@@ -68,8 +68,8 @@ func OutlookLoginHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 	session.Values["outlook"] = "yes"
 	session.Values["outlook_email"] = user.Data.Email
 
-	if r.URL.Query().Get("next") != "" {
-		session.Values["next"] = r.URL.Query().Get("next")
+	if queryNext(r) != "" {
+		session.Values["next"] = queryNext(r)
 	}
 
 	err = session.Save(r, w)
@@ -95,8 +95,8 @@ func RemoveOutlookHandler(w http.ResponseWriter, r *http.Request, _ httprouter.P
 	user.Data.Outlook = false
 	apiControllers.SaveUser(r, &user)
 
-	if r.URL.Query().Get("next") != "" {
-		returnURL := r.URL.Query().Get("next")
+	if queryNext(r) != "" {
+		returnURL := queryNext(r)
 		if err != nil {
 			http.Redirect(w, r, returnURL, 302)
 			return
@@ -178,7 +178,10 @@ func OutlookCallbackHandler(w http.ResponseWriter, r *http.Request, _ httprouter
 
 	apiControllers.SaveUser(r, &user)
 
-	returnURL := session.Values["next"].(string)
+	returnURL := "https://tabulae.newsai.co/settings"
+	if next := sessionNext(session); next != "" {
+		returnURL = next
+	}
 	u, err := url.Parse(returnURL)
 	if err != nil {
 		http.Redirect(w, r, returnURL, 302)
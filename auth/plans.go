@@ -22,14 +22,14 @@ func TrialPlanPageHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user, err := apiControllers.GetCurrentUser(r)
 
-		if r.URL.Query().Get("next") != "" {
+		if queryNext(r) != "" {
 			session, _ := store.Get(r, "sess")
-			session.Values["next"] = r.URL.Query().Get("next")
+			session.Values["next"] = queryNext(r)
 			session.Save(r, w)
 
 			// If there is a next and the user has not been logged in
 			if err != nil {
-				http.Redirect(w, r, r.URL.Query().Get("next"), 302)
+				http.Redirect(w, r, queryNext(r), 302)
 				return
 			}
 		}
@@ -61,7 +61,7 @@ func TrialPlanPageHandler() http.HandlerFunc {
 				}
 			}
 
-			billingId, err := billing.AddFreeTrialToUser(r, user, "free")
+			billingId, err := billing.AddFreeTrialToUser(r, &user, "free")
 			user.Data.IsActive = true
 			user.Data.BillingId = billingId
 			user.Save()
@@ -89,8 +89,8 @@ func TrialPlanPageHandler() http.HandlerFunc {
 			// If not then their is now probably successful so we redirect them back
 			returnURL := "https://tabulae.newsai.co/"
 			session, _ := store.Get(r, "sess")
-			if session.Values["next"] != nil {
-				returnURL = session.Values["next"].(string)
+			if next := sessionNext(session); next != "" {
+				returnURL = next
 			}
 			u, err := url.Parse(returnURL)
 
@@ -126,14 +126,14 @@ func CancelPlanPageHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user, err := apiControllers.GetCurrentUser(r)
 
-		if r.URL.Query().Get("next") != "" {
+		if queryNext(r) != "" {
 			session, _ := store.Get(r, "sess")
-			session.Values["next"] = r.URL.Query().Get("next")
+			session.Values["next"] = queryNext(r)
 			session.Save(r, w)
 
 			// If there is a next and the user has not been logged in
 			if err != nil {
-				http.Redirect(w, r, r.URL.Query().Get("next"), 302)
+				http.Redirect(w, r, queryNext(r), 302)
 				return
 			}
 		}
@@ -148,16 +148,7 @@ func CancelPlanPageHandler() http.HandlerFunc {
 
 		// If the user has a billing profile
 		if err == nil {
-			switch userBilling.Data.StripePlanId {
-			case "personal":
-				userBilling.Data.StripePlanId = "Personal"
-			case "consultant":
-				userBilling.Data.StripePlanId = "Consultant"
-			case "business":
-				userBilling.Data.StripePlanId = "Business"
-			case "growing":
-				userBilling.Data.StripePlanId = "Growing Business"
-			}
+			userBilling.Data.StripePlanId = billing.BillingIdToPlanName(userBilling.Data.StripePlanId)
 
 			userNotActiveNonTrialPlan := true
 			if user.Data.IsActive && !userBilling.Data.IsOnTrial {
@@ -188,15 +179,15 @@ func CancelPlanHandler() http.HandlerFunc {
 		// To check if there is a user logged in
 		user, err := apiControllers.GetCurrentUser(r)
 
-		if r.URL.Query().Get("next") != "" {
+		if queryNext(r) != "" {
 			session, _ := store.Get(r, "sess")
-			session.Values["next"] = r.URL.Query().Get("next")
+			session.Values["next"] = queryNext(r)
 			session.Save(r, w)
 
 			// If there is a next and the user has not been logged in
 			if err != nil {
 				log.Printf("%v", err)
-				http.Redirect(w, r, r.URL.Query().Get("next"), 302)
+				http.Redirect(w, r, queryNext(r), 302)
 				return
 			}
 		}
@@ -212,18 +203,15 @@ func CancelPlanHandler() http.HandlerFunc {
 
 		// If the user has a billing profile
 		if err == nil {
-			plan := ""
-			switch userBilling.Data.StripePlanId {
-			case "personal":
-				plan = "Personal"
-			case "consultant":
-				plan = "Consultant"
-			case "business":
-				plan = "Business"
-			case "growing":
-				plan = "Growing Business"
+			userBilling, err = apiControllers.CancelPlanOfUser(r, user)
+			if err != nil {
+				log.Printf("%v", err)
+				http.Redirect(w, r, "/api/billing", 302)
+				return
 			}
 
+			plan := billing.BillingIdToPlanName(userBilling.Data.StripePlanId)
+
 			data := map[string]interface{}{
 				"plan":           plan,
 				"userEmail":      user.Data.Email,
@@ -246,14 +234,14 @@ func ChoosePlanPageHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user, err := apiControllers.GetCurrentUser(r)
 
-		if r.URL.Query().Get("next") != "" {
+		if queryNext(r) != "" {
 			session, _ := store.Get(r, "sess")
-			session.Values["next"] = r.URL.Query().Get("next")
+			session.Values["next"] = queryNext(r)
 			session.Save(r, w)
 
 			// If there is a next and the user has not been logged in
 			if err != nil {
-				http.Redirect(w, r, r.URL.Query().Get("next"), 302)
+				http.Redirect(w, r, queryNext(r), 302)
 				return
 			}
 		}
@@ -301,15 +289,15 @@ func ChooseSwitchPlanHandler() http.HandlerFunc {
 		// To check if there is a user logged in
 		user, err := apiControllers.GetCurrentUser(r)
 
-		if r.URL.Query().Get("next") != "" {
+		if queryNext(r) != "" {
 			session, _ := store.Get(r, "sess")
-			session.Values["next"] = r.URL.Query().Get("next")
+			session.Values["next"] = queryNext(r)
 			session.Save(r, w)
 
 			// If there is a next and the user has not been logged in
 			if err != nil {
 				log.Printf("%v", err)
-				http.Redirect(w, r, r.URL.Query().Get("next"), 302)
+				http.Redirect(w, r, queryNext(r), 302)
 				return
 			}
 		}
@@ -325,33 +313,33 @@ func ChooseSwitchPlanHandler() http.HandlerFunc {
 
 		// If the user has a billing profile
 		if err == nil {
-			originalPlan := plan
-			switch plan {
-			case "personal":
-				plan = "Personal"
-			case "consultant":
-				plan = "Consultant"
-			case "business":
-				plan = "Business"
-			case "growing":
-				plan = "Growing Business"
+			catalogPlan, err := billing.LookupPlan(plan)
+			if err != nil || !catalogPlan.Active {
+				http.Redirect(w, r, "/api/billing/plans", 302)
+				return
 			}
+			plan = catalogPlan.Name
 
 			missingCard := true
 			if len(userBilling.Data.CardsOnFile) > 0 {
 				missingCard = false
 			}
 
-			price := billing.PlanAndDurationToPrice(plan, duration)
-			cost, _ := billing.SwitchUserPlanPreview(&userBilling, duration, originalPlan)
+			cost, scheduled, err := billing.SwitchUserPlanPreview(&userBilling, duration, catalogPlan.StripeId)
+			if err != nil {
+				log.Printf("%v", err)
+				http.Redirect(w, r, "/api/billing/plans", 302)
+				return
+			}
 
 			data := map[string]interface{}{
 				"missingCard": missingCard,
-				"price":       price,
 				"plan":        plan,
 				"duration":    duration,
 				"userEmail":   user.Data.Email,
-				"difference":  cost,
+				"difference":  float64(cost) / float64(100),
+				"scheduled":   scheduled,
+				"periodEnds":  userBilling.Data.Expires.Format("2006-01-02"),
 			}
 
 			t := template.New("switch-confirmation.html")
@@ -374,15 +362,15 @@ func ChoosePlanHandler() http.HandlerFunc {
 		// To check if there is a user logged in
 		user, err := apiControllers.GetCurrentUser(r)
 
-		if r.URL.Query().Get("next") != "" {
+		if queryNext(r) != "" {
 			session, _ := store.Get(r, "sess")
-			session.Values["next"] = r.URL.Query().Get("next")
+			session.Values["next"] = queryNext(r)
 			session.Save(r, w)
 
 			// If there is a next and the user has not been logged in
 			if err != nil {
 				log.Printf("%v", err)
-				http.Redirect(w, r, r.URL.Query().Get("next"), 302)
+				http.Redirect(w, r, queryNext(r), 302)
 				return
 			}
 		}
@@ -398,16 +386,12 @@ func ChoosePlanHandler() http.HandlerFunc {
 
 		// If the user has a billing profile
 		if err == nil {
-			switch plan {
-			case "personal":
-				plan = "Personal"
-			case "consultant":
-				plan = "Consultant"
-			case "business":
-				plan = "Business"
-			case "growing":
-				plan = "Growing Business"
+			catalogPlan, err := billing.LookupPlan(plan)
+			if err != nil || !catalogPlan.Active {
+				http.Redirect(w, r, "/api/billing/plans", 302)
+				return
 			}
+			plan = catalogPlan.Name
 
 			missingCard := true
 			if len(userBilling.Data.CardsOnFile) > 0 {
@@ -450,23 +434,9 @@ func CheckCouponValid() http.HandlerFunc {
 
 		coupon = strings.ToUpper(coupon)
 
-		if coupon == "FAVORITES" && duration == "annually" {
-			nError.ReturnError(w, http.StatusInternalServerError, "Coupon error", "Sorry - you can't use this coupon code on a yearly plan. Please switch the monthly one to use this!")
-			return
-		}
-
-		if coupon == "PRCOUTURE" && duration == "annually" {
-			nError.ReturnError(w, http.StatusInternalServerError, "Coupon error", "Sorry - you can't use this coupon code on a yearly plan. Please switch the monthly one to use this!")
-			return
-		}
-
-		if coupon == "CURIOUS" && duration == "annually" {
-			nError.ReturnError(w, http.StatusInternalServerError, "Coupon error", "Sorry - you can't use this coupon code on a yearly plan. Please switch the monthly one to use this!")
-			return
-		}
-
-		if coupon == "PRCONSULTANTS" && duration == "annually" {
-			nError.ReturnError(w, http.StatusInternalServerError, "Coupon error", "Sorry - you can't use this coupon code on a yearly plan. Please switch the monthly one to use this!")
+		err := billing.CheckCouponDuration(coupon, duration)
+		if err != nil {
+			nError.ReturnError(w, http.StatusInternalServerError, "Coupon error", err.Error())
 			return
 		}
 
@@ -499,15 +469,15 @@ func ConfirmPlanHandler() http.HandlerFunc {
 		// To check if there is a user logged in
 		user, err := apiControllers.GetCurrentUser(r)
 
-		if r.URL.Query().Get("next") != "" {
+		if queryNext(r) != "" {
 			session, _ := store.Get(r, "sess")
-			session.Values["next"] = r.URL.Query().Get("next")
+			session.Values["next"] = queryNext(r)
 			session.Save(r, w)
 
 			// If there is a next and the user has not been logged in
 			if err != nil {
 				log.Printf("%v", err)
-				http.Redirect(w, r, r.URL.Query().Get("next"), 302)
+				http.Redirect(w, r, queryNext(r), 302)
 				return
 			}
 		}
@@ -524,16 +494,12 @@ func ConfirmPlanHandler() http.HandlerFunc {
 		// If the user has a billing profile
 		if err == nil {
 			originalPlan := plan
-			switch plan {
-			case "Personal":
-				plan = "personal"
-			case "Consultant":
-				plan = "consultant"
-			case "Business":
-				plan = "business"
-			case "Growing Business":
-				plan = "growing"
+			catalogPlan, err := billing.LookupPlan(plan)
+			if err != nil || !catalogPlan.Active {
+				http.Redirect(w, r, "/api/billing/plans", 302)
+				return
 			}
+			plan = catalogPlan.StripeId
 
 			err = billing.AddPlanToUser(r, user, &userBilling, plan, duration, coupon, originalPlan)
 			hasError := false
@@ -565,18 +531,87 @@ func ConfirmPlanHandler() http.HandlerFunc {
 	}
 }
 
+func ConfirmSwitchPlanHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		plan := r.FormValue("plan")
+		duration := r.FormValue("duration")
+
+		// To check if there is a user logged in
+		user, err := apiControllers.GetCurrentUser(r)
+
+		if queryNext(r) != "" {
+			session, _ := store.Get(r, "sess")
+			session.Values["next"] = queryNext(r)
+			session.Save(r, w)
+
+			// If there is a next and the user has not been logged in
+			if err != nil {
+				log.Printf("%v", err)
+				http.Redirect(w, r, queryNext(r), 302)
+				return
+			}
+		}
+
+		// If there is no next and the user is not logged in
+		if err != nil {
+			log.Printf("%v", err)
+			http.Redirect(w, r, "https://tabulae.newsai.co/", 302)
+			return
+		}
+
+		_, err = apiControllers.GetUserBilling(r, user)
+
+		// If the user has a billing profile
+		if err == nil {
+			planName := billing.BillingIdToPlanName(plan)
+
+			userBilling, err := apiControllers.SwitchPlanOfUser(r, user, plan, duration)
+			hasError := false
+			errorMessage := ""
+			if err != nil {
+				hasError = true
+				// Return error to the "confirmation" page
+				errorMessage = err.Error()
+				log.Printf("%v", err)
+			}
+
+			data := map[string]interface{}{
+				"plan":         planName,
+				"duration":     duration,
+				"hasError":     hasError,
+				"errorMessage": errorMessage,
+				"userEmail":    user.Data.Email,
+			}
+
+			// Downgrades start when the period that was paid for ends
+			if userBilling.Data.PendingStripePlanId != "" {
+				data["startsOn"] = userBilling.Data.Expires.Format("2006-01-02")
+			}
+
+			t := template.New("receipt.html")
+			t, _ = t.ParseFiles("billing/receipt.html")
+			t.Execute(w, data)
+		} else {
+			// If the user does not have billing profile that means that they
+			// have not started their trial yet.
+			http.Redirect(w, r, "/api/billing/plans/trial", 302)
+			return
+		}
+	}
+}
+
 func BillingPageHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user, err := apiControllers.GetCurrentUser(r)
 
-		if r.URL.Query().Get("next") != "" {
+		if queryNext(r) != "" {
 			session, _ := store.Get(r, "sess")
-			session.Values["next"] = r.URL.Query().Get("next")
+			session.Values["next"] = queryNext(r)
 			session.Save(r, w)
 
 			// If there is a next and the user has not been logged in
 			if err != nil {
-				http.Redirect(w, r, r.URL.Query().Get("next"), 302)
+				http.Redirect(w, r, queryNext(r), 302)
 				return
 			}
 		}
@@ -591,16 +626,7 @@ func BillingPageHandler() http.HandlerFunc {
 
 		// If the user has a billing profile
 		if err == nil {
-			switch userBilling.Data.StripePlanId {
-			case "bronze", "personal":
-				userBilling.Data.StripePlanId = "Personal"
-			case "aluminum", "consultant":
-				userBilling.Data.StripePlanId = "Consultant"
-			case "silver-1", "silver", "business":
-				userBilling.Data.StripePlanId = "Business"
-			case "gold-1", "gold", "growing":
-				userBilling.Data.StripePlanId = "Growing Business"
-			}
+			userBilling.Data.StripePlanId = billing.BillingIdToPlanName(userBilling.Data.StripePlanId)
 
 			customerBalance, _ := billing.GetCustomerBalance(&userBilling)
 			userPlanExpires := userBilling.Data.Expires.AddDate(0, 0, -1).Format("2006-01-02")
@@ -634,14 +660,14 @@ func PaymentMethodsPageHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user, err := apiControllers.GetCurrentUser(r)
 
-		if r.URL.Query().Get("next") != "" {
+		if queryNext(r) != "" {
 			session, _ := store.Get(r, "sess")
-			session.Values["next"] = r.URL.Query().Get("next")
+			session.Values["next"] = queryNext(r)
 			session.Save(r, w)
 
 			// If there is a next and the user has not been logged in
 			if err != nil {
-				http.Redirect(w, r, r.URL.Query().Get("next"), 302)
+				http.Redirect(w, r, queryNext(r), 302)
 				return
 			}
 		}
@@ -690,14 +716,14 @@ func PaymentMethodsHandler() http.HandlerFunc {
 
 		stripeToken := r.FormValue("stripeToken")
 
-		if r.URL.Query().Get("next") != "" {
+		if queryNext(r) != "" {
 			session, _ := store.Get(r, "sess")
-			session.Values["next"] = r.URL.Query().Get("next")
+			session.Values["next"] = queryNext(r)
 			session.Save(r, w)
 
 			// If there is a next and the user has not been logged in
 			if err != nil {
-				http.Redirect(w, r, r.URL.Query().Get("next"), 302)
+				http.Redirect(w, r, queryNext(r), 302)
 				return
 			}
 		}
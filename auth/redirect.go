@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/sessions"
+
+	"github.com/news-ai/api-v1/utils"
+)
+
+// Sites that next can send the user on to, with their subdomains. Paths
+// on this server are always allowed.
+var redirectHosts = []string{"newsai.co"}
+
+/*
+* Private methods
+ */
+
+func isRedirectHost(host string) bool {
+	host = strings.ToLower(host)
+
+	if base, err := url.Parse(utils.BASEURL); err == nil && base.Hostname() != "" && host == strings.ToLower(base.Hostname()) {
+		return true
+	}
+
+	for _, allowed := range redirectHosts {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// safeNext returns next if it is a path on this server or a URL on one
+// of redirectHosts, and "" otherwise, so that a link to a login page
+// can't send the user on to another site.
+func safeNext(next string) string {
+	// Browsers read a backslash as a slash, so "/\evil.com" is "//evil.com"
+	if next == "" || strings.Contains(next, "\\") {
+		return ""
+	}
+
+	u, err := url.Parse(next)
+	if err != nil {
+		return ""
+	}
+
+	if u.Scheme == "" && u.Host == "" {
+		if strings.HasPrefix(next, "/") && !strings.HasPrefix(next, "//") {
+			return next
+		}
+		return ""
+	}
+
+	if (u.Scheme == "https" || u.Scheme == "http") && u.User == nil && isRedirectHost(u.Hostname()) {
+		return next
+	}
+	return ""
+}
+
+// The next a page was given in its query string
+func queryNext(r *http.Request) string {
+	return safeNext(r.URL.Query().Get("next"))
+}
+
+// The next the session was given by whichever page the user started on
+func sessionNext(session *sessions.Session) string {
+	next, _ := session.Values["next"].(string)
+	return safeNext(next)
+}
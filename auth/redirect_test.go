@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSafeNext(t *testing.T) {
+	tests := []struct {
+		next string
+		want string
+	}{
+		{"/api/billing", "/api/billing"},
+		{"/api/auth?next=/", "/api/auth?next=/"},
+		{"https://tabulae.newsai.co/lists", "https://tabulae.newsai.co/lists"},
+		{"http://newsai.co/", "http://newsai.co/"},
+		{"https://TABULAE.NEWSAI.CO/", "https://TABULAE.NEWSAI.CO/"},
+		{"", ""},
+		{"//evil.com", ""},
+		{"/\\evil.com", ""},
+		{"https://evil.com/", ""},
+		{"https://newsai.co.evil.com/", ""},
+		{"https://evilnewsai.co/", ""},
+		{"https://user@newsai.co/", ""},
+		{"javascript:alert(1)", ""},
+		{"ftp://newsai.co/", ""},
+		{"lists", ""},
+	}
+	for _, test := range tests {
+		if got := safeNext(test.next); got != test.want {
+			t.Errorf("safeNext(%q) = %q, want %q", test.next, got, test.want)
+		}
+	}
+}
+
+func TestQueryNext(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/api/auth?next=https%3A%2F%2Fevil.com%2F", nil)
+	if next := queryNext(r); next != "" {
+		t.Errorf("queryNext = %q, want none", next)
+	}
+
+	r, _ = http.NewRequest("GET", "/api/auth?next=%2Fapi%2Fbilling", nil)
+	if next := queryNext(r); next != "/api/billing" {
+		t.Errorf("queryNext = %q, want /api/billing", next)
+	}
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+
+	apiModels "github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/screening"
+)
+
+var (
+	signupScreener screening.SignupScreener
+	signupNotifier screening.Notifier
+)
+
+/*
+* Private methods
+ */
+
+// reCAPTCHA needs RECAPTCHA_SECRET, and the server does not start without
+// it unless SIGNUP_CHECK_RECAPTCHA=off turns the check off on purpose.
+// Clearbit only runs when CLEARBIT_API_KEY is set. The disposable domain
+// check always runs, on the list in DISPOSABLE_DOMAINS_FILE or the built
+// in one, and asks Kickbox about domains not on it. Signups that are not
+// allowed are posted to SLACK_SIGNUP_WEBHOOK when it is set.
+func setupSignupScreening() error {
+	checks := []screening.Check{}
+
+	if os.Getenv("RECAPTCHA_SECRET") != "" {
+		checks = append(checks, screening.RecaptchaCheck{Secret: os.Getenv("RECAPTCHA_SECRET")})
+	} else if os.Getenv("SIGNUP_CHECK_RECAPTCHA") != "off" {
+		return errors.New("RECAPTCHA_SECRET is not set. Set SIGNUP_CHECK_RECAPTCHA=off to take signups without reCAPTCHA")
+	}
+
+	disposableDomains := screening.DefaultDisposableDomains()
+	if os.Getenv("DISPOSABLE_DOMAINS_FILE") != "" {
+		var err error
+		disposableDomains, err = screening.LoadDomainList(os.Getenv("DISPOSABLE_DOMAINS_FILE"))
+		if err != nil {
+			return err
+		}
+	}
+	checks = append(checks, screening.DisposableDomainCheck{
+		Local:  disposableDomains,
+		Lookup: screening.KickboxLookup{},
+	})
+
+	if os.Getenv("CLEARBIT_API_KEY") != "" {
+		checks = append(checks, screening.ClearbitCheck{APIKey: os.Getenv("CLEARBIT_API_KEY")})
+	}
+
+	names := []string{}
+	for _, check := range checks {
+		names = append(names, check.Name())
+	}
+	policy, err := screening.LoadPolicy(names)
+	if err != nil {
+		return err
+	}
+
+	signupScreener = screening.NewPipeline(policy, checks...)
+
+	if os.Getenv("SLACK_SIGNUP_WEBHOOK") != "" {
+		signupNotifier = screening.SlackNotifier{WebhookURL: os.Getenv("SLACK_SIGNUP_WEBHOOK")}
+	}
+	return nil
+}
+
+func screenSignup(r *http.Request, email string, firstName string) screening.Decision {
+	signup := screening.Signup{
+		Email:     email,
+		FirstName: firstName,
+		IP:        apiModels.RequestIP(r),
+		Recaptcha: r.FormValue("g-recaptcha-response"),
+	}
+
+	decision := signupScreener.Screen(signup)
+	for _, err := range decision.Errors {
+		log.Printf("%v", err)
+	}
+
+	if decision.Verdict != screening.Allow {
+		log.Printf("%v", "Signup for "+email+" was given "+string(decision.Verdict))
+		log.Printf("%v", decision.Reasons)
+
+		if signupNotifier != nil {
+			go func() {
+				err := signupNotifier.Notify(signup, decision)
+				if err != nil {
+					log.Printf("%v", err)
+				}
+			}()
+		}
+	}
+
+	return decision
+}
+
+// What to tell someone whose signup was denied, by the check that did it
+func signupDeniedMessage(decision screening.Decision) string {
+	denied := ""
+	if len(decision.Results) > 0 {
+		denied = decision.Results[len(decision.Results)-1].Check
+	}
+
+	switch denied {
+	case "recaptcha":
+		return "Recaptcha failed. Please try again, sorry about that!"
+	case "disposable":
+		return "We believe your email is a disposable email. Please contact us! Since our service is an emailing service, we can't allow you to sign up with a disposable email address."
+	}
+	return "We could not complete your registration. Please contact us!"
+}
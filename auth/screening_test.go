@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSetupSignupScreeningNeedsRecaptcha(t *testing.T) {
+	defer os.Unsetenv("RECAPTCHA_SECRET")
+	defer os.Unsetenv("SIGNUP_CHECK_RECAPTCHA")
+
+	os.Setenv("RECAPTCHA_SECRET", "")
+	os.Setenv("SIGNUP_CHECK_RECAPTCHA", "")
+	if err := setupSignupScreening(); err == nil {
+		t.Error("setupSignupScreening without RECAPTCHA_SECRET succeeded")
+	}
+
+	os.Setenv("SIGNUP_CHECK_RECAPTCHA", "review")
+	if err := setupSignupScreening(); err == nil {
+		t.Error("setupSignupScreening without RECAPTCHA_SECRET, limited to review, succeeded")
+	}
+
+	os.Setenv("SIGNUP_CHECK_RECAPTCHA", "off")
+	if err := setupSignupScreening(); err != nil {
+		t.Errorf("setupSignupScreening with reCAPTCHA off = %v", err)
+	}
+
+	os.Setenv("RECAPTCHA_SECRET", "secret")
+	os.Setenv("SIGNUP_CHECK_RECAPTCHA", "")
+	if err := setupSignupScreening(); err != nil {
+		t.Errorf("setupSignupScreening with RECAPTCHA_SECRET = %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+
+	apiControllers "github.com/news-ai/api-v1/controllers"
+)
+
+/*
+* Private methods
+ */
+
+// Logs email into the session and records it, so it shows up in the
+// user's list of sessions and can be revoked from there.
+func loginSession(w http.ResponseWriter, r *http.Request, session *sessions.Session, email string) {
+	endSessionRecord(session)
+
+	session.Values["email"] = email
+
+	user, err := apiControllers.GetUserByEmail(email)
+	if err == nil {
+		token, err := apiControllers.StartUserSession(r, user.Id)
+		if err == nil {
+			session.Values["sessionid"] = token
+		}
+	}
+
+	session.Save(r, w)
+}
+
+// Revokes the record of the session, on logout. The caller saves the
+// session.
+func endSessionRecord(session *sessions.Session) {
+	token, ok := session.Values["sessionid"].(string)
+	if !ok {
+		return
+	}
+
+	err := apiControllers.EndUserSession(token)
+	if err != nil {
+		log.Printf("%v", err)
+	}
+	delete(session.Values, "sessionid")
+}
+
+/*
+* Public methods
+ */
+
+// CheckSession fails, and logs the browser out, when the session it is
+// using has been revoked. Sessions from before sessions were recorded get
+// a record on their first request.
+func CheckSession(w http.ResponseWriter, r *http.Request, email string) error {
+	session, err := store.Get(r, "sess")
+	if err != nil {
+		return err
+	}
+
+	token, ok := session.Values["sessionid"].(string)
+	if !ok {
+		loginSession(w, r, session, email)
+		return nil
+	}
+
+	err = apiControllers.CheckUserSession(r, token)
+	if err != nil {
+		EndSession(w, r)
+		return err
+	}
+	return nil
+}
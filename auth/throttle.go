@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	apiControllers "github.com/news-ai/api-v1/controllers"
+	apiModels "github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/throttle"
+)
+
+const (
+	throttleLogin     = "login"
+	throttleForget    = "forget"
+	throttleReset     = "reset"
+	throttleTwoFactor = "twofactor"
+	throttleMagicLink = "magiclink"
+)
+
+// Defaults for each password endpoint. Every value can be overridden with
+// THROTTLE_<ACTION>_<SETTING>, see throttle.LoadLimits.
+var defaultThrottleLimits = map[string]throttle.Limits{
+	throttleLogin: {
+		MaxIPAttempts:      50,
+		MaxAccountAttempts: 10,
+		Window:             15 * time.Minute,
+		LockoutDuration:    15 * time.Minute,
+		FreeAttempts:       3,
+		BaseDelay:          500 * time.Millisecond,
+		MaxDelay:           5 * time.Second,
+	},
+	// Every request sends an email, so these count all attempts
+	throttleForget: {
+		MaxIPAttempts:      10,
+		MaxAccountAttempts: 3,
+		Window:             time.Hour,
+		LockoutDuration:    time.Hour,
+	},
+	throttleReset: {
+		MaxIPAttempts:   20,
+		Window:          time.Hour,
+		LockoutDuration: time.Hour,
+		FreeAttempts:    3,
+		BaseDelay:       500 * time.Millisecond,
+		MaxDelay:        5 * time.Second,
+	},
+	// Every link sent is counted, like forget, and so is every link that
+	// does not work
+	throttleMagicLink: {
+		MaxIPAttempts:      10,
+		MaxAccountAttempts: 5,
+		Window:             time.Hour,
+		LockoutDuration:    time.Hour,
+	},
+	throttleTwoFactor: {
+		MaxIPAttempts:      50,
+		MaxAccountAttempts: 10,
+		Window:             15 * time.Minute,
+		LockoutDuration:    15 * time.Minute,
+		FreeAttempts:       3,
+		BaseDelay:          500 * time.Millisecond,
+		MaxDelay:           5 * time.Second,
+	},
+}
+
+var limiter *throttle.Limiter
+
+/*
+* Private methods
+ */
+
+// THROTTLE_STORE picks where counters live: "redis" (the default, shared
+// with the session store) or "memory" for a single instance.
+func setupThrottle() error {
+	limits := map[string]throttle.Limits{}
+	for action, defaults := range defaultThrottleLimits {
+		actionLimits, err := throttle.LoadLimits(action, defaults)
+		if err != nil {
+			return err
+		}
+		limits[action] = actionLimits
+	}
+
+	switch os.Getenv("THROTTLE_STORE") {
+	case "", "redis":
+		limiter = throttle.NewLimiter(throttle.NewRedisStore(store.Pool), limits)
+	case "memory":
+		limiter = throttle.NewLimiter(throttle.NewMemoryStore(), limits)
+	default:
+		return errors.New("Unknown THROTTLE_STORE " + os.Getenv("THROTTLE_STORE"))
+	}
+	return nil
+}
+
+// checkThrottle holds the request back for the progressive delay and
+// returns an error when the ip or account is locked out. A store that
+// can't be reached lets the attempt through, so an outage does not lock
+// everyone out.
+func checkThrottle(r *http.Request, action string, account string) error {
+	decision, err := limiter.Check(action, apiModels.RequestIP(r), account)
+	if err != nil {
+		log.Printf("%v", err)
+		return nil
+	}
+
+	if !decision.Allowed {
+		minutes := int(decision.LockedUntil.Sub(time.Now())/time.Minute) + 1
+		return errors.New("Too many attempts. Please try again in " + strconv.Itoa(minutes) + " minutes.")
+	}
+
+	if decision.Delay > 0 {
+		time.Sleep(decision.Delay)
+	}
+	return nil
+}
+
+// recordThrottleFailure counts a failed attempt, and emails the account
+// owner when it locks their account.
+func recordThrottleFailure(r *http.Request, action string, account string) {
+	until, err := limiter.Fail(action, apiModels.RequestIP(r), account)
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+
+	if until.IsZero() {
+		return
+	}
+
+	log.Printf("%v", "Locked "+action+" for "+account+" from "+apiModels.RequestIP(r))
+
+	// Accounts are counted by whatever was typed in, which is not always
+	// someone we should be emailing.
+	user, err := apiControllers.GetUserByEmail(account)
+	if err != nil {
+		return
+	}
+	go notifyLockout(user.Data.Email, action, apiModels.RequestIP(r), until)
+}
+
+func recordThrottleSuccess(action string, account string) {
+	err := limiter.Succeed(action, account)
+	if err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// Tells the owner of an account that it was locked, in case it was not
+// them trying.
+func notifyLockout(email string, action string, ip string, until time.Time) {
+	what := "log into your NewsAI account"
+	switch action {
+	case throttleForget:
+		what = "reset the password of your NewsAI account"
+	case throttleMagicLink:
+		what = "send a login link for your NewsAI account"
+	}
+
+	body := "Hi,\n\nThere were too many failed attempts to " + what + " from " + ip +
+		". To keep your account safe, we have paused these attempts until " +
+		until.UTC().Format("Jan 2, 2006 at 15:04 MST") + ".\n\n" +
+		"If this was you, you can try again after that. If it was not, we recommend changing your password.\n\nThe NewsAI team"
+
+	err := sendEmail(email, "Your NewsAI account has been locked", body)
+	if err != nil {
+		log.Printf("%v", err)
+	}
+}
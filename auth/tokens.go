@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+
+	apiControllers "github.com/news-ai/api-v1/controllers"
+	apiModels "github.com/news-ai/api-v1/models"
+
+	nError "github.com/news-ai/web/errors"
+)
+
+const (
+	accessTokenType  = "access"
+	refreshTokenType = "refresh"
+
+	accessTokenLifetime  = 15 * time.Minute
+	refreshTokenLifetime = 30 * 24 * time.Hour
+
+	// HS256 keys shorter than its hash are easier to guess than to break
+	minTokenKeyLength = 32
+)
+
+var (
+	ErrInvalidToken = errors.New("Invalid token")
+	ErrExpiredToken = errors.New("Token has expired")
+)
+
+// Set once by setupTokenKey
+var tokenKey []byte
+
+// Tokens are JWTs signed with HS256. Only this server reads them, so the
+// header is fixed and checked byte for byte instead of being parsed.
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+type tokenClaims struct {
+	Subject  int64  `json:"sub"`
+	Email    string `json:"email"`
+	Type     string `json:"typ"`
+	Id       string `json:"jti,omitempty"`
+	IssuedAt int64  `json:"iat"`
+	Expires  int64  `json:"exp"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+/*
+* Private methods
+ */
+
+// Tokens get their own key so that rotating it does not log everyone out
+// of their sessions. Falls back to the session key. Without a key anyone
+// could sign tokens, so the server does not start.
+func setupTokenKey() error {
+	key := os.Getenv("NEWSAI_TOKENKEY")
+	if key == "" {
+		key = os.Getenv("NEWSAI_SECRETKEY")
+	}
+
+	if len(key) < minTokenKeyLength {
+		return fmt.Errorf("NEWSAI_TOKENKEY or NEWSAI_SECRETKEY has to be at least %d bytes long", minTokenKeyLength)
+	}
+
+	tokenKey = []byte(key)
+	return nil
+}
+
+func signToken(payload string) string {
+	mac := hmac.New(sha256.New, tokenKey)
+	mac.Write([]byte(tokenHeader + "." + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func newToken(user apiModels.UserPostgres, tokenType string, tokenId string, lifetime time.Duration) (string, error) {
+	now := time.Now()
+	claims := tokenClaims{
+		Subject:  user.Id,
+		Email:    user.Data.Email,
+		Type:     tokenType,
+		Id:       tokenId,
+		IssuedAt: now.Unix(),
+		Expires:  now.Add(lifetime).Unix(),
+	}
+
+	raw, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	return tokenHeader + "." + payload + "." + signToken(payload), nil
+}
+
+func parseToken(token string, tokenType string) (tokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return tokenClaims{}, ErrInvalidToken
+	}
+
+	if !hmac.Equal([]byte(parts[2]), []byte(signToken(parts[1]))) {
+		return tokenClaims{}, ErrInvalidToken
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return tokenClaims{}, ErrInvalidToken
+	}
+
+	claims := tokenClaims{}
+	err = json.Unmarshal(raw, &claims)
+	if err != nil || claims.Type != tokenType {
+		return tokenClaims{}, ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= claims.Expires {
+		return tokenClaims{}, ErrExpiredToken
+	}
+
+	return claims, nil
+}
+
+func issueTokens(user apiModels.UserPostgres) (TokenResponse, error) {
+	accessToken, err := newToken(user, accessTokenType, "", accessTokenLifetime)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	// The id is what the database knows the refresh token by, so it can
+	// be revoked before it expires
+	refreshTokenId, err := apiControllers.CreateRefreshToken(user.Id, refreshTokenLifetime)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	refreshToken, err := newToken(user, refreshTokenType, refreshTokenId, refreshTokenLifetime)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	return TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(accessTokenLifetime / time.Second),
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// Same checks as the password login page, minus the redirects
+func tokenUserFromPassword(r *http.Request, email string, password string) (apiModels.UserPostgres, error) {
+	validEmail, err := mail.ParseAddress(strings.ToLower(email))
+	if err != nil {
+		return apiModels.UserPostgres{}, errors.New("The email you entered is not valid")
+	}
+
+	// Shares its counters with the login page, so neither is a way
+	// around the other's limits
+	err = checkThrottle(r, throttleLogin, validEmail.Address)
+	if err != nil {
+		return apiModels.UserPostgres{}, err
+	}
+
+	user, isOk, _ := apiControllers.ValidateUserPassword(r, validEmail.Address, password)
+	if !isOk || user.Data.GoogleId != "" {
+		recordThrottleFailure(r, throttleLogin, validEmail.Address)
+		return apiModels.UserPostgres{}, errors.New("Wrong email or password")
+	}
+	recordThrottleSuccess(throttleLogin, validEmail.Address)
+
+	if !user.Data.EmailConfirmed {
+		return apiModels.UserPostgres{}, errors.New("You have not confirmed your email yet")
+	}
+
+	// There is no second page to enroll on here, so users who have to set
+	// up two-factor do it through the login page first.
+	if apiControllers.UserRequiresTwoFactor(user) {
+		if !user.Data.TwoFactorEnabled {
+			return apiModels.UserPostgres{}, errors.New("Your team requires two-factor authentication. Log in at /api/auth to set it up")
+		}
+
+		err = checkThrottle(r, throttleTwoFactor, user.Data.Email)
+		if err != nil {
+			return apiModels.UserPostgres{}, err
+		}
+
+		err = apiControllers.ValidateTwoFactor(r, &user, strings.TrimSpace(r.FormValue("code")))
+		if err != nil {
+			recordThrottleFailure(r, throttleTwoFactor, user.Data.Email)
+			return apiModels.UserPostgres{}, err
+		}
+		recordThrottleSuccess(throttleTwoFactor, user.Data.Email)
+	}
+
+	return user, nil
+}
+
+// A refresh token works once, and only while it has not been revoked and
+// its user can still log in. Banning a user, changing or resetting their
+// password and logging out their sessions revoke all of their refresh
+// tokens.
+func tokenUserFromRefreshToken(refreshToken string) (apiModels.UserPostgres, error) {
+	claims, err := parseToken(refreshToken, refreshTokenType)
+	if err != nil {
+		return apiModels.UserPostgres{}, err
+	}
+
+	if claims.Id == "" {
+		return apiModels.UserPostgres{}, ErrInvalidToken
+	}
+
+	user, err := apiControllers.UseRefreshToken(claims.Subject, claims.Id)
+	if err != nil || user.Data.Email != claims.Email {
+		return apiModels.UserPostgres{}, ErrInvalidToken
+	}
+
+	return user, nil
+}
+
+/*
+* Public methods
+ */
+
+// GetBearerTokenEmail returns the email of the user an access token in
+// the Authorization header was issued to. It does not touch the session
+// store. The bool is false when no bearer token was sent.
+func GetBearerTokenEmail(r *http.Request) (string, bool, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", false, nil
+	}
+
+	claims, err := parseToken(strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")), accessTokenType)
+	if err != nil {
+		return "", true, err
+	}
+
+	return claims.Email, true, nil
+}
+
+// TokenHandler issues an access and refresh token pair. It takes either
+// grant_type=password with email and password (and code, for users with
+// two-factor), or grant_type=refresh_token with refresh_token.
+func TokenHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		user := apiModels.UserPostgres{}
+		err := errors.New("")
+
+		switch r.FormValue("grant_type") {
+		case "password":
+			user, err = tokenUserFromPassword(r, r.FormValue("email"), r.FormValue("password"))
+		case "refresh_token":
+			user, err = tokenUserFromRefreshToken(r.FormValue("refresh_token"))
+		default:
+			nError.ReturnError(w, http.StatusBadRequest, "Token error", "grant_type must be password or refresh_token")
+			return
+		}
+
+		if err != nil {
+			nError.ReturnError(w, http.StatusUnauthorized, "Token error", err.Error())
+			return
+		}
+
+		if user.Data.IsBanned || user.Data.IsDeleted() {
+			nError.ReturnError(w, http.StatusUnauthorized, "Token error", "This account can not log in")
+			return
+		}
+
+		tokens, err := issueTokens(user)
+		if err != nil {
+			nError.ReturnError(w, http.StatusInternalServerError, "Token error", err.Error())
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(tokens)
+	}
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	apiControllers "github.com/news-ai/api-v1/controllers"
+	apiModels "github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/repositories"
+)
+
+// Sets up a key and an in-memory store with an active user in it
+func newTokenTest(t *testing.T) apiModels.UserPostgres {
+	tokenKey = []byte("0123456789abcdef0123456789abcdef")
+
+	store := repositories.NewMemoryStore()
+	apiControllers.SetStore(store)
+
+	user := apiModels.UserPostgres{}
+	user.Data.Email = "jane@example.com"
+	user.Data.IsActive = true
+	if err := store.Users.Create(&user); err != nil {
+		t.Fatalf("Users.Create: %v", err)
+	}
+	return user
+}
+
+// Replaces one part of a token, keeping the others
+func withTokenPart(token string, i int, part string) string {
+	parts := strings.Split(token, ".")
+	parts[i] = part
+	return strings.Join(parts, ".")
+}
+
+func encodeTokenPart(t *testing.T, v interface{}) string {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func TestSetupTokenKey(t *testing.T) {
+	defer os.Unsetenv("NEWSAI_TOKENKEY")
+	defer os.Unsetenv("NEWSAI_SECRETKEY")
+
+	os.Setenv("NEWSAI_TOKENKEY", "")
+	os.Setenv("NEWSAI_SECRETKEY", "short")
+	if err := setupTokenKey(); err == nil {
+		t.Error("setupTokenKey with a short key succeeded")
+	}
+
+	os.Setenv("NEWSAI_TOKENKEY", "0123456789abcdef0123456789abcdef")
+	if err := setupTokenKey(); err != nil || string(tokenKey) != "0123456789abcdef0123456789abcdef" {
+		t.Errorf("setupTokenKey = %v, key %q", err, tokenKey)
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	user := newTokenTest(t)
+
+	access, err := newToken(user, accessTokenType, "", accessTokenLifetime)
+	if err != nil {
+		t.Fatalf("newToken: %v", err)
+	}
+	refresh, err := newToken(user, refreshTokenType, "token-id", refreshTokenLifetime)
+	if err != nil {
+		t.Fatalf("newToken: %v", err)
+	}
+	expired, err := newToken(user, accessTokenType, "", -time.Minute)
+	if err != nil {
+		t.Fatalf("newToken: %v", err)
+	}
+
+	claims, err := parseToken(access, accessTokenType)
+	if err != nil || claims.Subject != user.Id || claims.Email != user.Data.Email {
+		t.Fatalf("parseToken = %+v, %v, want the claims of user %d", claims, err, user.Id)
+	}
+
+	// Someone else's id, under the signature of the original payload
+	other := claims
+	other.Subject = user.Id + 1
+	tampered := withTokenPart(access, 1, encodeTokenPart(t, other))
+
+	// Signed for the fixed header, but sent with another one
+	noneHeader := withTokenPart(access, 0, encodeTokenPart(t, map[string]string{"alg": "none", "typ": "JWT"}))
+	otherAlg := withTokenPart(access, 0, encodeTokenPart(t, map[string]string{"alg": "HS512", "typ": "JWT"}))
+	unsigned := withTokenPart(access, 2, "")
+
+	// Signed with another key
+	tokenKey = []byte("fedcba9876543210fedcba9876543210")
+	otherKey, _ := newToken(user, accessTokenType, "", accessTokenLifetime)
+	tokenKey = []byte("0123456789abcdef0123456789abcdef")
+
+	tests := []struct {
+		name      string
+		token     string
+		tokenType string
+		err       error
+	}{
+		{"refresh token", refresh, refreshTokenType, nil},
+		{"tampered payload", tampered, accessTokenType, ErrInvalidToken},
+		{"alg none", noneHeader, accessTokenType, ErrInvalidToken},
+		{"other alg", otherAlg, accessTokenType, ErrInvalidToken},
+		{"no signature", unsigned, accessTokenType, ErrInvalidToken},
+		{"other key", otherKey, accessTokenType, ErrInvalidToken},
+		{"access token as refresh token", access, refreshTokenType, ErrInvalidToken},
+		{"refresh token as access token", refresh, accessTokenType, ErrInvalidToken},
+		{"expired", expired, accessTokenType, ErrExpiredToken},
+		{"not a token", "Bearer", accessTokenType, ErrInvalidToken},
+		{"extra part", access + ".x", accessTokenType, ErrInvalidToken},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parseToken(test.token, test.tokenType); err != test.err {
+				t.Errorf("parseToken = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	user := newTokenTest(t)
+
+	tokens, err := issueTokens(user)
+	if err != nil {
+		t.Fatalf("issueTokens: %v", err)
+	}
+
+	if _, err := tokenUserFromRefreshToken(tokens.AccessToken); err != ErrInvalidToken {
+		t.Errorf("tokenUserFromRefreshToken of an access token = %v, want ErrInvalidToken", err)
+	}
+
+	refreshed, err := tokenUserFromRefreshToken(tokens.RefreshToken)
+	if err != nil || refreshed.Id != user.Id {
+		t.Fatalf("tokenUserFromRefreshToken = %+v, %v, want user %d", refreshed, err, user.Id)
+	}
+
+	if _, err := tokenUserFromRefreshToken(tokens.RefreshToken); err != ErrInvalidToken {
+		t.Errorf("second tokenUserFromRefreshToken = %v, want ErrInvalidToken", err)
+	}
+
+	// A refresh token the database doesn't know, with a valid signature
+	unknown, _ := newToken(user, refreshTokenType, "unknown", refreshTokenLifetime)
+	if _, err := tokenUserFromRefreshToken(unknown); err != ErrInvalidToken {
+		t.Errorf("tokenUserFromRefreshToken of an unknown token = %v, want ErrInvalidToken", err)
+	}
+	withoutId, _ := newToken(user, refreshTokenType, "", refreshTokenLifetime)
+	if _, err := tokenUserFromRefreshToken(withoutId); err != ErrInvalidToken {
+		t.Errorf("tokenUserFromRefreshToken without an id = %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/sessions"
+
+	apiControllers "github.com/news-ai/api-v1/controllers"
+	apiModels "github.com/news-ai/api-v1/models"
+)
+
+const (
+	// How long someone has to enter their code after the password step
+	twoFactorChallengeLifetime = 5 * time.Minute
+
+	// Wrong codes allowed before they have to enter their password again
+	twoFactorMaxAttempts = 5
+)
+
+/*
+* Private methods
+ */
+
+// Remembers who passed the password step, without logging them in
+func startTwoFactorChallenge(w http.ResponseWriter, r *http.Request, session *sessions.Session, user apiModels.UserPostgres) {
+	session.Values["twofactorid"] = user.Id
+	session.Values["twofactorexpires"] = time.Now().Add(twoFactorChallengeLifetime).Unix()
+	session.Values["twofactorattempts"] = 0
+	session.Save(r, w)
+
+	http.Redirect(w, r, "/api/auth/two-factor", 302)
+}
+
+func clearTwoFactorChallenge(w http.ResponseWriter, r *http.Request, session *sessions.Session) {
+	delete(session.Values, "twofactorid")
+	delete(session.Values, "twofactorexpires")
+	delete(session.Values, "twofactorattempts")
+	session.Save(r, w)
+}
+
+func getTwoFactorChallengeUser(r *http.Request, session *sessions.Session) (apiModels.UserPostgres, error) {
+	userId, ok := session.Values["twofactorid"].(int64)
+	if !ok {
+		return apiModels.UserPostgres{}, errors.New("No login waiting for a two-factor code")
+	}
+
+	expires, ok := session.Values["twofactorexpires"].(int64)
+	if !ok || time.Now().Unix() > expires {
+		return apiModels.UserPostgres{}, errors.New("Two-factor challenge has expired")
+	}
+
+	return apiControllers.GetUserByIdUnauthorized(r, userId)
+}
+
+func redirectToLogin(w http.ResponseWriter, r *http.Request, message string) {
+	http.Redirect(w, r, "/api/auth?success=false&message="+url.QueryEscape(message), 302)
+}
+
+func renderTwoFactorPage(w http.ResponseWriter, r *http.Request, data map[string]interface{}) {
+	t := template.New("two-factor.html")
+	t, err := t.ParseFiles("auth/two-factor.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data[csrf.TemplateTag] = csrf.TemplateField(r)
+	t.Execute(w, data)
+}
+
+/*
+* Public methods
+ */
+
+// Second step of the password login. Users whose team requires two-factor
+// but who have not set it up yet get the enrollment form instead.
+func TwoFactorPageHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := store.Get(r, "sess")
+		user, err := getTwoFactorChallengeUser(r, session)
+		if err != nil {
+			log.Printf("%v", err)
+			clearTwoFactorChallenge(w, r, session)
+			redirectToLogin(w, r, "Please log in again.")
+			return
+		}
+
+		data := map[string]interface{}{
+			"enroll": !user.Data.TwoFactorEnabled,
+		}
+
+		// Keep the pending secret across reloads, or a wrong code would
+		// invalidate what the user already scanned.
+		if !user.Data.TwoFactorEnabled {
+			secret := user.Data.TwoFactorPendingSecret
+			if secret == "" {
+				enrollment, err := apiControllers.StartTwoFactorEnrollment(r, &user)
+				if err != nil {
+					log.Printf("%v", err)
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				secret = enrollment.Secret
+			}
+			data["secret"] = secret
+			data["uri"] = apiModels.TwoFactorURI(user.Data.Email, secret)
+		}
+
+		if r.URL.Query().Get("message") != "" {
+			data["message"] = r.URL.Query().Get("message")
+		}
+
+		renderTwoFactorPage(w, r, data)
+	}
+}
+
+func TwoFactorHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := store.Get(r, "sess")
+		user, err := getTwoFactorChallengeUser(r, session)
+		if err != nil {
+			log.Printf("%v", err)
+			clearTwoFactorChallenge(w, r, session)
+			redirectToLogin(w, r, "Please log in again.")
+			return
+		}
+
+		err = checkThrottle(r, throttleTwoFactor, user.Data.Email)
+		if err != nil {
+			clearTwoFactorChallenge(w, r, session)
+			redirectToLogin(w, r, err.Error())
+			return
+		}
+
+		code := strings.TrimSpace(r.FormValue("code"))
+
+		if user.Data.TwoFactorEnabled {
+			err = apiControllers.ValidateTwoFactor(r, &user, code)
+			if err == nil {
+				recordThrottleSuccess(throttleTwoFactor, user.Data.Email)
+				clearTwoFactorChallenge(w, r, session)
+				completePasswordLogin(w, r, session, user)
+				return
+			}
+		} else {
+			codes, err := apiControllers.ConfirmTwoFactorEnrollment(r, &user, code)
+			if err == nil {
+				// The recovery codes are only ever shown here, so the
+				// user is logged in and sent on from this page.
+				recordThrottleSuccess(throttleTwoFactor, user.Data.Email)
+				clearTwoFactorChallenge(w, r, session)
+				next := finishPasswordLogin(w, r, session, user)
+
+				renderTwoFactorPage(w, r, map[string]interface{}{
+					"recoveryCodes": codes.RecoveryCodes,
+					"next":          next,
+				})
+				return
+			}
+		}
+
+		recordThrottleFailure(r, throttleTwoFactor, user.Data.Email)
+
+		attempts, _ := session.Values["twofactorattempts"].(int)
+		attempts++
+		if attempts >= twoFactorMaxAttempts {
+			clearTwoFactorChallenge(w, r, session)
+			redirectToLogin(w, r, "Too many wrong codes. Please log in again.")
+			return
+		}
+
+		session.Values["twofactorattempts"] = attempts
+		session.Save(r, w)
+
+		wrongCodeMessage := url.QueryEscape("The code you entered is not valid!")
+		http.Redirect(w, r, "/api/auth/two-factor?message="+wrongCodeMessage, 302)
+	}
+}
@@ -0,0 +1,524 @@
+package billing
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/news-ai/api-v1/repositories"
+)
+
+// Trials last a week, like the trial billing profiles get.
+const fakeTrialPeriod = 7 * 24 * time.Hour
+
+// Cards for the Stripe test tokens. Any other token gets a Visa.
+var fakeCards = map[string]Card{
+	"tok_visa":       {LastFour: "4242", Brand: "Visa"},
+	"tok_mastercard": {LastFour: "4444", Brand: "MasterCard"},
+	"tok_amex":       {LastFour: "8431", Brand: "American Express"},
+}
+
+// Tokens whose card is refused, like Stripe's test ones.
+var fakeDeclinedTokens = map[string]bool{
+	"tok_chargeDeclined":             true,
+	"tok_chargeDeclinedExpiredCard":  true,
+	"tok_chargeDeclinedInsufficient": true,
+}
+
+// FakeProvider is a PaymentProvider that keeps everything in memory and
+// never talks to Stripe. Plans cost what its plan catalog says, trials are
+// free, plan changes are prorated by the second like Stripe does and
+// coupons take their percentage off every charge of the subscription they
+// were redeemed on.
+type FakeProvider struct {
+	sync.Mutex
+
+	// The provider's clock. Tests move it to reach the end of a period.
+	Now func() time.Time
+
+	// The catalog plans are priced from
+	Plans repositories.Plans
+
+	lastId        int
+	customers     map[string]*Customer
+	subscriptions map[string]*Subscription
+
+	// Subscription ids in the order they were created
+	subscriptionIds []string
+
+	coupons   map[string]Coupon
+	discounts map[string]uint64
+	charges   map[string][]Charge
+}
+
+func NewFakeProvider(plans repositories.Plans) *FakeProvider {
+	return &FakeProvider{
+		Now:           time.Now,
+		Plans:         plans,
+		customers:     map[string]*Customer{},
+		subscriptions: map[string]*Subscription{},
+		coupons:       map[string]Coupon{},
+		discounts:     map[string]uint64{},
+		charges:       map[string][]Charge{},
+	}
+}
+
+/*
+* Private methods
+ */
+
+func (p *FakeProvider) newId(prefix string) string {
+	p.lastId++
+	return prefix + "_fake_" + strconv.Itoa(p.lastId)
+}
+
+func (p *FakeProvider) getCustomer(customerId string) (*Customer, error) {
+	customer, ok := p.customers[customerId]
+	if !ok {
+		return nil, errors.New("No such customer: " + customerId)
+	}
+	return customer, nil
+}
+
+func (p *FakeProvider) getSubscription(subscriptionId string) (*Subscription, error) {
+	subscription, ok := p.subscriptions[subscriptionId]
+	if !ok || subscription.Status == "canceled" {
+		return nil, errors.New("No such subscription: " + subscriptionId)
+	}
+	return subscription, nil
+}
+
+// The price of one period of a Stripe plan, in cents.
+func (p *FakeProvider) price(stripePlan string) (int64, error) {
+	if IsTrialStripePlan(stripePlan) {
+		return 0, nil
+	}
+
+	plan, err := p.Plans.FindByAlias(strings.TrimSuffix(stripePlan, "-yearly"))
+	if err != nil {
+		return 0, errors.New("No such plan: " + stripePlan)
+	}
+
+	return int64(round(plan.Price(stripePlanDuration(stripePlan)) * 100)), nil
+}
+
+func (p *FakeProvider) discounted(subscriptionId string, amount int64) int64 {
+	return amount * int64(100-p.discounts[subscriptionId]) / 100
+}
+
+func fakePeriodEnd(stripePlan string, start time.Time) time.Time {
+	if IsTrialStripePlan(stripePlan) {
+		return start.Add(fakeTrialPeriod)
+	}
+	if isAnnualStripePlan(stripePlan) {
+		return start.AddDate(1, 0, 0)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
+func prorate(amount int64, remaining time.Duration, period time.Duration) int64 {
+	if period <= 0 {
+		return 0
+	}
+	return int64(round(float64(amount) * float64(remaining) / float64(period)))
+}
+
+// Charges the customer's default card, once any credit they have is used
+// up. What is left of a credit is kept for the next charge.
+func (p *FakeProvider) charge(customer *Customer, amount int64) error {
+	amount += customer.Balance
+	if amount <= 0 {
+		customer.Balance = amount
+		return nil
+	}
+	if len(customer.Cards) == 0 {
+		return errors.New("This customer has no attached payment source")
+	}
+
+	customer.Balance = 0
+	p.charges[customer.Id] = append(p.charges[customer.Id], Charge{
+		Id:      p.newId("ch"),
+		Amount:  amount,
+		Created: p.Now(),
+		Paid:    true,
+	})
+	return nil
+}
+
+// Switching between monthly and annual billing, or out of a trial, starts
+// a new period.
+func startsNewPeriod(from string, to string) bool {
+	return IsTrialStripePlan(from) || isAnnualStripePlan(from) != isAnnualStripePlan(to)
+}
+
+func (p *FakeProvider) subscribe(customer *Customer, plan string, coupon string) (Subscription, error) {
+	price, err := p.price(plan)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	percentOff := uint64(0)
+	if coupon != "" {
+		found, ok := p.coupons[strings.ToUpper(coupon)]
+		if !ok {
+			return Subscription{}, errors.New("No such coupon: " + strings.ToUpper(coupon))
+		}
+		if !found.Valid {
+			return Subscription{}, errors.New("Coupon expired: " + found.Id)
+		}
+		percentOff = found.PercentOff
+	}
+
+	err = p.charge(customer, price*int64(100-percentOff)/100)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	now := p.Now()
+	subscription := &Subscription{
+		Id:                 p.newId("sub"),
+		CustomerId:         customer.Id,
+		Plan:               plan,
+		Status:             "active",
+		CurrentPeriodStart: now,
+		CurrentPeriodEnd:   fakePeriodEnd(plan, now),
+	}
+	if IsTrialStripePlan(plan) {
+		subscription.Status = "trialing"
+	}
+
+	p.subscriptions[subscription.Id] = subscription
+	p.subscriptionIds = append(p.subscriptionIds, subscription.Id)
+	p.discounts[subscription.Id] = percentOff
+	return *subscription, nil
+}
+
+// Credits what is left of the current period on the old plan and charges
+// it on the new one, both from the given time. A change that starts a new
+// period charges the whole of it with the credit; otherwise the new plan is
+// charged again when the period ends.
+func (p *FakeProvider) preview(subscription *Subscription, plan string, at time.Time) (Invoice, error) {
+	oldPrice, err := p.price(subscription.Plan)
+	if err != nil {
+		return Invoice{}, err
+	}
+	newPrice, err := p.price(plan)
+	if err != nil {
+		return Invoice{}, err
+	}
+	oldPrice = p.discounted(subscription.Id, oldPrice)
+	newPrice = p.discounted(subscription.Id, newPrice)
+
+	periodStart := subscription.CurrentPeriodStart
+	periodEnd := subscription.CurrentPeriodEnd
+	period := periodEnd.Sub(periodStart)
+	remaining := periodEnd.Sub(at)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	invoice := Invoice{
+		CustomerId: subscription.CustomerId,
+		Lines:      []InvoiceLine{},
+	}
+
+	if oldPrice > 0 {
+		invoice.Lines = append(invoice.Lines, InvoiceLine{
+			Plan:        subscription.Plan,
+			Amount:      -prorate(oldPrice, remaining, period),
+			Proration:   true,
+			PeriodStart: at,
+			PeriodEnd:   periodEnd,
+		})
+	}
+
+	if startsNewPeriod(subscription.Plan, plan) {
+		invoice.Lines = append(invoice.Lines, InvoiceLine{
+			Plan:        plan,
+			Amount:      newPrice,
+			PeriodStart: at,
+			PeriodEnd:   fakePeriodEnd(plan, at),
+		})
+		return invoice, nil
+	}
+
+	invoice.Lines = append(invoice.Lines, InvoiceLine{
+		Plan:        plan,
+		Amount:      prorate(newPrice, remaining, period),
+		Proration:   true,
+		PeriodStart: at,
+		PeriodEnd:   periodEnd,
+	}, InvoiceLine{
+		Plan:        plan,
+		Amount:      newPrice,
+		PeriodStart: periodEnd,
+		PeriodEnd:   fakePeriodEnd(plan, periodEnd),
+	})
+	return invoice, nil
+}
+
+func (p *FakeProvider) customerView(customer *Customer) Customer {
+	view := *customer
+	view.Cards = append([]Card{}, customer.Cards...)
+	view.Subscriptions = []Subscription{}
+	for _, id := range p.subscriptionIds {
+		subscription := p.subscriptions[id]
+		if subscription.CustomerId == customer.Id && subscription.Status != "canceled" {
+			view.Subscriptions = append(view.Subscriptions, *subscription)
+		}
+	}
+	return view
+}
+
+/*
+* Public methods
+ */
+
+// AddCoupon makes a coupon redeemable, or not when it isn't Valid.
+func (p *FakeProvider) AddCoupon(coupon Coupon) {
+	p.Lock()
+	defer p.Unlock()
+	coupon.Id = strings.ToUpper(coupon.Id)
+	p.coupons[coupon.Id] = coupon
+}
+
+func (p *FakeProvider) CreateCustomer(email string, plan string) (Customer, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	customer := &Customer{
+		Id:    p.newId("cus"),
+		Email: email,
+		Cards: []Card{},
+	}
+
+	// Stripe refuses to create a customer it can't subscribe
+	_, err := p.subscribe(customer, plan, "")
+	if err != nil {
+		return Customer{}, err
+	}
+
+	p.customers[customer.Id] = customer
+	return p.customerView(customer), nil
+}
+
+func (p *FakeProvider) GetCustomer(customerId string) (Customer, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	customer, err := p.getCustomer(customerId)
+	if err != nil {
+		return Customer{}, err
+	}
+	return p.customerView(customer), nil
+}
+
+// AddCard replaces the customer's default card, like setting a source on a
+// Stripe customer does.
+func (p *FakeProvider) AddCard(customerId string, token string) (Customer, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	customer, err := p.getCustomer(customerId)
+	if err != nil {
+		return Customer{}, err
+	}
+
+	if fakeDeclinedTokens[token] {
+		return Customer{}, errors.New("Your card was declined.")
+	}
+
+	card, ok := fakeCards[token]
+	if !ok {
+		card = fakeCards["tok_visa"]
+	}
+	card.Id = p.newId("card")
+	card.IsDefault = true
+
+	cards := []Card{card}
+	for i := 0; i < len(customer.Cards); i++ {
+		if !customer.Cards[i].IsDefault {
+			cards = append(cards, customer.Cards[i])
+		}
+	}
+	customer.Cards = cards
+
+	return p.customerView(customer), nil
+}
+
+// ListCharges returns the customer's charges, newest first.
+func (p *FakeProvider) ListCharges(customerId string) ([]Charge, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	_, err := p.getCustomer(customerId)
+	if err != nil {
+		return []Charge{}, err
+	}
+
+	charges := []Charge{}
+	for i := len(p.charges[customerId]) - 1; i >= 0; i-- {
+		charges = append(charges, p.charges[customerId][i])
+	}
+	return charges, nil
+}
+
+func (p *FakeProvider) CreateSubscription(customerId string, plan string, coupon string) (Subscription, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	customer, err := p.getCustomer(customerId)
+	if err != nil {
+		return Subscription{}, err
+	}
+	return p.subscribe(customer, plan, coupon)
+}
+
+func (p *FakeProvider) CancelSubscription(subscriptionId string, atPeriodEnd bool) (Subscription, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	subscription, err := p.getSubscription(subscriptionId)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	if atPeriodEnd {
+		subscription.CancelAtPeriodEnd = true
+	} else {
+		subscription.Status = "canceled"
+	}
+	return *subscription, nil
+}
+
+// ChangeSubscription charges the lines of the change's preview that start
+// right away, less any credit the customer has. A change that comes out
+// as a credit is kept for their next charge.
+func (p *FakeProvider) ChangeSubscription(subscriptionId string, plan string, prorationDate time.Time) (Subscription, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	subscription, err := p.getSubscription(subscriptionId)
+	if err != nil {
+		return Subscription{}, err
+	}
+	customer, err := p.getCustomer(subscription.CustomerId)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	invoice, err := p.preview(subscription, plan, prorationDate)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	var due int64 = 0
+	for _, line := range invoice.Lines {
+		if line.PeriodStart.Equal(prorationDate) {
+			due += line.Amount
+		}
+	}
+
+	err = p.charge(customer, due)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	if startsNewPeriod(subscription.Plan, plan) {
+		subscription.CurrentPeriodStart = prorationDate
+		subscription.CurrentPeriodEnd = fakePeriodEnd(plan, prorationDate)
+	}
+	subscription.Plan = plan
+	subscription.Status = "active"
+	return *subscription, nil
+}
+
+func (p *FakeProvider) ScheduleSubscriptionChange(subscriptionId string, plan string) (Subscription, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	subscription, err := p.getSubscription(subscriptionId)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	_, err = p.price(plan)
+	if err != nil {
+		return Subscription{}, err
+	}
+	if startsNewPeriod(subscription.Plan, plan) {
+		return Subscription{}, errors.New("Can't change the billing interval of " + subscriptionId + " without proration")
+	}
+
+	subscription.Plan = plan
+	return *subscription, nil
+}
+
+// RenewSubscriptions starts the next period of every subscription whose
+// period has ended by the provider's clock, and charges it. Those canceled
+// at the end of their period end instead, and those that can't be charged
+// become past due. It returns the subscriptions it renewed or ended.
+func (p *FakeProvider) RenewSubscriptions() []Subscription {
+	p.Lock()
+	defer p.Unlock()
+
+	now := p.Now()
+	renewed := []Subscription{}
+	for _, id := range p.subscriptionIds {
+		subscription := p.subscriptions[id]
+		if subscription.Status == "canceled" || subscription.CurrentPeriodEnd.After(now) {
+			continue
+		}
+
+		if subscription.CancelAtPeriodEnd {
+			subscription.Status = "canceled"
+			renewed = append(renewed, *subscription)
+			continue
+		}
+
+		subscription.CurrentPeriodStart = subscription.CurrentPeriodEnd
+		subscription.CurrentPeriodEnd = fakePeriodEnd(subscription.Plan, subscription.CurrentPeriodStart)
+
+		price, err := p.price(subscription.Plan)
+		if err == nil {
+			err = p.charge(p.customers[subscription.CustomerId], p.discounted(id, price))
+		}
+		if err != nil {
+			subscription.Status = "past_due"
+		} else if !IsTrialStripePlan(subscription.Plan) {
+			subscription.Status = "active"
+		}
+		renewed = append(renewed, *subscription)
+	}
+	return renewed
+}
+
+// PreviewSubscriptionChange prorates a change by the second, like Stripe
+// does.
+func (p *FakeProvider) PreviewSubscriptionChange(customerId string, subscriptionId string, plan string, at time.Time) (Invoice, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	subscription, err := p.getSubscription(subscriptionId)
+	if err != nil {
+		return Invoice{}, err
+	}
+	if subscription.CustomerId != customerId {
+		return Invoice{}, errors.New("No such subscription: " + subscriptionId)
+	}
+
+	return p.preview(subscription, plan, at)
+}
+
+func (p *FakeProvider) GetCoupon(code string) (Coupon, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	coupon, ok := p.coupons[strings.ToUpper(code)]
+	if !ok {
+		return Coupon{}, errors.New("No such coupon: " + strings.ToUpper(code))
+	}
+	return coupon, nil
+}
@@ -0,0 +1,446 @@
+package billing
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/repositories"
+)
+
+// 2017-03-01 to 2017-04-01 is 31 days, and the year from it 365.
+var fakeStart = time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// A catalog with the plans the catalog migrations add
+func newTestPlans() repositories.Plans {
+	catalog := repositories.NewMemoryStore().Plans
+	catalog.Create(&models.Plan{Name: "Trial Member", StripeId: "free", Aliases: []string{"free"}, EmailsPerDay: 100, EnhanceCredits: 10})
+	catalog.Create(&models.Plan{Name: "Personal", StripeId: "personal", Aliases: []string{"bronze", "personal"}, MonthlyPrice: 18.99, AnnualPrice: 15.99, EmailsPerDay: 100, SocialAccounts: 100, EnhanceCredits: 50, Active: true})
+	catalog.Create(&models.Plan{Name: "Consultant", StripeId: "consultant", Aliases: []string{"aluminum", "consultant"}, MonthlyPrice: 34.99, AnnualPrice: 28.99, EmailAccounts: 2, EmailsPerDay: 400, SocialAccounts: 250, EnhanceCredits: 150, Active: true})
+	catalog.Create(&models.Plan{Name: "Business", StripeId: "business", Aliases: []string{"silver", "silver-1", "business"}, MonthlyPrice: 41.99, AnnualPrice: 34.99, EmailAccounts: 5, EmailsPerDay: 1000, SocialAccounts: 500, EnhanceCredits: 500, MediaDatabase: true, Active: true})
+	catalog.Create(&models.Plan{Name: "Growing Business", StripeId: "growing", Aliases: []string{"gold", "gold-1", "growing"}, MonthlyPrice: 52.99, AnnualPrice: 43.99, EmailAccounts: 10, EmailsPerDay: 2500, SocialAccounts: 100000, EnhanceCredits: 2000, MediaDatabase: true, Active: true})
+	return catalog
+}
+
+func newTestProvider() (*FakeProvider, *time.Time) {
+	now := fakeStart
+	p := NewFakeProvider(newTestPlans())
+	p.Now = func() time.Time { return now }
+	return p, &now
+}
+
+// A customer with a card, out of their trial, with nothing charged yet.
+func newTestCustomer(t *testing.T, p *FakeProvider) Customer {
+	customer, err := p.CreateCustomer("jane@example.com", "personal-trial")
+	if err != nil {
+		t.Fatalf("CreateCustomer: %v", err)
+	}
+	_, err = p.CancelSubscription(customer.Subscriptions[0].Id, false)
+	if err != nil {
+		t.Fatalf("CancelSubscription: %v", err)
+	}
+	_, err = p.AddCard(customer.Id, "tok_visa")
+	if err != nil {
+		t.Fatalf("AddCard: %v", err)
+	}
+	return customer
+}
+
+func charged(t *testing.T, p *FakeProvider, customerId string) []int64 {
+	charges, err := p.ListCharges(customerId)
+	if err != nil {
+		t.Fatalf("ListCharges: %v", err)
+	}
+	amounts := []int64{}
+	for _, charge := range charges {
+		amounts = append(amounts, charge.Amount)
+	}
+	return amounts
+}
+
+func sameAmounts(a []int64, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// What the lines of an invoice that start at the given time add up to
+func dueAt(invoice Invoice, at time.Time) int64 {
+	var due int64 = 0
+	for _, line := range invoice.Lines {
+		if line.PeriodStart.Equal(at) {
+			due += line.Amount
+		}
+	}
+	return due
+}
+
+func TestFakeProviderPrices(t *testing.T) {
+	p, _ := newTestProvider()
+
+	tests := []struct {
+		plan  string
+		price int64
+	}{
+		{"personal", 1899},
+		{"bronze", 1899},
+		{"personal-yearly", 19188},
+		{"business", 4199},
+		{"silver-1-yearly", 41988},
+		{"growing-trial", 0},
+		{"free", 0},
+	}
+	for _, test := range tests {
+		price, err := p.price(test.plan)
+		if err != nil || price != test.price {
+			t.Errorf("price(%q) = %d, %v, want %d", test.plan, price, err, test.price)
+		}
+	}
+
+	if _, err := p.price("platinum"); err == nil {
+		t.Error("price of a plan that isn't in the catalog succeeded")
+	}
+}
+
+func TestSetupFakePaymentProvider(t *testing.T) {
+	os.Setenv("PAYMENT_PROVIDER", "fake")
+	defer os.Unsetenv("PAYMENT_PROVIDER")
+	defer SetPaymentProvider(nil)
+
+	catalog := newTestPlans()
+	SetPlans(catalog)
+	defer SetPlans(nil)
+
+	if err := SetupPaymentProvider(); err != nil {
+		t.Fatalf("SetupPaymentProvider: %v", err)
+	}
+	fake, ok := provider.(*FakeProvider)
+	if !ok {
+		t.Fatalf("SetupPaymentProvider set up %T, want a *FakeProvider", provider)
+	}
+
+	// Plans added to the catalog, as the admin plan pages do, are priced
+	// right away
+	catalog.Create(&models.Plan{Name: "Agency", StripeId: "agency", Aliases: []string{"agency"}, MonthlyPrice: 99.99, AnnualPrice: 89.99, Active: true})
+	if price, err := fake.price("agency"); err != nil || price != 9999 {
+		t.Errorf("price(agency) = %d, %v, want 9999", price, err)
+	}
+	if price := PlanAndDurationToPrice("agency", "annually"); price != 1079.88 {
+		t.Errorf("PlanAndDurationToPrice(agency, annually) = %v, want 1079.88", price)
+	}
+}
+
+func TestFakeProviderTrial(t *testing.T) {
+	p, now := newTestProvider()
+
+	customer, err := p.CreateCustomer("jane@example.com", "personal-trial")
+	if err != nil {
+		t.Fatalf("CreateCustomer: %v", err)
+	}
+	trial := customer.Subscriptions[0]
+	if trial.Status != "trialing" || !trial.CurrentPeriodEnd.Equal(fakeStart.Add(fakeTrialPeriod)) {
+		t.Errorf("trial = %+v, want trialing for a week", trial)
+	}
+	if amounts := charged(t, p, customer.Id); len(amounts) != 0 {
+		t.Errorf("charges after a trial started = %v, want none", amounts)
+	}
+
+	// Leaving the trial needs a card and starts a paid period
+	*now = fakeStart.Add(3 * 24 * time.Hour)
+	if _, err := p.ChangeSubscription(trial.Id, "personal", *now); err == nil {
+		t.Error("ChangeSubscription without a card succeeded")
+	}
+	if _, err := p.AddCard(customer.Id, "tok_chargeDeclined"); err == nil {
+		t.Error("AddCard of a declined card succeeded")
+	}
+	if _, err := p.AddCard(customer.Id, "tok_visa"); err != nil {
+		t.Fatalf("AddCard: %v", err)
+	}
+
+	subscription, err := p.ChangeSubscription(trial.Id, "personal", *now)
+	if err != nil {
+		t.Fatalf("ChangeSubscription: %v", err)
+	}
+	if subscription.Status != "active" || !subscription.CurrentPeriodStart.Equal(*now) || !subscription.CurrentPeriodEnd.Equal(now.AddDate(0, 1, 0)) {
+		t.Errorf("subscription after the trial = %+v, want active for a month from now", subscription)
+	}
+	if amounts := charged(t, p, customer.Id); !sameAmounts(amounts, []int64{1899}) {
+		t.Errorf("charges after the trial = %v, want [1899]", amounts)
+	}
+}
+
+func TestFakeProviderCoupons(t *testing.T) {
+	p, now := newTestProvider()
+	p.AddCoupon(Coupon{Id: "half", PercentOff: 50, Valid: true})
+	p.AddCoupon(Coupon{Id: "LAUNCH", PercentOff: 20, Valid: false})
+
+	customer := newTestCustomer(t, p)
+
+	if _, err := p.CreateSubscription(customer.Id, "business", "NOPE"); err == nil {
+		t.Error("CreateSubscription with an unknown coupon succeeded")
+	}
+	if _, err := p.CreateSubscription(customer.Id, "business", "launch"); err == nil {
+		t.Error("CreateSubscription with an expired coupon succeeded")
+	}
+
+	coupon, err := p.GetCoupon("Half")
+	if err != nil || coupon.Id != "HALF" || coupon.PercentOff != 50 {
+		t.Errorf("GetCoupon(Half) = %+v, %v, want HALF at 50%%", coupon, err)
+	}
+
+	subscription, err := p.CreateSubscription(customer.Id, "business", "half")
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+
+	// The coupon stays on the subscription: on its renewals and on what a
+	// change of plan credits and charges.
+	*now = fakeStart.AddDate(0, 1, 0)
+	p.RenewSubscriptions()
+
+	*now = now.Add(15 * 24 * time.Hour)
+	invoice, err := p.PreviewSubscriptionChange(customer.Id, subscription.Id, "growing", *now)
+	if err != nil {
+		t.Fatalf("PreviewSubscriptionChange: %v", err)
+	}
+	// Half of 2099 back and half of 2649 charged, for half of April
+	if due := dueAt(invoice, *now); due != 1325-1050 {
+		t.Errorf("cost of the upgrade = %d, want %d", due, 1325-1050)
+	}
+
+	if amounts := charged(t, p, customer.Id); !sameAmounts(amounts, []int64{2099, 2099}) {
+		t.Errorf("charges = %v, want [2099 2099]", amounts)
+	}
+}
+
+func TestFakeProviderProration(t *testing.T) {
+	p, now := newTestProvider()
+	customer := newTestCustomer(t, p)
+
+	subscription, err := p.CreateSubscription(customer.Id, "personal", "")
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+
+	// Halfway through March
+	*now = fakeStart.Add(31 * 12 * time.Hour)
+	invoice, err := p.PreviewSubscriptionChange(customer.Id, subscription.Id, "business", *now)
+	if err != nil {
+		t.Fatalf("PreviewSubscriptionChange: %v", err)
+	}
+
+	end := fakeStart.AddDate(0, 1, 0)
+	want := []InvoiceLine{
+		{Plan: "personal", Amount: -950, Proration: true, PeriodStart: *now, PeriodEnd: end},
+		{Plan: "business", Amount: 2100, Proration: true, PeriodStart: *now, PeriodEnd: end},
+		{Plan: "business", Amount: 4199, PeriodStart: end, PeriodEnd: end.AddDate(0, 1, 0)},
+	}
+	if len(invoice.Lines) != len(want) {
+		t.Fatalf("preview lines = %+v, want %+v", invoice.Lines, want)
+	}
+	for i := range want {
+		if invoice.Lines[i] != want[i] {
+			t.Errorf("preview line %d = %+v, want %+v", i, invoice.Lines[i], want[i])
+		}
+	}
+
+	subscription, err = p.ChangeSubscription(subscription.Id, "business", *now)
+	if err != nil {
+		t.Fatalf("ChangeSubscription: %v", err)
+	}
+	if subscription.Plan != "business" || !subscription.CurrentPeriodEnd.Equal(end) {
+		t.Errorf("subscription after the upgrade = %+v, want business until %v", subscription, end)
+	}
+	if amounts := charged(t, p, customer.Id); !sameAmounts(amounts, []int64{1150, 1899}) {
+		t.Errorf("charges = %v, want [1150 1899]", amounts)
+	}
+}
+
+func TestFakeProviderSwitchDuration(t *testing.T) {
+	p, now := newTestProvider()
+	customer := newTestCustomer(t, p)
+
+	subscription, err := p.CreateSubscription(customer.Id, "personal", "")
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+
+	// Only a change with proration can move to annual billing
+	if _, err := p.ScheduleSubscriptionChange(subscription.Id, "personal-yearly"); err == nil {
+		t.Error("ScheduleSubscriptionChange to annual billing succeeded")
+	}
+
+	// Monthly to annual: half of March back, and the whole year charged
+	*now = fakeStart.Add(31 * 12 * time.Hour)
+	subscription, err = p.ChangeSubscription(subscription.Id, "personal-yearly", *now)
+	if err != nil {
+		t.Fatalf("ChangeSubscription: %v", err)
+	}
+	if !subscription.CurrentPeriodStart.Equal(*now) || !subscription.CurrentPeriodEnd.Equal(now.AddDate(1, 0, 0)) {
+		t.Errorf("annual subscription = %+v, want a year from now", subscription)
+	}
+	if amounts := charged(t, p, customer.Id); !sameAmounts(amounts, []int64{19188 - 950, 1899}) {
+		t.Errorf("charges = %v, want [%d 1899]", amounts, 19188-950)
+	}
+
+	// Annual to monthly: half of the year back is more than a month costs,
+	// so the rest is kept for the next charges.
+	yearStart := *now
+	*now = yearStart.Add(365 * 12 * time.Hour)
+	subscription, err = p.ChangeSubscription(subscription.Id, "personal", *now)
+	if err != nil {
+		t.Fatalf("ChangeSubscription: %v", err)
+	}
+	if !subscription.CurrentPeriodEnd.Equal(now.AddDate(0, 1, 0)) {
+		t.Errorf("monthly subscription = %+v, want a month from now", subscription)
+	}
+
+	customer, err = p.GetCustomer(customer.Id)
+	if err != nil {
+		t.Fatalf("GetCustomer: %v", err)
+	}
+	if customer.Balance != 1899-9594 {
+		t.Errorf("balance = %d, want %d", customer.Balance, 1899-9594)
+	}
+
+	*now = now.AddDate(0, 1, 0)
+	p.RenewSubscriptions()
+	customer, _ = p.GetCustomer(customer.Id)
+	if customer.Balance != 2*1899-9594 {
+		t.Errorf("balance after a renewal = %d, want %d", customer.Balance, 2*1899-9594)
+	}
+	if amounts := charged(t, p, customer.Id); len(amounts) != 2 {
+		t.Errorf("charges = %v, want no new ones", amounts)
+	}
+}
+
+func TestFakeProviderScheduledDowngrade(t *testing.T) {
+	p, now := newTestProvider()
+	customer := newTestCustomer(t, p)
+
+	subscription, err := p.CreateSubscription(customer.Id, "business", "")
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+
+	*now = fakeStart.Add(10 * 24 * time.Hour)
+	subscription, err = p.ScheduleSubscriptionChange(subscription.Id, "personal")
+	if err != nil {
+		t.Fatalf("ScheduleSubscriptionChange: %v", err)
+	}
+	if subscription.Plan != "personal" || !subscription.CurrentPeriodEnd.Equal(fakeStart.AddDate(0, 1, 0)) {
+		t.Errorf("subscription = %+v, want personal from the next period", subscription)
+	}
+	if amounts := charged(t, p, customer.Id); !sameAmounts(amounts, []int64{4199}) {
+		t.Errorf("charges after the downgrade = %v, want [4199]", amounts)
+	}
+
+	*now = fakeStart.AddDate(0, 1, 0)
+	p.RenewSubscriptions()
+	if amounts := charged(t, p, customer.Id); !sameAmounts(amounts, []int64{1899, 4199}) {
+		t.Errorf("charges after the renewal = %v, want [1899 4199]", amounts)
+	}
+}
+
+func TestFakeProviderCancel(t *testing.T) {
+	p, now := newTestProvider()
+	customer := newTestCustomer(t, p)
+
+	subscription, err := p.CreateSubscription(customer.Id, "personal", "")
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+
+	subscription, err = p.CancelSubscription(subscription.Id, true)
+	if err != nil || !subscription.CancelAtPeriodEnd {
+		t.Fatalf("CancelSubscription at the period end = %+v, %v", subscription, err)
+	}
+
+	// The user keeps what they paid for until the period ends
+	customer, _ = p.GetCustomer(customer.Id)
+	if len(customer.Subscriptions) != 1 || customer.Subscriptions[0].Status != "active" {
+		t.Errorf("subscriptions before the period end = %+v, want the active one", customer.Subscriptions)
+	}
+
+	*now = fakeStart.AddDate(0, 1, 0)
+	renewed := p.RenewSubscriptions()
+	if len(renewed) != 1 || renewed[0].Status != "canceled" {
+		t.Errorf("RenewSubscriptions = %+v, want the subscription canceled", renewed)
+	}
+	customer, _ = p.GetCustomer(customer.Id)
+	if len(customer.Subscriptions) != 0 {
+		t.Errorf("subscriptions after the period end = %+v, want none", customer.Subscriptions)
+	}
+	if amounts := charged(t, p, customer.Id); !sameAmounts(amounts, []int64{1899}) {
+		t.Errorf("charges = %v, want [1899]", amounts)
+	}
+
+	// Canceling right away ends it, and it can't be changed after
+	subscription, err = p.CreateSubscription(customer.Id, "personal", "")
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+	if _, err := p.CancelSubscription(subscription.Id, false); err != nil {
+		t.Fatalf("CancelSubscription: %v", err)
+	}
+	if _, err := p.ChangeSubscription(subscription.Id, "business", *now); err == nil {
+		t.Error("ChangeSubscription of a canceled subscription succeeded")
+	}
+}
+
+func TestSwitchUserPlanPreview(t *testing.T) {
+	// Previews are prorated from the real time
+	p := NewFakeProvider(newTestPlans())
+	SetPaymentProvider(p)
+	SetPlans(p.Plans)
+	defer SetPaymentProvider(nil)
+	defer SetPlans(nil)
+
+	customer := newTestCustomer(t, p)
+	subscription, err := p.CreateSubscription(customer.Id, "consultant", "")
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+
+	userBilling := models.BillingPostgres{}
+	userBilling.Data.StripeId = customer.Id
+	userBilling.Data.StripeSubscriptionId = subscription.Id
+	userBilling.Data.StripePlanId = "consultant"
+
+	tests := []struct {
+		name      string
+		plan      string
+		duration  string
+		delayed   bool
+		costsMore bool
+	}{
+		{"upgrade", "business", "monthly", false, true},
+		{"downgrade", "personal", "monthly", true, false},
+		{"to annual", "personal", "annually", false, true},
+		{"to annual on the same plan", "consultant", "annually", false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cost, delayed, err := SwitchUserPlanPreview(&userBilling, test.duration, test.plan)
+			if err != nil {
+				t.Fatalf("SwitchUserPlanPreview: %v", err)
+			}
+			if delayed != test.delayed || (cost > 0) != test.costsMore {
+				t.Errorf("SwitchUserPlanPreview = %d, %v, want delayed %v and a cost %v", cost, delayed, test.delayed, test.costsMore)
+			}
+		})
+	}
+
+	trialBilling := userBilling
+	trialBilling.Data.IsOnTrial = true
+	if _, _, err := SwitchUserPlanPreview(&trialBilling, "monthly", "business"); err == nil {
+		t.Error("SwitchUserPlanPreview during a trial succeeded")
+	}
+}
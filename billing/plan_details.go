@@ -1,72 +1,71 @@
 package billing
 
-func BillingIdToPlanName(plan string) string {
-	switch plan {
-	case "bronze", "personal": // now "Personal"
-		return "Personal"
-	case "aluminum", "consultant": // now "Consultant"
-		return "Consultant"
-	case "silver", "silver-1", "business": // now "Business"
-		return "Business"
-	case "gold", "gold-1", "growing": // now "Growing Business"
-		return "Growing Business"
-	case "free":
-		return "Trial Member"
+import (
+	"github.com/news-ai/api-v1/db"
+	"github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/repositories"
+)
+
+// Billing profiles with an id the catalog doesn't know are treated as on
+// this plan
+const defaultPlanName = "Personal"
+
+var plans repositories.Plans
+
+// SetPlans swaps the catalog the plan lookups below read from.
+func SetPlans(p repositories.Plans) {
+	plans = p
+}
+
+func getPlans() repositories.Plans {
+	if plans == nil {
+		return repositories.NewPostgresStore(db.DB, db.ReadDB).Plans
 	}
+	return plans
+}
 
-	return "Personal"
+// LookupPlan finds a plan in the catalog by its Stripe id, one of its
+// legacy aliases or its name.
+func LookupPlan(plan string) (models.Plan, error) {
+	found, err := getPlans().FindByAlias(plan)
+	if err == repositories.ErrNotFound {
+		found, err = getPlans().FindByName(plan)
+	}
+	return found, err
 }
 
-func UserMaximumSocialAccounts(plan string) int {
-	switch plan {
-	case "Personal": // now "Personal"
-		return 100
-	case "Consultant": // now "Consultant"
-		return 250
-	case "Business": // now "Business"
-		return 500
-	case "Growing Business": // now "Growing Business"
-		return 100000
+func BillingIdToPlanName(plan string) string {
+	found, err := LookupPlan(plan)
+	if err != nil {
+		return defaultPlanName
 	}
+	return found.Name
+}
 
-	return 0
+func UserMaximumSocialAccounts(plan string) int {
+	found, err := LookupPlan(plan)
+	if err != nil {
+		return 0
+	}
+	return found.SocialAccounts
 }
 
 func UserMaximumEmailAccounts(plan string) int {
-	switch plan {
-	case "Personal": // now "Personal"
+	found, err := LookupPlan(plan)
+	if err != nil {
 		return 0
-	case "Consultant": // now "Consultant"
-		return 2
-	case "Business": // now "Business"
-		return 5
-	case "Growing Business": // now "Growing Business"
-		return 10
 	}
-
-	return 0
+	return found.EmailAccounts
 }
 
 func UserMaximumEmailSent(plan string) int {
-	switch plan {
-	case "Personal": // now "Personal"
-		return 100
-	case "Consultant": // now "Consultant"
-		return 400
-	case "Business": // now "Business"
-		return 1000
-	case "Growing Business": // now "Growing Business"
-		return 2500
+	found, err := LookupPlan(plan)
+	if err != nil {
+		return 0
 	}
-
-	return 0
+	return found.EmailsPerDay
 }
 
 func StripePlanIdToMaximumEmailSent(stripePlanId string) int {
-	switch stripePlanId {
-	case "free": // now "Personal"
-		return 100
-	}
-
-	return 20000
+	return UserMaximumEmailSent(stripePlanId)
 }
@@ -0,0 +1,160 @@
+package billing
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+// Customer is someone we bill. Balance is what Stripe calls the account
+// balance, in cents: negative when we owe them credit.
+type Customer struct {
+	Id      string
+	Email   string
+	Balance int64
+
+	// Subscriptions that have not been canceled yet
+	Subscriptions []Subscription
+	Cards         []Card
+}
+
+// Subscription bills a customer for a plan every period. Plan is the Stripe
+// plan id, like "business-yearly" or "free-trial".
+type Subscription struct {
+	Id         string
+	CustomerId string
+	Plan       string
+	Status     string
+
+	CurrentPeriodStart time.Time
+	CurrentPeriodEnd   time.Time
+	CancelAtPeriodEnd  bool
+}
+
+type Card struct {
+	Id        string
+	LastFour  string
+	IsDefault bool
+	Brand     string
+}
+
+type Charge struct {
+	Id      string
+	Amount  int64
+	Created time.Time
+	Paid    bool
+}
+
+type Coupon struct {
+	Id         string
+	PercentOff uint64
+
+	// Whether the coupon can still be redeemed
+	Valid bool
+}
+
+// InvoiceLine is one amount of an invoice, in cents. Proration lines credit
+// or charge part of a period after a plan change.
+type InvoiceLine struct {
+	Plan        string
+	Amount      int64
+	Proration   bool
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+}
+
+type Invoice struct {
+	CustomerId string
+	Lines      []InvoiceLine
+}
+
+// PaymentProvider is what billing needs from whoever charges our customers.
+// Amounts are in cents and plans are Stripe plan ids. Errors are meant to
+// be shown to the user.
+type PaymentProvider interface {
+	// CreateCustomer adds a customer and subscribes them to plan.
+	CreateCustomer(email string, plan string) (Customer, error)
+	GetCustomer(customerId string) (Customer, error)
+
+	// AddCard makes the card behind a Stripe.js token the customer's
+	// default one.
+	AddCard(customerId string, token string) (Customer, error)
+	ListCharges(customerId string) ([]Charge, error)
+
+	CreateSubscription(customerId string, plan string, coupon string) (Subscription, error)
+	CancelSubscription(subscriptionId string, atPeriodEnd bool) (Subscription, error)
+
+	// ChangeSubscription moves the subscription to plan right away and
+	// charges what the change costs, prorated from the given time.
+	ChangeSubscription(subscriptionId string, plan string, prorationDate time.Time) (Subscription, error)
+
+	// ScheduleSubscriptionChange moves the subscription to plan without
+	// proration, so its price is only charged from the next period. It
+	// keeps the period, and can't change how often the plan is billed.
+	ScheduleSubscriptionChange(subscriptionId string, plan string) (Subscription, error)
+
+	// PreviewSubscriptionChange returns the next invoice of the customer if
+	// the subscription switched to plan at the given time.
+	PreviewSubscriptionChange(customerId string, subscriptionId string, plan string, at time.Time) (Invoice, error)
+
+	GetCoupon(code string) (Coupon, error)
+}
+
+var provider PaymentProvider
+
+/*
+* Private methods
+ */
+
+func getProvider() PaymentProvider {
+	if provider == nil {
+		return StripeProvider{SecretKey: os.Getenv("STRIPE_SECRET_KEY")}
+	}
+	return provider
+}
+
+// Plans billed annually have their own Stripe plan.
+func stripePlanId(plan string, duration string) string {
+	if duration == "annually" {
+		return plan + "-yearly"
+	}
+	return plan
+}
+
+func isAnnualStripePlan(stripePlan string) bool {
+	return strings.HasSuffix(stripePlan, "-yearly")
+}
+
+func stripePlanDuration(stripePlan string) string {
+	if isAnnualStripePlan(stripePlan) {
+		return "annually"
+	}
+	return "monthly"
+}
+
+/*
+* Public methods
+ */
+
+// SetPaymentProvider swaps the provider the billing functions charge
+// through.
+func SetPaymentProvider(p PaymentProvider) {
+	provider = p
+}
+
+// SetupPaymentProvider picks the provider named in PAYMENT_PROVIDER:
+// "stripe", the default, bills through Stripe with STRIPE_SECRET_KEY and
+// "fake" keeps everything in memory, to run billing locally, and prices
+// plans from the catalog the plan lookups read.
+func SetupPaymentProvider() error {
+	switch os.Getenv("PAYMENT_PROVIDER") {
+	case "", "stripe":
+		SetPaymentProvider(StripeProvider{SecretKey: os.Getenv("STRIPE_SECRET_KEY")})
+	case "fake":
+		SetPaymentProvider(NewFakeProvider(getPlans()))
+	default:
+		return errors.New("Unknown PAYMENT_PROVIDER " + os.Getenv("PAYMENT_PROVIDER"))
+	}
+	return nil
+}
@@ -1,41 +1,23 @@
 package billing
 
 import (
-	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
-	"strings"
-	"time"
-
-	"github.com/stripe/stripe-go"
-	"github.com/stripe/stripe-go/client"
 
 	"github.com/news-ai/api-v1/models"
 	"github.com/news-ai/tabulae-v1/emails"
 )
 
-func AddFreeTrialToUser(r *http.Request, user models.UserPostgres, plan string) (int64, error) {
-	sc := &client.API{}
-	sc.Init(os.Getenv("STRIPE_SECRET_KEY"), nil)
-
-	// https://stripe.com/docs/api
-	// Create new customer in Stripe
-	params := &stripe.CustomerParams{
-		Email:    user.Data.Email,
-		Plan:     plan + "-trial",
-		Quantity: uint64(1),
-	}
-
-	customer, err := sc.Customers.New(params)
+func AddFreeTrialToUser(r *http.Request, user *models.UserPostgres, plan string) (int64, error) {
+	// Create new customer on the trial of the plan
+	customer, err := getProvider().CreateCustomer(user.Data.Email, plan+"-trial")
 	if err != nil {
 		log.Printf("%v", err)
 		return 0, err
 	}
 
-	_, billingId, err := user.SetStripeId(user, customer.ID, plan, true, true)
+	_, billingId, err := user.SetStripeId(*user, customer.Id, plan, true, true)
 	if err != nil {
 		log.Printf("%v", err)
 		return billingId, err
@@ -44,76 +26,36 @@ func AddFreeTrialToUser(r *http.Request, user models.UserPostgres, plan string)
 }
 
 func AddPlanToUser(r *http.Request, user models.UserPostgres, userBilling *models.BillingPostgres, plan string, duration string, coupon string, originalPlan string) error {
-	sc := &client.API{}
-	sc.Init(os.Getenv("STRIPE_SECRET_KEY"), nil)
-
-	customer, err := sc.Customers.Get(userBilling.Data.StripeId, nil)
+	err := CheckCouponDuration(coupon, duration)
 	if err != nil {
-		var stripeError StripeError
-		err = json.Unmarshal([]byte(err.Error()), &stripeError)
-		if err != nil {
-			log.Printf("%v", err)
-			return errors.New("We had an error getting your user")
-		}
+		return err
+	}
 
+	customer, err := getProvider().GetCustomer(userBilling.Data.StripeId)
+	if err != nil {
 		log.Printf("%v", err)
-		return errors.New(stripeError.Message)
+		return err
 	}
 
 	// Only considers plans currently that moving from trial. Not changing plans.
 	// Cancel all past subscriptions they had
-	for i := 0; i < len(customer.Subs.Values); i++ {
-		sc.Subs.Cancel(customer.Subs.Values[i].ID, nil)
+	for i := 0; i < len(customer.Subscriptions); i++ {
+		getProvider().CancelSubscription(customer.Subscriptions[i].Id, false)
 	}
 
 	// Start a new subscription without trial (they already went through the trial)
-	params := &stripe.SubParams{
-		Customer: customer.ID,
-		Plan:     plan,
-	}
-
-	if duration == "annually" {
-		params.Plan = plan + "-yearly"
-	}
-
-	if coupon != "" {
-		coupon = strings.ToUpper(coupon)
-		params.Coupon = coupon
-	}
-
-	if strings.ToLower(coupon) == "favorites" && duration == "annually" {
-		return errors.New("Sorry - you can't use this coupon code on a yearly plan. Please switch the monthly one to use this!")
-	}
-
-	if strings.ToLower(coupon) == "prcouture" && duration == "annually" {
-		return errors.New("Sorry - you can't use this coupon code on a yearly plan. Please switch the monthly one to use this!")
-	}
-
-	if strings.ToLower(coupon) == "curious" && duration == "annually" {
-		return errors.New("Sorry - you can't use this coupon code on a yearly plan. Please switch the monthly one to use this!")
-	}
-
-	if strings.ToLower(coupon) == "prconsultants" && duration == "annually" {
-		return errors.New("Sorry - you can't use this coupon code on a yearly plan. Please switch the monthly one to use this!")
-	}
-
-	newSub, err := sc.Subs.New(params)
+	newSub, err := getProvider().CreateSubscription(customer.Id, stripePlanId(plan, duration), coupon)
 	if err != nil {
-		var stripeError StripeError
-		err = json.Unmarshal([]byte(err.Error()), &stripeError)
-		if err != nil {
-			log.Printf("%v", err)
-			return errors.New("We had an error setting your subscription")
-		}
-
 		log.Printf("%v", err)
-		return errors.New(stripeError.Message)
+		return err
 	}
 
 	// Return if there are any errors
-	expiresAt := time.Unix(newSub.PeriodEnd, 0)
+	expiresAt := newSub.CurrentPeriodEnd
 	userBilling.Data.Expires = expiresAt
 	userBilling.Data.StripePlanId = plan
+	userBilling.Data.StripeSubscriptionId = newSub.Id
+	userBilling.Data.PendingStripePlanId = ""
 	userBilling.Data.IsOnTrial = false
 	userBilling.Save()
 
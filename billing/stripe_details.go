@@ -1,24 +1,17 @@
 package billing
 
 import (
-	"encoding/json"
 	"errors"
 	"log"
-	"os"
 	"strings"
-	"time"
-
-	"github.com/stripe/stripe-go"
-	"github.com/stripe/stripe-go/client"
 
 	"github.com/news-ai/api-v1/models"
 )
 
-type Card struct {
-	LastFour  string
-	IsDefault bool
-	Brand     stripe.CardBrand
-}
+// Coupons that can only be used on monthly plans
+var monthlyOnlyCoupons = []string{"FAVORITES", "PRCOUTURE", "CURIOUS", "PRCONSULTANTS"}
+
+var ErrMonthlyOnlyCoupon = errors.New("Sorry - you can't use this coupon code on a yearly plan. Please switch the monthly one to use this!")
 
 type StripeError struct {
 	Type    string `json:"type"`
@@ -32,52 +25,28 @@ type StripeBillingHistory struct {
 }
 
 func GetCustomerBalance(userBilling *models.BillingPostgres) (int64, error) {
-	sc := &client.API{}
-	sc.Init(os.Getenv("STRIPE_SECRET_KEY"), nil)
-
-	customer, err := sc.Customers.Get(userBilling.Data.StripeId, nil)
+	customer, err := getProvider().GetCustomer(userBilling.Data.StripeId)
 	if err != nil {
-		var stripeError StripeError
-		err = json.Unmarshal([]byte(err.Error()), &stripeError)
-		if err != nil {
-			return 0.0, errors.New("We had an error getting your user")
-		}
-
 		log.Printf("%v", err)
-		return 0.0, errors.New(stripeError.Message)
+		return 0.0, err
 	}
 
 	return customer.Balance, nil
 }
 
 func GetCustomerBillingHistory(userBilling *models.BillingPostgres) ([]StripeBillingHistory, error) {
-	sc := &client.API{}
-	sc.Init(os.Getenv("STRIPE_SECRET_KEY"), nil)
-
-	customer, err := sc.Customers.Get(userBilling.Data.StripeId, nil)
+	charges, err := getProvider().ListCharges(userBilling.Data.StripeId)
 	if err != nil {
-		var stripeError StripeError
-		err = json.Unmarshal([]byte(err.Error()), &stripeError)
-		if err != nil {
-			return []StripeBillingHistory{}, errors.New("We had an error getting your user")
-		}
-
 		log.Printf("%v", err)
-		return []StripeBillingHistory{}, errors.New(stripeError.Message)
+		return []StripeBillingHistory{}, err
 	}
 
-	params := &stripe.ChargeListParams{}
-	params.Customer = customer.ID
-	i := sc.Charges.List(params)
-
 	billingHistory := []StripeBillingHistory{}
 
-	for i.Next() {
-		singleCharge := i.Charge()
-
+	for _, singleCharge := range charges {
 		history := StripeBillingHistory{}
 		history.Amount = float64(float64(singleCharge.Amount) / float64(100))
-		history.Created = time.Unix(singleCharge.Created, 0).Format("2006-01-02")
+		history.Created = singleCharge.Created.Format("2006-01-02")
 		history.Paid = singleCharge.Paid
 
 		billingHistory = append(billingHistory, history)
@@ -86,90 +55,56 @@ func GetCustomerBillingHistory(userBilling *models.BillingPostgres) ([]StripeBil
 	return billingHistory, nil
 }
 
-func GetCoupon(coupon string) (uint64, error) {
-	sc := &client.API{}
-	sc.Init(os.Getenv("STRIPE_SECRET_KEY"), nil)
-	coupon = strings.ToUpper(coupon)
+// CheckCouponDuration returns ErrMonthlyOnlyCoupon if the coupon can't be
+// used on a plan billed for this duration.
+func CheckCouponDuration(coupon string, duration string) error {
+	if duration != "annually" {
+		return nil
+	}
 
-	stripeCoupon, err := sc.Coupons.Get(coupon, nil)
-	if err != nil {
-		var stripeError StripeError
-		err = json.Unmarshal([]byte(err.Error()), &stripeError)
-		if err != nil {
-			return uint64(0), errors.New("Your coupon was invalid")
+	coupon = strings.ToUpper(coupon)
+	for i := 0; i < len(monthlyOnlyCoupons); i++ {
+		if monthlyOnlyCoupons[i] == coupon {
+			return ErrMonthlyOnlyCoupon
 		}
+	}
+	return nil
+}
 
+func GetCoupon(coupon string) (uint64, error) {
+	found, err := getProvider().GetCoupon(strings.ToUpper(coupon))
+	if err != nil {
 		log.Printf("%v", err)
-		return uint64(0), errors.New(stripeError.Message)
+		return uint64(0), err
 	}
 
-	if stripeCoupon.Valid && stripeCoupon.Live {
-		return stripeCoupon.Percent, nil
+	if found.Valid {
+		return found.PercentOff, nil
 	}
 
 	return uint64(0), errors.New("Your coupon was invalid or has expired")
 }
 
 func GetUserCards(userBilling *models.BillingPostgres) ([]Card, error) {
-	sc := &client.API{}
-	sc.Init(os.Getenv("STRIPE_SECRET_KEY"), nil)
-
-	customer, err := sc.Customers.Get(userBilling.Data.StripeId, nil)
+	customer, err := getProvider().GetCustomer(userBilling.Data.StripeId)
 	if err != nil {
-		var stripeError StripeError
-		err = json.Unmarshal([]byte(err.Error()), &stripeError)
-		if err != nil {
-			return []Card{}, errors.New("We had an error getting your user")
-		}
-
 		log.Printf("%v", err)
-		return []Card{}, errors.New(stripeError.Message)
-	}
-
-	cards := []Card{}
-	for i := 0; i < len(customer.Sources.Values); i++ {
-		newCard := Card{}
-		newCard.IsDefault = customer.Sources.Values[i].Card.Default
-		newCard.LastFour = customer.Sources.Values[i].Card.LastFour
-		newCard.Brand = customer.Sources.Values[i].Card.Brand
-		cards = append(cards, newCard)
+		return []Card{}, err
 	}
 
-	return cards, nil
+	return customer.Cards, nil
 }
 
 func AddPaymentsToCustomer(userBilling *models.BillingPostgres, stripeToken string) error {
-	sc := &client.API{}
-	sc.Init(os.Getenv("STRIPE_SECRET_KEY"), nil)
-
-	params := &stripe.CustomerParams{}
-	params.SetSource(stripeToken)
-
-	_, err := sc.Customers.Update(
-		userBilling.Data.StripeId,
-		params,
-	)
-
-	if err != nil {
-		var stripeError StripeError
-		err = json.Unmarshal([]byte(err.Error()), &stripeError)
-		if err != nil {
-			return errors.New("We had an error getting your user")
-		}
-
-		log.Printf("%v", err)
-		return errors.New(stripeError.Message)
-	}
-
-	newCustomer, err := sc.Customers.Get(userBilling.Data.StripeId, nil)
+	customer, err := getProvider().AddCard(userBilling.Data.StripeId, stripeToken)
 	if err != nil {
 		log.Printf("%v", err)
 		return err
 	}
 
 	userBilling.Data.CardsOnFile = []string{}
-	for i := 0; i < len(newCustomer.Sources.Values); i++ {
-		userBilling.Data.CardsOnFile = append(userBilling.Data.CardsOnFile, newCustomer.Sources.Values[i].ID)
+	for i := 0; i < len(customer.Cards); i++ {
+		userBilling.Data.CardsOnFile = append(userBilling.Data.CardsOnFile, customer.Cards[i].Id)
 	}
 	userBilling.Save()
 
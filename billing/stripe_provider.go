@@ -0,0 +1,283 @@
+package billing
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/stripe/stripe-go"
+	"github.com/stripe/stripe-go/client"
+)
+
+// StripeProvider is the PaymentProvider that bills through Stripe.
+type StripeProvider struct {
+	SecretKey string
+}
+
+/*
+* Private methods
+ */
+
+func (p StripeProvider) client() *client.API {
+	sc := &client.API{}
+	sc.Init(p.SecretKey, nil)
+	return sc
+}
+
+// Stripe errors carry a message that can be shown to the user. Errors
+// without one get the fallback.
+func stripeError(err error, fallback string) error {
+	log.Printf("%v", err)
+
+	var stripeError StripeError
+	if json.Unmarshal([]byte(err.Error()), &stripeError) != nil || stripeError.Message == "" {
+		return errors.New(fallback)
+	}
+	return errors.New(stripeError.Message)
+}
+
+func stripeSubscription(sub *stripe.Sub) Subscription {
+	subscription := Subscription{
+		Id:                 sub.ID,
+		Status:             string(sub.Status),
+		CurrentPeriodStart: time.Unix(sub.PeriodStart, 0),
+		CurrentPeriodEnd:   time.Unix(sub.PeriodEnd, 0),
+		CancelAtPeriodEnd:  sub.EndCancel,
+	}
+	if sub.Customer != nil {
+		subscription.CustomerId = sub.Customer.ID
+	}
+	if sub.Plan != nil {
+		subscription.Plan = sub.Plan.ID
+	}
+	return subscription
+}
+
+func stripeCustomer(c *stripe.Customer) Customer {
+	customer := Customer{
+		Id:            c.ID,
+		Email:         c.Email,
+		Balance:       c.Balance,
+		Subscriptions: []Subscription{},
+		Cards:         []Card{},
+	}
+
+	if c.Subs != nil {
+		for i := 0; i < len(c.Subs.Values); i++ {
+			subscription := stripeSubscription(c.Subs.Values[i])
+			subscription.CustomerId = c.ID
+			customer.Subscriptions = append(customer.Subscriptions, subscription)
+		}
+	}
+
+	if c.Sources != nil {
+		for i := 0; i < len(c.Sources.Values); i++ {
+			source := c.Sources.Values[i]
+			if source.Card == nil {
+				continue
+			}
+			customer.Cards = append(customer.Cards, Card{
+				Id:        source.ID,
+				LastFour:  source.Card.LastFour,
+				IsDefault: source.Card.Default,
+				Brand:     string(source.Card.Brand),
+			})
+		}
+	}
+
+	return customer
+}
+
+/*
+* Public methods
+ */
+
+func (p StripeProvider) CreateCustomer(email string, plan string) (Customer, error) {
+	// https://stripe.com/docs/api
+	params := &stripe.CustomerParams{
+		Email:    email,
+		Plan:     plan,
+		Quantity: uint64(1),
+	}
+
+	customer, err := p.client().Customers.New(params)
+	if err != nil {
+		return Customer{}, stripeError(err, "We had an error creating your user")
+	}
+	return stripeCustomer(customer), nil
+}
+
+func (p StripeProvider) GetCustomer(customerId string) (Customer, error) {
+	customer, err := p.client().Customers.Get(customerId, nil)
+	if err != nil {
+		return Customer{}, stripeError(err, "We had an error getting your user")
+	}
+	return stripeCustomer(customer), nil
+}
+
+func (p StripeProvider) AddCard(customerId string, token string) (Customer, error) {
+	params := &stripe.CustomerParams{}
+	params.SetSource(token)
+
+	customer, err := p.client().Customers.Update(customerId, params)
+	if err != nil {
+		return Customer{}, stripeError(err, "We had an error getting your user")
+	}
+	return stripeCustomer(customer), nil
+}
+
+func (p StripeProvider) ListCharges(customerId string) ([]Charge, error) {
+	params := &stripe.ChargeListParams{}
+	params.Customer = customerId
+	i := p.client().Charges.List(params)
+
+	charges := []Charge{}
+	for i.Next() {
+		singleCharge := i.Charge()
+		charges = append(charges, Charge{
+			Id:      singleCharge.ID,
+			Amount:  int64(singleCharge.Amount),
+			Created: time.Unix(singleCharge.Created, 0),
+			Paid:    singleCharge.Paid,
+		})
+	}
+	if err := i.Err(); err != nil {
+		return []Charge{}, stripeError(err, "We had an error getting your billing history")
+	}
+
+	return charges, nil
+}
+
+func (p StripeProvider) CreateSubscription(customerId string, plan string, coupon string) (Subscription, error) {
+	params := &stripe.SubParams{
+		Customer: customerId,
+		Plan:     plan,
+	}
+	if coupon != "" {
+		params.Coupon = strings.ToUpper(coupon)
+	}
+
+	sub, err := p.client().Subs.New(params)
+	if err != nil {
+		return Subscription{}, stripeError(err, "We had an error setting your subscription")
+	}
+
+	subscription := stripeSubscription(sub)
+	subscription.CustomerId = customerId
+	return subscription, nil
+}
+
+func (p StripeProvider) CancelSubscription(subscriptionId string, atPeriodEnd bool) (Subscription, error) {
+	params := &stripe.SubParams{
+		EndCancel: atPeriodEnd,
+	}
+
+	sub, err := p.client().Subs.Cancel(subscriptionId, params)
+	if err != nil {
+		return Subscription{}, stripeError(err, "We had an error canceling your subscription")
+	}
+	return stripeSubscription(sub), nil
+}
+
+func (p StripeProvider) ChangeSubscription(subscriptionId string, plan string, prorationDate time.Time) (Subscription, error) {
+	sc := p.client()
+
+	current, err := sc.Subs.Get(subscriptionId, nil)
+	if err != nil {
+		return Subscription{}, stripeError(err, "We had an error getting your subscription")
+	}
+
+	params := &stripe.SubParams{
+		Plan:          plan,
+		ProrationDate: prorationDate.Unix(),
+	}
+
+	sub, err := sc.Subs.Update(subscriptionId, params)
+	if err != nil {
+		return Subscription{}, stripeError(err, "We had an error switching your plan")
+	}
+	subscription := stripeSubscription(sub)
+
+	// Stripe bills a new period right away when the interval changes.
+	// Otherwise the prorations wait for the next invoice, so they are
+	// invoiced now. The plan has changed by then either way: an invoice
+	// that can't be paid is retried by Stripe like any other.
+	if current.Plan != nil && isAnnualStripePlan(current.Plan.ID) == isAnnualStripePlan(plan) {
+		invoice, err := sc.Invoices.New(&stripe.InvoiceParams{
+			Customer: subscription.CustomerId,
+			Sub:      subscriptionId,
+		})
+		if err != nil {
+			log.Printf("%v", err)
+			return subscription, nil
+		}
+
+		_, err = sc.Invoices.Pay(invoice.ID, nil)
+		if err != nil {
+			log.Printf("%v", err)
+		}
+	}
+
+	return subscription, nil
+}
+
+func (p StripeProvider) ScheduleSubscriptionChange(subscriptionId string, plan string) (Subscription, error) {
+	params := &stripe.SubParams{
+		Plan:      plan,
+		NoProrate: true,
+	}
+
+	sub, err := p.client().Subs.Update(subscriptionId, params)
+	if err != nil {
+		return Subscription{}, stripeError(err, "We had an error switching your plan")
+	}
+	return stripeSubscription(sub), nil
+}
+
+func (p StripeProvider) PreviewSubscriptionChange(customerId string, subscriptionId string, plan string, at time.Time) (Invoice, error) {
+	invoiceParams := &stripe.InvoiceParams{
+		Customer:         customerId,
+		Sub:              subscriptionId,
+		SubPlan:          plan,
+		SubProrationDate: at.Unix(),
+	}
+
+	invoice, err := p.client().Invoices.GetNext(invoiceParams)
+	if err != nil {
+		return Invoice{}, stripeError(err, "We had an error previewing your new plan")
+	}
+
+	preview := Invoice{
+		CustomerId: customerId,
+		Lines:      []InvoiceLine{},
+	}
+	for _, invoiceItem := range invoice.Lines.Values {
+		line := InvoiceLine{
+			Amount:      invoiceItem.Amount,
+			Proration:   invoiceItem.Proration,
+			PeriodStart: time.Unix(invoiceItem.Period.Start, 0),
+			PeriodEnd:   time.Unix(invoiceItem.Period.End, 0),
+		}
+		if invoiceItem.Plan != nil {
+			line.Plan = invoiceItem.Plan.ID
+		}
+		preview.Lines = append(preview.Lines, line)
+	}
+
+	return preview, nil
+}
+
+func (p StripeProvider) GetCoupon(code string) (Coupon, error) {
+	stripeCoupon, err := p.client().Coupons.Get(strings.ToUpper(code), nil)
+	if err != nil {
+		return Coupon{}, stripeError(err, "Your coupon was invalid")
+	}
+
+	return Coupon{
+		Id:         stripeCoupon.ID,
+		PercentOff: stripeCoupon.Percent,
+		Valid:      stripeCoupon.Valid && stripeCoupon.Live,
+	}, nil
+}
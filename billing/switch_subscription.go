@@ -1,83 +1,244 @@
 package billing
 
 import (
-	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
-	"os"
+	"net/http"
 	"time"
 
-	"github.com/stripe/stripe-go"
-	"github.com/stripe/stripe-go/client"
-
 	"github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/repositories"
+
+	"github.com/news-ai/tabulae-v1/emails"
 )
 
-func SwitchUserPlanPreview(userBilling *models.BillingPostgres, duration, newPlan string) (int64, error) {
-	sc := &client.API{}
-	sc.Init(os.Getenv("STRIPE_SECRET_KEY"), nil)
+// planSwitch is a move of a billing profile's subscription from the Stripe
+// plan the user is on to another one.
+type planSwitch struct {
+	customer     Customer
+	subscription Subscription
+	from         string
+	to           string
+
+	// Upgrades and changes of duration happen right away, with proration.
+	// Downgrades wait for the end of the period that was paid for.
+	immediate bool
+}
+
+/*
+* Private methods
+ */
 
-	customer, err := sc.Customers.Get(userBilling.Data.StripeId, nil)
+func getPlanSwitch(userBilling *models.BillingPostgres, plan string, duration string) (planSwitch, error) {
+	if userBilling.Data.IsOnTrial {
+		return planSwitch{}, errors.New("Please choose a plan to end your trial first")
+	}
+
+	customer, err := getProvider().GetCustomer(userBilling.Data.StripeId)
 	if err != nil {
-		var stripeError StripeError
-		err = json.Unmarshal([]byte(err.Error()), &stripeError)
-		if err != nil {
-			log.Printf("%v", err)
-			return 0.0, errors.New("We had an error getting your user")
+		log.Printf("%v", err)
+		return planSwitch{}, err
+	}
+
+	found := false
+	subscription := Subscription{}
+	for i := 0; i < len(customer.Subscriptions); i++ {
+		if userBilling.Data.StripeSubscriptionId == "" || customer.Subscriptions[i].Id == userBilling.Data.StripeSubscriptionId {
+			subscription = customer.Subscriptions[i]
+			found = true
+			break
 		}
+	}
+	if !found {
+		return planSwitch{}, errors.New("You don't have a plan to switch from")
+	}
+
+	// A pending downgrade is already on the subscription, but the user is
+	// on the plan they paid for until the period ends.
+	from := subscription.Plan
+	if userBilling.Data.PendingStripePlanId != "" {
+		from = stripePlanId(userBilling.Data.StripePlanId, stripePlanDuration(subscription.Plan))
+	}
+	to := stripePlanId(plan, duration)
+
+	fromPrice := PlanAndDurationToPrice(StripePlanToPlanId(from), stripePlanDuration(from))
+	toPrice := PlanAndDurationToPrice(plan, duration)
+
+	return planSwitch{
+		customer:     customer,
+		subscription: subscription,
+		from:         from,
+		to:           to,
+		immediate:    stripePlanDuration(from) != duration || toPrice > fromPrice,
+	}, nil
+}
 
+// saveSwitch applies update to the billing profile and saves it. The
+// Stripe webhook saves the same row while a switch is under way, so on a
+// conflict the profile is read again and update applied to that.
+func saveSwitch(billings repositories.Billings, userBilling *models.BillingPostgres, update func(b *models.Billing)) error {
+	attempt := 0
+	return models.RetryOnConflict(3, func() error {
+		if attempt > 0 {
+			latest, err := billings.Get(userBilling.Id)
+			if err != nil {
+				return err
+			}
+			*userBilling = latest
+		}
+		attempt++
+
+		update(&userBilling.Data)
+		return billings.Save(userBilling)
+	})
+}
+
+// What switching costs today, in cents: the lines of the preview that
+// start at the proration date.
+func previewSwitchCost(change planSwitch, prorationDate time.Time) (int64, error) {
+	invoice, err := getProvider().PreviewSubscriptionChange(change.customer.Id, change.subscription.Id, change.to, prorationDate)
+	if err != nil {
 		log.Printf("%v", err)
-		return 0.0, errors.New(stripeError.Message)
+		return 0, err
 	}
 
-	if duration == "annually" {
-		newPlan = newPlan + "-yearly"
+	var cost int64 = 0
+	for _, invoiceItem := range invoice.Lines {
+		if invoiceItem.PeriodStart.Unix() == prorationDate.Unix() {
+			cost += invoiceItem.Amount
+		}
+	}
+	return cost, nil
+}
+
+/*
+* Public methods
+ */
+
+// SwitchUserPlanPreview returns what switching to the plan would cost
+// today, in cents, and whether the switch waits for the end of the
+// period. Those that wait cost nothing today.
+func SwitchUserPlanPreview(userBilling *models.BillingPostgres, duration, newPlan string) (int64, bool, error) {
+	change, err := getPlanSwitch(userBilling, newPlan, duration)
+	if err != nil {
+		return 0.0, false, err
+	}
+
+	if !change.immediate {
+		return 0.0, true, nil
 	}
 
-	if customer.Subs.Count > 0 {
-		prorationDate := time.Now().Unix()
+	cost, err := previewSwitchCost(change, time.Now())
+	if err != nil {
+		return 0.0, false, err
+	}
+	return cost, false, nil
+}
+
+// SwitchUserPlan moves the user's subscription to plan, billed for
+// duration. Upgrades and changes between monthly and annual billing start
+// right away and charge the prorated difference. Downgrades keep the user
+// on their plan until the period ends and are billed from the next one;
+// switching back to the current plan before then calls the downgrade off.
+// Whether the new plan fits what the user has is up to the caller, and the
+// billing profile is saved to billings.
+func SwitchUserPlan(r *http.Request, billings repositories.Billings, user models.UserPostgres, userBilling *models.BillingPostgres, plan string, duration string, originalPlan string) error {
+	change, err := getPlanSwitch(userBilling, plan, duration)
+	if err != nil {
+		return err
+	}
+
+	if change.to == change.from && userBilling.Data.PendingStripePlanId == "" {
+		return errors.New("You are already on this plan")
+	}
 
-		invoiceParams := &stripe.InvoiceParams{
-			Customer:         customer.ID,
-			Sub:              customer.Subs.Values[0].ID,
-			SubPlan:          newPlan,
-			SubProrationDate: prorationDate,
+	var paid int64 = 0
+	if change.immediate {
+		// The period was paid for on the plan the user is on, so a pending
+		// downgrade is called off before the change is prorated.
+		if change.subscription.Plan != change.from {
+			change.subscription, err = getProvider().ScheduleSubscriptionChange(change.subscription.Id, change.from)
+			if err != nil {
+				log.Printf("%v", err)
+				return err
+			}
+		}
+
+		prorationDate := time.Now()
+		paid, err = previewSwitchCost(change, prorationDate)
+		if err != nil {
+			return err
 		}
-		invoice, err := sc.Invoices.GetNext(invoiceParams)
 
+		subscription, err := getProvider().ChangeSubscription(change.subscription.Id, change.to, prorationDate)
 		if err != nil {
 			log.Printf("%v", err)
-			return 0.0, err
+			return err
 		}
 
-		var cost int64 = 0
-		for _, invoiceItem := range invoice.Lines.Values {
-			if invoiceItem.Period.Start == prorationDate {
-				cost += invoiceItem.Amount
+		err = saveSwitch(billings, userBilling, func(b *models.Billing) {
+			b.StripePlanId = plan
+			b.Expires = subscription.CurrentPeriodEnd
+			b.PendingStripePlanId = ""
+			b.StripeSubscriptionId = change.subscription.Id
+		})
+		if err != nil {
+			log.Printf("%v", err)
+			return err
+		}
+	} else {
+		pending := change.to
+		if change.to == change.from {
+			pending = ""
+		}
+
+		// The webhook for the scheduled change can arrive before Stripe
+		// answers, and it only leaves the user on their plan if it finds
+		// the downgrade pending. So it is saved first, and put back if
+		// Stripe turns it down.
+		previous := userBilling.Data.PendingStripePlanId
+		err = saveSwitch(billings, userBilling, func(b *models.Billing) {
+			b.PendingStripePlanId = pending
+			b.StripeSubscriptionId = change.subscription.Id
+		})
+		if err != nil {
+			log.Printf("%v", err)
+			return err
+		}
+
+		_, err = getProvider().ScheduleSubscriptionChange(change.subscription.Id, change.to)
+		if err != nil {
+			log.Printf("%v", err)
+			rollbackErr := saveSwitch(billings, userBilling, func(b *models.Billing) {
+				if b.PendingStripePlanId == pending {
+					b.PendingStripePlanId = previous
+				}
+			})
+			if rollbackErr != nil {
+				log.Printf("%v", rollbackErr)
 			}
+			return err
 		}
+	}
 
-		return cost, nil
+	if paid < 0 {
+		paid = 0
 	}
+	billAmount := "$" + fmt.Sprintf("%0.2f", PlanAndDurationToPrice(plan, duration))
+	paidAmount := "$" + fmt.Sprintf("%0.2f", float64(paid)/float64(100))
 
-	return 0.00, nil
-}
+	ExpiresAt := userBilling.Data.Expires.Format("2006-01-02")
 
-func SwitchUserPlan(userBilling *models.BillingPostgres, newPlan string) error {
-	sc := &client.API{}
-	sc.Init(os.Getenv("STRIPE_SECRET_KEY"), nil)
+	emailDuration := "a monthly"
+	if duration == "annually" {
+		emailDuration = "an annual"
+	}
 
-	_, err := sc.Customers.Get(userBilling.Data.StripeId, nil)
+	// Email confirmation
+	err = emails.AddUserToTabulaePremiumList(user.Data, originalPlan, emailDuration, ExpiresAt, billAmount, paidAmount)
 	if err != nil {
-		var stripeError StripeError
-		err = json.Unmarshal([]byte(err.Error()), &stripeError)
-		if err != nil {
-			log.Printf("%v", err)
-			return errors.New("We had an error getting your user")
-		}
-
 		log.Printf("%v", err)
-		return errors.New(stripeError.Message)
 	}
 
 	return nil
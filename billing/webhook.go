@@ -0,0 +1,221 @@
+package billing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stripe event types the webhook acts on
+const (
+	StripeInvoicePaid          = "invoice.paid"
+	StripeInvoicePaymentFailed = "invoice.payment_failed"
+	StripeSubscriptionUpdated  = "customer.subscription.updated"
+	StripeSubscriptionDeleted  = "customer.subscription.deleted"
+	StripeChargeRefunded       = "charge.refunded"
+)
+
+// Signatures older than this are refused, so a captured request can't be
+// replayed later.
+const webhookTolerance = 5 * time.Minute
+
+var ErrInvalidSignature = errors.New("Invalid Stripe signature")
+
+// StripeEvent is the envelope of every webhook call. Object is decoded
+// into one of the types below depending on Type.
+type StripeEvent struct {
+	Id      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+
+	Data struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+type StripePlan struct {
+	Id string `json:"id"`
+}
+
+type StripeInvoice struct {
+	Id                 string `json:"id"`
+	Customer           string `json:"customer"`
+	Subscription       string `json:"subscription"`
+	Paid               bool   `json:"paid"`
+	AttemptCount       int    `json:"attempt_count"`
+	NextPaymentAttempt *int64 `json:"next_payment_attempt"`
+
+	Lines struct {
+		Data []struct {
+			Plan   *StripePlan `json:"plan"`
+			Period struct {
+				Start int64 `json:"start"`
+				End   int64 `json:"end"`
+			} `json:"period"`
+		} `json:"data"`
+	} `json:"lines"`
+}
+
+type StripeSubscription struct {
+	Id                string      `json:"id"`
+	Customer          string      `json:"customer"`
+	Status            string      `json:"status"`
+	CurrentPeriodEnd  int64       `json:"current_period_end"`
+	CancelAtPeriodEnd bool        `json:"cancel_at_period_end"`
+	EndedAt           int64       `json:"ended_at"`
+	Plan              *StripePlan `json:"plan"`
+}
+
+type StripeCharge struct {
+	Id             string `json:"id"`
+	Customer       string `json:"customer"`
+	Invoice        string `json:"invoice"`
+	Amount         int64  `json:"amount"`
+	AmountRefunded int64  `json:"amount_refunded"`
+	Refunded       bool   `json:"refunded"`
+}
+
+/*
+* Private methods
+ */
+
+func signPayload(secret string, timestamp string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+/*
+* Public methods
+ */
+
+// VerifyWebhookSignature checks the Stripe-Signature header of a webhook
+// call against STRIPE_WEBHOOK_SECRET. The header holds a timestamp and one
+// or more v1 signatures of "<timestamp>.<payload>"; any of them may match
+// while Stripe rolls the secret.
+func VerifyWebhookSignature(payload []byte, header string, now time.Time) error {
+	secret := os.Getenv("STRIPE_WEBHOOK_SECRET")
+	if secret == "" {
+		return errors.New("STRIPE_WEBHOOK_SECRET is not set")
+	}
+
+	timestamp := ""
+	signatures := [][]byte{}
+	for _, part := range strings.Split(header, ",") {
+		pair := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(pair) != 2 {
+			continue
+		}
+		switch pair[0] {
+		case "t":
+			timestamp = pair[1]
+		case "v1":
+			signature, err := hex.DecodeString(pair[1])
+			if err == nil {
+				signatures = append(signatures, signature)
+			}
+		}
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	signedAt := time.Unix(seconds, 0)
+	if now.Sub(signedAt) > webhookTolerance || signedAt.Sub(now) > webhookTolerance {
+		return ErrInvalidSignature
+	}
+
+	expected := signPayload(secret, timestamp, payload)
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// ParseWebhookEvent verifies the signature of a webhook call and decodes
+// its envelope.
+func ParseWebhookEvent(payload []byte, header string) (StripeEvent, error) {
+	err := VerifyWebhookSignature(payload, header, time.Now())
+	if err != nil {
+		return StripeEvent{}, err
+	}
+
+	var event StripeEvent
+	err = json.Unmarshal(payload, &event)
+	if err != nil {
+		return StripeEvent{}, err
+	}
+
+	if event.Id == "" || event.Type == "" {
+		return StripeEvent{}, errors.New("Stripe event is missing its id or type")
+	}
+	return event, nil
+}
+
+// StripePlanToPlanId turns the id of a Stripe plan, like
+// "business-yearly" or "free-trial", into the plan id billing profiles
+// store.
+func StripePlanToPlanId(stripePlan string) string {
+	planId := strings.TrimSuffix(strings.TrimSuffix(stripePlan, "-yearly"), "-trial")
+	plan, err := LookupPlan(planId)
+	if err != nil {
+		return planId
+	}
+	return plan.StripeId
+}
+
+func IsTrialStripePlan(stripePlan string) bool {
+	return strings.HasSuffix(stripePlan, "-trial")
+}
+
+// PeriodEnd is the end of the latest period the invoice pays for.
+func (i *StripeInvoice) PeriodEnd() time.Time {
+	end := int64(0)
+	for _, line := range i.Lines.Data {
+		if line.Period.End > end {
+			end = line.Period.End
+		}
+	}
+	if end == 0 {
+		return time.Time{}
+	}
+	return time.Unix(end, 0)
+}
+
+// StripePlanId is the Stripe plan of the invoice's subscription, or "" if
+// no line is for a plan.
+func (i *StripeInvoice) StripePlanId() string {
+	for _, line := range i.Lines.Data {
+		if line.Plan != nil && line.Plan.Id != "" {
+			return line.Plan.Id
+		}
+	}
+	return ""
+}
+
+// IsFinalFailure tells whether Stripe has stopped retrying the payment.
+func (i *StripeInvoice) IsFinalFailure() bool {
+	return i.NextPaymentAttempt == nil
+}
+
+// IsLive tells whether the subscription still gives access. Stripe keeps
+// retrying payments while it is past due.
+func (s *StripeSubscription) IsLive() bool {
+	return s.Status == "active" || s.Status == "trialing" || s.Status == "past_due"
+}
+
+func (c *StripeCharge) IsFullyRefunded() bool {
+	return c.Refunded || (c.Amount > 0 && c.AmountRefunded >= c.Amount)
+}
@@ -0,0 +1,95 @@
+package billing
+
+import (
+	"encoding/hex"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var testPayload = []byte(`{"id":"evt_1","type":"invoice.paid","created":1488326400,"data":{"object":{"id":"in_1"}}}`)
+
+func signature(secret string, signedAt time.Time, payload []byte) string {
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	return "v1=" + hex.EncodeToString(signPayload(secret, timestamp, payload))
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	os.Setenv("STRIPE_WEBHOOK_SECRET", "whsec_new")
+	defer os.Unsetenv("STRIPE_WEBHOOK_SECRET")
+
+	now := time.Unix(1488326400, 0)
+	at := func(signedAt time.Time) string {
+		return "t=" + strconv.FormatInt(signedAt.Unix(), 10)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		valid  bool
+	}{
+		{"signed", at(now) + "," + signature("whsec_new", now, testPayload), true},
+		{"with spaces", at(now) + ", " + signature("whsec_new", now, testPayload), true},
+		{"signed a little ago", at(now.Add(-4*time.Minute)) + "," + signature("whsec_new", now.Add(-4*time.Minute), testPayload), true},
+		// While Stripe rolls the secret the header holds one signature for each
+		{"old secret first", at(now) + "," + signature("whsec_old", now, testPayload) + "," + signature("whsec_new", now, testPayload), true},
+		{"old secret last", at(now) + "," + signature("whsec_new", now, testPayload) + "," + signature("whsec_old", now, testPayload), true},
+		{"only the old secret", at(now) + "," + signature("whsec_old", now, testPayload), false},
+		{"other secret", at(now) + "," + signature("whsec_other", now, testPayload), false},
+		{"other payload", at(now) + "," + signature("whsec_new", now, []byte(`{"id":"evt_2"}`)), false},
+		{"timestamp changed", at(now.Add(time.Second)) + "," + signature("whsec_new", now, testPayload), false},
+		{"expired", at(now.Add(-6*time.Minute)) + "," + signature("whsec_new", now.Add(-6*time.Minute), testPayload), false},
+		{"from the future", at(now.Add(6*time.Minute)) + "," + signature("whsec_new", now.Add(6*time.Minute), testPayload), false},
+		{"v0 signature", at(now) + ",v0=" + signature("whsec_new", now, testPayload)[3:], false},
+		{"not hex", at(now) + ",v1=zz", false},
+		{"no timestamp", signature("whsec_new", now, testPayload), false},
+		{"no signature", at(now), false},
+		{"empty", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := VerifyWebhookSignature(testPayload, test.header, now)
+			if test.valid && err != nil {
+				t.Errorf("VerifyWebhookSignature = %v, want it valid", err)
+			}
+			if !test.valid && err != ErrInvalidSignature {
+				t.Errorf("VerifyWebhookSignature = %v, want %v", err, ErrInvalidSignature)
+			}
+		})
+	}
+}
+
+func TestVerifyWebhookSignatureWithoutSecret(t *testing.T) {
+	os.Unsetenv("STRIPE_WEBHOOK_SECRET")
+
+	now := time.Now()
+	header := "t=" + strconv.FormatInt(now.Unix(), 10) + "," + signature("", now, testPayload)
+	if err := VerifyWebhookSignature(testPayload, header, now); err == nil {
+		t.Error("VerifyWebhookSignature without STRIPE_WEBHOOK_SECRET succeeded")
+	}
+}
+
+func TestParseWebhookEvent(t *testing.T) {
+	os.Setenv("STRIPE_WEBHOOK_SECRET", "whsec_new")
+	defer os.Unsetenv("STRIPE_WEBHOOK_SECRET")
+
+	now := time.Now()
+	sign := func(payload []byte) string {
+		return "t=" + strconv.FormatInt(now.Unix(), 10) + "," + signature("whsec_new", now, payload)
+	}
+
+	event, err := ParseWebhookEvent(testPayload, sign(testPayload))
+	if err != nil {
+		t.Fatalf("ParseWebhookEvent: %v", err)
+	}
+	if event.Id != "evt_1" || event.Type != StripeInvoicePaid || event.Created != 1488326400 || string(event.Data.Object) != `{"id":"in_1"}` {
+		t.Errorf("ParseWebhookEvent = %+v", event)
+	}
+
+	for _, payload := range [][]byte{[]byte(`{"type":"invoice.paid"}`), []byte(`{"id":"evt_1"}`), []byte(`not json`)} {
+		if _, err := ParseWebhookEvent(payload, sign(payload)); err == nil {
+			t.Errorf("ParseWebhookEvent(%s) succeeded", payload)
+		}
+	}
+}
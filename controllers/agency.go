@@ -8,9 +8,9 @@ import (
 
 	// gcontext "github.com/gorilla/context"
 
+	"github.com/news-ai/web/permissions"
 	"github.com/news-ai/web/utilities"
 
-	"github.com/news-ai/api-v1/db"
 	"github.com/news-ai/api-v1/models"
 	// "github.com/news-ai/tabulae-v1/search"
 )
@@ -24,14 +24,13 @@ import (
  */
 
 func getAgency(id int64) (models.Agency, error) {
-	agency := models.Agency{}
-	err := db.DB.Model(&agency).Where("id = ?", id).Select()
+	agency, err := getStore().Agencies.Get(id)
 	if err != nil {
 		log.Printf("%v", err)
 		return models.Agency{}, err
 	}
 
-	if !agency.Created.IsZero() {
+	if !agency.Created.IsZero() && !agency.IsDeleted() {
 		agency.Type = "agencies"
 		return agency, nil
 	}
@@ -43,9 +42,8 @@ func getAgency(id int64) (models.Agency, error) {
 * Filter methods
  */
 
-func filterAgency(queryType, query string) (models.Agency, error) {
-	agency := models.Agency{}
-	err := db.DB.Model(&agency).Where(queryType+" = ?", query).Select()
+func filterAgencyByEmail(email string) (models.Agency, error) {
+	agency, err := getStore().Agencies.FindByEmail(email)
 	if err != nil {
 		log.Printf("%v", err)
 		return models.Agency{}, err
@@ -56,7 +54,12 @@ func filterAgency(queryType, query string) (models.Agency, error) {
 		return agency, nil
 	}
 
-	return models.Agency{}, errors.New("No agency by this " + queryType)
+	return models.Agency{}, errors.New("No agency by this Email")
+}
+
+// Agencies can be deleted by whoever created them
+func canManageAgency(currentUser models.UserPostgres, agency models.Agency) bool {
+	return currentUser.Data.IsAdmin || permissions.AccessToObject(agency.CreatedBy, currentUser.Id)
 }
 
 /*
@@ -157,11 +160,13 @@ func CreateAgencyFromUser(r *http.Request, u *models.UserPostgres) (models.Agenc
 			return agency, err
 		}
 
-		agency.Create(r, currentUser)
+		agency.CreatedBy = currentUser.Id
+		getStore().Agencies.Create(&agency)
 	}
 
 	u.Data.Employers = append(u.Data.Employers, agency.Id)
-	u.Save()
+	u.Data.Updated = time.Now()
+	getStore().Users.Save(u)
 	return agency, nil
 }
 
@@ -171,7 +176,7 @@ func CreateAgencyFromUser(r *http.Request, u *models.UserPostgres) (models.Agenc
 
 func FilterAgencyByEmail(email string) (models.Agency, error) {
 	// Get the id of the current agency
-	agency, err := filterAgency("Email", email)
+	agency, err := filterAgencyByEmail(email)
 	if err != nil {
 		log.Printf("%v", err)
 		return models.Agency{}, err
@@ -179,3 +184,82 @@ func FilterAgencyByEmail(email string) (models.Agency, error) {
 
 	return agency, nil
 }
+
+/*
+* Delete methods
+ */
+
+func DeleteAgency(r *http.Request, id string) (models.Agency, interface{}, error) {
+	currentUser, err := GetCurrentUser(r)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Agency{}, nil, err
+	}
+
+	currentId, err := utilities.StringIdToInt(id)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Agency{}, nil, err
+	}
+
+	agency, err := getAgency(currentId)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Agency{}, nil, err
+	}
+
+	if !canManageAgency(currentUser, agency) {
+		return models.Agency{}, nil, errors.New("Forbidden")
+	}
+
+	before := agency
+	agency.SoftDelete()
+	err = getStore().Agencies.Save(&agency)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Agency{}, nil, err
+	}
+
+	recordAudit(r, models.AuditAgencyDelete, "agencies", agency.Id, before, agency)
+	return agency, nil, nil
+}
+
+/*
+* Action methods
+ */
+
+func RestoreAgency(r *http.Request, id string) (models.Agency, interface{}, error) {
+	_, err := getCurrentAdmin(r)
+	if err != nil {
+		return models.Agency{}, nil, err
+	}
+
+	currentId, err := utilities.StringIdToInt(id)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Agency{}, nil, err
+	}
+
+	// getAgency hides deleted agencies, so go to the store directly
+	agency, err := getStore().Agencies.Get(currentId)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Agency{}, nil, err
+	}
+
+	if !agency.IsDeleted() {
+		return models.Agency{}, nil, errors.New("Agency is not deleted")
+	}
+
+	before := agency
+	agency.Restore()
+	err = getStore().Agencies.Save(&agency)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Agency{}, nil, err
+	}
+
+	recordAudit(r, models.AuditAgencyRestore, "agencies", agency.Id, before, agency)
+	agency.Type = "agencies"
+	return agency, nil, nil
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pquerna/ffjson/ffjson"
+
+	"github.com/news-ai/api-v1/models"
+
+	"github.com/news-ai/web/utilities"
+)
+
+var ErrInvalidApiKey = errors.New("Invalid API key")
+
+type apiKeyRequest struct {
+	Name    string    `json:"name"`
+	Scopes  []string  `json:"scopes"`
+	Expires time.Time `json:"expires"`
+}
+
+/*
+* Public methods
+ */
+
+/*
+* Get methods
+ */
+
+// GetUserByApiKey resolves the user behind a key sent with basic auth,
+// and the key with its scopes. Keys from before api_keys were moved there
+// by a migration, with every scope.
+func GetUserByApiKey(apiKey string) (models.UserPostgres, *models.ApiKey, error) {
+	key, err := getStore().ApiKeys.FindByHash(models.HashApiKey(apiKey))
+	if err != nil || !key.Usable() {
+		return models.UserPostgres{}, nil, ErrInvalidApiKey
+	}
+
+	user, err := getStore().Users.Get(key.UserId)
+	if err != nil || user.Data.IsDeleted() {
+		return models.UserPostgres{}, nil, ErrInvalidApiKey
+	}
+
+	err = getStore().ApiKeys.TouchLastUsed(key.Id, time.Now())
+	if err != nil {
+		log.Printf("%v", err)
+	}
+
+	user.Data.Type = "users"
+	user.Data.Id = user.Id
+	return user, &key, nil
+}
+
+func GetApiKeys(r *http.Request, id string) ([]models.ApiKey, interface{}, int, int, error) {
+	user, err := getOwnUser(r, id)
+	if err != nil {
+		return []models.ApiKey{}, nil, 0, 0, err
+	}
+
+	keys, err := getStore().ApiKeys.ListByUser(user.Id)
+	if err != nil {
+		log.Printf("%v", err)
+		return []models.ApiKey{}, nil, 0, 0, err
+	}
+
+	for i := 0; i < len(keys); i++ {
+		keys[i].Type = "apikeys"
+	}
+
+	return keys, nil, len(keys), 0, nil
+}
+
+/*
+* Create methods
+ */
+
+// CreateApiKey is the only time the key itself is returned.
+func CreateApiKey(r *http.Request, id string) (models.ApiKeyCreated, interface{}, error) {
+	user, err := getOwnUser(r, id)
+	if err != nil {
+		return models.ApiKeyCreated{}, nil, err
+	}
+
+	buf, _ := ioutil.ReadAll(r.Body)
+	decoder := ffjson.NewDecoder()
+	var request apiKeyRequest
+	err = decoder.Decode(buf, &request)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.ApiKeyCreated{}, nil, err
+	}
+
+	if request.Name == "" {
+		return models.ApiKeyCreated{}, nil, errors.New("API key needs a name")
+	}
+
+	if len(request.Scopes) == 0 {
+		return models.ApiKeyCreated{}, nil, errors.New("API key needs at least one scope")
+	}
+
+	for i := 0; i < len(request.Scopes); i++ {
+		if !models.ValidApiKeyScope(request.Scopes[i]) {
+			return models.ApiKeyCreated{}, nil, errors.New("Invalid scope " + request.Scopes[i])
+		}
+	}
+
+	if !request.Expires.IsZero() && request.Expires.Before(time.Now()) {
+		return models.ApiKeyCreated{}, nil, errors.New("Expiry is in the past")
+	}
+
+	secret, hash, err := models.NewApiKeySecret()
+	if err != nil {
+		log.Printf("%v", err)
+		return models.ApiKeyCreated{}, nil, err
+	}
+
+	key := models.ApiKey{}
+	key.CreatedBy = user.Id
+	key.Created = time.Now()
+	key.Updated = key.Created
+	key.UserId = user.Id
+	key.Name = request.Name
+	key.Prefix = secret[:12]
+	key.KeyHash = hash
+	key.Scopes = request.Scopes
+	key.Expires = request.Expires
+
+	err = getStore().ApiKeys.Create(&key)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.ApiKeyCreated{}, nil, err
+	}
+
+	recordAudit(r, models.AuditApiKeyCreate, "apikeys", key.Id, nil, key)
+
+	key.Type = "apikeys"
+	return models.ApiKeyCreated{ApiKey: key, Key: secret}, nil, nil
+}
+
+/*
+* Delete methods
+ */
+
+func RevokeApiKey(r *http.Request, id string, keyId string) (models.ApiKey, interface{}, error) {
+	user, err := getOwnUser(r, id)
+	if err != nil {
+		return models.ApiKey{}, nil, err
+	}
+
+	currentId, err := utilities.StringIdToInt(keyId)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.ApiKey{}, nil, err
+	}
+
+	key, err := getStore().ApiKeys.Get(currentId)
+	if err != nil || key.UserId != user.Id {
+		return models.ApiKey{}, nil, errors.New("No API key by this id")
+	}
+
+	if key.Revoked != nil {
+		return models.ApiKey{}, nil, errors.New("API key is already revoked")
+	}
+
+	before := key
+	err = getStore().ApiKeys.Revoke(&key)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.ApiKey{}, nil, err
+	}
+
+	recordAudit(r, models.AuditApiKeyRevoke, "apikeys", key.Id, before, key)
+
+	key.Type = "apikeys"
+	return key, nil, nil
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	gcontext "github.com/gorilla/context"
+
+	"github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/repositories"
+
+	"github.com/news-ai/web/utilities"
+)
+
+/*
+* Private methods
+ */
+
+// Writes an audit event for the current request. A failure is logged and
+// does not undo the action, which has already been saved by now.
+func recordAudit(r *http.Request, action string, targetType string, targetId int64, before, after interface{}) {
+	actorId := int64(0)
+	currentUser, err := GetCurrentUser(r)
+	if err == nil {
+		actorId = currentUser.Id
+	}
+
+	recordAuditAs(r, actorId, action, targetType, targetId, before, after)
+}
+
+// Same as recordAudit, for when the actor is not the current user
+func recordAuditAs(r *http.Request, actorId int64, action string, targetType string, targetId int64, before, after interface{}) {
+	event := models.NewAuditEvent(r, actorId, action, targetType, targetId, before, after)
+	event.ImpersonatorId = GetImpersonatorId(r)
+	err := getStore().AuditEvents.Create(&event)
+	if err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+/*
+* Public methods
+ */
+
+/*
+* Get methods
+ */
+
+func GetAuditEvents(r *http.Request) ([]models.AuditEvent, interface{}, int, int, error) {
+	currentUser, err := GetCurrentUser(r)
+	if err != nil {
+		log.Printf("%v", err)
+		return []models.AuditEvent{}, nil, 0, 0, err
+	}
+
+	if !currentUser.Data.IsAdmin {
+		return []models.AuditEvent{}, nil, 0, 0, errors.New("Forbidden")
+	}
+
+	query := r.URL.Query()
+	filter := repositories.AuditFilter{
+		TargetType: query.Get("targettype"),
+		Action:     query.Get("action"),
+	}
+
+	if query.Get("actor") != "" {
+		filter.ActorId, err = utilities.StringIdToInt(query.Get("actor"))
+		if err != nil {
+			return []models.AuditEvent{}, nil, 0, 0, errors.New("Invalid value for actor")
+		}
+	}
+
+	if query.Get("impersonator") != "" {
+		filter.ImpersonatorId, err = utilities.StringIdToInt(query.Get("impersonator"))
+		if err != nil {
+			return []models.AuditEvent{}, nil, 0, 0, errors.New("Invalid value for impersonator")
+		}
+	}
+
+	if query.Get("target") != "" {
+		filter.TargetId, err = utilities.StringIdToInt(query.Get("target"))
+		if err != nil {
+			return []models.AuditEvent{}, nil, 0, 0, errors.New("Invalid value for target")
+		}
+	}
+
+	if offset, ok := gcontext.GetOk(r, "offset"); ok {
+		filter.Offset = offset.(int)
+	}
+	if limit, ok := gcontext.GetOk(r, "limit"); ok {
+		filter.Limit = limit.(int)
+	}
+
+	events, err := getStore().AuditEvents.Find(filter)
+	if err != nil {
+		log.Printf("%v", err)
+		return []models.AuditEvent{}, nil, 0, 0, err
+	}
+
+	for i := 0; i < len(events); i++ {
+		events[i].Type = "audit"
+	}
+
+	return events, nil, len(events), 0, nil
+}
@@ -1,7 +1,13 @@
 package controllers
 
 import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
 	"strings"
+
+	"github.com/news-ai/api-v1/models"
 )
 
 // At some point automate this
@@ -56,3 +62,34 @@ func normalizeOrderQuery(order string) string {
 func ConstructQuery() {
 
 }
+
+// Restoring deleted records is only open to admins
+func getCurrentAdmin(r *http.Request) (models.UserPostgres, error) {
+	currentUser, err := GetCurrentUser(r)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.UserPostgres{}, err
+	}
+
+	if !currentUser.Data.IsAdmin {
+		return models.UserPostgres{}, errors.New("Forbidden")
+	}
+
+	return currentUser, nil
+}
+
+// API keys and two-factor settings can only be managed by the user they
+// belong to, so id has to be "me" or the current user's own id.
+func getOwnUser(r *http.Request, id string) (models.UserPostgres, error) {
+	currentUser, err := GetCurrentUser(r)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.UserPostgres{}, err
+	}
+
+	if id != "me" && id != strconv.FormatInt(currentUser.Id, 10) {
+		return models.UserPostgres{}, errors.New("Forbidden")
+	}
+
+	return currentUser, nil
+}
@@ -5,7 +5,7 @@ import (
 	"log"
 	"net/http"
 
-	"github.com/news-ai/api-v1/db"
+	"github.com/news-ai/api-v1/billing"
 	"github.com/news-ai/api-v1/models"
 )
 
@@ -14,8 +14,7 @@ func GetUserBilling(r *http.Request, userPostgres models.UserPostgres) (models.B
 		return models.BillingPostgres{}, errors.New("No billing for this user")
 	}
 
-	billingPostgres := models.BillingPostgres{}
-	err := db.DB.Model(&billingPostgres).Where("id = ?", userPostgres.Data.BillingId).Select()
+	billingPostgres, err := getStore().Billings.Get(userPostgres.Data.BillingId)
 	if err != nil {
 		log.Printf("%v", err)
 		return models.BillingPostgres{}, err
@@ -26,3 +25,60 @@ func GetUserBilling(r *http.Request, userPostgres models.UserPostgres) (models.B
 
 	return billingPostgres, nil
 }
+
+// Cancels the Stripe subscription of a user. They stay active until the
+// billing period runs out.
+func CancelPlanOfUser(r *http.Request, userPostgres models.UserPostgres) (models.BillingPostgres, error) {
+	userBilling, err := GetUserBilling(r, userPostgres)
+	if err != nil {
+		return models.BillingPostgres{}, err
+	}
+
+	before := userBilling.Data
+	err = billing.CancelPlanOfUser(&userBilling)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.BillingPostgres{}, err
+	}
+
+	recordAudit(r, models.AuditBillingCancel, "users", userPostgres.Id, before, userBilling.Data)
+	return userBilling, nil
+}
+
+// Switches the subscription of a user to another plan of the catalog, as
+// long as they don't have more than it allows.
+func SwitchPlanOfUser(r *http.Request, userPostgres models.UserPostgres, plan string, duration string) (models.BillingPostgres, error) {
+	if duration != "monthly" && duration != "annually" {
+		return models.BillingPostgres{}, errors.New("Duration is invalid")
+	}
+
+	catalogPlan, err := billing.LookupPlan(plan)
+	if err != nil || !catalogPlan.Active {
+		return models.BillingPostgres{}, errors.New("Plan is invalid")
+	}
+
+	userBilling, err := GetUserBilling(r, userPostgres)
+	if err != nil {
+		return models.BillingPostgres{}, err
+	}
+
+	if len(userBilling.Data.CardsOnFile) == 0 {
+		return models.BillingPostgres{}, errors.New("This user has no cards on file")
+	}
+
+	err = checkPlanUsage(userPostgres, catalogPlan)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.BillingPostgres{}, err
+	}
+
+	before := userBilling.Data
+	err = billing.SwitchUserPlan(r, getStore().Billings, userPostgres, &userBilling, catalogPlan.StripeId, duration, catalogPlan.Name)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.BillingPostgres{}, err
+	}
+
+	recordAudit(r, models.AuditBillingSwitchPlan, "users", userPostgres.Id, before, userBilling.Data)
+	return userBilling, nil
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/news-ai/api-v1/billing"
+	"github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/repositories"
+)
+
+// A provider that can't schedule changes, like Stripe when it is down
+type failingScheduleProvider struct {
+	*billing.FakeProvider
+}
+
+func (p failingScheduleProvider) ScheduleSubscriptionChange(subscriptionId string, plan string) (billing.Subscription, error) {
+	return billing.Subscription{}, errors.New("Stripe is unavailable")
+}
+
+type switchTest struct {
+	t        *testing.T
+	s        repositories.Store
+	p        *billing.FakeProvider
+	user     models.UserPostgres
+	billing  models.BillingPostgres
+	customer string
+	period   billing.Subscription
+}
+
+// A user on Consultant, billed monthly, with its first month paid for.
+func newSwitchTest(t *testing.T) *switchTest {
+	s := newWebhookTestStore()
+	p := billing.NewFakeProvider(s.Plans)
+	billing.SetPaymentProvider(p)
+
+	customer, err := p.CreateCustomer("jane@example.com", "personal-trial")
+	if err != nil {
+		t.Fatalf("CreateCustomer: %v", err)
+	}
+	_, err = p.CancelSubscription(customer.Subscriptions[0].Id, false)
+	if err != nil {
+		t.Fatalf("CancelSubscription: %v", err)
+	}
+	_, err = p.AddCard(customer.Id, "tok_visa")
+	if err != nil {
+		t.Fatalf("AddCard: %v", err)
+	}
+	subscription, err := p.CreateSubscription(customer.Id, "consultant", "")
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+
+	user := models.UserPostgres{Data: models.User{Email: "jane@example.com", IsActive: true}}
+	s.Users.Create(&user)
+	userBilling := models.BillingPostgres{Data: models.Billing{
+		StripeId:             customer.Id,
+		StripePlanId:         "consultant",
+		StripeSubscriptionId: subscription.Id,
+		Expires:              subscription.CurrentPeriodEnd,
+		CardsOnFile:          []string{"Visa"},
+	}}
+	userBilling.Data.CreatedBy = user.Id
+	s.Billings.Create(&userBilling)
+
+	return &switchTest{t: t, s: s, p: p, user: user, billing: userBilling, customer: customer.Id, period: subscription}
+}
+
+func (st *switchTest) switchTo(plan string) error {
+	r, _ := http.NewRequest("POST", "/api/billing/plan", nil)
+	return billing.SwitchUserPlan(r, st.s.Billings, st.user, &st.billing, plan, "monthly", plan)
+}
+
+// The billing as saved, and the plan of the subscription
+func (st *switchTest) saved() (models.Billing, string) {
+	userBilling, err := st.s.Billings.Get(st.billing.Id)
+	if err != nil {
+		st.t.Fatalf("Billings.Get: %v", err)
+	}
+	customer, err := st.p.GetCustomer(st.customer)
+	if err != nil {
+		st.t.Fatalf("GetCustomer: %v", err)
+	}
+	for _, subscription := range customer.Subscriptions {
+		if subscription.Id == st.period.Id {
+			return userBilling.Data, subscription.Plan
+		}
+	}
+	st.t.Fatalf("subscription %s is gone", st.period.Id)
+	return models.Billing{}, ""
+}
+
+// Charges, newest first
+func (st *switchTest) charges() []int64 {
+	charges, err := st.p.ListCharges(st.customer)
+	if err != nil {
+		st.t.Fatalf("ListCharges: %v", err)
+	}
+	amounts := []int64{}
+	for _, charge := range charges {
+		amounts = append(amounts, charge.Amount)
+	}
+	return amounts
+}
+
+func TestSwitchUserPlanUpgrade(t *testing.T) {
+	st := newSwitchTest(t)
+	defer func() { store = nil }()
+	defer billing.SetPaymentProvider(nil)
+
+	if err := st.switchTo("business"); err != nil {
+		t.Fatalf("SwitchUserPlan: %v", err)
+	}
+
+	saved, plan := st.saved()
+	if saved.StripePlanId != "business" || saved.PendingStripePlanId != "" || plan != "business" {
+		t.Errorf("after the upgrade billing = %+v and the subscription is on %s, want both on business", saved, plan)
+	}
+	if !saved.Expires.Equal(st.period.CurrentPeriodEnd) {
+		t.Errorf("Expires = %v, want the period kept until %v", saved.Expires, st.period.CurrentPeriodEnd)
+	}
+
+	// What's left of the month at the difference between the two plans
+	charges := st.charges()
+	if len(charges) != 2 || charges[0] <= 0 || charges[0] > 4199-3499 {
+		t.Errorf("charges = %v, want the prorated difference on top of 3499", charges)
+	}
+
+	if err := st.switchTo("business"); err == nil {
+		t.Error("SwitchUserPlan to the plan the user is on succeeded")
+	}
+}
+
+func TestSwitchUserPlanDowngrade(t *testing.T) {
+	os.Setenv("STRIPE_WEBHOOK_SECRET", "whsec_test")
+	defer os.Unsetenv("STRIPE_WEBHOOK_SECRET")
+	st := newSwitchTest(t)
+	defer func() { store = nil }()
+	defer billing.SetPaymentProvider(nil)
+
+	if err := st.switchTo("personal"); err != nil {
+		t.Fatalf("SwitchUserPlan: %v", err)
+	}
+
+	// The subscription moves now, the user at the end of what they paid for
+	saved, plan := st.saved()
+	if saved.StripePlanId != "consultant" || saved.PendingStripePlanId != "personal" || plan != "personal" {
+		t.Errorf("after the downgrade billing = %+v and the subscription is on %s, want consultant with personal pending", saved, plan)
+	}
+	if charges := st.charges(); len(charges) != 1 {
+		t.Errorf("charges = %v, want nothing charged for the downgrade", charges)
+	}
+
+	renewal := st.period.CurrentPeriodEnd
+	st.p.Now = func() time.Time { return renewal.Add(time.Second) }
+	renewed := st.p.RenewSubscriptions()
+	if len(renewed) != 1 {
+		t.Fatalf("RenewSubscriptions = %+v, want the subscription renewed", renewed)
+	}
+	if charges := st.charges(); len(charges) != 2 || charges[0] != 1899 {
+		t.Errorf("charges = %v, want the renewal at 1899", charges)
+	}
+
+	invoice := testInvoice("in_renewal", st.period.Id, "personal", renewed[0].CurrentPeriodEnd)
+	invoice.Customer = st.customer
+	err := HandleStripeWebhook(stripeEvent(t, "evt_renewal", billing.StripeInvoicePaid, renewal, invoice))
+	if err != nil {
+		t.Fatalf("HandleStripeWebhook: %v", err)
+	}
+
+	saved, _ = st.saved()
+	if saved.StripePlanId != "personal" || saved.PendingStripePlanId != "" || saved.StripeInvoiceId != "in_renewal" {
+		t.Errorf("after the renewal's invoice.paid billing = %+v, want it on personal", saved)
+	}
+	if saved.Expires.Unix() != renewed[0].CurrentPeriodEnd.Unix() {
+		t.Errorf("Expires = %v, want %v", saved.Expires, renewed[0].CurrentPeriodEnd)
+	}
+}
+
+func TestSwitchUserPlanCallOffDowngrade(t *testing.T) {
+	st := newSwitchTest(t)
+	defer func() { store = nil }()
+	defer billing.SetPaymentProvider(nil)
+
+	if err := st.switchTo("personal"); err != nil {
+		t.Fatalf("SwitchUserPlan to personal: %v", err)
+	}
+
+	// Switching back to the plan the user is still on calls it off
+	if err := st.switchTo("consultant"); err != nil {
+		t.Fatalf("SwitchUserPlan back to consultant: %v", err)
+	}
+
+	saved, plan := st.saved()
+	if saved.StripePlanId != "consultant" || saved.PendingStripePlanId != "" || plan != "consultant" {
+		t.Errorf("after calling the downgrade off billing = %+v and the subscription is on %s, want both on consultant", saved, plan)
+	}
+	if charges := st.charges(); len(charges) != 1 {
+		t.Errorf("charges = %v, want nothing charged for calling it off", charges)
+	}
+}
+
+func TestSwitchUserPlanScheduleFails(t *testing.T) {
+	st := newSwitchTest(t)
+	defer func() { store = nil }()
+	defer billing.SetPaymentProvider(nil)
+
+	billing.SetPaymentProvider(failingScheduleProvider{st.p})
+	if err := st.switchTo("personal"); err == nil {
+		t.Fatal("SwitchUserPlan with Stripe down succeeded")
+	}
+
+	// The downgrade saved before asking Stripe is taken back
+	saved, plan := st.saved()
+	if saved.StripePlanId != "consultant" || saved.PendingStripePlanId != "" || plan != "consultant" {
+		t.Errorf("after the failed downgrade billing = %+v and the subscription is on %s, want both on consultant", saved, plan)
+	}
+}
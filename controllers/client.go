@@ -5,9 +5,9 @@ import (
 	"log"
 	"net/http"
 
-	"github.com/news-ai/api-v1/db"
 	"github.com/news-ai/api-v1/models"
 
+	"github.com/news-ai/web/permissions"
 	"github.com/news-ai/web/utilities"
 )
 
@@ -24,14 +24,13 @@ func getClient(id int64) (models.Client, error) {
 		return models.Client{}, errors.New("datastore: no such entity")
 	}
 
-	client := models.Client{}
-	err := db.DB.Model(&client).Where("id = ?", id).Select()
+	client, err := getStore().Clients.Get(id)
 	if err != nil {
 		log.Printf("%v", err)
 		return models.Client{}, err
 	}
 
-	if !client.Created.IsZero() {
+	if !client.Created.IsZero() && !client.IsDeleted() {
 		client.Type = "clients"
 		return client, nil
 	}
@@ -39,6 +38,23 @@ func getClient(id int64) (models.Client, error) {
 	return models.Client{}, errors.New("No client by this id")
 }
 
+// Clients can be deleted by whoever created them and by the admins of
+// their team
+func canManageClient(currentUser models.UserPostgres, client models.Client) bool {
+	if currentUser.Data.IsAdmin || permissions.AccessToObject(client.CreatedBy, currentUser.Id) {
+		return true
+	}
+
+	if client.TeamId == 0 {
+		return false
+	}
+	team, err := getTeam(client.TeamId)
+	if err != nil {
+		return false
+	}
+	return canManageTeam(currentUser, team)
+}
+
 /*
 * Public methods
  */
@@ -59,8 +75,7 @@ func GetClients(r *http.Request) ([]models.Client, interface{}, int, int, error)
 		return []models.Client{}, nil, 0, 0, errors.New("Forbidden")
 	}
 
-	clients := []models.Client{}
-	err = db.DB.Model(&clients).Where("created_by = ?", user.Id).Select()
+	clients, err := getStore().Clients.ListCreatedBy(user.Id)
 	if err != nil {
 		log.Printf("%v", err)
 		return []models.Client{}, nil, 0, 0, err
@@ -89,3 +104,82 @@ func GetClient(id string) (models.Client, interface{}, error) {
 
 	return client, nil, nil
 }
+
+/*
+* Delete methods
+ */
+
+func DeleteClient(r *http.Request, id string) (models.Client, interface{}, error) {
+	currentUser, err := GetCurrentUser(r)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Client{}, nil, err
+	}
+
+	currentId, err := utilities.StringIdToInt(id)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Client{}, nil, err
+	}
+
+	client, err := getClient(currentId)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Client{}, nil, err
+	}
+
+	if !canManageClient(currentUser, client) {
+		return models.Client{}, nil, errors.New("Forbidden")
+	}
+
+	before := client
+	client.SoftDelete()
+	err = getStore().Clients.Save(&client)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Client{}, nil, err
+	}
+
+	recordAudit(r, models.AuditClientDelete, "clients", client.Id, before, client)
+	return client, nil, nil
+}
+
+/*
+* Action methods
+ */
+
+func RestoreClient(r *http.Request, id string) (models.Client, interface{}, error) {
+	_, err := getCurrentAdmin(r)
+	if err != nil {
+		return models.Client{}, nil, err
+	}
+
+	currentId, err := utilities.StringIdToInt(id)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Client{}, nil, err
+	}
+
+	// getClient hides deleted clients, so go to the store directly
+	client, err := getStore().Clients.Get(currentId)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Client{}, nil, err
+	}
+
+	if !client.IsDeleted() {
+		return models.Client{}, nil, errors.New("Client is not deleted")
+	}
+
+	before := client
+	client.Restore()
+	err = getStore().Clients.Save(&client)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Client{}, nil, err
+	}
+
+	recordAudit(r, models.AuditClientRestore, "clients", client.Id, before, client)
+	client.Type = "clients"
+	return client, nil, nil
+}
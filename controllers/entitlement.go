@@ -0,0 +1,410 @@
+package controllers
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pquerna/ffjson/ffjson"
+
+	"github.com/news-ai/api-v1/billing"
+	"github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/repositories"
+
+	"github.com/news-ai/web/permissions"
+	"github.com/news-ai/web/utilities"
+)
+
+// Users without a billing profile have not started their trial, and get
+// what the trial plan allows.
+const noBillingPlan = "free"
+
+// Resources that are not metered are counted by what the user has when
+// they ask for more. Packages that own other such resources register how
+// to count them with RegisterEntitlementCounter.
+var entitlementCounters = map[string]func(user models.UserPostgres) (int, error){
+	models.EntitlementEmailAccounts: func(user models.UserPostgres) (int, error) {
+		return len(user.Data.Emails), nil
+	},
+	models.EntitlementSocialAccounts: func(user models.UserPostgres) (int, error) {
+		connected := 0
+		for _, id := range []string{user.Data.LinkedinId, user.Data.InstagramId} {
+			if id != "" {
+				connected++
+			}
+		}
+		return connected, nil
+	},
+}
+
+/*
+* Private methods
+ */
+
+// The plan the user is on, and their limits on it.
+func entitlementLimits(r *http.Request, user models.UserPostgres) (models.Plan, bool, map[string]int, error) {
+	planId := noBillingPlan
+	onTrial := true
+	userBilling, err := GetUserBilling(r, user)
+	if err == nil {
+		planId = userBilling.Data.StripePlanId
+		onTrial = userBilling.Data.IsOnTrial
+	}
+
+	plan, err := billing.LookupPlan(billing.BillingIdToPlanName(planId))
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Plan{}, false, nil, err
+	}
+
+	limits, err := planLimits(user, plan)
+	if err != nil {
+		return models.Plan{}, false, nil, err
+	}
+
+	return plan, onTrial, limits, nil
+}
+
+// The limits of a plan, then those of the user's team's overrides, then
+// those of their own.
+func planLimits(user models.UserPostgres, plan models.Plan) (map[string]int, error) {
+	limits := map[string]int{}
+	for _, resource := range models.EntitlementResources {
+		limits[resource] = plan.Limit(resource)
+	}
+
+	overrides, err := getStore().Overrides.ListFor(user.Id, user.Data.TeamId)
+	if err != nil {
+		log.Printf("%v", err)
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, own := range []bool{false, true} {
+		for i := 0; i < len(overrides); i++ {
+			if (overrides[i].UserId == user.Id) == own && !overrides[i].IsExpired(now) {
+				limits[overrides[i].Resource] = overrides[i].Limit
+			}
+		}
+	}
+
+	return limits, nil
+}
+
+func entitlementUsed(user models.UserPostgres, resource string, at time.Time) (int, error) {
+	if models.IsMeteredEntitlement(resource) {
+		period, _ := models.EntitlementPeriod(resource, at)
+		return getStore().Usage.Used(user.Id, resource, period)
+	}
+
+	counter, ok := entitlementCounters[resource]
+	if !ok {
+		return 0, nil
+	}
+	return counter(user)
+}
+
+func limitExceeded(resource string, limit int, used int, at time.Time) error {
+	exceeded := &models.LimitExceededError{Resource: resource, Limit: limit, Used: used}
+	if models.IsMeteredEntitlement(resource) {
+		_, exceeded.Resets = models.EntitlementPeriod(resource, at)
+	}
+	return exceeded
+}
+
+// Returns a *models.PlanUsageError if the user has more of a resource that
+// is not metered, like email accounts, than the plan would let them have.
+// Metered resources start over with the plan's limit.
+func checkPlanUsage(user models.UserPostgres, plan models.Plan) error {
+	limits, err := planLimits(user, plan)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, resource := range models.EntitlementResources {
+		limit := limits[resource]
+		if models.IsMeteredEntitlement(resource) || resource == models.EntitlementMediaDatabase || limit == models.EntitlementUnlimited {
+			continue
+		}
+
+		used, err := entitlementUsed(user, resource, now)
+		if err != nil {
+			log.Printf("%v", err)
+			return err
+		}
+
+		if used > limit {
+			return &models.PlanUsageError{Plan: plan.Name, Resource: resource, Limit: limit, Used: used}
+		}
+	}
+	return nil
+}
+
+/*
+* Public methods
+ */
+
+// RegisterEntitlementCounter sets how to count what a user has of a
+// resource that is not metered.
+func RegisterEntitlementCounter(resource string, counter func(user models.UserPostgres) (int, error)) {
+	entitlementCounters[resource] = counter
+}
+
+// ResolveEntitlements returns the user's effective limits and what they
+// have used of each.
+func ResolveEntitlements(r *http.Request, user models.UserPostgres) (models.Entitlements, error) {
+	plan, onTrial, limits, err := entitlementLimits(r, user)
+	if err != nil {
+		return models.Entitlements{}, err
+	}
+
+	now := time.Now()
+	used := map[string]int{}
+	for _, resource := range models.EntitlementResources {
+		used[resource], err = entitlementUsed(user, resource, now)
+		if err != nil {
+			log.Printf("%v", err)
+			return models.Entitlements{}, err
+		}
+	}
+
+	return models.Entitlements{
+		UserId:   user.Id,
+		PlanName: plan.Name,
+		OnTrial:  onTrial,
+		Limits:   limits,
+		Used:     used,
+	}, nil
+}
+
+// CheckEntitlement returns a *models.LimitExceededError if n more of the
+// resource would take the user over their limit. Nothing is recorded.
+func CheckEntitlement(r *http.Request, user models.UserPostgres, resource string, n int) error {
+	_, _, limits, err := entitlementLimits(r, user)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	limit := limits[resource]
+	if resource == models.EntitlementMediaDatabase {
+		if limit == 0 {
+			return limitExceeded(resource, limit, 0, now)
+		}
+		return nil
+	}
+	if limit == models.EntitlementUnlimited {
+		return nil
+	}
+
+	used, err := entitlementUsed(user, resource, now)
+	if err != nil {
+		log.Printf("%v", err)
+		return err
+	}
+
+	if used+n > limit {
+		return limitExceeded(resource, limit, used, now)
+	}
+	return nil
+}
+
+// ConsumeEntitlement records that the user used n of a metered resource,
+// or returns a *models.LimitExceededError and records nothing if that
+// would take them over their limit. Resources that are not metered are
+// only checked.
+func ConsumeEntitlement(r *http.Request, user models.UserPostgres, resource string, n int) error {
+	if !models.IsMeteredEntitlement(resource) {
+		return CheckEntitlement(r, user, resource, n)
+	}
+
+	_, _, limits, err := entitlementLimits(r, user)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	limit := limits[resource]
+	period, _ := models.EntitlementPeriod(resource, now)
+	_, err = getStore().Usage.Consume(user.Id, resource, period, n, limit)
+	if err == repositories.ErrLimitReached {
+		used, _ := getStore().Usage.Used(user.Id, resource, period)
+		return limitExceeded(resource, limit, used, now)
+	}
+	if err != nil {
+		log.Printf("%v", err)
+		return err
+	}
+	return nil
+}
+
+/*
+* Get methods
+ */
+
+func GetUserEntitlements(r *http.Request, id string) (models.Entitlements, interface{}, error) {
+	currentUser, err := GetCurrentUser(r)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Entitlements{}, nil, err
+	}
+
+	user := currentUser
+	if id != "me" {
+		userId, err := utilities.StringIdToInt(id)
+		if err != nil {
+			log.Printf("%v", err)
+			return models.Entitlements{}, nil, err
+		}
+		user, err = getUser(r, userId)
+		if err != nil {
+			log.Printf("%v", err)
+			return models.Entitlements{}, nil, err
+		}
+	}
+
+	if !permissions.AccessToObject(user.Id, currentUser.Id) && !currentUser.Data.IsAdmin {
+		err = errors.New("Forbidden")
+		log.Printf("%v", err)
+		return models.Entitlements{}, nil, err
+	}
+
+	entitlements, err := ResolveEntitlements(r, user)
+	if err != nil {
+		return models.Entitlements{}, nil, err
+	}
+
+	return entitlements, nil, nil
+}
+
+// GetEntitlementOverrides lists the overrides of the user in ?userid and
+// of the team in ?teamid, for admins.
+func GetEntitlementOverrides(r *http.Request) ([]models.EntitlementOverride, interface{}, int, int, error) {
+	_, err := getCurrentAdmin(r)
+	if err != nil {
+		return []models.EntitlementOverride{}, nil, 0, 0, err
+	}
+
+	userId := int64(0)
+	if r.URL.Query().Get("userid") != "" {
+		userId, err = utilities.StringIdToInt(r.URL.Query().Get("userid"))
+		if err != nil {
+			log.Printf("%v", err)
+			return []models.EntitlementOverride{}, nil, 0, 0, err
+		}
+	}
+
+	teamId := int64(0)
+	if r.URL.Query().Get("teamid") != "" {
+		teamId, err = utilities.StringIdToInt(r.URL.Query().Get("teamid"))
+		if err != nil {
+			log.Printf("%v", err)
+			return []models.EntitlementOverride{}, nil, 0, 0, err
+		}
+	}
+
+	overrides, err := getStore().Overrides.ListFor(userId, teamId)
+	if err != nil {
+		log.Printf("%v", err)
+		return []models.EntitlementOverride{}, nil, 0, 0, err
+	}
+
+	for i := 0; i < len(overrides); i++ {
+		overrides[i].Type = "entitlementoverrides"
+	}
+
+	return overrides, nil, len(overrides), 0, nil
+}
+
+/*
+* Create methods
+ */
+
+func CreateEntitlementOverride(r *http.Request) ([]models.EntitlementOverride, interface{}, error) {
+	buf, _ := ioutil.ReadAll(r.Body)
+
+	currentUser, err := getCurrentAdmin(r)
+	if err != nil {
+		return []models.EntitlementOverride{}, nil, err
+	}
+
+	decoder := ffjson.NewDecoder()
+	var override models.EntitlementOverride
+	err = decoder.Decode(buf, &override)
+	if err != nil {
+		log.Printf("%v", err)
+		return []models.EntitlementOverride{}, nil, err
+	}
+
+	if !models.IsEntitlementResource(override.Resource) {
+		return []models.EntitlementOverride{}, nil, errors.New("Unknown resource " + override.Resource)
+	}
+
+	if (override.UserId == 0) == (override.TeamId == 0) {
+		return []models.EntitlementOverride{}, nil, errors.New("An override is either for a user or for a team")
+	}
+
+	if override.Limit < models.EntitlementUnlimited {
+		return []models.EntitlementOverride{}, nil, errors.New("Limit is invalid")
+	}
+
+	if override.UserId != 0 {
+		_, err = getUser(r, override.UserId)
+	} else {
+		_, err = getTeam(override.TeamId)
+	}
+	if err != nil {
+		log.Printf("%v", err)
+		return []models.EntitlementOverride{}, nil, err
+	}
+
+	override.Id = 0
+	override.CreatedBy = currentUser.Id
+	override.Created = time.Now()
+	err = getStore().Overrides.Create(&override)
+	if err != nil {
+		log.Printf("%v", err)
+		return []models.EntitlementOverride{}, nil, err
+	}
+
+	recordAudit(r, models.AuditEntitlementOverrideCreate, "entitlementoverrides", override.Id, nil, override)
+
+	override.Type = "entitlementoverrides"
+	return []models.EntitlementOverride{override}, nil, nil
+}
+
+/*
+* Delete methods
+ */
+
+func DeleteEntitlementOverride(r *http.Request, id string) (models.EntitlementOverride, interface{}, error) {
+	_, err := getCurrentAdmin(r)
+	if err != nil {
+		return models.EntitlementOverride{}, nil, err
+	}
+
+	overrideId, err := utilities.StringIdToInt(id)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.EntitlementOverride{}, nil, err
+	}
+
+	override, err := getStore().Overrides.Get(overrideId)
+	if err != nil {
+		return models.EntitlementOverride{}, nil, errors.New("No override by this id")
+	}
+
+	err = getStore().Overrides.Delete(&override)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.EntitlementOverride{}, nil, err
+	}
+
+	recordAudit(r, models.AuditEntitlementOverrideDelete, "entitlementoverrides", override.Id, override, nil)
+
+	override.Type = "entitlementoverrides"
+	return override, nil, nil
+}
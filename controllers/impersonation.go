@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	gcontext "github.com/gorilla/context"
+
+	"github.com/news-ai/api-v1/models"
+
+	"github.com/news-ai/web/utilities"
+)
+
+/*
+* Public methods
+ */
+
+/*
+* Get methods
+ */
+
+// GetImpersonatorId returns the id of the admin impersonating the current
+// user, or 0 when the session is not impersonated.
+func GetImpersonatorId(r *http.Request) int64 {
+	impersonatorId, ok := gcontext.GetOk(r, "impersonator")
+	if !ok {
+		return 0
+	}
+	return impersonatorId.(int64)
+}
+
+// SetImpersonator marks the request as made by an admin on behalf of the
+// user in the context. It fails if that user has stopped being an admin.
+func SetImpersonator(r *http.Request, impersonatorId int64) error {
+	admin, err := getUserUnauthorized(r, impersonatorId)
+	if err != nil {
+		log.Printf("%v", err)
+		return err
+	}
+
+	if !admin.Data.IsAdmin {
+		return errors.New("Impersonation is only open to admins")
+	}
+
+	gcontext.Set(r, "impersonator", impersonatorId)
+	return nil
+}
+
+/*
+* Action methods
+ */
+
+// StartImpersonation checks that the current user can impersonate id and
+// returns who they will be. The caller switches the session over.
+func StartImpersonation(r *http.Request, id string) (models.UserPostgres, error) {
+	admin, err := getCurrentAdmin(r)
+	if err != nil {
+		return models.UserPostgres{}, err
+	}
+
+	if GetImpersonatorId(r) != 0 {
+		return models.UserPostgres{}, errors.New("Already impersonating a user")
+	}
+
+	userId, err := utilities.StringIdToInt(id)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.UserPostgres{}, err
+	}
+
+	user, err := getUser(r, userId)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.UserPostgres{}, err
+	}
+
+	if user.Id == admin.Id {
+		return models.UserPostgres{}, errors.New("You can't impersonate yourself")
+	}
+
+	// An admin session would let the impersonator act with someone
+	// else's admin rights.
+	if user.Data.IsAdmin {
+		return models.UserPostgres{}, errors.New("Admins can't be impersonated")
+	}
+
+	recordAuditAs(r, admin.Id, models.AuditUserImpersonateStart, "users", user.Id, nil, nil)
+	return user, nil
+}
+
+// StopImpersonation returns the admin whose session it was.
+func StopImpersonation(r *http.Request) (models.UserPostgres, error) {
+	impersonatorId := GetImpersonatorId(r)
+	if impersonatorId == 0 {
+		return models.UserPostgres{}, errors.New("Not impersonating a user")
+	}
+
+	currentUser, err := GetCurrentUser(r)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.UserPostgres{}, err
+	}
+
+	admin, err := getUserUnauthorized(r, impersonatorId)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.UserPostgres{}, err
+	}
+
+	recordAuditAs(r, admin.Id, models.AuditUserImpersonateStop, "users", currentUser.Id, nil, nil)
+	return admin, nil
+}
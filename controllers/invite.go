@@ -6,17 +6,20 @@ import (
 	"log"
 	"net/http"
 	"net/mail"
+	"time"
 
 	"github.com/pquerna/ffjson/ffjson"
 
-	"github.com/news-ai/api-v1/db"
 	"github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/repositories"
 
 	"github.com/news-ai/tabulae-v1/emails"
 
 	"github.com/news-ai/web/utilities"
 )
 
+var ErrInviteUsed = errors.New("This invitation code has already been used")
+
 /*
 * Private
  */
@@ -43,8 +46,7 @@ func generateTokenAndEmail(r *http.Request, invite models.Invite) (models.UserIn
 		return models.UserInviteCode{}, invalidEmailError
 	}
 
-	userInviteCodes := []models.UserInviteCode{}
-	err = db.DB.Model(&userInviteCodes).Where("email = ?", validEmail.Address).Select()
+	userInviteCodes, err := getStore().Invites.ListByEmail(validEmail.Address)
 	if err != nil {
 		log.Printf("%v", err)
 		return models.UserInviteCode{}, err
@@ -79,7 +81,10 @@ func generateTokenAndEmail(r *http.Request, invite models.Invite) (models.UserIn
 	referralCode := models.UserInviteCode{}
 	referralCode.Email = validEmail.Address
 	referralCode.InviteCode = utilities.RandToken()
-	_, err = referralCode.Create(r, currentUser)
+	referralCode.CreatedBy = currentUser.Id
+	referralCode.Created = time.Now()
+	referralCode.IsUsed = false
+	err = getStore().Invites.Create(&referralCode)
 	if err != nil {
 		log.Printf("%v", err)
 		return models.UserInviteCode{}, err
@@ -113,8 +118,7 @@ func GetInvites(r *http.Request) ([]models.UserInviteCode, interface{}, int, int
 		return []models.UserInviteCode{}, nil, 0, 0, err
 	}
 
-	userInviteCodes := []models.UserInviteCode{}
-	err = db.DB.Model(&userInviteCodes).Where("created_by = ?", currentUser.Id).Where("is_used = ?", true).Select()
+	userInviteCodes, err := getStore().Invites.ListUsedCreatedBy(currentUser.Id)
 	if err != nil {
 		log.Printf("%v", err)
 		return []models.UserInviteCode{}, nil, 0, 0, err
@@ -128,8 +132,7 @@ func GetInvites(r *http.Request) ([]models.UserInviteCode, interface{}, int, int
 }
 
 func GetInviteFromInvitationCode(r *http.Request, invitationCode string) (models.UserInviteCode, error) {
-	userInviteCode := models.UserInviteCode{}
-	err := db.DB.Model(&userInviteCode).Where("invite_code = ?", invitationCode).Select()
+	userInviteCode, err := getStore().Invites.FindByCode(invitationCode)
 	if err != nil {
 		log.Printf("%v", err)
 		return models.UserInviteCode{}, err
@@ -165,3 +168,47 @@ func CreateInvite(r *http.Request) (models.UserInviteCode, interface{}, error) {
 	userInvite.Type = "invites"
 	return userInvite, nil, nil
 }
+
+/*
+* Update methods
+ */
+
+// Marks the invitation as used and calls register in the same
+// transaction, with the store of that transaction. If register fails the
+// invitation stays unused, and two registrations can't redeem the same
+// code.
+func RedeemInvite(r *http.Request, invitationCode string, register func(s repositories.Store, invite models.UserInviteCode) error) (models.UserInviteCode, error) {
+	userInviteCode := models.UserInviteCode{}
+	err := getStore().RunInTransaction(func(s repositories.Store) error {
+		invite, err := s.Invites.LockByCode(invitationCode)
+		if err != nil {
+			return err
+		}
+
+		if invite.IsUsed {
+			return ErrInviteUsed
+		}
+
+		invite.IsUsed = true
+		invite.Updated = time.Now()
+		err = s.Invites.Save(&invite)
+		if err != nil {
+			return err
+		}
+
+		err = register(s, invite)
+		if err != nil {
+			return err
+		}
+
+		userInviteCode = invite
+		return nil
+	})
+	if err != nil {
+		log.Printf("%v", err)
+		return models.UserInviteCode{}, err
+	}
+
+	userInviteCode.Type = "invites"
+	return userInviteCode, nil
+}
@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pquerna/ffjson/ffjson"
+
+	"github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/repositories"
+
+	"github.com/news-ai/web/utilities"
+)
+
+/*
+* Private methods
+ */
+
+func getPlan(id string) (models.Plan, error) {
+	planId, err := utilities.StringIdToInt(id)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Plan{}, err
+	}
+
+	plan, err := getStore().Plans.Get(planId)
+	if err != nil {
+		return models.Plan{}, errors.New("No plan by this id")
+	}
+
+	return plan, nil
+}
+
+// Plans are looked up by name and by every Stripe id and alias, so none of
+// them may be shared with another plan.
+func validatePlan(plans repositories.Plans, plan *models.Plan) error {
+	plan.Name = strings.TrimSpace(plan.Name)
+	plan.StripeId = strings.ToLower(strings.TrimSpace(plan.StripeId))
+	if plan.Name == "" {
+		return errors.New("Plan name is required")
+	}
+	if plan.StripeId == "" {
+		return errors.New("Plan Stripe id is required")
+	}
+	if plan.MonthlyPrice < 0 || plan.AnnualPrice < 0 {
+		return errors.New("Plan prices can't be negative")
+	}
+	if plan.EmailAccounts < 0 || plan.EmailsPerDay < 0 || plan.SocialAccounts < 0 {
+		return errors.New("Plan limits can't be negative")
+	}
+
+	existing, err := plans.FindByName(plan.Name)
+	if err == nil && existing.Id != plan.Id {
+		return errors.New("There is already a plan named " + plan.Name)
+	}
+
+	aliases := []string{}
+	for i := 0; i < len(plan.Aliases); i++ {
+		alias := strings.ToLower(strings.TrimSpace(plan.Aliases[i]))
+		if alias != "" {
+			aliases = append(aliases, alias)
+		}
+	}
+	plan.Aliases = aliases
+
+	for _, id := range append([]string{plan.StripeId}, plan.Aliases...) {
+		existing, err := plans.FindByAlias(id)
+		if err == nil && existing.Id != plan.Id {
+			return errors.New("The plan id " + id + " is already used by " + existing.Name)
+		}
+	}
+
+	return nil
+}
+
+/*
+* Public methods
+ */
+
+/*
+* Get methods
+ */
+
+// GetPlans lists the plan catalog. Admins see every plan, everyone else
+// only the ones that can still be picked.
+func GetPlans(r *http.Request) ([]models.Plan, interface{}, int, int, error) {
+	currentUser, err := GetCurrentUser(r)
+	if err != nil {
+		log.Printf("%v", err)
+		return []models.Plan{}, nil, 0, 0, err
+	}
+
+	plans, err := getStore().Plans.List()
+	if err != nil {
+		log.Printf("%v", err)
+		return []models.Plan{}, nil, 0, 0, err
+	}
+
+	visible := []models.Plan{}
+	for i := 0; i < len(plans); i++ {
+		if plans[i].Active || currentUser.Data.IsAdmin {
+			plans[i].Type = "plans"
+			visible = append(visible, plans[i])
+		}
+	}
+
+	return visible, nil, len(visible), 0, nil
+}
+
+func GetPlan(r *http.Request, id string) (models.Plan, interface{}, error) {
+	currentUser, err := GetCurrentUser(r)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Plan{}, nil, err
+	}
+
+	plan, err := getPlan(id)
+	if err != nil {
+		return models.Plan{}, nil, err
+	}
+
+	if !plan.Active && !currentUser.Data.IsAdmin {
+		return models.Plan{}, nil, errors.New("No plan by this id")
+	}
+
+	plan.Type = "plans"
+	return plan, nil, nil
+}
+
+/*
+* Create methods
+ */
+
+func CreatePlan(r *http.Request) ([]models.Plan, interface{}, error) {
+	buf, _ := ioutil.ReadAll(r.Body)
+
+	_, err := getCurrentAdmin(r)
+	if err != nil {
+		return []models.Plan{}, nil, err
+	}
+
+	decoder := ffjson.NewDecoder()
+	var plan models.Plan
+	err = decoder.Decode(buf, &plan)
+	if err != nil {
+		log.Printf("%v", err)
+		return []models.Plan{}, nil, err
+	}
+
+	err = getStore().RunInTransaction(func(s repositories.Store) error {
+		plan.Id = 0
+		err := validatePlan(s.Plans, &plan)
+		if err != nil {
+			return err
+		}
+
+		plan.Created = time.Now()
+		plan.Updated = time.Now()
+		return s.Plans.Create(&plan)
+	})
+	if err != nil {
+		log.Printf("%v", err)
+		return []models.Plan{}, nil, err
+	}
+
+	recordAudit(r, models.AuditPlanCreate, "plans", plan.Id, nil, plan)
+
+	plan.Type = "plans"
+	return []models.Plan{plan}, nil, nil
+}
+
+/*
+* Update methods
+ */
+
+// UpdatePlan changes only the fields that are in the request body.
+func UpdatePlan(r *http.Request, id string) (models.Plan, interface{}, error) {
+	buf, _ := ioutil.ReadAll(r.Body)
+
+	_, err := getCurrentAdmin(r)
+	if err != nil {
+		return models.Plan{}, nil, err
+	}
+
+	plan, err := getPlan(id)
+	if err != nil {
+		return models.Plan{}, nil, err
+	}
+
+	before := plan
+	decoder := ffjson.NewDecoder()
+	err = decoder.Decode(buf, &plan)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Plan{}, nil, err
+	}
+
+	err = getStore().RunInTransaction(func(s repositories.Store) error {
+		plan.Id = before.Id
+		plan.Created = before.Created
+		err := validatePlan(s.Plans, &plan)
+		if err != nil {
+			return err
+		}
+
+		plan.Updated = time.Now()
+		return s.Plans.Save(&plan)
+	})
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Plan{}, nil, err
+	}
+
+	recordAudit(r, models.AuditPlanUpdate, "plans", plan.Id, before, plan)
+
+	plan.Type = "plans"
+	return plan, nil, nil
+}
+
+/*
+* Delete methods
+ */
+
+// DeletePlan only deactivates the plan: billing profiles may still point
+// at it, and they keep its limits.
+func DeletePlan(r *http.Request, id string) (models.Plan, interface{}, error) {
+	_, err := getCurrentAdmin(r)
+	if err != nil {
+		return models.Plan{}, nil, err
+	}
+
+	plan, err := getPlan(id)
+	if err != nil {
+		return models.Plan{}, nil, err
+	}
+
+	before := plan
+	plan.Active = false
+	plan.Updated = time.Now()
+	err = getStore().Plans.Save(&plan)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Plan{}, nil, err
+	}
+
+	recordAudit(r, models.AuditPlanDeactivate, "plans", plan.Id, before, plan)
+
+	plan.Type = "plans"
+	return plan, nil, nil
+}
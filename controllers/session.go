@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	gcontext "github.com/gorilla/context"
+
+	"github.com/news-ai/api-v1/models"
+
+	"github.com/news-ai/web/utilities"
+)
+
+// LastSeen is only written when it is older than this, so a busy session
+// does not turn every request into a write
+const sessionTouchInterval = time.Minute
+
+var ErrSessionRevoked = errors.New("This session has been logged out")
+
+/*
+* Private methods
+ */
+
+func getCurrentSessionId(r *http.Request) int64 {
+	sessionId, ok := gcontext.GetOk(r, "session")
+	if !ok {
+		return 0
+	}
+	return sessionId.(int64)
+}
+
+// Refresh tokens are other clients too, so they all stop working
+func revokeAllUserSessions(userId int64, exceptId int64) error {
+	err := getStore().Sessions.RevokeAllForUser(userId, exceptId)
+	if err != nil {
+		log.Printf("%v", err)
+		return err
+	}
+
+	err = getStore().Tokens.Expire(userId, models.UserTokenRefresh)
+	if err != nil {
+		log.Printf("%v", err)
+	}
+	return err
+}
+
+/*
+* Public methods
+ */
+
+/*
+* Get methods
+ */
+
+func GetSessions(r *http.Request, id string) ([]models.UserSession, interface{}, int, int, error) {
+	user, err := getOwnUser(r, id)
+	if err != nil {
+		return []models.UserSession{}, nil, 0, 0, err
+	}
+
+	sessions, err := getStore().Sessions.ListByUser(user.Id)
+	if err != nil {
+		log.Printf("%v", err)
+		return []models.UserSession{}, nil, 0, 0, err
+	}
+
+	currentId := getCurrentSessionId(r)
+	for i := 0; i < len(sessions); i++ {
+		sessions[i].Type = "sessions"
+		sessions[i].Current = sessions[i].Id == currentId
+	}
+
+	return sessions, nil, len(sessions), 0, nil
+}
+
+/*
+* Create methods
+ */
+
+// StartUserSession records a new login and returns the token to keep in
+// the redis session.
+func StartUserSession(r *http.Request, userId int64) (string, error) {
+	token, hash, err := models.NewSessionToken()
+	if err != nil {
+		log.Printf("%v", err)
+		return "", err
+	}
+
+	session := models.UserSession{
+		UserId:    userId,
+		TokenHash: hash,
+		Device:    r.UserAgent(),
+		IPAddress: models.RequestIP(r),
+		Created:   time.Now(),
+		LastSeen:  time.Now(),
+	}
+
+	err = getStore().Sessions.Create(&session)
+	if err != nil {
+		log.Printf("%v", err)
+		return "", err
+	}
+
+	gcontext.Set(r, "session", session.Id)
+	return token, nil
+}
+
+/*
+* Update methods
+ */
+
+// CheckUserSession looks up the session behind token, fails if it has
+// been revoked and moves its LastSeen forward.
+func CheckUserSession(r *http.Request, token string) error {
+	session, err := getStore().Sessions.FindByTokenHash(models.HashSessionToken(token))
+	if err != nil || session.IsRevoked() {
+		return ErrSessionRevoked
+	}
+
+	if time.Since(session.LastSeen) > sessionTouchInterval {
+		err = getStore().Sessions.Touch(session.Id, time.Now(), models.RequestIP(r))
+		if err != nil {
+			log.Printf("%v", err)
+		}
+	}
+
+	gcontext.Set(r, "session", session.Id)
+	return nil
+}
+
+// EndUserSession revokes the session behind token, when logging out.
+func EndUserSession(token string) error {
+	session, err := getStore().Sessions.FindByTokenHash(models.HashSessionToken(token))
+	if err != nil || session.IsRevoked() {
+		return nil
+	}
+	return getStore().Sessions.Revoke(&session)
+}
+
+// RevokeAllUserSessions logs a user out everywhere, for example after
+// their password changed.
+func RevokeAllUserSessions(r *http.Request, userId int64) error {
+	return revokeAllUserSessions(userId, 0)
+}
+
+/*
+* Delete methods
+ */
+
+func RevokeSession(r *http.Request, id string, sessionId string) (models.UserSession, interface{}, error) {
+	user, err := getOwnUser(r, id)
+	if err != nil {
+		return models.UserSession{}, nil, err
+	}
+
+	currentId, err := utilities.StringIdToInt(sessionId)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.UserSession{}, nil, err
+	}
+
+	session, err := getStore().Sessions.Get(currentId)
+	if err != nil || session.UserId != user.Id {
+		return models.UserSession{}, nil, errors.New("No session by this id")
+	}
+
+	if session.IsRevoked() {
+		return models.UserSession{}, nil, errors.New("Session is already revoked")
+	}
+
+	err = getStore().Sessions.Revoke(&session)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.UserSession{}, nil, err
+	}
+
+	session.Type = "sessions"
+	return session, nil, nil
+}
+
+// RevokeOtherSessions logs the user out everywhere but the session the
+// request came from.
+func RevokeOtherSessions(r *http.Request, id string) ([]models.UserSession, interface{}, int, int, error) {
+	user, err := getOwnUser(r, id)
+	if err != nil {
+		return []models.UserSession{}, nil, 0, 0, err
+	}
+
+	err = revokeAllUserSessions(user.Id, getCurrentSessionId(r))
+	if err != nil {
+		return []models.UserSession{}, nil, 0, 0, err
+	}
+
+	return GetSessions(r, id)
+}
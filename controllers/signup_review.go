@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/repositories"
+
+	"github.com/news-ai/tabulae-v1/emails"
+
+	"github.com/news-ai/web/utilities"
+)
+
+/*
+* Private methods
+ */
+
+func getPendingSignupReview(r *http.Request, id string) (models.SignupReview, models.UserPostgres, error) {
+	_, err := getCurrentAdmin(r)
+	if err != nil {
+		return models.SignupReview{}, models.UserPostgres{}, err
+	}
+
+	reviewId, err := utilities.StringIdToInt(id)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.SignupReview{}, models.UserPostgres{}, err
+	}
+
+	review, err := getStore().Reviews.Get(reviewId)
+	if err != nil {
+		return models.SignupReview{}, models.UserPostgres{}, errors.New("No signup review by this id")
+	}
+
+	if !review.IsPending() {
+		return models.SignupReview{}, models.UserPostgres{}, errors.New("Signup review has already been " + review.Status)
+	}
+
+	user, err := getUserUnauthorized(r, review.UserId)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.SignupReview{}, models.UserPostgres{}, err
+	}
+
+	return review, user, nil
+}
+
+func decideSignupReview(r *http.Request, review *models.SignupReview, status string) {
+	currentUser, _ := GetCurrentUser(r)
+	now := time.Now()
+	review.Status = status
+	review.DecidedBy = currentUser.Id
+	review.Decided = &now
+}
+
+/*
+* Public methods
+ */
+
+/*
+* Get methods
+ */
+
+// GetSignupReviews lists the review queue for admins, pending signups by
+// default or those with the status in ?status.
+func GetSignupReviews(r *http.Request) ([]models.SignupReview, interface{}, int, int, error) {
+	_, err := getCurrentAdmin(r)
+	if err != nil {
+		return []models.SignupReview{}, nil, 0, 0, err
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.SignupReviewPending
+	}
+
+	reviews, err := getStore().Reviews.ListByStatus(status)
+	if err != nil {
+		log.Printf("%v", err)
+		return []models.SignupReview{}, nil, 0, 0, err
+	}
+
+	for i := 0; i < len(reviews); i++ {
+		reviews[i].Type = "signupreviews"
+	}
+
+	return reviews, nil, len(reviews), 0, nil
+}
+
+// UserAwaitingReview tells whether the user's signup is still waiting for
+// an admin, so they can't log in yet.
+func UserAwaitingReview(user models.UserPostgres) bool {
+	_, err := getStore().Reviews.FindPendingByUser(user.Id)
+	return err == nil
+}
+
+/*
+* Create methods
+ */
+
+// RegisterReviewedUserIn creates a user the screening flagged together
+// with their review, so that the account can't exist without being in the
+// queue.
+func RegisterReviewedUserIn(s repositories.Store, r *http.Request, user models.User, reasons []string) (models.UserPostgres, error) {
+	postgresUser, err := RegisterUserIn(s, user)
+	if err != nil {
+		return models.UserPostgres{}, err
+	}
+
+	_, err = createSignupReview(s, r, postgresUser, reasons)
+	if err != nil {
+		return models.UserPostgres{}, err
+	}
+
+	return postgresUser, nil
+}
+
+// RegisterReviewedUser is RegisterReviewedUserIn in a transaction of its
+// own.
+func RegisterReviewedUser(r *http.Request, user models.User, reasons []string) (models.UserPostgres, error) {
+	postgresUser := models.UserPostgres{}
+	err := getStore().RunInTransaction(func(s repositories.Store) error {
+		var err error
+		postgresUser, err = RegisterReviewedUserIn(s, r, user, reasons)
+		return err
+	})
+	return postgresUser, err
+}
+
+// Puts a signup the screening flagged in the queue
+func createSignupReview(s repositories.Store, r *http.Request, user models.UserPostgres, reasons []string) (models.SignupReview, error) {
+	review := models.SignupReview{
+		UserId:    user.Id,
+		Email:     user.Data.Email,
+		IPAddress: models.RequestIP(r),
+		Reasons:   reasons,
+		Status:    models.SignupReviewPending,
+		Created:   time.Now(),
+	}
+
+	err := s.Reviews.Create(&review)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.SignupReview{}, err
+	}
+
+	review.Type = "signupreviews"
+	return review, nil
+}
+
+/*
+* Update methods
+ */
+
+// ApproveSignupReview lets the signup go ahead, by sending the
+// confirmation email it was held back from.
+func ApproveSignupReview(r *http.Request, id string) (models.SignupReview, interface{}, error) {
+	review, user, err := getPendingSignupReview(r, id)
+	if err != nil {
+		return models.SignupReview{}, nil, err
+	}
+
+	before := review
+	decideSignupReview(r, &review, models.SignupReviewApproved)
+	err = getStore().Reviews.Save(&review)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.SignupReview{}, nil, err
+	}
+
+	if !user.Data.EmailConfirmed {
+		confirmationCode, err := CreateUserToken(user.Id, models.UserTokenConfirmEmail)
+		if err == nil {
+			err = emails.ConfirmUserAccount(user.Data, confirmationCode)
+		}
+		if err != nil {
+			log.Printf("%v", "Confirmation email was not sent for "+user.Data.Email)
+			log.Printf("%v", err)
+		}
+	}
+
+	recordAudit(r, models.AuditSignupReviewApprove, "signupreviews", review.Id, before, review)
+
+	review.Type = "signupreviews"
+	return review, nil, nil
+}
+
+// RejectSignupReview bans the account the signup created.
+func RejectSignupReview(r *http.Request, id string) (models.SignupReview, interface{}, error) {
+	review, user, err := getPendingSignupReview(r, id)
+	if err != nil {
+		return models.SignupReview{}, nil, err
+	}
+
+	before := review
+	err = getStore().RunInTransaction(func(s repositories.Store) error {
+		user.Data.IsActive = false
+		user.Data.IsBanned = true
+		err := s.Users.Save(&user)
+		if err != nil {
+			return err
+		}
+
+		decideSignupReview(r, &review, models.SignupReviewRejected)
+		return s.Reviews.Save(&review)
+	})
+	if err != nil {
+		log.Printf("%v", err)
+		return models.SignupReview{}, nil, err
+	}
+
+	revokeAllUserSessions(user.Id, 0)
+	recordAudit(r, models.AuditSignupReviewReject, "signupreviews", review.Id, before, review)
+
+	review.Type = "signupreviews"
+	return review, nil, nil
+}
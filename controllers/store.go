@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"github.com/news-ai/api-v1/billing"
+	"github.com/news-ai/api-v1/db"
+	"github.com/news-ai/api-v1/repositories"
+)
+
+var store *repositories.Store
+
+// SetStore swaps the repositories used by the controllers, for example
+// with repositories.NewMemoryStore() in tests. The billing plan lookups
+// read from the same catalog.
+func SetStore(s repositories.Store) {
+	store = &s
+	billing.SetPlans(s.Plans)
+}
+
+func getStore() repositories.Store {
+	if store == nil {
+		return repositories.NewPostgresStore(db.DB, db.ReadDB)
+	}
+	return *store
+}
@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/news-ai/api-v1/billing"
+	"github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/repositories"
+)
+
+/*
+* Private methods
+ */
+
+// Events about another subscription than the one the billing follows are
+// left alone: starting a plan cancels the trial's subscription, and its
+// deletion must not end the new plan.
+func isCurrentSubscription(userBilling models.Billing, subscriptionId string) bool {
+	return userBilling.StripeSubscriptionId == "" || subscriptionId == "" || userBilling.StripeSubscriptionId == subscriptionId
+}
+
+func applyInvoicePaid(invoice billing.StripeInvoice, userBilling *models.Billing, user *models.User) {
+	if !isCurrentSubscription(*userBilling, invoice.Subscription) {
+		return
+	}
+
+	periodEnd := invoice.PeriodEnd()
+	if periodEnd.After(userBilling.Expires) {
+		userBilling.Expires = periodEnd
+	}
+
+	// The first invoice of a downgrade's plan is when the user moves to it
+	stripePlan := invoice.StripePlanId()
+	if stripePlan != "" {
+		userBilling.StripePlanId = billing.StripePlanToPlanId(stripePlan)
+		userBilling.IsOnTrial = billing.IsTrialStripePlan(stripePlan)
+		if stripePlan == userBilling.PendingStripePlanId {
+			userBilling.PendingStripePlanId = ""
+		}
+	}
+	if invoice.Subscription != "" {
+		userBilling.StripeSubscriptionId = invoice.Subscription
+	}
+	userBilling.StripeInvoiceId = invoice.Id
+	user.IsActive = true
+}
+
+// Of an invoice.paid older than the last event applied, only the invoice
+// is kept, so refunding it still takes its period back. The period, the plan
+// and whether the user is active are the newer event's. An invoice for an
+// earlier period than the billing's is not the current one.
+func applyStaleInvoicePaid(invoice billing.StripeInvoice, userBilling *models.Billing) {
+	if !isCurrentSubscription(*userBilling, invoice.Subscription) {
+		return
+	}
+
+	if invoice.PeriodEnd().Before(userBilling.Expires) {
+		return
+	}
+	userBilling.StripeInvoiceId = invoice.Id
+}
+
+// Stripe retries a failed payment a few times; the user only loses access
+// once it gives up.
+func applyInvoicePaymentFailed(invoice billing.StripeInvoice, userBilling *models.Billing, user *models.User) {
+	if !isCurrentSubscription(*userBilling, invoice.Subscription) {
+		return
+	}
+
+	if invoice.IsFinalFailure() {
+		user.IsActive = false
+	}
+}
+
+func applySubscriptionUpdated(subscription billing.StripeSubscription, userBilling *models.Billing, user *models.User) {
+	if !isCurrentSubscription(*userBilling, subscription.Id) {
+		return
+	}
+
+	if subscription.CurrentPeriodEnd > 0 {
+		userBilling.Expires = time.Unix(subscription.CurrentPeriodEnd, 0)
+	}
+	// A downgrade is on the subscription from when it is asked for, but the
+	// user keeps their plan until its first invoice is paid.
+	if subscription.Plan != nil && subscription.Plan.Id != "" && subscription.Plan.Id != userBilling.PendingStripePlanId {
+		userBilling.StripePlanId = billing.StripePlanToPlanId(subscription.Plan.Id)
+		userBilling.PendingStripePlanId = ""
+	}
+	userBilling.StripeSubscriptionId = subscription.Id
+	userBilling.IsOnTrial = subscription.Status == "trialing"
+	userBilling.IsCancel = subscription.CancelAtPeriodEnd
+	user.IsActive = subscription.IsLive()
+}
+
+func applySubscriptionDeleted(subscription billing.StripeSubscription, userBilling *models.Billing, user *models.User) {
+	if !isCurrentSubscription(*userBilling, subscription.Id) {
+		return
+	}
+
+	ended := time.Now()
+	if subscription.EndedAt > 0 {
+		ended = time.Unix(subscription.EndedAt, 0)
+	}
+	userBilling.Expires = ended
+	userBilling.IsCancel = true
+	userBilling.IsOnTrial = false
+	user.IsActive = false
+}
+
+// A full refund of the invoice of the current period takes the period
+// back. Partial refunds are goodwill, and refunds of earlier invoices or of
+// charges outside the subscription are for periods that are over; neither
+// changes anything.
+func applyChargeRefunded(charge billing.StripeCharge, userBilling *models.Billing, user *models.User) {
+	if !charge.IsFullyRefunded() || charge.Invoice == "" || charge.Invoice != userBilling.StripeInvoiceId {
+		return
+	}
+
+	userBilling.Expires = time.Now()
+	user.IsActive = false
+}
+
+/*
+* Public methods
+ */
+
+// HandleStripeWebhook applies a signed Stripe event to the billing of the
+// customer it is about, and to whether their user is active. Each event is
+// applied once; events Stripe delivers again, events of other types and
+// events about customers we don't know are acknowledged and skipped. Of
+// events older than the last one applied to the billing, only what doesn't
+// depend on their order is applied.
+func HandleStripeWebhook(r *http.Request) error {
+	payload, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("%v", err)
+		return err
+	}
+
+	event, err := billing.ParseWebhookEvent(payload, r.Header.Get("Stripe-Signature"))
+	if err != nil {
+		log.Printf("%v", err)
+		return err
+	}
+
+	customerId := ""
+	var apply func(userBilling *models.Billing, user *models.User)
+	var applyStale func(userBilling *models.Billing)
+	switch event.Type {
+	case billing.StripeInvoicePaid, billing.StripeInvoicePaymentFailed:
+		invoice := billing.StripeInvoice{}
+		err = json.Unmarshal(event.Data.Object, &invoice)
+		customerId = invoice.Customer
+		apply = func(userBilling *models.Billing, user *models.User) {
+			if event.Type == billing.StripeInvoicePaid {
+				applyInvoicePaid(invoice, userBilling, user)
+			} else {
+				applyInvoicePaymentFailed(invoice, userBilling, user)
+			}
+		}
+		if event.Type == billing.StripeInvoicePaid {
+			applyStale = func(userBilling *models.Billing) {
+				applyStaleInvoicePaid(invoice, userBilling)
+			}
+		}
+	case billing.StripeSubscriptionUpdated, billing.StripeSubscriptionDeleted:
+		subscription := billing.StripeSubscription{}
+		err = json.Unmarshal(event.Data.Object, &subscription)
+		customerId = subscription.Customer
+		apply = func(userBilling *models.Billing, user *models.User) {
+			if event.Type == billing.StripeSubscriptionUpdated {
+				applySubscriptionUpdated(subscription, userBilling, user)
+			} else {
+				applySubscriptionDeleted(subscription, userBilling, user)
+			}
+		}
+	case billing.StripeChargeRefunded:
+		charge := billing.StripeCharge{}
+		err = json.Unmarshal(event.Data.Object, &charge)
+		customerId = charge.Customer
+		apply = func(userBilling *models.Billing, user *models.User) {
+			applyChargeRefunded(charge, userBilling, user)
+		}
+	default:
+		return nil
+	}
+	if err != nil {
+		log.Printf("%v", err)
+		return err
+	}
+
+	// The event is recorded in the same transaction it is applied in, so
+	// one that fails is applied again when Stripe retries it. Saves that
+	// race with the user's own requests are retried with fresh rows.
+	var billingId int64
+	var before, after models.Billing
+	err = models.RetryOnConflict(3, func() error {
+		billingId = 0
+		return getStore().RunInTransaction(func(s repositories.Store) error {
+			recorded, err := s.Events.Record(&models.ProcessedStripeEvent{
+				Id:        event.Id,
+				Type:      event.Type,
+				Processed: time.Now(),
+			})
+			if err != nil {
+				return err
+			}
+			if !recorded {
+				log.Printf("%v", "Stripe event "+event.Id+" was already processed")
+				return nil
+			}
+
+			userBilling, err := s.Billings.FindByStripeId(customerId)
+			if err == repositories.ErrNotFound {
+				log.Printf("%v", "No billing for Stripe customer "+customerId)
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			// A subscription.updated that arrives after the
+			// subscription.deleted must not bring the plan back
+			created := time.Unix(event.Created, 0)
+			if created.Before(userBilling.Data.LastStripeEvent) {
+				log.Printf("%v", "Stripe event "+event.Id+" is older than the last one applied for customer "+customerId)
+				if applyStale == nil {
+					return nil
+				}
+
+				before = userBilling.Data
+				applyStale(&userBilling.Data)
+				err = s.Billings.Save(&userBilling)
+				if err != nil {
+					return err
+				}
+
+				billingId = userBilling.Id
+				after = userBilling.Data
+				return nil
+			}
+
+			user, err := s.Users.Get(userBilling.Data.CreatedBy)
+			if err == repositories.ErrNotFound {
+				log.Printf("%v", "No user for Stripe customer "+customerId)
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			before = userBilling.Data
+			apply(&userBilling.Data, &user.Data)
+			userBilling.Data.LastStripeEvent = created
+			err = s.Billings.Save(&userBilling)
+			if err != nil {
+				return err
+			}
+
+			err = s.Users.Save(&user)
+			if err != nil {
+				return err
+			}
+
+			billingId = userBilling.Id
+			after = userBilling.Data
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("%v", err)
+		return err
+	}
+
+	if billingId != 0 {
+		recordAuditAs(r, 0, models.AuditBillingWebhook, "billings", billingId, before, after)
+	}
+	return nil
+}
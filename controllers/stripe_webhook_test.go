@@ -0,0 +1,461 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/news-ai/api-v1/billing"
+	"github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/repositories"
+)
+
+// The current period of the test billing, and the one after it
+var (
+	periodEnd     = time.Unix(1491004800, 0)
+	nextPeriodEnd = time.Unix(1493596800, 0)
+)
+
+func newWebhookTestStore() repositories.Store {
+	s := repositories.NewMemoryStore()
+	s.Plans.Create(&models.Plan{Name: "Personal", StripeId: "personal", Aliases: []string{"bronze", "personal"}, MonthlyPrice: 18.99, AnnualPrice: 15.99, Active: true})
+	s.Plans.Create(&models.Plan{Name: "Consultant", StripeId: "consultant", Aliases: []string{"aluminum", "consultant"}, MonthlyPrice: 34.99, AnnualPrice: 28.99, Active: true})
+	s.Plans.Create(&models.Plan{Name: "Business", StripeId: "business", Aliases: []string{"silver", "business"}, MonthlyPrice: 41.99, AnnualPrice: 34.99, Active: true})
+	SetStore(s)
+	return s
+}
+
+func testBilling() models.Billing {
+	return models.Billing{
+		StripeId:             "cus_1",
+		StripePlanId:         "business",
+		Expires:              periodEnd,
+		StripeSubscriptionId: "sub_1",
+		StripeInvoiceId:      "in_1",
+	}
+}
+
+func testInvoice(id, subscription, stripePlan string, end time.Time) billing.StripeInvoice {
+	invoice := billing.StripeInvoice{}
+	json.Unmarshal([]byte(fmt.Sprintf(`{"id":%q,"customer":"cus_1","subscription":%q,"paid":true,
+		"lines":{"data":[{"plan":{"id":%q},"period":{"start":%d,"end":%d}}]}}`,
+		id, subscription, stripePlan, end.AddDate(0, -1, 0).Unix(), end.Unix())), &invoice)
+	return invoice
+}
+
+func TestApplyInvoicePaid(t *testing.T) {
+	newWebhookTestStore()
+	defer func() { store = nil }()
+
+	tests := []struct {
+		name    string
+		billing func(b *models.Billing)
+		invoice billing.StripeInvoice
+		want    func(b *models.Billing)
+	}{
+		{
+			name:    "renewal",
+			invoice: testInvoice("in_2", "sub_1", "business", nextPeriodEnd),
+			want: func(b *models.Billing) {
+				b.Expires = nextPeriodEnd
+				b.StripeInvoiceId = "in_2"
+			},
+		},
+		{
+			name:    "first invoice of a pending downgrade",
+			billing: func(b *models.Billing) { b.PendingStripePlanId = "personal" },
+			invoice: testInvoice("in_2", "sub_1", "personal", nextPeriodEnd),
+			want: func(b *models.Billing) {
+				b.Expires = nextPeriodEnd
+				b.StripePlanId = "personal"
+				b.PendingStripePlanId = ""
+				b.StripeInvoiceId = "in_2"
+			},
+		},
+		{
+			name:    "old plan ids and yearly plans",
+			invoice: testInvoice("in_2", "sub_1", "bronze-yearly", nextPeriodEnd),
+			want: func(b *models.Billing) {
+				b.Expires = nextPeriodEnd
+				b.StripePlanId = "personal"
+				b.StripeInvoiceId = "in_2"
+			},
+		},
+		{
+			name:    "trial",
+			invoice: testInvoice("in_2", "sub_1", "business-trial", nextPeriodEnd),
+			want: func(b *models.Billing) {
+				b.Expires = nextPeriodEnd
+				b.IsOnTrial = true
+				b.StripeInvoiceId = "in_2"
+			},
+		},
+		{
+			name:    "earlier period",
+			invoice: testInvoice("in_0", "sub_1", "business", periodEnd.AddDate(0, -1, 0)),
+			want:    func(b *models.Billing) { b.StripeInvoiceId = "in_0" },
+		},
+		{
+			name:    "first subscription",
+			billing: func(b *models.Billing) { b.StripeSubscriptionId = "" },
+			invoice: testInvoice("in_2", "sub_2", "business", nextPeriodEnd),
+			want: func(b *models.Billing) {
+				b.Expires = nextPeriodEnd
+				b.StripeSubscriptionId = "sub_2"
+				b.StripeInvoiceId = "in_2"
+			},
+		},
+		{
+			name:    "other subscription",
+			invoice: testInvoice("in_2", "sub_trial", "business", nextPeriodEnd),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userBilling, user := testBilling(), models.User{}
+			if test.billing != nil {
+				test.billing(&userBilling)
+			}
+			want, wantActive := userBilling, false
+			if test.want != nil {
+				test.want(&want)
+				wantActive = true
+			}
+
+			applyInvoicePaid(test.invoice, &userBilling, &user)
+			if !reflect.DeepEqual(userBilling, want) {
+				t.Errorf("billing = %+v, want %+v", userBilling, want)
+			}
+			if user.IsActive != wantActive {
+				t.Errorf("IsActive = %v, want %v", user.IsActive, wantActive)
+			}
+		})
+	}
+}
+
+func TestApplyStaleInvoicePaid(t *testing.T) {
+	tests := []struct {
+		name    string
+		invoice billing.StripeInvoice
+		want    string
+	}{
+		{"current period", testInvoice("in_2", "sub_1", "personal", periodEnd), "in_2"},
+		{"later period", testInvoice("in_2", "sub_1", "personal", nextPeriodEnd), "in_2"},
+		{"earlier period", testInvoice("in_0", "sub_1", "business", periodEnd.AddDate(0, -1, 0)), "in_1"},
+		{"other subscription", testInvoice("in_2", "sub_trial", "business", periodEnd), "in_1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userBilling := testBilling()
+			want := testBilling()
+			want.StripeInvoiceId = test.want
+
+			// Only the invoice: the plan and the period are the newer event's
+			applyStaleInvoicePaid(test.invoice, &userBilling)
+			if !reflect.DeepEqual(userBilling, want) {
+				t.Errorf("billing = %+v, want %+v", userBilling, want)
+			}
+		})
+	}
+}
+
+func TestApplyInvoicePaymentFailed(t *testing.T) {
+	retry := int64(1491264000)
+	tests := []struct {
+		name         string
+		subscription string
+		next         *int64
+		active       bool
+	}{
+		{"retried", "sub_1", &retry, true},
+		{"last attempt", "sub_1", nil, false},
+		{"other subscription", "sub_trial", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userBilling, user := testBilling(), models.User{IsActive: true}
+			invoice := billing.StripeInvoice{Id: "in_2", Subscription: test.subscription, NextPaymentAttempt: test.next}
+
+			applyInvoicePaymentFailed(invoice, &userBilling, &user)
+			if user.IsActive != test.active {
+				t.Errorf("IsActive = %v, want %v", user.IsActive, test.active)
+			}
+			if !reflect.DeepEqual(userBilling, testBilling()) {
+				t.Errorf("billing = %+v, want it unchanged", userBilling)
+			}
+		})
+	}
+}
+
+func TestApplySubscriptionUpdated(t *testing.T) {
+	newWebhookTestStore()
+	defer func() { store = nil }()
+
+	subscription := func(status, stripePlan string) billing.StripeSubscription {
+		return billing.StripeSubscription{
+			Id:               "sub_1",
+			Customer:         "cus_1",
+			Status:           status,
+			CurrentPeriodEnd: nextPeriodEnd.Unix(),
+			Plan:             &billing.StripePlan{Id: stripePlan},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		billing      func(b *models.Billing)
+		subscription func() billing.StripeSubscription
+		want         func(b *models.Billing)
+		active       bool
+	}{
+		{
+			name:         "renewed",
+			subscription: func() billing.StripeSubscription { return subscription("active", "business") },
+			want:         func(b *models.Billing) { b.Expires = nextPeriodEnd },
+			active:       true,
+		},
+		{
+			name:         "upgraded",
+			subscription: func() billing.StripeSubscription { return subscription("active", "silver-yearly") },
+			billing:      func(b *models.Billing) { b.StripePlanId = "personal" },
+			want: func(b *models.Billing) {
+				b.Expires = nextPeriodEnd
+				b.StripePlanId = "business"
+			},
+			active: true,
+		},
+		{
+			name:         "downgrade asked for",
+			subscription: func() billing.StripeSubscription { return subscription("active", "personal") },
+			billing:      func(b *models.Billing) { b.PendingStripePlanId = "personal" },
+			want:         func(b *models.Billing) { b.Expires = nextPeriodEnd },
+			active:       true,
+		},
+		{
+			name:         "downgrade called off",
+			subscription: func() billing.StripeSubscription { return subscription("active", "business") },
+			billing:      func(b *models.Billing) { b.PendingStripePlanId = "personal" },
+			want: func(b *models.Billing) {
+				b.Expires = nextPeriodEnd
+				b.PendingStripePlanId = ""
+			},
+			active: true,
+		},
+		{
+			name: "cancelled at the end of the period",
+			subscription: func() billing.StripeSubscription {
+				s := subscription("active", "business")
+				s.CancelAtPeriodEnd = true
+				return s
+			},
+			want: func(b *models.Billing) {
+				b.Expires = nextPeriodEnd
+				b.IsCancel = true
+			},
+			active: true,
+		},
+		{
+			name:         "trialing",
+			subscription: func() billing.StripeSubscription { return subscription("trialing", "business") },
+			want: func(b *models.Billing) {
+				b.Expires = nextPeriodEnd
+				b.IsOnTrial = true
+			},
+			active: true,
+		},
+		{
+			name:         "past due",
+			subscription: func() billing.StripeSubscription { return subscription("past_due", "business") },
+			want:         func(b *models.Billing) { b.Expires = nextPeriodEnd },
+			active:       true,
+		},
+		{
+			name:         "unpaid",
+			subscription: func() billing.StripeSubscription { return subscription("unpaid", "business") },
+			want:         func(b *models.Billing) { b.Expires = nextPeriodEnd },
+			active:       false,
+		},
+		{
+			name: "other subscription",
+			subscription: func() billing.StripeSubscription {
+				s := subscription("canceled", "personal")
+				s.Id = "sub_trial"
+				return s
+			},
+			active: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userBilling, user := testBilling(), models.User{IsActive: true}
+			if test.billing != nil {
+				test.billing(&userBilling)
+			}
+			want := userBilling
+			if test.want != nil {
+				test.want(&want)
+			}
+
+			applySubscriptionUpdated(test.subscription(), &userBilling, &user)
+			if !reflect.DeepEqual(userBilling, want) {
+				t.Errorf("billing = %+v, want %+v", userBilling, want)
+			}
+			if user.IsActive != test.active {
+				t.Errorf("IsActive = %v, want %v", user.IsActive, test.active)
+			}
+		})
+	}
+}
+
+func TestApplySubscriptionDeleted(t *testing.T) {
+	ended := time.Unix(1489536000, 0)
+
+	userBilling, user := testBilling(), models.User{IsActive: true}
+	userBilling.IsOnTrial = true
+	applySubscriptionDeleted(billing.StripeSubscription{Id: "sub_1", EndedAt: ended.Unix()}, &userBilling, &user)
+
+	want := testBilling()
+	want.Expires = ended
+	want.IsCancel = true
+	if !reflect.DeepEqual(userBilling, want) || user.IsActive {
+		t.Errorf("after the deletion billing = %+v and IsActive = %v, want %+v and false", userBilling, user.IsActive, want)
+	}
+
+	// Starting a plan deletes the trial's subscription
+	userBilling, user = testBilling(), models.User{IsActive: true}
+	applySubscriptionDeleted(billing.StripeSubscription{Id: "sub_trial", EndedAt: ended.Unix()}, &userBilling, &user)
+	if !reflect.DeepEqual(userBilling, testBilling()) || !user.IsActive {
+		t.Errorf("after the deletion of another subscription billing = %+v and IsActive = %v, want them unchanged", userBilling, user.IsActive)
+	}
+}
+
+func TestApplyChargeRefunded(t *testing.T) {
+	tests := []struct {
+		name   string
+		charge billing.StripeCharge
+		ends   bool
+	}{
+		{"full refund", billing.StripeCharge{Invoice: "in_1", Amount: 4199, AmountRefunded: 4199}, true},
+		{"marked refunded", billing.StripeCharge{Invoice: "in_1", Refunded: true}, true},
+		{"partial refund", billing.StripeCharge{Invoice: "in_1", Amount: 4199, AmountRefunded: 1000}, false},
+		{"earlier invoice", billing.StripeCharge{Invoice: "in_0", Refunded: true}, false},
+		{"outside the subscription", billing.StripeCharge{Refunded: true}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userBilling, user := testBilling(), models.User{IsActive: true}
+
+			applyChargeRefunded(test.charge, &userBilling, &user)
+			ended := !userBilling.Expires.Equal(periodEnd)
+			if ended != test.ends || user.IsActive == test.ends {
+				t.Errorf("Expires = %v and IsActive = %v, want the period ended: %v", userBilling.Expires, user.IsActive, test.ends)
+			}
+		})
+	}
+}
+
+/*
+* HandleStripeWebhook
+ */
+
+func stripeEvent(t *testing.T, id, eventType string, created time.Time, object interface{}) *http.Request {
+	data, err := json.Marshal(object)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"id":      id,
+		"type":    eventType,
+		"created": created.Unix(),
+		"data":    map[string]json.RawMessage{"object": data},
+	})
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(os.Getenv("STRIPE_WEBHOOK_SECRET")))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+
+	r, _ := http.NewRequest("POST", "/api/billing/webhook", bytes.NewReader(payload))
+	r.Header.Set("Stripe-Signature", "t="+timestamp+",v1="+hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+func TestHandleStripeWebhook(t *testing.T) {
+	os.Setenv("STRIPE_WEBHOOK_SECRET", "whsec_test")
+	defer os.Unsetenv("STRIPE_WEBHOOK_SECRET")
+	s := newWebhookTestStore()
+	defer func() { store = nil }()
+
+	user := models.UserPostgres{Data: models.User{IsActive: true}}
+	s.Users.Create(&user)
+	userBilling := models.BillingPostgres{Data: testBilling()}
+	userBilling.Data.CreatedBy = user.Id
+	s.Billings.Create(&userBilling)
+
+	handle := func(r *http.Request) (models.Billing, bool) {
+		if err := HandleStripeWebhook(r); err != nil {
+			t.Fatalf("HandleStripeWebhook: %v", err)
+		}
+		b, _ := s.Billings.Get(userBilling.Id)
+		u, _ := s.Users.Get(user.Id)
+		return b.Data, u.Data.IsActive
+	}
+
+	start := periodEnd.Add(-time.Hour)
+	renewal := testInvoice("in_2", "sub_1", "business", nextPeriodEnd)
+	renewed := billing.StripeSubscription{Id: "sub_1", Customer: "cus_1", Status: "active", CurrentPeriodEnd: nextPeriodEnd.Unix(), Plan: &billing.StripePlan{Id: "business"}}
+
+	// Stripe sends the renewal's subscription.updated before its invoice.paid
+	got, active := handle(stripeEvent(t, "evt_1", billing.StripeSubscriptionUpdated, start.Add(2*time.Second), renewed))
+	if !got.Expires.Equal(nextPeriodEnd) || !active {
+		t.Fatalf("after subscription.updated billing = %+v, IsActive = %v", got, active)
+	}
+
+	// The invoice is older, but it is still the one that paid for the period
+	got, _ = handle(stripeEvent(t, "evt_2", billing.StripeInvoicePaid, start.Add(time.Second), renewal))
+	if got.StripeInvoiceId != "in_2" || !got.LastStripeEvent.Equal(start.Add(2*time.Second)) {
+		t.Fatalf("after a late invoice.paid billing = %+v, want in_2 recorded and LastStripeEvent kept", got)
+	}
+
+	// A late subscription.updated of before the renewal changes nothing
+	old := renewed
+	old.CurrentPeriodEnd = periodEnd.Unix()
+	old.Plan = &billing.StripePlan{Id: "personal"}
+	got, _ = handle(stripeEvent(t, "evt_3", billing.StripeSubscriptionUpdated, start, old))
+	if !got.Expires.Equal(nextPeriodEnd) || got.StripePlanId != "business" {
+		t.Fatalf("after a late subscription.updated billing = %+v, want it unchanged", got)
+	}
+
+	// So refunding the renewal takes the period back
+	refund := billing.StripeCharge{Id: "ch_2", Customer: "cus_1", Invoice: "in_2", Amount: 4199, AmountRefunded: 4199}
+	got, active = handle(stripeEvent(t, "evt_4", billing.StripeChargeRefunded, start.Add(3*time.Second), refund))
+	if got.Expires.Equal(nextPeriodEnd) || active {
+		t.Fatalf("after charge.refunded billing = %+v, IsActive = %v, want the period ended", got, active)
+	}
+
+	// Stripe delivering an event again doesn't apply it again
+	got, active = handle(stripeEvent(t, "evt_1", billing.StripeSubscriptionUpdated, start.Add(4*time.Second), renewed))
+	if got.Expires.Equal(nextPeriodEnd) || active {
+		t.Errorf("after evt_1 again billing = %+v, IsActive = %v, want it skipped", got, active)
+	}
+
+	// Nor does it fail for customers and event types we don't know
+	stranger := billing.StripeCharge{Id: "ch_3", Customer: "cus_2", Invoice: "in_3", Refunded: true}
+	handle(stripeEvent(t, "evt_5", billing.StripeChargeRefunded, start.Add(5*time.Second), stranger))
+	handle(stripeEvent(t, "evt_6", "customer.created", start.Add(5*time.Second), map[string]string{"id": "cus_3"}))
+
+	r := stripeEvent(t, "evt_7", billing.StripeChargeRefunded, start.Add(6*time.Second), refund)
+	r.Header.Set("Stripe-Signature", "t=1,v1=00")
+	if err := HandleStripeWebhook(r); err != billing.ErrInvalidSignature {
+		t.Errorf("HandleStripeWebhook with a bad signature = %v, want %v", err, billing.ErrInvalidSignature)
+	}
+}
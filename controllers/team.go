@@ -5,12 +5,14 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/pquerna/ffjson/ffjson"
 
-	"github.com/news-ai/api-v1/db"
 	"github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/repositories"
 
+	"github.com/news-ai/web/permissions"
 	"github.com/news-ai/web/utilities"
 )
 
@@ -28,14 +30,13 @@ func getTeam(id int64) (models.Team, error) {
 	}
 
 	// Get the team details by id
-	var team models.Team
-	err := db.DB.Model(&team).Where("id = ?", id).Select()
+	team, err := getStore().Teams.Get(id)
 	if err != nil {
 		log.Printf("%v", err)
 		return models.Team{}, err
 	}
 
-	if !team.Created.IsZero() {
+	if !team.Created.IsZero() && !team.IsDeleted() {
 		team.Type = "teams"
 		return team, nil
 	}
@@ -43,6 +44,20 @@ func getTeam(id int64) (models.Team, error) {
 	return models.Team{}, errors.New("No team by this id")
 }
 
+// Teams can be deleted by whoever created them and by their admins
+func canManageTeam(currentUser models.UserPostgres, team models.Team) bool {
+	if currentUser.Data.IsAdmin || permissions.AccessToObject(team.CreatedBy, currentUser.Id) {
+		return true
+	}
+
+	for i := 0; i < len(team.Admins); i++ {
+		if team.Admins[i] == currentUser.Id {
+			return true
+		}
+	}
+	return false
+}
+
 /*
 * Public methods
  */
@@ -63,8 +78,7 @@ func GetTeams(r *http.Request) ([]models.Team, interface{}, int, int, error) {
 		return []models.Team{}, nil, 0, 0, errors.New("Forbidden")
 	}
 
-	teams := []models.Team{}
-	err = db.DB.Model(&teams).Where("created_by = ?", user.Id).Select()
+	teams, err := getStore().Teams.ListCreatedBy(user.Id)
 	if err != nil {
 		log.Printf("%v", err)
 		return []models.Team{}, nil, 0, 0, err
@@ -122,22 +136,12 @@ func CreateTeam(r *http.Request) ([]models.Team, interface{}, error) {
 		return []models.Team{}, nil, errors.New("The number of members is greater than the allowed number of members")
 	}
 
-	// Create team
-	_, err = team.Create(r, currentUser)
-	if err != nil {
-		log.Printf("%v", err)
-		return []models.Team{}, nil, err
-	}
-
-	// Add team Id to team members
 	// Validate member accounts
-	confirmMembers := []int64{}
+	members := []models.UserPostgres{}
 	for i := 0; i < len(team.Members); i++ {
 		user, err := getUser(r, team.Members[i])
 		if err == nil && user.Data.TeamId == 0 {
-			confirmMembers = append(confirmMembers, user.Id)
-			user.Data.TeamId = team.Id
-			user.Save()
+			members = append(members, user)
 		}
 	}
 
@@ -150,9 +154,115 @@ func CreateTeam(r *http.Request) ([]models.Team, interface{}, error) {
 		}
 	}
 
-	team.Members = confirmMembers
-	team.Admins = confirmAdmins
-	team.Save()
+	// Create the team and add its id to the members in one transaction, so
+	// no user ends up pointing at a team that was never finalized.
+	err = getStore().RunInTransaction(func(s repositories.Store) error {
+		team.CreatedBy = currentUser.Id
+		team.Created = time.Now()
+		err := s.Teams.Create(&team)
+		if err != nil {
+			return err
+		}
+
+		confirmMembers := []int64{}
+		for i := 0; i < len(members); i++ {
+			members[i].Data.TeamId = team.Id
+			members[i].Data.Updated = time.Now()
+			err = s.Users.Save(&members[i])
+			if err != nil {
+				return err
+			}
+			confirmMembers = append(confirmMembers, members[i].Id)
+		}
+
+		team.Members = confirmMembers
+		team.Admins = confirmAdmins
+		team.Updated = time.Now()
+		return s.Teams.Save(&team)
+	})
+	if err != nil {
+		log.Printf("%v", err)
+		return []models.Team{}, nil, err
+	}
 
 	return []models.Team{team}, nil, nil
 }
+
+/*
+* Delete methods
+ */
+
+func DeleteTeam(r *http.Request, id string) (models.Team, interface{}, error) {
+	currentUser, err := GetCurrentUser(r)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Team{}, nil, err
+	}
+
+	currentId, err := utilities.StringIdToInt(id)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Team{}, nil, err
+	}
+
+	team, err := getTeam(currentId)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Team{}, nil, err
+	}
+
+	if !canManageTeam(currentUser, team) {
+		return models.Team{}, nil, errors.New("Forbidden")
+	}
+
+	before := team
+	team.SoftDelete()
+	err = getStore().Teams.Save(&team)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Team{}, nil, err
+	}
+
+	recordAudit(r, models.AuditTeamDelete, "teams", team.Id, before, team)
+	return team, nil, nil
+}
+
+/*
+* Action methods
+ */
+
+func RestoreTeam(r *http.Request, id string) (models.Team, interface{}, error) {
+	_, err := getCurrentAdmin(r)
+	if err != nil {
+		return models.Team{}, nil, err
+	}
+
+	currentId, err := utilities.StringIdToInt(id)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Team{}, nil, err
+	}
+
+	// getTeam hides deleted teams, so go to the store directly
+	team, err := getStore().Teams.Get(currentId)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Team{}, nil, err
+	}
+
+	if !team.IsDeleted() {
+		return models.Team{}, nil, errors.New("Team is not deleted")
+	}
+
+	before := team
+	team.Restore()
+	err = getStore().Teams.Save(&team)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Team{}, nil, err
+	}
+
+	recordAudit(r, models.AuditTeamRestore, "teams", team.Id, before, team)
+	team.Type = "teams"
+	return team, nil, nil
+}
@@ -0,0 +1,297 @@
+package controllers
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	gcontext "github.com/gorilla/context"
+	"github.com/pquerna/ffjson/ffjson"
+
+	"github.com/news-ai/api-v1/models"
+
+	"github.com/news-ai/web/permissions"
+	"github.com/news-ai/web/utilities"
+)
+
+var ErrInvalidTwoFactorCode = errors.New("Invalid two-factor code")
+
+type twoFactorRequest struct {
+	Code string `json:"code"`
+}
+
+type teamTwoFactorRequest struct {
+	Required bool `json:"required"`
+}
+
+/*
+* Private methods
+ */
+
+func decodeTwoFactorCode(r *http.Request) (string, error) {
+	buf, _ := ioutil.ReadAll(r.Body)
+	decoder := ffjson.NewDecoder()
+	var request twoFactorRequest
+	err := decoder.Decode(buf, &request)
+	if err != nil {
+		log.Printf("%v", err)
+		return "", err
+	}
+	return request.Code, nil
+}
+
+// Saves the signed in user and puts the new version back in the context,
+// so a later save in the same request does not conflict.
+func saveCurrentUser(r *http.Request, user *models.UserPostgres) error {
+	_, err := SaveUser(r, user)
+	if err != nil {
+		return err
+	}
+	gcontext.Set(r, "user", *user)
+	return nil
+}
+
+func teamRequiresTwoFactor(user models.UserPostgres) bool {
+	if user.Data.TeamId == 0 {
+		return false
+	}
+
+	team, err := getTeam(user.Data.TeamId)
+	if err != nil {
+		return false
+	}
+	return team.RequireTwoFactor
+}
+
+/*
+* Public methods
+ */
+
+/*
+* Get methods
+ */
+
+// UserRequiresTwoFactor is true when the user has turned two-factor on,
+// or their team makes everyone use it.
+func UserRequiresTwoFactor(user models.UserPostgres) bool {
+	return user.Data.TwoFactorEnabled || teamRequiresTwoFactor(user)
+}
+
+func GetTwoFactorStatus(r *http.Request, id string) (models.TwoFactorStatus, interface{}, error) {
+	user, err := getOwnUser(r, id)
+	if err != nil {
+		return models.TwoFactorStatus{}, nil, err
+	}
+
+	status := models.TwoFactorStatus{
+		Enabled:           user.Data.TwoFactorEnabled,
+		Required:          teamRequiresTwoFactor(user),
+		RecoveryCodesLeft: len(user.Data.TwoFactorRecoveryCodes),
+	}
+	return status, nil, nil
+}
+
+/*
+* Update methods
+ */
+
+// StartTwoFactorEnrollment gives the user a new pending secret. It only
+// replaces the active one once it is confirmed with a code.
+func StartTwoFactorEnrollment(r *http.Request, user *models.UserPostgres) (models.TwoFactorEnrollment, error) {
+	secret, err := models.NewTwoFactorSecret()
+	if err != nil {
+		log.Printf("%v", err)
+		return models.TwoFactorEnrollment{}, err
+	}
+
+	user.Data.TwoFactorPendingSecret = secret
+	_, err = SaveUser(r, user)
+	if err != nil {
+		return models.TwoFactorEnrollment{}, err
+	}
+
+	return models.TwoFactorEnrollment{
+		Secret: secret,
+		URI:    models.TwoFactorURI(user.Data.Email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactorEnrollment turns two-factor on if code matches the
+// pending secret, and returns a fresh set of recovery codes.
+func ConfirmTwoFactorEnrollment(r *http.Request, user *models.UserPostgres, code string) (models.TwoFactorRecoveryCodes, error) {
+	if user.Data.TwoFactorPendingSecret == "" {
+		return models.TwoFactorRecoveryCodes{}, errors.New("Two-factor enrollment has not been started")
+	}
+
+	step := models.CheckTwoFactorCode(user.Data.TwoFactorPendingSecret, code, 0)
+	if step == 0 {
+		return models.TwoFactorRecoveryCodes{}, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := models.NewRecoveryCodes()
+	if err != nil {
+		log.Printf("%v", err)
+		return models.TwoFactorRecoveryCodes{}, err
+	}
+
+	before := user.Data
+	user.Data.TwoFactorEnabled = true
+	user.Data.TwoFactorSecret = user.Data.TwoFactorPendingSecret
+	user.Data.TwoFactorPendingSecret = ""
+	user.Data.TwoFactorLastStep = step
+	user.Data.TwoFactorRecoveryCodes = hashes
+	_, err = SaveUser(r, user)
+	if err != nil {
+		return models.TwoFactorRecoveryCodes{}, err
+	}
+
+	recordAudit(r, models.AuditUserTwoFactorEnable, "users", user.Id, before, user.Data)
+	return models.TwoFactorRecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+// ValidateTwoFactor checks a code from the user's app or one of their
+// recovery codes. Either one can only be used once.
+func ValidateTwoFactor(r *http.Request, user *models.UserPostgres, code string) error {
+	if !user.Data.TwoFactorEnabled {
+		return errors.New("Two-factor is not enabled")
+	}
+
+	step := models.CheckTwoFactorCode(user.Data.TwoFactorSecret, code, user.Data.TwoFactorLastStep)
+	if step != 0 {
+		user.Data.TwoFactorLastStep = step
+	} else if !user.Data.UseRecoveryCode(code) {
+		return ErrInvalidTwoFactorCode
+	}
+
+	_, err := SaveUser(r, user)
+	return err
+}
+
+func EnrollTwoFactor(r *http.Request, id string) (models.TwoFactorEnrollment, interface{}, error) {
+	user, err := getOwnUser(r, id)
+	if err != nil {
+		return models.TwoFactorEnrollment{}, nil, err
+	}
+
+	if user.Data.TwoFactorEnabled {
+		return models.TwoFactorEnrollment{}, nil, errors.New("Two-factor is already enabled")
+	}
+
+	enrollment, err := StartTwoFactorEnrollment(r, &user)
+	if err != nil {
+		return models.TwoFactorEnrollment{}, nil, err
+	}
+
+	gcontext.Set(r, "user", user)
+	return enrollment, nil, nil
+}
+
+func ConfirmTwoFactor(r *http.Request, id string) (models.TwoFactorRecoveryCodes, interface{}, error) {
+	user, err := getOwnUser(r, id)
+	if err != nil {
+		return models.TwoFactorRecoveryCodes{}, nil, err
+	}
+
+	code, err := decodeTwoFactorCode(r)
+	if err != nil {
+		return models.TwoFactorRecoveryCodes{}, nil, err
+	}
+
+	codes, err := ConfirmTwoFactorEnrollment(r, &user, code)
+	if err != nil {
+		return models.TwoFactorRecoveryCodes{}, nil, err
+	}
+
+	gcontext.Set(r, "user", user)
+	return codes, nil, nil
+}
+
+// Turning two-factor off needs a current code, and is not allowed while
+// the user's team requires it.
+func DisableTwoFactor(r *http.Request, id string) (models.TwoFactorStatus, interface{}, error) {
+	user, err := getOwnUser(r, id)
+	if err != nil {
+		return models.TwoFactorStatus{}, nil, err
+	}
+
+	if teamRequiresTwoFactor(user) {
+		return models.TwoFactorStatus{}, nil, errors.New("Your team requires two-factor authentication")
+	}
+
+	code, err := decodeTwoFactorCode(r)
+	if err != nil {
+		return models.TwoFactorStatus{}, nil, err
+	}
+
+	err = ValidateTwoFactor(r, &user, code)
+	if err != nil {
+		return models.TwoFactorStatus{}, nil, err
+	}
+
+	before := user.Data
+	user.Data.TwoFactorEnabled = false
+	user.Data.TwoFactorSecret = ""
+	user.Data.TwoFactorLastStep = 0
+	user.Data.TwoFactorRecoveryCodes = []string{}
+	err = saveCurrentUser(r, &user)
+	if err != nil {
+		return models.TwoFactorStatus{}, nil, err
+	}
+
+	recordAudit(r, models.AuditUserTwoFactorDisable, "users", user.Id, before, user.Data)
+	return models.TwoFactorStatus{}, nil, nil
+}
+
+// SetTeamTwoFactor is open to site admins and the team's own admins.
+func SetTeamTwoFactor(r *http.Request, id string) (models.Team, interface{}, error) {
+	currentUser, err := GetCurrentUser(r)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Team{}, nil, err
+	}
+
+	currentId, err := utilities.StringIdToInt(id)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Team{}, nil, err
+	}
+
+	team, err := getTeam(currentId)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Team{}, nil, err
+	}
+
+	isTeamAdmin := false
+	for i := 0; i < len(team.Admins); i++ {
+		if permissions.AccessToObject(team.Admins[i], currentUser.Id) {
+			isTeamAdmin = true
+		}
+	}
+
+	if !isTeamAdmin && !currentUser.Data.IsAdmin {
+		return models.Team{}, nil, errors.New("Forbidden")
+	}
+
+	buf, _ := ioutil.ReadAll(r.Body)
+	decoder := ffjson.NewDecoder()
+	var request teamTwoFactorRequest
+	err = decoder.Decode(buf, &request)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Team{}, nil, err
+	}
+
+	before := team
+	team.RequireTwoFactor = request.Required
+	err = getStore().Teams.Save(&team)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.Team{}, nil, err
+	}
+
+	recordAudit(r, models.AuditTeamRequireTwoFactor, "teams", team.Id, before, team)
+	team.Type = "teams"
+	return team, nil, nil
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"net/mail"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,8 +14,8 @@ import (
 	"github.com/pquerna/ffjson/ffjson"
 
 	"github.com/news-ai/api-v1/billing"
-	"github.com/news-ai/api-v1/db"
 	"github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/repositories"
 
 	"github.com/news-ai/tabulae-v1/emails"
 
@@ -22,6 +23,8 @@ import (
 	"github.com/news-ai/web/utilities"
 )
 
+var ErrEmailRegistered = errors.New("User with the email already exists")
+
 /*
 * Private methods
  */
@@ -32,14 +35,13 @@ import (
 
 func getUser(r *http.Request, id int64) (models.UserPostgres, error) {
 	// Get the current signed in user details by Id
-	postgresUser := models.UserPostgres{}
-	err := db.DB.Model(&postgresUser).Where("id = ?", id).Select()
+	postgresUser, err := getStore().Users.Get(id)
 	if err != nil {
 		log.Printf("%v", err)
 		return models.UserPostgres{}, err
 	}
 
-	if postgresUser.Data.Email != "" {
+	if postgresUser.Data.Email != "" && !postgresUser.Data.IsDeleted() {
 		// postgresUser.Format(userId, "users")
 		currentUser, err := GetCurrentUser(r)
 		if err != nil {
@@ -73,8 +75,7 @@ func getUsers(r *http.Request) ([]models.UserPostgres, error) {
 		return []models.UserPostgres{}, errors.New("Forbidden")
 	}
 
-	postgresUsers := []models.UserPostgres{}
-	err = db.DB.Model(&postgresUsers).Select()
+	postgresUsers, err := getStore().Users.List()
 	if err != nil {
 		log.Printf("%v", err)
 		return []models.UserPostgres{}, err
@@ -90,14 +91,13 @@ func getUsers(r *http.Request) ([]models.UserPostgres, error) {
 
 func getUserUnauthorized(r *http.Request, id int64) (models.UserPostgres, error) {
 	// Get the current signed in user details by Id
-	postgresUser := models.UserPostgres{}
-	err := db.DB.Model(&postgresUser).Where("id = ?", id).Select()
+	postgresUser, err := getStore().Users.Get(id)
 	if err != nil {
 		log.Printf("%v", err)
 		return models.UserPostgres{}, err
 	}
 
-	if postgresUser.Data.Email != "" {
+	if postgresUser.Data.Email != "" && !postgresUser.Data.IsDeleted() {
 		postgresUser.Data.Type = "users"
 		postgresUser.Data.Id = postgresUser.Id
 		return postgresUser, nil
@@ -108,8 +108,7 @@ func getUserUnauthorized(r *http.Request, id int64) (models.UserPostgres, error)
 
 func getUsersUnauthorized(r *http.Request) ([]models.UserPostgres, error) {
 	// Get the current signed in user details by Id
-	postgresUsers := []models.UserPostgres{}
-	err := db.DB.Model(&postgresUsers).Select()
+	postgresUsers, err := getStore().Users.List()
 	if err != nil {
 		log.Printf("%v", err)
 		return []models.UserPostgres{}, err
@@ -124,14 +123,14 @@ func getUsersUnauthorized(r *http.Request) ([]models.UserPostgres, error) {
 }
 
 func filterUser(queryType, query string) (models.UserPostgres, error) {
-	postgresUser := models.UserPostgres{}
-	err := db.DB.Model(&postgresUser).Where("data->>'" + queryType + "' = '" + query + "'").Select()
+	postgresUsers, err := getStore().Users.Find(repositories.UserLookup(queryType, query))
 	if err != nil {
 		log.Printf("%v", err)
 		return models.UserPostgres{}, err
 	}
 
-	if postgresUser.Data.Email != "" {
+	if len(postgresUsers) > 0 && postgresUsers[0].Data.Email != "" {
+		postgresUser := postgresUsers[0]
 		postgresUser.Data.Type = "users"
 		postgresUser.Data.Id = postgresUser.Id
 		return postgresUser, nil
@@ -141,8 +140,7 @@ func filterUser(queryType, query string) (models.UserPostgres, error) {
 }
 
 func filterUserConfirmed(queryType, query string) (models.UserPostgres, error) {
-	postgresUsers := []models.UserPostgres{}
-	err := db.DB.Model(&postgresUsers).Where("data->>'" + queryType + "' = '" + query + "'").Select()
+	postgresUsers, err := getStore().Users.Find(repositories.NewUserFilter().Equals(queryType, query))
 	if err != nil {
 		log.Printf("%v", err)
 	}
@@ -202,6 +200,90 @@ func GetUsers(r *http.Request) ([]models.User, interface{}, int, int, error) {
 	return users, nil, 0, 0, nil
 }
 
+// Admin search over users. Every query parameter is optional:
+// email/firstname/lastname match by prefix, emails is a comma separated
+// list, isactive/isbanned/isadmin/emailconfirmed are flags and
+// createdfrom/createdto are RFC3339 timestamps.
+func SearchUsers(r *http.Request) ([]models.User, interface{}, int, int, error) {
+	currentUser, err := GetCurrentUser(r)
+	if err != nil {
+		log.Printf("%v", err)
+		return []models.User{}, nil, 0, 0, err
+	}
+
+	if !currentUser.Data.IsAdmin {
+		return []models.User{}, nil, 0, 0, errors.New("Forbidden")
+	}
+
+	query := r.URL.Query()
+	filter := repositories.NewUserFilter()
+
+	for _, key := range []string{"email", "firstname", "lastname"} {
+		if query.Get(key) != "" {
+			value := query.Get(key)
+			if key == "email" {
+				value = strings.ToLower(value)
+			}
+			filter.Prefix(key, value)
+		}
+	}
+
+	if query.Get("emails") != "" {
+		emailList := strings.Split(strings.ToLower(query.Get("emails")), ",")
+		filter.In("email", emailList...)
+	}
+
+	for _, key := range []string{"isactive", "isbanned", "isadmin", "emailconfirmed"} {
+		if query.Get(key) != "" {
+			flag, err := strconv.ParseBool(query.Get(key))
+			if err != nil {
+				return []models.User{}, nil, 0, 0, errors.New("Invalid value for " + key)
+			}
+			filter.Flag(key, flag)
+		}
+	}
+
+	createdFrom := time.Time{}
+	createdTo := time.Time{}
+	if query.Get("createdfrom") != "" {
+		createdFrom, err = time.Parse(time.RFC3339, query.Get("createdfrom"))
+		if err != nil {
+			return []models.User{}, nil, 0, 0, errors.New("Invalid value for createdfrom")
+		}
+	}
+	if query.Get("createdto") != "" {
+		createdTo, err = time.Parse(time.RFC3339, query.Get("createdto"))
+		if err != nil {
+			return []models.User{}, nil, 0, 0, errors.New("Invalid value for createdto")
+		}
+	}
+	if !createdFrom.IsZero() || !createdTo.IsZero() {
+		filter.Between("created", createdFrom, createdTo)
+	}
+
+	if offset, ok := gcontext.GetOk(r, "offset"); ok {
+		filter.Offset(offset.(int))
+	}
+	if limit, ok := gcontext.GetOk(r, "limit"); ok {
+		filter.Limit(limit.(int))
+	}
+
+	postgresUsers, err := getStore().Users.Find(filter)
+	if err != nil {
+		log.Printf("%v", err)
+		return []models.User{}, nil, 0, 0, err
+	}
+
+	users := []models.User{}
+	for i := 0; i < len(postgresUsers); i++ {
+		postgresUsers[i].Data.Type = "users"
+		postgresUsers[i].Data.Id = postgresUsers[i].Id
+		users = append(users, postgresUsers[i].Data)
+	}
+
+	return users, nil, len(users), 0, nil
+}
+
 func GetUser(r *http.Request, id string) (models.User, interface{}, error) {
 	switch id {
 	case "me":
@@ -210,6 +292,7 @@ func GetUser(r *http.Request, id string) (models.User, interface{}, error) {
 			log.Printf("%v", err)
 			return models.User{}, nil, err
 		}
+		user.Data.ImpersonatedBy = GetImpersonatorId(r)
 		return user.Data, nil, err
 	default:
 		userId, err := utilities.StringIdToInt(id)
@@ -269,43 +352,6 @@ func GetUserByEmailForValidation(email string) (models.UserPostgres, error) {
 	return postgresUser, nil
 }
 
-func GetUserFromApiKey(apiKey string) (models.UserPostgres, error) {
-	postgresUser, err := filterUser("apikey", apiKey)
-	if err != nil {
-		log.Printf("%v", err)
-		return models.UserPostgres{}, err
-	}
-
-	return postgresUser, nil
-}
-
-func GetUserByConfirmationCode(confirmationCode string) (models.UserPostgres, error) {
-	postgresUser, err := filterUser("confirmationcode", confirmationCode)
-	if err != nil {
-		log.Printf("%v", err)
-
-		userBackup, errBackup := filterUser("confirmationcodebackup", confirmationCode)
-		if errBackup != nil {
-			log.Printf("%v", err)
-			return models.UserPostgres{}, errBackup
-		}
-
-		return userBackup, nil
-	}
-
-	return postgresUser, nil
-}
-
-func GetUserByResetCode(resetCode string) (models.UserPostgres, error) {
-	postgresUser, err := filterUser("resetpasswordcode", resetCode)
-	if err != nil {
-		log.Printf("%v", err)
-		return models.UserPostgres{}, err
-	}
-
-	return postgresUser, nil
-}
-
 func GetCurrentUser(r *http.Request) (models.UserPostgres, error) {
 	// Get the current user
 	_, ok := gcontext.GetOk(r, "user")
@@ -329,13 +375,16 @@ func GetUserByIdUnauthorized(r *http.Request, userId int64) (models.UserPostgres
 
 func AddUserToContext(r *http.Request, email string) {
 	_, ok := gcontext.GetOk(r, "user")
+	// Update can save the user, so the context has to get the copy with
+	// the new version or the next save in this request would conflict.
 	if !ok {
 		user, _ := GetUserByEmail(email)
-		gcontext.Set(r, "user", user)
 		Update(r, &user)
+		gcontext.Set(r, "user", user)
 	} else {
 		user := gcontext.Get(r, "user").(models.UserPostgres)
 		Update(r, &user)
+		gcontext.Set(r, "user", user)
 	}
 }
 
@@ -394,13 +443,10 @@ func AddPlanToUser(r *http.Request, id string) (models.User, interface{}, error)
 	}
 
 	originalPlan := ""
-	switch userNewPlan.Plan {
-	case "bronze":
-		originalPlan = "Personal"
-	case "silver-1":
-		originalPlan = "Freelancer"
-	case "gold-1":
-		originalPlan = "Business"
+	plan, err := billing.LookupPlan(userNewPlan.Plan)
+	if err == nil {
+		originalPlan = plan.Name
+		userNewPlan.Plan = plan.StripeId
 	}
 
 	if userNewPlan.Duration != "monthly" && userNewPlan.Duration != "annually" {
@@ -415,12 +461,15 @@ func AddPlanToUser(r *http.Request, id string) (models.User, interface{}, error)
 		return models.User{}, nil, errors.New("Original Plan is invalid")
 	}
 
+	before := userBilling.Data
 	err = billing.AddPlanToUser(r, postgresUser, &userBilling, userNewPlan.Plan, userNewPlan.Duration, userNewPlan.Coupon, originalPlan)
 	if err != nil {
 		log.Printf("%v", err)
 		return models.User{}, nil, err
 	}
 
+	recordAudit(r, models.AuditBillingAddPlan, "users", postgresUser.Id, before, userBilling.Data)
+
 	return postgresUser.Data, userBilling.Data, nil
 }
 
@@ -497,10 +546,17 @@ func AddEmailToUser(r *http.Request, id string) (models.User, interface{}, error
 		}
 	}
 
+	err = CheckEntitlement(r, user, models.EntitlementEmailAccounts, 1)
+	if err != nil {
+		return models.User{}, nil, err
+	}
+
 	userEmailCode := models.UserEmailCode{}
 	userEmailCode.InviteCode = utilities.RandToken()
 	userEmailCode.Email = validEmail.Address
-	userEmailCode.Create(r, currentUser)
+	userEmailCode.CreatedBy = currentUser.Id
+	userEmailCode.Created = time.Now()
+	getStore().EmailCodes.Create(&userEmailCode)
 
 	// Send Confirmation Email to this email address
 	err = emails.AddEmailToUser(user.Data, validEmail.Address, userEmailCode.InviteCode)
@@ -572,12 +628,22 @@ func RemoveEmailFromUser(r *http.Request, id string) (models.User, interface{},
 		}
 	}
 
-	SaveUser(r, &user)
+	_, err = SaveUser(r, &user)
+	if err != nil {
+		return user.Data, nil, err
+	}
+
 	return user.Data, nil, nil
 }
 
+// GetUserDailyEmail returns how many emails the user has sent today.
 func GetUserDailyEmail(r *http.Request, user models.UserPostgres) int {
-	return 0
+	used, err := entitlementUsed(user, models.EntitlementEmailsPerDay, time.Now())
+	if err != nil {
+		log.Printf("%v", err)
+		return 0
+	}
+	return used
 }
 
 func GetUserPlanDetails(r *http.Request, id string) (models.UserPlan, interface{}, error) {
@@ -617,9 +683,17 @@ func GetUserPlanDetails(r *http.Request, id string) (models.UserPlan, interface{
 		return models.UserPlan{}, nil, err
 	}
 
+	entitlements, err := ResolveEntitlements(r, user)
+	if err != nil {
+		return models.UserPlan{}, nil, err
+	}
+
 	userPlan := models.UserPlan{}
-	userPlanName := billing.BillingIdToPlanName(userBilling.Data.StripePlanId)
-	userPlan.PlanName = userPlanName
+	userPlan.PlanName = billing.BillingIdToPlanName(userBilling.Data.StripePlanId)
+	userPlan.EmailAccounts = entitlements.Limits[models.EntitlementEmailAccounts]
+	userPlan.DailyEmailsAllowed = entitlements.Limits[models.EntitlementEmailsPerDay]
+	userPlan.EmailsSentToday = entitlements.Used[models.EntitlementEmailsPerDay]
+	userPlan.OnTrial = userBilling.Data.IsOnTrial
 	return userPlan, nil, nil
 }
 
@@ -656,8 +730,7 @@ func ConfirmAddEmailToUser(r *http.Request, id string) (models.User, interface{}
 	}
 
 	if r.URL.Query().Get("code") != "" {
-		userEmailCode := models.UserEmailCode{}
-		err := db.DB.Model(&userEmailCode).Where("invite_code = ?", r.URL.Query().Get("code")).Select()
+		userEmailCode, err := getStore().EmailCodes.FindByCode(r.URL.Query().Get("code"))
 		if err != nil {
 			log.Printf("%v", err)
 			return models.User{}, nil, err
@@ -678,6 +751,12 @@ func ConfirmAddEmailToUser(r *http.Request, id string) (models.User, interface{}
 			}
 
 			if !alreadyExists {
+				// The plan may have changed since the code was sent
+				err = CheckEntitlement(r, user, models.EntitlementEmailAccounts, 1)
+				if err != nil {
+					return models.User{}, nil, err
+				}
+
 				user.Data.Emails = append(user.Data.Emails, userEmailCode.Email)
 				SaveUser(r, &user)
 			}
@@ -740,18 +819,64 @@ func FeedbackFromUser(r *http.Request, id string) (models.User, interface{}, err
 
 	// Set the trial feedback to true - since they gave us feedback now
 	user.Data.TrialFeedback = true
-	user.Save()
+	_, err = user.Save()
+	if err != nil {
+		log.Printf("%v", err)
+		return models.User{}, nil, err
+	}
 
 	// sync.ResourceSync(r, user.Id, "User", "create")
 	return user.Data, nil, nil
 }
 
+/*
+* Create methods
+ */
+
+// RegisterUserIn creates a user registered with a password through the
+// given store, so a registration that redeems an invitation is created in
+// the same transaction that marks the invitation used.
+func RegisterUserIn(s repositories.Store, user models.User) (models.UserPostgres, error) {
+	existing, err := s.Users.Find(repositories.NewUserFilter().Equals("email", user.Email).Limit(1))
+	if err != nil {
+		log.Printf("%v", err)
+		return models.UserPostgres{}, err
+	}
+	if len(existing) > 0 {
+		return models.UserPostgres{}, ErrEmailRegistered
+	}
+
+	user.Type = "users"
+	user.Created = time.Now()
+	user.Updated = user.Created
+
+	postgresUser := models.UserPostgres{Data: user}
+	err = s.Users.Create(&postgresUser)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.UserPostgres{}, err
+	}
+
+	postgresUser.Data.Id = postgresUser.Id
+	return postgresUser, nil
+}
+
+// RegisterUser is RegisterUserIn outside of a transaction.
+func RegisterUser(r *http.Request, user models.User) (models.UserPostgres, error) {
+	return RegisterUserIn(getStore(), user)
+}
+
 /*
 * Update methods
  */
 
 func SaveUser(r *http.Request, u *models.UserPostgres) (*models.UserPostgres, error) {
-	u.Save()
+	_, err := u.Save()
+	if err != nil {
+		log.Printf("%v", err)
+		return u, err
+	}
+
 	// sync.ResourceSync(r, u.Id, "User", "create")
 	return u, nil
 }
@@ -761,40 +886,55 @@ func Update(r *http.Request, u *models.UserPostgres) (*models.UserPostgres, erro
 		// CreateAgencyFromUser( r, u)
 	}
 
-	billing, err := GetUserBilling(r, *u)
-	if err != nil {
-		return u, err
+	// This runs on every request, so it is likely to race with the user's
+	// own updates. On a conflict reload both rows and try again.
+	attempt := 0
+	err := models.RetryOnConflict(3, func() error {
+		if attempt > 0 {
+			latest, err := getStore().Users.Get(u.Id)
+			if err != nil {
+				return err
+			}
+			*u = latest
+		}
+		attempt++
+
+		billing, err := GetUserBilling(r, *u)
+		if err != nil {
+			return err
+		}
+
+		return updateBillingPeriod(u, &billing)
+	})
+
+	return u, err
+}
+
+func updateBillingPeriod(u *models.UserPostgres, billing *models.BillingPostgres) error {
+	if !billing.Data.Expires.Before(time.Now()) {
+		return nil
 	}
 
-	if billing.Data.Expires.Before(time.Now()) {
-		if billing.Data.IsOnTrial {
-			u.Data.IsActive = false
-			u.Save()
-
-			billing.Data.IsOnTrial = false
-			billing.Save()
-		} else {
-			if billing.Data.IsCancel {
-				u.Data.IsActive = false
-				u.Save()
-			} else {
-				if billing.Data.StripePlanId != "free" {
-					// If they haven't canceled then we can add a month until they do.
-					// More sophisticated to add the amount depending on what
-					// plan they were on.
-					addAMonth := billing.Data.Expires.AddDate(0, 1, 0)
-					billing.Data.Expires = addAMonth
-					billing.Save()
-
-					// Keep the user active
-					u.Data.IsActive = true
-					u.Save()
-				}
-			}
+	if billing.Data.IsOnTrial {
+		u.Data.IsActive = false
+		_, err := u.Save()
+		if err != nil {
+			return err
 		}
+
+		billing.Data.IsOnTrial = false
+		_, err = billing.Save()
+		return err
 	}
 
-	return u, nil
+	if billing.Data.IsCancel {
+		u.Data.IsActive = false
+		_, err := u.Save()
+		return err
+	}
+
+	// Paid subscriptions are renewed, or ended, by the Stripe webhook
+	return nil
 }
 
 func UpdateUser(r *http.Request, id string) (models.User, interface{}, error) {
@@ -877,12 +1017,55 @@ func UpdateUser(r *http.Request, id string) (models.User, interface{}, error) {
 		user.Data.EmailSignatures = updatedUser.EmailSignatures
 	}
 
-	user.Save()
+	_, err = user.Save()
+	if err != nil {
+		log.Printf("%v", err)
+		return models.User{}, nil, err
+	}
+
 	// sync.ResourceSync(r, user.Id, "User", "create")
 	return user.Data, nil, nil
 
 }
 
+/*
+* Delete methods
+ */
+
+func DeleteUser(r *http.Request, id string) (models.User, interface{}, error) {
+	currentUser, err := getCurrentAdmin(r)
+	if err != nil {
+		return models.User{}, nil, err
+	}
+
+	userId, err := utilities.StringIdToInt(id)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.User{}, nil, err
+	}
+
+	if userId == currentUser.Id {
+		return models.User{}, nil, errors.New("You can't delete your own account")
+	}
+
+	user, err := getUser(r, userId)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.User{}, nil, err
+	}
+
+	before := user.Data
+	user.Data.SoftDelete()
+	_, err = SaveUser(r, &user)
+	if err != nil {
+		return models.User{}, nil, err
+	}
+
+	recordAudit(r, models.AuditUserDelete, "users", user.Id, before, user.Data)
+
+	return user.Data, nil, nil
+}
+
 /*
 * Action methods
  */
@@ -919,9 +1102,55 @@ func BanUser(r *http.Request, id string) (models.User, interface{}, error) {
 		return models.User{}, nil, err
 	}
 
+	before := user.Data
 	user.Data.IsActive = false
 	user.Data.IsBanned = true
-	SaveUser(r, &user)
+	_, err = SaveUser(r, &user)
+	if err != nil {
+		return models.User{}, nil, err
+	}
+
+	// A banned user is logged out everywhere straight away
+	revokeAllUserSessions(user.Id, 0)
+
+	recordAudit(r, models.AuditUserBan, "users", user.Id, before, user.Data)
+	return user.Data, nil, nil
+}
+
+func RestoreUser(r *http.Request, id string) (models.User, interface{}, error) {
+	_, err := getCurrentAdmin(r)
+	if err != nil {
+		return models.User{}, nil, err
+	}
+
+	userId, err := utilities.StringIdToInt(id)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.User{}, nil, err
+	}
+
+	// getUser hides deleted users, so go to the store directly
+	user, err := getStore().Users.Get(userId)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.User{}, nil, err
+	}
+
+	if !user.Data.IsDeleted() {
+		return models.User{}, nil, errors.New("User is not deleted")
+	}
+
+	before := user.Data
+	user.Data.Restore()
+	_, err = SaveUser(r, &user)
+	if err != nil {
+		return models.User{}, nil, err
+	}
+
+	recordAudit(r, models.AuditUserRestore, "users", user.Id, before, user.Data)
+
+	user.Data.Type = "users"
+	user.Data.Id = user.Id
 	return user.Data, nil, nil
 }
 
@@ -1031,12 +1260,21 @@ func UpdateUserEmail(r *http.Request, id string) (models.User, interface{}, erro
 		return models.User{}, nil, err
 	}
 
+	before := user.Data
+
 	// If new user wants to get daily emails
 	if updatedUser.Email != "" {
 		user.Data.Email = updatedUser.Email
 	}
 
-	user.Save()
+	_, err = user.Save()
+	if err != nil {
+		log.Printf("%v", err)
+		return models.User{}, nil, err
+	}
+
+	recordAudit(r, models.AuditUserUpdateEmail, "users", user.Id, before, user.Data)
+
 	// sync.ResourceSync(r, user.Id, "User", "create")
 	return user.Data, nil, nil
 }
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/repositories"
+)
+
+var ErrIdentityLinked = errors.New("This login is already connected to another account")
+
+/*
+* Public methods
+ */
+
+/*
+* Get methods
+ */
+
+// GetUserByIdentity returns the user linked to the subject at the
+// identity provider, or repositories.ErrNotFound if there is none.
+func GetUserByIdentity(issuer string, subject string) (models.UserPostgres, error) {
+	identity, err := getStore().Identities.FindBySubject(issuer, subject)
+	if err != nil {
+		if err != repositories.ErrNotFound {
+			log.Printf("%v", err)
+		}
+		return models.UserPostgres{}, err
+	}
+
+	user, err := getStore().Users.Get(identity.UserId)
+	if err != nil {
+		log.Printf("%v", err)
+		return models.UserPostgres{}, err
+	}
+
+	if user.Data.IsDeleted() {
+		return models.UserPostgres{}, repositories.ErrNotFound
+	}
+
+	user.Data.Type = "users"
+	user.Data.Id = user.Id
+	return user, nil
+}
+
+/*
+* Create methods
+ */
+
+// RegisterUserWithIdentity creates a user who signed up through an
+// identity provider, linked to their identity there, in one transaction.
+// It fails if a user with the email exists already.
+func RegisterUserWithIdentity(user models.User, issuer string, subject string) (models.UserPostgres, error) {
+	postgresUser := models.UserPostgres{}
+	err := getStore().RunInTransaction(func(s repositories.Store) error {
+		var err error
+		postgresUser, err = RegisterUserIn(s, user)
+		if err != nil {
+			return err
+		}
+
+		identity := models.UserIdentity{
+			UserId:  postgresUser.Id,
+			Issuer:  issuer,
+			Subject: subject,
+			Created: postgresUser.Data.Created,
+		}
+		return s.Identities.Create(&identity)
+	})
+	if err != nil {
+		log.Printf("%v", err)
+		return models.UserPostgres{}, err
+	}
+
+	postgresUser.Data.Type = "users"
+	return postgresUser, nil
+}
+
+// LinkUserIdentity lets the user log in through the identity provider
+// from now on. Linking an identity to the user it already belongs to does
+// nothing.
+func LinkUserIdentity(userId int64, issuer string, subject string) error {
+	err := getStore().RunInTransaction(func(s repositories.Store) error {
+		identity, err := s.Identities.FindBySubject(issuer, subject)
+		if err == nil {
+			if identity.UserId != userId {
+				return ErrIdentityLinked
+			}
+			return nil
+		}
+		if err != repositories.ErrNotFound {
+			return err
+		}
+
+		identity = models.UserIdentity{
+			UserId:  userId,
+			Issuer:  issuer,
+			Subject: subject,
+			Created: time.Now(),
+		}
+		return s.Identities.Create(&identity)
+	})
+	if err != nil {
+		log.Printf("%v", err)
+	}
+	return err
+}
@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/news-ai/api-v1/models"
+	"github.com/news-ai/api-v1/repositories"
+)
+
+// How long the link in each email works for
+var userTokenLifetimes = map[string]time.Duration{
+	models.UserTokenResetPassword: time.Hour,
+	models.UserTokenConfirmEmail:  7 * 24 * time.Hour,
+	models.UserTokenMagicLink:     15 * time.Minute,
+}
+
+// Used and expired tokens are kept this long before the cleanup deletes
+// them, to help with support questions about a link that did not work.
+const userTokenRetention = 7 * 24 * time.Hour
+
+var ErrInvalidUserToken = errors.New("This link is invalid or has expired")
+
+/*
+* Private methods
+ */
+
+// Uses up token in the transaction and returns the user it was for
+func consumeUserToken(s repositories.Store, token string, purpose string) (models.UserPostgres, error) {
+	userToken, err := s.Tokens.Consume(models.HashToken(token), purpose, time.Now())
+	if err != nil {
+		if err != repositories.ErrNotFound {
+			log.Printf("%v", err)
+		}
+		return models.UserPostgres{}, ErrInvalidUserToken
+	}
+
+	user, err := s.Users.Get(userToken.UserId)
+	if err != nil || user.Data.IsDeleted() {
+		return models.UserPostgres{}, ErrInvalidUserToken
+	}
+
+	user.Data.Type = "users"
+	user.Data.Id = user.Id
+	return user, nil
+}
+
+/*
+* Public methods
+ */
+
+/*
+* Get methods
+ */
+
+// GetUserByToken checks token without using it up, for pages that show
+// a form before the token is used.
+func GetUserByToken(token string, purpose string) (models.UserPostgres, error) {
+	userToken, err := getStore().Tokens.FindByTokenHash(models.HashToken(token))
+	if err != nil || userToken.Purpose != purpose || !userToken.IsUsable() {
+		return models.UserPostgres{}, ErrInvalidUserToken
+	}
+
+	user, err := getStore().Users.Get(userToken.UserId)
+	if err != nil || user.Data.IsDeleted() {
+		return models.UserPostgres{}, ErrInvalidUserToken
+	}
+
+	user.Data.Type = "users"
+	user.Data.Id = user.Id
+	return user, nil
+}
+
+/*
+* Create methods
+ */
+
+// CreateUserToken returns a new token to email to the user. Any earlier
+// token for the same purpose stops working.
+func CreateUserToken(userId int64, purpose string) (string, error) {
+	lifetime, ok := userTokenLifetimes[purpose]
+	if !ok {
+		return "", errors.New("Unknown token purpose " + purpose)
+	}
+
+	token, userToken, err := models.NewUserToken(userId, purpose, lifetime)
+	if err != nil {
+		log.Printf("%v", err)
+		return "", err
+	}
+
+	err = getStore().RunInTransaction(func(s repositories.Store) error {
+		err := s.Tokens.Expire(userId, purpose)
+		if err != nil {
+			return err
+		}
+		return s.Tokens.Create(&userToken)
+	})
+	if err != nil {
+		log.Printf("%v", err)
+		return "", err
+	}
+
+	return token, nil
+}
+
+// CreateRefreshToken records a new refresh token for the user and returns
+// its id. Unlike the emailed tokens, the user's other refresh tokens keep
+// working: each client they log in from has its own.
+func CreateRefreshToken(userId int64, lifetime time.Duration) (string, error) {
+	token, userToken, err := models.NewUserToken(userId, models.UserTokenRefresh, lifetime)
+	if err != nil {
+		log.Printf("%v", err)
+		return "", err
+	}
+
+	err = getStore().Tokens.Create(&userToken)
+	if err != nil {
+		log.Printf("%v", err)
+		return "", err
+	}
+
+	return token, nil
+}
+
+/*
+* Update methods
+ */
+
+// UseRefreshToken uses up the refresh token with the given id and returns
+// its user, who must still be allowed to log in. The client gets a new
+// refresh token with the new access token.
+func UseRefreshToken(userId int64, tokenId string) (models.UserPostgres, error) {
+	user := models.UserPostgres{}
+	err := getStore().RunInTransaction(func(s repositories.Store) error {
+		var err error
+		user, err = consumeUserToken(s, tokenId, models.UserTokenRefresh)
+		if err != nil {
+			return err
+		}
+
+		if user.Id != userId || user.Data.IsBanned || !user.Data.IsActive {
+			return ErrInvalidUserToken
+		}
+		return nil
+	})
+	if err != nil {
+		return models.UserPostgres{}, err
+	}
+
+	return user, nil
+}
+
+// ResetPasswordWithToken sets the password of the user the reset token
+// was sent to. The token is only used up if the password is saved.
+func ResetPasswordWithToken(r *http.Request, token string, hashedPassword []byte) (models.UserPostgres, error) {
+	user := models.UserPostgres{}
+	err := getStore().RunInTransaction(func(s repositories.Store) error {
+		var err error
+		user, err = consumeUserToken(s, token, models.UserTokenResetPassword)
+		if err != nil {
+			return err
+		}
+
+		user.Data.Password = hashedPassword
+		return s.Users.Save(&user)
+	})
+	if err != nil {
+		log.Printf("%v", err)
+		return models.UserPostgres{}, err
+	}
+
+	return user, nil
+}
+
+// ConfirmEmailWithToken confirms the email of the user the confirmation
+// token was sent to.
+func ConfirmEmailWithToken(r *http.Request, token string) (models.UserPostgres, error) {
+	user := models.UserPostgres{}
+	err := getStore().RunInTransaction(func(s repositories.Store) error {
+		var err error
+		user, err = consumeUserToken(s, token, models.UserTokenConfirmEmail)
+		if err != nil {
+			return err
+		}
+
+		user.Data.EmailConfirmed = true
+		return s.Users.Save(&user)
+	})
+	if err != nil {
+		log.Printf("%v", err)
+		return models.UserPostgres{}, err
+	}
+
+	return user, nil
+}
+
+// LoginWithToken uses up a magic link and returns the user to log in.
+// Getting the link proves they own the address, so it is confirmed too.
+func LoginWithToken(r *http.Request, token string) (models.UserPostgres, error) {
+	user := models.UserPostgres{}
+	err := getStore().RunInTransaction(func(s repositories.Store) error {
+		var err error
+		user, err = consumeUserToken(s, token, models.UserTokenMagicLink)
+		if err != nil {
+			return err
+		}
+
+		// Signups waiting for review are not confirmed until approved
+		_, err = s.Reviews.FindPendingByUser(user.Id)
+		if err == nil {
+			return ErrInvalidUserToken
+		}
+
+		if user.Data.EmailConfirmed {
+			return nil
+		}
+		user.Data.EmailConfirmed = true
+		return s.Users.Save(&user)
+	})
+	if err != nil {
+		log.Printf("%v", err)
+		return models.UserPostgres{}, err
+	}
+
+	return user, nil
+}
+
+/*
+* Delete methods
+ */
+
+// CleanupUserTokens deletes tokens that have been used or expired for a
+// while. It is meant to be called by a scheduled job logged in as an
+// admin.
+func CleanupUserTokens(r *http.Request) (models.UserTokenCleanup, interface{}, error) {
+	_, err := getCurrentAdmin(r)
+	if err != nil {
+		return models.UserTokenCleanup{}, nil, err
+	}
+
+	deleted, err := getStore().Tokens.DeleteExpired(time.Now().Add(-userTokenRetention))
+	if err != nil {
+		log.Printf("%v", err)
+		return models.UserTokenCleanup{}, nil, err
+	}
+
+	return models.UserTokenCleanup{Type: "token-cleanups", Deleted: deleted}, nil, nil
+}
@@ -0,0 +1,243 @@
+package db
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-pg/pg"
+)
+
+// Config holds everything needed to connect to Postgres. Values are read
+// from an optional JSON file (DATABASE_CONFIG) and then overridden by
+// environment variables, so a local setup only needs a couple of exports.
+type Config struct {
+	Addr     string `json:"addr"`
+	User     string `json:"user"`
+	Database string `json:"database"`
+	Password string `json:"password"`
+
+	// Read replica used for list queries. Falls back to the primary.
+	ReplicaAddr string `json:"replicaaddr"`
+
+	PoolSize     int           `json:"poolsize"`
+	PoolTimeout  time.Duration `json:"pooltimeout"`
+	DialTimeout  time.Duration `json:"dialtimeout"`
+	ReadTimeout  time.Duration `json:"readtimeout"`
+	WriteTimeout time.Duration `json:"writetimeout"`
+	IdleTimeout  time.Duration `json:"idletimeout"`
+	MaxRetries   int           `json:"maxretries"`
+
+	// One of "disable", "require" or "verify-full".
+	SSLMode string `json:"sslmode"`
+
+	LogQueries bool `json:"logqueries"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Addr:         "newsaiapitest.cnloofuhvjcp.us-east-2.rds.amazonaws.com:5432",
+		User:         "newsaiapitest",
+		Database:     "api",
+		PoolSize:     10,
+		PoolTimeout:  30 * time.Second,
+		DialTimeout:  5 * time.Second,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  5 * time.Minute,
+		SSLMode:      "require",
+		LogQueries:   true,
+	}
+}
+
+/*
+* Private methods
+ */
+
+func envString(key string, value *string) {
+	if os.Getenv(key) != "" {
+		*value = os.Getenv(key)
+	}
+}
+
+func envInt(key string, value *int) error {
+	if os.Getenv(key) == "" {
+		return nil
+	}
+
+	parsed, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return errors.New("Invalid value for " + key)
+	}
+	*value = parsed
+	return nil
+}
+
+func envDuration(key string, value *time.Duration) error {
+	if os.Getenv(key) == "" {
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return errors.New("Invalid duration for " + key)
+	}
+	*value = parsed
+	return nil
+}
+
+func envBool(key string, value *bool) error {
+	if os.Getenv(key) == "" {
+		return nil
+	}
+
+	parsed, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return errors.New("Invalid value for " + key)
+	}
+	*value = parsed
+	return nil
+}
+
+func tlsConfig(sslMode, addr string) (*tls.Config, error) {
+	switch sslMode {
+	case "", "disable":
+		return nil, nil
+	case "require":
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	case "verify-full":
+		host := addr
+		for i := len(addr) - 1; i >= 0; i-- {
+			if addr[i] == ':' {
+				host = addr[:i]
+				break
+			}
+		}
+		return &tls.Config{ServerName: host}, nil
+	}
+
+	return nil, errors.New("Unknown sslmode " + sslMode)
+}
+
+/*
+* Public methods
+ */
+
+// LoadConfig reads the database configuration shared by the API and the
+// migration command.
+func LoadConfig() (Config, error) {
+	config := defaultConfig()
+
+	if path := os.Getenv("DATABASE_CONFIG"); path != "" {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+
+		var fileConfig struct {
+			Config
+			PoolTimeout  string `json:"pooltimeout"`
+			DialTimeout  string `json:"dialtimeout"`
+			ReadTimeout  string `json:"readtimeout"`
+			WriteTimeout string `json:"writetimeout"`
+			IdleTimeout  string `json:"idletimeout"`
+			LogQueries   *bool  `json:"logqueries"`
+		}
+		fileConfig.Config = config
+		err = json.Unmarshal(raw, &fileConfig)
+		if err != nil {
+			return Config{}, err
+		}
+		config = fileConfig.Config
+
+		durations := []struct {
+			raw   string
+			value *time.Duration
+		}{
+			{fileConfig.PoolTimeout, &config.PoolTimeout},
+			{fileConfig.DialTimeout, &config.DialTimeout},
+			{fileConfig.ReadTimeout, &config.ReadTimeout},
+			{fileConfig.WriteTimeout, &config.WriteTimeout},
+			{fileConfig.IdleTimeout, &config.IdleTimeout},
+		}
+		for _, duration := range durations {
+			if duration.raw == "" {
+				continue
+			}
+			parsed, err := time.ParseDuration(duration.raw)
+			if err != nil {
+				return Config{}, errors.New("Invalid duration " + duration.raw + " in " + path)
+			}
+			*duration.value = parsed
+		}
+
+		if fileConfig.LogQueries != nil {
+			config.LogQueries = *fileConfig.LogQueries
+		}
+	}
+
+	envString("DATABASE_ADDR", &config.Addr)
+	envString("DATABASE_USER", &config.User)
+	envString("DATABASE_NAME", &config.Database)
+	envString("DATABASE_PASSWORD", &config.Password)
+	envString("DATABASE_REPLICA_ADDR", &config.ReplicaAddr)
+	envString("DATABASE_SSL_MODE", &config.SSLMode)
+
+	for key, value := range map[string]*int{
+		"DATABASE_POOL_SIZE":   &config.PoolSize,
+		"DATABASE_MAX_RETRIES": &config.MaxRetries,
+	} {
+		if err := envInt(key, value); err != nil {
+			return Config{}, err
+		}
+	}
+
+	for key, value := range map[string]*time.Duration{
+		"DATABASE_POOL_TIMEOUT":  &config.PoolTimeout,
+		"DATABASE_DIAL_TIMEOUT":  &config.DialTimeout,
+		"DATABASE_READ_TIMEOUT":  &config.ReadTimeout,
+		"DATABASE_WRITE_TIMEOUT": &config.WriteTimeout,
+		"DATABASE_IDLE_TIMEOUT":  &config.IdleTimeout,
+	} {
+		if err := envDuration(key, value); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if err := envBool("DATABASE_LOG_QUERIES", &config.LogQueries); err != nil {
+		return Config{}, err
+	}
+
+	if config.Addr == "" || config.User == "" || config.Database == "" {
+		return Config{}, errors.New("Database address, user and name are required")
+	}
+
+	return config, nil
+}
+
+// Options turns the configuration into pg.Options for the given address.
+func (c Config) Options(addr string) (*pg.Options, error) {
+	tlsConfig, err := tlsConfig(c.SSLMode, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pg.Options{
+		Addr:         addr,
+		User:         c.User,
+		Database:     c.Database,
+		Password:     c.Password,
+		TLSConfig:    tlsConfig,
+		PoolSize:     c.PoolSize,
+		PoolTimeout:  c.PoolTimeout,
+		DialTimeout:  c.DialTimeout,
+		ReadTimeout:  c.ReadTimeout,
+		WriteTimeout: c.WriteTimeout,
+		IdleTimeout:  c.IdleTimeout,
+		MaxRetries:   c.MaxRetries,
+	}, nil
+}
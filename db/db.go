@@ -9,20 +9,60 @@ import (
 
 var DB *pg.DB
 
-func InitDB() {
-	DB = pg.Connect(&pg.Options{
-		Addr:     "newsaiapitest.cnloofuhvjcp.us-east-2.rds.amazonaws.com:5432",
-		User:     "newsaiapitest",
-		Database: "api",
-		Password: "*Q4MQNCbtlLyP",
-	})
-
-	DB.OnQueryProcessed(func(event *pg.QueryProcessedEvent) {
-		query, err := event.FormattedQuery()
+// ReadDB points at the read replica when one is configured, and at DB
+// otherwise.
+var ReadDB *pg.DB
+
+// Connect opens the primary connection (and replica, if any) described
+// by config.
+func Connect(config Config) (*pg.DB, *pg.DB, error) {
+	options, err := config.Options(config.Addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	primary := pg.Connect(options)
+
+	replica := primary
+	if config.ReplicaAddr != "" {
+		replicaOptions, err := config.Options(config.ReplicaAddr)
 		if err != nil {
-			panic(err)
+			return nil, nil, err
+		}
+		replica = pg.Connect(replicaOptions)
+	}
+
+	if config.LogQueries {
+		primary.OnQueryProcessed(logQuery)
+		if replica != primary {
+			replica.OnQueryProcessed(logQuery)
 		}
+	}
+
+	return primary, replica, nil
+}
+
+// RunInTransaction runs fn in a transaction on the primary. The
+// transaction is rolled back if fn returns an error or panics.
+func RunInTransaction(fn func(tx *pg.Tx) error) error {
+	return DB.RunInTransaction(fn)
+}
+
+func InitDB() error {
+	config, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	DB, ReadDB, err = Connect(config)
+	return err
+}
+
+func logQuery(event *pg.QueryProcessedEvent) {
+	query, err := event.FormattedQuery()
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
 
-		log.Printf("%s %s", time.Since(event.StartTime), query)
-	})
+	log.Printf("%s %s", time.Since(event.StartTime), query)
 }
@@ -0,0 +1,391 @@
+// Command fillgen writes typed SetField and FillStruct methods for structs
+// that are filled from Elasticsearch (or other decoded JSON) payloads. It
+// replaces the reflection in models.SetField.
+//
+// Use it from go:generate in the file that declares the types:
+//
+//	//go:generate go run ../fillgen/main.go -type=Feed
+//
+// Each exported field is set when the map key is its Go name. Fields that
+// used to be renamed by models.SetField (id, cityName, ...) also accept the
+// lower camel case key. Values are converted by field type:
+//
+//	int        cast.ToInt
+//	int64      cast.ToInt64
+//	[]string   cast.ToStringSlice
+//	[]int64    cast.ToInt64SliceE
+//	time.Time  cast.ToTime
+//
+// Any other type has to match exactly. A `fill` struct tag adds extra keys
+// for a field (`fill:"key1,key2"`), and `fill:"-"` accepts the key but
+// ignores the value.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Keys models.SetField used to rename before looking up the field
+var lowerCaseKeys = map[string]bool{
+	"Id":               true,
+	"OrganizationName": true,
+	"CountryName":      true,
+	"FixedCountryName": true,
+	"StateName":        true,
+	"FixedStateName":   true,
+	"CityName":         true,
+}
+
+// Fields models.SetField always skipped
+var ignoredFields = map[string]bool{
+	"TwitterId":    true,
+	"Entities":     true,
+	"CustomFields": true,
+}
+
+var casts = map[string]string{
+	"int":       "cast.ToInt(value)",
+	"int64":     "cast.ToInt64(value)",
+	"[]string":  "cast.ToStringSlice(value)",
+	"[]int64":   "cast.ToInt64SliceE(value)",
+	"time.Time": "cast.ToTime(value)",
+}
+
+// Casts that also return an error
+var castsWithError = map[string]bool{
+	"[]int64":   true,
+	"time.Time": true,
+}
+
+type field struct {
+	name     string
+	typeExpr string
+	keys     []string
+	ignored  bool
+	imports  map[string]string
+}
+
+type structType struct {
+	spec    *ast.StructType
+	imports map[string]string
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: fillgen -type=T1,T2 [-lenient] [-output file]")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	typeNames := flag.String("type", "", "comma separated list of struct names")
+	lenient := flag.Bool("lenient", false, "FillStruct skips values it can't set instead of failing")
+	output := flag.String("output", "", "output file, defaults to <file>_fill.go")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *typeNames == "" {
+		usage()
+	}
+
+	sourceFile := os.Getenv("GOFILE")
+	if *output == "" {
+		if sourceFile == "" {
+			log.Fatalf("-output is required outside of go generate")
+		}
+		*output = strings.TrimSuffix(sourceFile, ".go") + "_fill.go"
+	}
+
+	packageName, structs, err := parsePackage(".", filepath.Base(*output))
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	body := bytes.Buffer{}
+	imports := map[string]string{"errors": "errors"}
+	for _, name := range strings.Split(*typeNames, ",") {
+		name = strings.TrimSpace(name)
+		fields, err := collectFields(structs, name)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		writeMethods(&body, name, fields, *lenient, imports)
+	}
+
+	source := bytes.Buffer{}
+	fmt.Fprintf(&source, "// Code generated by fillgen; DO NOT EDIT.\n\npackage %s\n\n", packageName)
+	writeImports(&source, imports)
+	source.Write(body.Bytes())
+
+	formatted, err := format.Source(source.Bytes())
+	if err != nil {
+		log.Fatalf("%v\n%s", err, source.String())
+	}
+
+	err = ioutil.WriteFile(*output, formatted, 0644)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+}
+
+/*
+* Parsing
+ */
+
+func parsePackage(dir string, skip string) (string, map[string]structType, error) {
+	fset := token.NewFileSet()
+	packages, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		name := info.Name()
+		return name != skip && !strings.HasSuffix(name, "_test.go")
+	}, 0)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(packages) != 1 {
+		return "", nil, fmt.Errorf("expected one package in %s, found %d", dir, len(packages))
+	}
+
+	packageName := ""
+	structs := map[string]structType{}
+	for name, pkg := range packages {
+		packageName = name
+		for _, file := range pkg.Files {
+			imports := fileImports(file)
+			for _, decl := range file.Decls {
+				genDecl, ok := decl.(*ast.GenDecl)
+				if !ok || genDecl.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range genDecl.Specs {
+					typeSpec := spec.(*ast.TypeSpec)
+					if structSpec, ok := typeSpec.Type.(*ast.StructType); ok {
+						structs[typeSpec.Name.Name] = structType{spec: structSpec, imports: imports}
+					}
+				}
+			}
+		}
+	}
+
+	return packageName, structs, nil
+}
+
+// Maps the name a file uses for each import to its path
+func fileImports(file *ast.File) map[string]string {
+	imports := map[string]string{}
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := filepath.Base(path)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = path
+	}
+	return imports
+}
+
+// Returns the settable fields of a struct, including the ones promoted
+// from embedded structs of the same package. Shallower fields win, like
+// they do in Go.
+func collectFields(structs map[string]structType, name string) ([]field, error) {
+	fields := []field{}
+	seen := map[string]bool{}
+
+	queue := []string{name}
+	for len(queue) > 0 {
+		next := []string{}
+		depthFields := []field{}
+		for _, typeName := range queue {
+			structSpec, ok := structs[typeName]
+			if !ok {
+				return nil, fmt.Errorf("%s is not a struct declared in this package", typeName)
+			}
+
+			for _, astField := range structSpec.spec.Fields.List {
+				if len(astField.Names) == 0 {
+					embedded, ok := astField.Type.(*ast.Ident)
+					if !ok {
+						return nil, fmt.Errorf("%s: only embedded structs from the same package are supported", typeName)
+					}
+					next = append(next, embedded.Name)
+					continue
+				}
+
+				for _, fieldName := range astField.Names {
+					if !fieldName.IsExported() || seen[fieldName.Name] {
+						continue
+					}
+					depthFields = append(depthFields, newField(fieldName.Name, astField, structSpec.imports))
+				}
+			}
+		}
+
+		for _, f := range depthFields {
+			seen[f.name] = true
+			fields = append(fields, f)
+		}
+		queue = next
+	}
+
+	sort.Slice(fields, func(i, j int) bool { return fields[i].name < fields[j].name })
+	return fields, nil
+}
+
+func newField(name string, astField *ast.Field, fileImports map[string]string) field {
+	f := field{
+		name:     name,
+		typeExpr: types.ExprString(astField.Type),
+		keys:     []string{name},
+		ignored:  ignoredFields[name],
+		imports:  map[string]string{},
+	}
+
+	if lowerCaseKeys[name] {
+		f.keys = append(f.keys, lowerFirst(name))
+	}
+
+	if astField.Tag != nil {
+		tag, _ := strconv.Unquote(astField.Tag.Value)
+		fillTag := reflect.StructTag(tag).Get("fill")
+		if fillTag == "-" {
+			f.ignored = true
+		} else if fillTag != "" {
+			for _, key := range strings.Split(fillTag, ",") {
+				f.keys = append(f.keys, strings.TrimSpace(key))
+			}
+		}
+	}
+
+	// Packages the type refers to, for types that are not cast
+	ast.Inspect(astField.Type, func(node ast.Node) bool {
+		selector, ok := node.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if ident, ok := selector.X.(*ast.Ident); ok {
+			if path, ok := fileImports[ident.Name]; ok {
+				f.imports[ident.Name] = path
+			}
+		}
+		return false
+	})
+
+	return f
+}
+
+func lowerFirst(name string) string {
+	runes := []rune(name)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+/*
+* Output
+ */
+
+func quotedKeys(keys []string) string {
+	quoted := []string{}
+	for _, key := range keys {
+		quoted = append(quoted, strconv.Quote(key))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func writeMethods(w *bytes.Buffer, typeName string, fields []field, lenient bool, imports map[string]string) {
+	receiver := strings.ToLower(typeName[:1])
+
+	fmt.Fprintf(w, "// SetField sets the field of %s named by key from a decoded JSON value.\n", typeName)
+	fmt.Fprintf(w, "func (%s *%s) SetField(key string, value interface{}) error {\n", receiver, typeName)
+	fmt.Fprintf(w, "switch key {\n")
+	for _, f := range fields {
+		fmt.Fprintf(w, "case %s:\n", quotedKeys(f.keys))
+
+		if f.ignored {
+			fmt.Fprintf(w, "return nil\n")
+			continue
+		}
+
+		if cast, ok := casts[f.typeExpr]; ok {
+			imports["cast"] = "github.com/news-ai/cast"
+			if castsWithError[f.typeExpr] {
+				fmt.Fprintf(w, "v, err := %s\nif err != nil {\nreturn err\n}\n", cast)
+				fmt.Fprintf(w, "%s.%s = v\nreturn nil\n", receiver, f.name)
+			} else {
+				fmt.Fprintf(w, "%s.%s = %s\nreturn nil\n", receiver, f.name, cast)
+			}
+			continue
+		}
+
+		for name, path := range f.imports {
+			imports[name] = path
+		}
+		fmt.Fprintf(w, "v, ok := value.(%s)\n", f.typeExpr)
+		fmt.Fprintf(w, "if !ok {\nreturn errors.New(\"Provided value type didn't match obj field type\")\n}\n")
+		fmt.Fprintf(w, "%s.%s = v\nreturn nil\n", receiver, f.name)
+	}
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "return errors.New(\"No such field:\" + key + \" in obj\")\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	fmt.Fprintf(w, "// FillStruct sets every field of %s present in m.\n", typeName)
+	fmt.Fprintf(w, "func (%s *%s) FillStruct(m map[string]interface{}) error {\n", receiver, typeName)
+	fmt.Fprintf(w, "for k, v := range m {\n")
+	if lenient {
+		fmt.Fprintf(w, "// Values that can't be set are skipped\n")
+		fmt.Fprintf(w, "%s.SetField(k, v)\n", receiver)
+	} else {
+		fmt.Fprintf(w, "err := %s.SetField(k, v)\nif err != nil {\nreturn err\n}\n", receiver)
+	}
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "return nil\n")
+	fmt.Fprintf(w, "}\n\n")
+}
+
+func writeImports(w *bytes.Buffer, imports map[string]string) {
+	names := []string{}
+	for name := range imports {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return imports[names[i]] < imports[names[j]] })
+
+	// Standard library first, like the rest of the repo
+	standard := []string{}
+	external := []string{}
+	for _, name := range names {
+		if strings.Contains(strings.Split(imports[name], "/")[0], ".") {
+			external = append(external, name)
+		} else {
+			standard = append(standard, name)
+		}
+	}
+
+	fmt.Fprintf(w, "import (\n")
+	for i, group := range [][]string{standard, external} {
+		if i > 0 && len(group) > 0 {
+			fmt.Fprintf(w, "\n")
+		}
+		for _, name := range group {
+			if name == filepath.Base(imports[name]) {
+				fmt.Fprintf(w, "%q\n", imports[name])
+			} else {
+				fmt.Fprintf(w, "%s %q\n", name, imports[name])
+			}
+		}
+	}
+	fmt.Fprintf(w, ")\n\n")
+}
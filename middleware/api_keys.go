@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/news-ai/api-v1/models"
+)
+
+// Scope a key needs to call anything below each path. Paths that are not
+// listed can only be read, with the read-only scope.
+var apiKeyRouteScopes = []struct {
+	prefix string
+	scope  string
+}{
+	{"/api/users", models.ApiKeyScopeUsers},
+	{"/api/teams", models.ApiKeyScopeUsers},
+	{"/api/agencies", models.ApiKeyScopeUsers},
+	{"/api/clients", models.ApiKeyScopeUsers},
+	{"/api/invites", models.ApiKeyScopeUsers},
+	{"/api/billing", models.ApiKeyScopeBilling},
+	{"/api/search", models.ApiKeyScopeSearch},
+}
+
+// Routes a key can never use, whatever its scopes: logging in and out,
+// and minting more keys.
+var apiKeyForbiddenRoutes = []string{
+	"/api/auth",
+	"/api/audit",
+}
+
+func apiKeyAllows(key *models.ApiKey, r *http.Request) bool {
+	path := r.URL.Path
+
+	for _, prefix := range apiKeyForbiddenRoutes {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+
+	// Nor manage the credentials of the user they belong to
+	if strings.HasPrefix(path, "/api/users/") && (strings.Contains(path, "/api-keys") || strings.Contains(path, "/two-factor") || strings.Contains(path, "/sessions")) {
+		return false
+	}
+
+	readOnly := r.Method == "GET" || r.Method == "HEAD"
+	if readOnly && key.HasScope(models.ApiKeyScopeReadOnly) {
+		return true
+	}
+
+	for _, route := range apiKeyRouteScopes {
+		if strings.HasPrefix(path, route.prefix) {
+			return key.HasScope(route.scope)
+		}
+	}
+
+	return false
+}
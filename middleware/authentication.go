@@ -13,21 +13,83 @@ import (
 )
 
 func UpdateOrCreateUser(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	// Basic authentication
+	// Stripe does not log in to call its webhook; the handler checks the
+	// signature of the request instead.
+	if strings.HasPrefix(r.URL.Path, "/api/billing/webhooks/") {
+		next(w, r)
+		return
+	}
+
+	// Basic authentication with an API key. Nothing is kept between
+	// requests, so the session below is never looked at.
 	apiKey, _, _ := r.BasicAuth()
-	apiKeyValid := false
 	if apiKey != "" {
-		apiKeyValid = auth.BasicAuthLogin(w, r, apiKey)
+		user, key, err := auth.BasicAuthLogin(w, r, apiKey)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			errors.ReturnError(w, http.StatusUnauthorized, "Authentication Required", err.Error())
+			return
+		}
+
+		if !apiKeyAllows(key, r) {
+			w.Header().Set("Content-Type", "application/json")
+			errors.ReturnError(w, http.StatusForbidden, "Forbidden", "This API key does not have access to "+r.URL.Path)
+			return
+		}
+
+		apiControllers.AddUserToContext(r, user.Data.Email)
+		next(w, r)
+		return
 	}
 
-	email, err := auth.GetCurrentUserEmail(r)
-	if err != nil && !strings.Contains(r.URL.Path, "/api/auth") && !strings.Contains(r.URL.Path, "/static") && !apiKeyValid {
+	// Bearer access tokens are signed, so they are checked without going
+	// to the session store.
+	email, hasToken, err := auth.GetBearerTokenEmail(r)
+	if hasToken {
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			errors.ReturnError(w, http.StatusUnauthorized, "Authentication Required", err.Error())
+			return
+		}
+
+		apiControllers.AddUserToContext(r, email)
+		next(w, r)
+		return
+	}
+
+	email, err = auth.GetCurrentUserEmail(r)
+	if err != nil && !strings.Contains(r.URL.Path, "/api/auth") && !strings.Contains(r.URL.Path, "/static") {
 		w.Header().Set("Content-Type", "application/json")
 		errors.ReturnError(w, http.StatusUnauthorized, "Authentication Required", "Please login "+utils.APIURL+"/auth/google")
 		return
 	} else {
 		if email != "" {
+			// Sessions revoked from another browser are logged out here
+			err = auth.CheckSession(w, r, email)
+			if err != nil {
+				if !strings.Contains(r.URL.Path, "/api/auth") {
+					w.Header().Set("Content-Type", "application/json")
+					errors.ReturnError(w, http.StatusUnauthorized, "Authentication Required", err.Error())
+					return
+				}
+				next(w, r)
+				return
+			}
+
 			apiControllers.AddUserToContext(r, email)
+
+			// An impersonated session is dropped as soon as the admin
+			// behind it loses their admin rights.
+			impersonatorId, err := auth.GetImpersonatorId(r)
+			if err == nil {
+				err = apiControllers.SetImpersonator(r, impersonatorId)
+				if err != nil {
+					auth.EndSession(w, r)
+					w.Header().Set("Content-Type", "application/json")
+					errors.ReturnError(w, http.StatusUnauthorized, "Authentication Required", err.Error())
+					return
+				}
+			}
 		}
 	}
 
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-pg/pg"
+
+	"github.com/news-ai/api-v1/repositories"
+)
+
+type lookupBenchmark struct {
+	Key   string
+	Index string
+}
+
+// The lookups done by controllers.filterUser, and the index each one is
+// expected to use. They are run through the same repository and filter,
+// so what is explained is the query the controllers send.
+var userLookupBenchmarks = []lookupBenchmark{
+	{"email", "user_postgres_email_idx"},
+}
+
+var errBenchmarkRollback = errors.New("benchmark rollback")
+
+// The last query the lookup sent, while capturing is set
+var (
+	capturing     bool
+	capturedQuery string
+)
+
+func captureQuery(event *pg.QueryProcessedEvent) {
+	if !capturing {
+		return
+	}
+
+	query, err := event.FormattedQuery()
+	if err == nil {
+		capturedQuery = query
+	}
+}
+
+func planIndexes(node map[string]interface{}, indexes map[string]bool) {
+	if name, ok := node["Index Name"].(string); ok {
+		indexes[name] = true
+	}
+
+	if plans, ok := node["Plans"].([]interface{}); ok {
+		for i := 0; i < len(plans); i++ {
+			if child, ok := plans[i].(map[string]interface{}); ok {
+				planIndexes(child, indexes)
+			}
+		}
+	}
+}
+
+func benchmarkLookup(tx *pg.Tx, benchmark lookupBenchmark, value string) error {
+	capturing = true
+	capturedQuery = ""
+	start := time.Now()
+	users, err := repositories.NewPostgresStoreIn(tx).Users.Find(repositories.UserLookup(benchmark.Key, value))
+	elapsed := time.Since(start)
+	capturing = false
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return fmt.Errorf("Lookup by %s found no user", benchmark.Key)
+	}
+
+	var rawPlan string
+	_, err = tx.QueryOne(pg.Scan(&rawPlan), "EXPLAIN (FORMAT JSON) "+capturedQuery)
+	if err != nil {
+		return err
+	}
+
+	var plans []struct {
+		Plan map[string]interface{} `json:"Plan"`
+	}
+	err = json.Unmarshal([]byte(rawPlan), &plans)
+	if err != nil {
+		return err
+	}
+
+	indexes := map[string]bool{}
+	for i := 0; i < len(plans); i++ {
+		planIndexes(plans[i].Plan, indexes)
+	}
+
+	if !indexes[benchmark.Index] {
+		return fmt.Errorf("Lookup by %s does not use %s:\n%s\n%s", benchmark.Key, benchmark.Index, capturedQuery, rawPlan)
+	}
+
+	fmt.Printf("%-24s %-42s %s\n", benchmark.Key, benchmark.Index, elapsed)
+	return nil
+}
+
+// BenchmarkUserLookups seeds n users inside a transaction, checks that
+// every user lookup is served by its index and prints the lookup time.
+// The transaction is always rolled back.
+func BenchmarkUserLookups(n int) error {
+	if n <= 0 {
+		return errors.New("Number of users to seed must be positive")
+	}
+
+	dB.OnQueryProcessed(captureQuery)
+
+	err := dB.RunInTransaction(func(tx *pg.Tx) error {
+		_, err := tx.Exec(`INSERT INTO user_postgres (data)
+			SELECT jsonb_build_object(
+				'email', 'benchmark-' || g || '@newsai.org'
+			)
+			FROM generate_series(1, ?) AS g`, n)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("ANALYZE user_postgres")
+		if err != nil {
+			return err
+		}
+
+		// Look up a user from the middle of the seeded range. The values
+		// mirror the ones generated by the insert above.
+		middle := strconv.Itoa(n/2 + 1)
+		values := map[string]string{
+			"email": "benchmark-" + middle + "@newsai.org",
+		}
+
+		for i := 0; i < len(userLookupBenchmarks); i++ {
+			err = benchmarkLookup(tx, userLookupBenchmarks[i], values[userLookupBenchmarks[i].Key])
+			if err != nil {
+				return err
+			}
+		}
+
+		return errBenchmarkRollback
+	})
+
+	if err == errBenchmarkRollback {
+		return nil
+	}
+	return err
+}
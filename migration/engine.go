@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/go-pg/pg"
+)
+
+// Migration is a single numbered schema change. Up and Down are run in
+// order inside one transaction.
+type Migration struct {
+	Version int64
+	Name    string
+
+	Up   []string
+	Down []string
+}
+
+type SchemaMigration struct {
+	TableName struct{} `sql:"schema_migrations"`
+
+	Version int64 `sql:",pk"`
+	Name    string
+
+	AppliedAt time.Time
+}
+
+/*
+* Private methods
+ */
+
+func ensureMigrationsTable() error {
+	_, err := dB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`)
+	return err
+}
+
+func migrationsTableExists() (bool, error) {
+	var exists bool
+	_, err := dB.QueryOne(pg.Scan(&exists), "SELECT to_regclass('schema_migrations') IS NOT NULL")
+	return exists, err
+}
+
+func sortedMigrations() ([]Migration, error) {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Version == sorted[i-1].Version {
+			return nil, fmt.Errorf("Duplicate migration version %d", sorted[i].Version)
+		}
+	}
+
+	return sorted, nil
+}
+
+func appliedMigrations() (map[int64]SchemaMigration, error) {
+	applied := []SchemaMigration{}
+	err := dB.Model(&applied).Select()
+	if err != nil {
+		return nil, err
+	}
+
+	appliedMap := map[int64]SchemaMigration{}
+	for i := 0; i < len(applied); i++ {
+		appliedMap[applied[i].Version] = applied[i]
+	}
+	return appliedMap, nil
+}
+
+// Only runs that change the schema create the migrations table. The others
+// must not write, and read a missing table as nothing applied.
+func loadAppliedMigrations(readOnly bool) (map[int64]SchemaMigration, error) {
+	if !readOnly {
+		err := ensureMigrationsTable()
+		if err != nil {
+			return nil, err
+		}
+		return appliedMigrations()
+	}
+
+	exists, err := migrationsTableExists()
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return map[int64]SchemaMigration{}, nil
+	}
+	return appliedMigrations()
+}
+
+func runMigration(migration Migration, statements []string, up bool, dryRun bool) error {
+	direction := "down"
+	if up {
+		direction = "up"
+	}
+
+	if dryRun {
+		fmt.Printf("-- %d_%s (%s)\n", migration.Version, migration.Name, direction)
+		for i := 0; i < len(statements); i++ {
+			fmt.Printf("%s;\n", statements[i])
+		}
+		fmt.Println()
+		return nil
+	}
+
+	return dB.RunInTransaction(func(tx *pg.Tx) error {
+		for i := 0; i < len(statements); i++ {
+			_, err := tx.Exec(statements[i])
+			if err != nil {
+				return fmt.Errorf("%d_%s (%s): %v", migration.Version, migration.Name, direction, err)
+			}
+		}
+
+		if up {
+			schemaMigration := SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}
+			return tx.Insert(&schemaMigration)
+		}
+
+		_, err := tx.Model(&SchemaMigration{}).Where("version = ?", migration.Version).Delete()
+		return err
+	})
+}
+
+/*
+* Public methods
+ */
+
+// MigrateUp applies every migration that has not been applied yet.
+func MigrateUp(dryRun bool) error {
+	sorted, err := sortedMigrations()
+	if err != nil {
+		return err
+	}
+
+	applied, err := loadAppliedMigrations(dryRun)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(sorted); i++ {
+		if _, ok := applied[sorted[i].Version]; ok {
+			continue
+		}
+
+		err = runMigration(sorted[i], sorted[i].Up, true, dryRun)
+		if err != nil {
+			return err
+		}
+
+		if !dryRun {
+			log.Printf("Applied %d_%s", sorted[i].Version, sorted[i].Name)
+		}
+	}
+
+	return nil
+}
+
+// MigrateDown rolls back the last n applied migrations.
+func MigrateDown(n int, dryRun bool) error {
+	if n <= 0 {
+		return errors.New("Number of migrations to roll back must be positive")
+	}
+
+	sorted, err := sortedMigrations()
+	if err != nil {
+		return err
+	}
+
+	applied, err := loadAppliedMigrations(dryRun)
+	if err != nil {
+		return err
+	}
+
+	for i := len(sorted) - 1; i >= 0 && n > 0; i-- {
+		if _, ok := applied[sorted[i].Version]; !ok {
+			continue
+		}
+
+		err = runMigration(sorted[i], sorted[i].Down, false, dryRun)
+		if err != nil {
+			return err
+		}
+
+		if !dryRun {
+			log.Printf("Rolled back %d_%s", sorted[i].Version, sorted[i].Name)
+		}
+		n--
+	}
+
+	return nil
+}
+
+// MigrationStatus prints every known migration and when it was applied.
+func MigrationStatus() error {
+	sorted, err := sortedMigrations()
+	if err != nil {
+		return err
+	}
+
+	applied, err := loadAppliedMigrations(true)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(sorted); i++ {
+		status := "pending"
+		if schemaMigration, ok := applied[sorted[i].Version]; ok {
+			status = "applied " + schemaMigration.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%4d  %-40s %s\n", sorted[i].Version, sorted[i].Name, status)
+	}
+
+	return nil
+}
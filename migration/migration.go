@@ -1,22 +1,78 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
 	"github.com/go-pg/pg"
+
+	"github.com/news-ai/api-v1/db"
 )
 
 var dB *pg.DB
 
 func initDB() {
-	dB = pg.Connect(&pg.Options{
-		Addr:     "newsaiapitest.cnloofuhvjcp.us-east-2.rds.amazonaws.com:5432",
-		User:     "newsaiapitest",
-		Database: "api",
-		Password: "*Q4MQNCbtlLyP",
-	})
+	config, err := db.LoadConfig()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	dB, _, err = db.Connect(config)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: migration [-dry-run] up | down N | status | benchmark N")
+	flag.PrintDefaults()
+	os.Exit(2)
 }
 
 func main() {
+	dryRun := flag.Bool("dry-run", false, "print the SQL instead of running it")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+	}
+
 	initDB()
 	// getDatastoreAndInsertIntoPostgres()
-	createSchema()
+
+	var err error
+	switch flag.Arg(0) {
+	case "up":
+		err = MigrateUp(*dryRun)
+	case "down":
+		if flag.NArg() != 2 {
+			usage()
+		}
+		n, parseErr := strconv.Atoi(flag.Arg(1))
+		if parseErr != nil {
+			usage()
+		}
+		err = MigrateDown(n, *dryRun)
+	case "status":
+		err = MigrationStatus()
+	case "benchmark":
+		if flag.NArg() != 2 {
+			usage()
+		}
+		n, parseErr := strconv.Atoi(flag.Arg(1))
+		if parseErr != nil {
+			usage()
+		}
+		err = BenchmarkUserLookups(n)
+	default:
+		usage()
+	}
+
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
 }
@@ -0,0 +1,479 @@
+package main
+
+// Every schema change goes here with the next version number. Never edit
+// a migration that has already been applied; add a new one instead.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_base_tables",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS agencies (
+				id bigserial PRIMARY KEY,
+				type text,
+				created_by bigint,
+				created timestamptz,
+				updated timestamptz,
+				name text,
+				email text
+			)`,
+			`CREATE TABLE IF NOT EXISTS billing_postgres (
+				id bigserial PRIMARY KEY,
+				data jsonb
+			)`,
+			`CREATE TABLE IF NOT EXISTS clients (
+				id bigserial PRIMARY KEY,
+				type text,
+				created_by bigint,
+				created timestamptz,
+				updated timestamptz,
+				name text,
+				url text,
+				notes text,
+				tags jsonb,
+				team_id bigint,
+				linked_in text,
+				twitter text,
+				instagram text,
+				websites jsonb,
+				blog text
+			)`,
+			`CREATE TABLE IF NOT EXISTS plans (
+				name text,
+				stripe_id text,
+				active boolean
+			)`,
+			`CREATE TABLE IF NOT EXISTS teams (
+				id bigserial PRIMARY KEY,
+				type text,
+				created_by bigint,
+				created timestamptz,
+				updated timestamptz,
+				name text,
+				agency_id bigint,
+				max_members bigint,
+				members jsonb,
+				admins jsonb
+			)`,
+			`CREATE TABLE IF NOT EXISTS user_postgres (
+				id bigserial PRIMARY KEY,
+				data jsonb
+			)`,
+			`CREATE TABLE IF NOT EXISTS user_email_codes (
+				id bigserial PRIMARY KEY,
+				type text,
+				created_by bigint,
+				created timestamptz,
+				updated timestamptz,
+				invite_code text,
+				email text
+			)`,
+			`CREATE TABLE IF NOT EXISTS user_invite_codes (
+				id bigserial PRIMARY KEY,
+				type text,
+				created_by bigint,
+				created timestamptz,
+				updated timestamptz,
+				invite_code text,
+				email text,
+				is_used boolean
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS user_invite_codes`,
+			`DROP TABLE IF EXISTS user_email_codes`,
+			`DROP TABLE IF EXISTS user_postgres`,
+			`DROP TABLE IF EXISTS teams`,
+			`DROP TABLE IF EXISTS plans`,
+			`DROP TABLE IF EXISTS clients`,
+			`DROP TABLE IF EXISTS billing_postgres`,
+			`DROP TABLE IF EXISTS agencies`,
+		},
+	},
+	// The unique email index fails if two users share an email address
+	// (ignoring case); merge those accounts before applying it.
+	{
+		Version: 2,
+		Name:    "index_user_lookups",
+		Up: []string{
+			`CREATE INDEX IF NOT EXISTS user_postgres_email_idx ON user_postgres ((data->>'email'))`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS user_postgres_lower_email_key ON user_postgres (lower(data->>'email'))`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS user_postgres_apikey_key ON user_postgres ((data->>'apikey')) WHERE data->>'apikey' <> ''`,
+			`CREATE INDEX IF NOT EXISTS user_postgres_confirmationcode_idx ON user_postgres ((data->>'confirmationcode')) WHERE data->>'confirmationcode' <> ''`,
+			`CREATE INDEX IF NOT EXISTS user_postgres_confirmationcodebackup_idx ON user_postgres ((data->>'confirmationcodebackup')) WHERE data->>'confirmationcodebackup' <> ''`,
+			`CREATE INDEX IF NOT EXISTS user_postgres_resetpasswordcode_idx ON user_postgres ((data->>'resetpasswordcode')) WHERE data->>'resetpasswordcode' <> ''`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS user_postgres_resetpasswordcode_idx`,
+			`DROP INDEX IF EXISTS user_postgres_confirmationcodebackup_idx`,
+			`DROP INDEX IF EXISTS user_postgres_confirmationcode_idx`,
+			`DROP INDEX IF EXISTS user_postgres_apikey_key`,
+			`DROP INDEX IF EXISTS user_postgres_lower_email_key`,
+			`DROP INDEX IF EXISTS user_postgres_email_idx`,
+		},
+	},
+	{
+		Version: 3,
+		Name:    "add_row_versions",
+		Up: []string{
+			`ALTER TABLE agencies ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0`,
+			`ALTER TABLE billing_postgres ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0`,
+			`ALTER TABLE clients ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0`,
+			`ALTER TABLE teams ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0`,
+			`ALTER TABLE user_postgres ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0`,
+			`ALTER TABLE user_email_codes ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0`,
+			`ALTER TABLE user_invite_codes ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0`,
+		},
+		Down: []string{
+			`ALTER TABLE user_invite_codes DROP COLUMN IF EXISTS version`,
+			`ALTER TABLE user_email_codes DROP COLUMN IF EXISTS version`,
+			`ALTER TABLE user_postgres DROP COLUMN IF EXISTS version`,
+			`ALTER TABLE teams DROP COLUMN IF EXISTS version`,
+			`ALTER TABLE clients DROP COLUMN IF EXISTS version`,
+			`ALTER TABLE billing_postgres DROP COLUMN IF EXISTS version`,
+			`ALTER TABLE agencies DROP COLUMN IF EXISTS version`,
+		},
+	},
+	// Users keep their deleted timestamp in data like every other field.
+	{
+		Version: 4,
+		Name:    "add_soft_delete",
+		Up: []string{
+			`ALTER TABLE agencies ADD COLUMN IF NOT EXISTS deleted timestamptz`,
+			`ALTER TABLE clients ADD COLUMN IF NOT EXISTS deleted timestamptz`,
+			`ALTER TABLE teams ADD COLUMN IF NOT EXISTS deleted timestamptz`,
+			`ALTER TABLE user_email_codes ADD COLUMN IF NOT EXISTS deleted timestamptz`,
+			`ALTER TABLE user_invite_codes ADD COLUMN IF NOT EXISTS deleted timestamptz`,
+		},
+		Down: []string{
+			`ALTER TABLE user_invite_codes DROP COLUMN IF EXISTS deleted`,
+			`ALTER TABLE user_email_codes DROP COLUMN IF EXISTS deleted`,
+			`ALTER TABLE teams DROP COLUMN IF EXISTS deleted`,
+			`ALTER TABLE clients DROP COLUMN IF EXISTS deleted`,
+			`ALTER TABLE agencies DROP COLUMN IF EXISTS deleted`,
+		},
+	},
+	// The rules make audit_events append-only: updates and deletes on it
+	// are silently dropped.
+	{
+		Version: 5,
+		Name:    "create_audit_events",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS audit_events (
+				id bigserial PRIMARY KEY,
+				created timestamptz NOT NULL DEFAULT now(),
+				actor_id bigint,
+				action text NOT NULL,
+				target_type text,
+				target_id bigint,
+				changes jsonb,
+				ip_address text,
+				user_agent text,
+				method text,
+				path text
+			)`,
+			`CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor_id, id)`,
+			`CREATE INDEX IF NOT EXISTS audit_events_target_idx ON audit_events (target_type, target_id, id)`,
+			`CREATE INDEX IF NOT EXISTS audit_events_action_idx ON audit_events (action, id)`,
+			`CREATE OR REPLACE RULE audit_events_no_update AS ON UPDATE TO audit_events DO INSTEAD NOTHING`,
+			`CREATE OR REPLACE RULE audit_events_no_delete AS ON DELETE TO audit_events DO INSTEAD NOTHING`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS audit_events`,
+		},
+	},
+	// Keys are looked up by the hash of the key, never by the key itself.
+	{
+		Version: 6,
+		Name:    "create_api_keys",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS api_keys (
+				id bigserial PRIMARY KEY,
+				type text,
+				created_by bigint,
+				created timestamptz,
+				updated timestamptz,
+				deleted timestamptz,
+				user_id bigint NOT NULL,
+				name text,
+				prefix text,
+				key_hash text UNIQUE NOT NULL,
+				scopes jsonb,
+				expires timestamptz,
+				last_used timestamptz,
+				revoked timestamptz
+			)`,
+			`CREATE INDEX IF NOT EXISTS api_keys_user_idx ON api_keys (user_id)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS api_keys`,
+		},
+	},
+	{
+		Version: 7,
+		Name:    "add_team_require_two_factor",
+		Up: []string{
+			`ALTER TABLE teams ADD COLUMN IF NOT EXISTS require_two_factor boolean NOT NULL DEFAULT false`,
+		},
+		Down: []string{
+			`ALTER TABLE teams DROP COLUMN IF EXISTS require_two_factor`,
+		},
+	},
+	{
+		Version: 8,
+		Name:    "add_audit_impersonator",
+		Up: []string{
+			`ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS impersonator_id bigint`,
+			`CREATE INDEX IF NOT EXISTS audit_events_impersonator_idx ON audit_events (impersonator_id, id)`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS audit_events_impersonator_idx`,
+			`ALTER TABLE audit_events DROP COLUMN IF EXISTS impersonator_id`,
+		},
+	},
+	{
+		Version: 9,
+		Name:    "create_user_sessions",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS user_sessions (
+				id bigserial PRIMARY KEY,
+				user_id bigint NOT NULL,
+				token_hash text UNIQUE NOT NULL,
+				device text,
+				ip_address text,
+				created timestamptz,
+				last_seen timestamptz,
+				revoked timestamptz
+			)`,
+			`CREATE INDEX IF NOT EXISTS user_sessions_user_idx ON user_sessions (user_id)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS user_sessions`,
+		},
+	},
+	{
+		Version: 10,
+		Name:    "create_user_tokens",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS user_tokens (
+				id bigserial PRIMARY KEY,
+				user_id bigint NOT NULL,
+				purpose text NOT NULL,
+				token_hash text UNIQUE NOT NULL,
+				created timestamptz,
+				expires timestamptz NOT NULL,
+				used timestamptz
+			)`,
+			`CREATE INDEX IF NOT EXISTS user_tokens_user_idx ON user_tokens (user_id, purpose)`,
+			`CREATE INDEX IF NOT EXISTS user_tokens_expires_idx ON user_tokens (expires)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS user_tokens`,
+		},
+	},
+	{
+		Version: 11,
+		Name:    "create_signup_reviews",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS signup_reviews (
+				id bigserial PRIMARY KEY,
+				user_id bigint NOT NULL,
+				email text,
+				ip_address text,
+				reasons jsonb,
+				status text NOT NULL,
+				created timestamptz,
+				decided_by bigint,
+				decided timestamptz
+			)`,
+			`CREATE INDEX IF NOT EXISTS signup_reviews_status_idx ON signup_reviews (status, id)`,
+			`CREATE INDEX IF NOT EXISTS signup_reviews_user_idx ON signup_reviews (user_id)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS signup_reviews`,
+		},
+	},
+	{
+		Version: 12,
+		Name:    "extend_plans_into_catalog",
+		Up: []string{
+			`ALTER TABLE plans ADD COLUMN IF NOT EXISTS id bigserial`,
+			`ALTER TABLE plans ADD COLUMN IF NOT EXISTS aliases jsonb`,
+			`ALTER TABLE plans ADD COLUMN IF NOT EXISTS monthly_price numeric(10, 2)`,
+			`ALTER TABLE plans ADD COLUMN IF NOT EXISTS annual_price numeric(10, 2)`,
+			`ALTER TABLE plans ADD COLUMN IF NOT EXISTS email_accounts integer`,
+			`ALTER TABLE plans ADD COLUMN IF NOT EXISTS emails_per_day integer`,
+			`ALTER TABLE plans ADD COLUMN IF NOT EXISTS social_accounts integer`,
+			`ALTER TABLE plans ADD COLUMN IF NOT EXISTS created timestamptz`,
+			`ALTER TABLE plans ADD COLUMN IF NOT EXISTS updated timestamptz`,
+			`ALTER TABLE plans ADD PRIMARY KEY (id)`,
+			// The values the billing code had hard-coded until now. Rows
+			// that already exist for a plan, by its name or one of its
+			// Stripe ids, are filled in and keep whether they are active;
+			// the others are added.
+			`WITH seed (name, stripe_id, aliases, monthly_price, annual_price, email_accounts, emails_per_day, social_accounts, active) AS (
+				VALUES
+					('Trial Member', 'free', '["free"]'::jsonb, 0, 0, 0, 100, 0, false),
+					('Personal', 'personal', '["bronze", "personal"]'::jsonb, 18.99, 15.99, 0, 100, 100, true),
+					('Consultant', 'consultant', '["aluminum", "consultant"]'::jsonb, 34.99, 28.99, 2, 400, 250, true),
+					('Business', 'business', '["silver", "silver-1", "business"]'::jsonb, 41.99, 34.99, 5, 1000, 500, true),
+					('Growing Business', 'growing', '["gold", "gold-1", "growing"]'::jsonb, 52.99, 43.99, 10, 2500, 100000, true)
+			), backfilled AS (
+				UPDATE plans SET
+					name = seed.name,
+					stripe_id = seed.stripe_id,
+					aliases = seed.aliases,
+					monthly_price = seed.monthly_price,
+					annual_price = seed.annual_price,
+					email_accounts = seed.email_accounts,
+					emails_per_day = seed.emails_per_day,
+					social_accounts = seed.social_accounts,
+					active = coalesce(plans.active, seed.active),
+					created = now(),
+					updated = now()
+				FROM seed
+				WHERE lower(plans.name) = lower(seed.name)
+					OR lower(plans.stripe_id) IN (SELECT lower(alias) FROM jsonb_array_elements_text(seed.aliases) AS alias)
+				RETURNING seed.name
+			)
+			INSERT INTO plans (name, stripe_id, aliases, monthly_price, annual_price, email_accounts, emails_per_day, social_accounts, active, created, updated)
+				SELECT name, stripe_id, aliases, monthly_price, annual_price, email_accounts, emails_per_day, social_accounts, active, now(), now()
+				FROM seed
+				WHERE name NOT IN (SELECT name FROM backfilled)`,
+			// These fail if two rows are for the same plan; merge them
+			// before applying the migration.
+			`CREATE UNIQUE INDEX IF NOT EXISTS plans_name_idx ON plans (lower(name))`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS plans_stripe_id_idx ON plans (lower(stripe_id))`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS plans_stripe_id_idx`,
+			`DROP INDEX IF EXISTS plans_name_idx`,
+			`ALTER TABLE plans DROP CONSTRAINT IF EXISTS plans_pkey`,
+			`ALTER TABLE plans DROP COLUMN IF EXISTS updated`,
+			`ALTER TABLE plans DROP COLUMN IF EXISTS created`,
+			`ALTER TABLE plans DROP COLUMN IF EXISTS social_accounts`,
+			`ALTER TABLE plans DROP COLUMN IF EXISTS emails_per_day`,
+			`ALTER TABLE plans DROP COLUMN IF EXISTS email_accounts`,
+			`ALTER TABLE plans DROP COLUMN IF EXISTS annual_price`,
+			`ALTER TABLE plans DROP COLUMN IF EXISTS monthly_price`,
+			`ALTER TABLE plans DROP COLUMN IF EXISTS aliases`,
+			`ALTER TABLE plans DROP COLUMN IF EXISTS id`,
+		},
+	},
+	{
+		Version: 13,
+		Name:    "create_entitlements",
+		Up: []string{
+			`ALTER TABLE plans ADD COLUMN IF NOT EXISTS enhance_credits integer`,
+			`ALTER TABLE plans ADD COLUMN IF NOT EXISTS media_database boolean`,
+			`UPDATE plans SET enhance_credits = 10 WHERE stripe_id = 'free'`,
+			`UPDATE plans SET enhance_credits = 50 WHERE stripe_id = 'personal'`,
+			`UPDATE plans SET enhance_credits = 150 WHERE stripe_id = 'consultant'`,
+			`UPDATE plans SET enhance_credits = 500, media_database = true WHERE stripe_id = 'business'`,
+			`UPDATE plans SET enhance_credits = 2000, media_database = true WHERE stripe_id = 'growing'`,
+			`CREATE TABLE IF NOT EXISTS entitlement_overrides (
+				id bigserial PRIMARY KEY,
+				user_id bigint,
+				team_id bigint,
+				resource text NOT NULL,
+				"limit" integer,
+				reason text,
+				created_by bigint,
+				created timestamptz,
+				expires timestamptz
+			)`,
+			`CREATE INDEX IF NOT EXISTS entitlement_overrides_user_idx ON entitlement_overrides (user_id)`,
+			`CREATE INDEX IF NOT EXISTS entitlement_overrides_team_idx ON entitlement_overrides (team_id)`,
+			`CREATE TABLE IF NOT EXISTS entitlement_usages (
+				user_id bigint NOT NULL,
+				resource text NOT NULL,
+				period text NOT NULL,
+				used integer NOT NULL,
+				updated timestamptz,
+				PRIMARY KEY (user_id, resource, period)
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS entitlement_usages`,
+			`DROP TABLE IF EXISTS entitlement_overrides`,
+			`ALTER TABLE plans DROP COLUMN IF EXISTS media_database`,
+			`ALTER TABLE plans DROP COLUMN IF EXISTS enhance_credits`,
+		},
+	},
+	{
+		Version: 14,
+		Name:    "create_processed_stripe_events",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS processed_stripe_events (
+				id text PRIMARY KEY,
+				type text,
+				processed timestamptz
+			)`,
+			`CREATE INDEX IF NOT EXISTS billing_postgres_stripe_id_idx ON billing_postgres ((data->>'stripeid'))`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS billing_postgres_stripe_id_idx`,
+			`DROP TABLE IF EXISTS processed_stripe_events`,
+		},
+	},
+	{
+		Version: 15,
+		Name:    "move_legacy_api_keys",
+		Up: []string{
+			// Keys that were kept in plain text on the user become hashed
+			// rows of api_keys, with every scope they used to have
+			`INSERT INTO api_keys (type, created_by, created, updated, user_id, name, prefix, key_hash, scopes)
+				SELECT 'apikeys', id, now(), now(), id, 'Legacy key', left(data->>'apikey', 12),
+					encode(sha256(convert_to(data->>'apikey', 'UTF8')), 'hex'),
+					'["read-only", "users", "billing", "search"]'
+				FROM user_postgres
+				WHERE coalesce(data->>'apikey', '') <> ''
+				ON CONFLICT (key_hash) DO NOTHING`,
+			`UPDATE user_postgres SET data = data - 'apikey' WHERE data->'apikey' IS NOT NULL`,
+			`DROP INDEX IF EXISTS user_postgres_apikey_key`,
+		},
+		// The plain text keys are gone, so the hashed ones stay
+		Down: []string{
+			`CREATE UNIQUE INDEX IF NOT EXISTS user_postgres_apikey_key ON user_postgres ((data->>'apikey')) WHERE data->>'apikey' <> ''`,
+		},
+	},
+	// Confirmation and reset codes are looked up in user_tokens since
+	// version 10, so nothing reads these indexes anymore
+	{
+		Version: 16,
+		Name:    "drop_user_code_indexes",
+		Up: []string{
+			`DROP INDEX IF EXISTS user_postgres_resetpasswordcode_idx`,
+			`DROP INDEX IF EXISTS user_postgres_confirmationcodebackup_idx`,
+			`DROP INDEX IF EXISTS user_postgres_confirmationcode_idx`,
+		},
+		Down: []string{
+			`CREATE INDEX IF NOT EXISTS user_postgres_confirmationcode_idx ON user_postgres ((data->>'confirmationcode')) WHERE data->>'confirmationcode' <> ''`,
+			`CREATE INDEX IF NOT EXISTS user_postgres_confirmationcodebackup_idx ON user_postgres ((data->>'confirmationcodebackup')) WHERE data->>'confirmationcodebackup' <> ''`,
+			`CREATE INDEX IF NOT EXISTS user_postgres_resetpasswordcode_idx ON user_postgres ((data->>'resetpasswordcode')) WHERE data->>'resetpasswordcode' <> ''`,
+		},
+	},
+	{
+		Version: 17,
+		Name:    "create_user_identities",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS user_identities (
+				id bigserial PRIMARY KEY,
+				user_id bigint NOT NULL,
+				issuer text NOT NULL,
+				subject text NOT NULL,
+				created timestamptz,
+				UNIQUE (issuer, subject)
+			)`,
+			`CREATE INDEX IF NOT EXISTS user_identities_user_idx ON user_identities (user_id)`,
+			// Users who signed up with Google keep logging in with it
+			`INSERT INTO user_identities (user_id, issuer, subject, created)
+				SELECT id, 'https://accounts.google.com', data->>'googleid', now()
+				FROM user_postgres
+				WHERE coalesce(data->>'googleid', '') <> ''
+				ON CONFLICT (issuer, subject) DO NOTHING`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS user_identities`,
+		},
+	},
+}
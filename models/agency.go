@@ -4,11 +4,16 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/go-pg/pg/orm"
+
 	"github.com/news-ai/api-v1/db"
 )
 
+//go:generate go run ../fillgen/main.go -type=Agency
+
 type Agency struct {
 	Base
+	Version int64 `json:"version"`
 
 	Name  string `json:"name"`
 	Email string `json:"email"`
@@ -35,22 +40,13 @@ func (a *Agency) Create(r *http.Request, currentUser UserPostgres) (*Agency, err
 
 // Function to save a new agency into App Engine
 func (a *Agency) Save() (*Agency, error) {
+	return a.SaveIn(db.DB)
+}
+
+// Same as Save, on a given connection or transaction
+func (a *Agency) SaveIn(conn orm.DB) (*Agency, error) {
 	// Update the Updated time
 	a.Updated = time.Now()
-	_, err := db.DB.Model(a).Update()
+	err := saveVersioned(conn, a, "Agency", a.Id, &a.Version)
 	return a, err
 }
-
-/*
-* Action methods
- */
-
-func (a *Agency) FillStruct(m map[string]interface{}) error {
-	for k, v := range m {
-		err := SetField(a, k, v)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
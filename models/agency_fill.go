@@ -0,0 +1,79 @@
+// Code generated by fillgen; DO NOT EDIT.
+
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/news-ai/cast"
+)
+
+// SetField sets the field of Agency named by key from a decoded JSON value.
+func (a *Agency) SetField(key string, value interface{}) error {
+	switch key {
+	case "Created":
+		v, err := cast.ToTime(value)
+		if err != nil {
+			return err
+		}
+		a.Created = v
+		return nil
+	case "CreatedBy":
+		a.CreatedBy = cast.ToInt64(value)
+		return nil
+	case "Deleted":
+		v, ok := value.(*time.Time)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		a.Deleted = v
+		return nil
+	case "Email":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		a.Email = v
+		return nil
+	case "Id", "id":
+		a.Id = cast.ToInt64(value)
+		return nil
+	case "Name":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		a.Name = v
+		return nil
+	case "Type":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		a.Type = v
+		return nil
+	case "Updated":
+		v, err := cast.ToTime(value)
+		if err != nil {
+			return err
+		}
+		a.Updated = v
+		return nil
+	case "Version":
+		a.Version = cast.ToInt64(value)
+		return nil
+	}
+	return errors.New("No such field:" + key + " in obj")
+}
+
+// FillStruct sets every field of Agency present in m.
+func (a *Agency) FillStruct(m map[string]interface{}) error {
+	for k, v := range m {
+		err := a.SetField(k, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestAgencyFillStructMatchesSetField(t *testing.T) {
+	payloads := []string{
+		`{"Id": 5066549580791808, "Type": "agencies", "CreatedBy": 4785074604081152,
+			"Created": "2017-01-09T21:44:03.113Z", "Updated": "2017-02-01T10:00:00Z",
+			"Name": "NewsAI", "Email": "newsai.org"}`,
+		`{"id": "5066549580791808", "Name": "NewsAI"}`,
+		`{"Name": "NewsAI", "Email": 12}`,
+		`{"Name": "NewsAI", "Administrators": [1, 2]}`,
+		`{"Name": "NewsAI", "Created": "last week"}`,
+	}
+
+	for _, payload := range payloads {
+		m := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(payload), &m); err != nil {
+			t.Fatalf("payload %s: %v", payload, err)
+		}
+
+		// How FillStruct worked before fillgen
+		legacy := Agency{}
+		var legacyErr error
+		for k, v := range m {
+			if legacyErr = SetField(&legacy, k, v); legacyErr != nil {
+				break
+			}
+		}
+
+		generated := Agency{}
+		generatedErr := generated.FillStruct(m)
+
+		if (legacyErr == nil) != (generatedErr == nil) {
+			t.Errorf("%s: SetField error %v, FillStruct error %v", payload, legacyErr, generatedErr)
+			continue
+		}
+		if legacyErr == nil && !reflect.DeepEqual(legacy, generated) {
+			t.Errorf("%s: SetField filled %+v, FillStruct filled %+v", payload, legacy, generated)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+const (
+	ApiKeyScopeReadOnly = "read-only"
+	ApiKeyScopeUsers    = "users"
+	ApiKeyScopeBilling  = "billing"
+	ApiKeyScopeSearch   = "search"
+)
+
+var ApiKeyScopes = []string{ApiKeyScopeReadOnly, ApiKeyScopeUsers, ApiKeyScopeBilling, ApiKeyScopeSearch}
+
+// Every key starts with this, so a leaked key is easy to grep for
+const apiKeyPrefix = "nai_"
+
+// ApiKey is one of the keys a user can call the API with. Only the hash
+// of the key is stored; the key itself is shown once when it is created.
+type ApiKey struct {
+	Base
+
+	UserId int64  `json:"userid"`
+	Name   string `json:"name"`
+
+	// First characters of the key, to tell keys apart in a list
+	Prefix  string `json:"prefix"`
+	KeyHash string `json:"-"`
+
+	Scopes []string `json:"scopes"`
+
+	Expires  time.Time  `json:"expires"`
+	LastUsed time.Time  `json:"lastused"`
+	Revoked  *time.Time `json:"revoked,omitempty"`
+}
+
+// What a user gets back once, right after creating a key
+type ApiKeyCreated struct {
+	ApiKey
+
+	Key string `json:"key"`
+}
+
+/*
+* Public methods
+ */
+
+// NewApiKeySecret returns a new random key and the hash to store for it.
+func NewApiKeySecret() (string, string, error) {
+	raw := make([]byte, 24)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", "", err
+	}
+
+	key := apiKeyPrefix + hex.EncodeToString(raw)
+	return key, HashApiKey(key), nil
+}
+
+func HashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func ValidApiKeyScope(scope string) bool {
+	for _, valid := range ApiKeyScopes {
+		if scope == valid {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *ApiKey) HasScope(scope string) bool {
+	for _, current := range k.Scopes {
+		if current == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Usable is false once a key has been revoked, deleted or has expired.
+func (k *ApiKey) Usable() bool {
+	if k.Revoked != nil || k.IsDeleted() {
+		return false
+	}
+	return k.Expires.IsZero() || k.Expires.After(time.Now())
+}
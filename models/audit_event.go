@@ -0,0 +1,141 @@
+package models
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+const (
+	AuditUserBan         = "user.ban"
+	AuditUserUpdateEmail = "user.updateemail"
+	AuditUserDelete      = "user.delete"
+	AuditUserRestore     = "user.restore"
+	AuditBillingAddPlan  = "billing.addplan"
+	AuditBillingCancel   = "billing.cancel"
+	AuditBillingWebhook  = "billing.webhook"
+	AuditTeamDelete      = "team.delete"
+	AuditTeamRestore     = "team.restore"
+	AuditClientDelete    = "client.delete"
+	AuditClientRestore   = "client.restore"
+	AuditAgencyDelete    = "agency.delete"
+	AuditAgencyRestore   = "agency.restore"
+	AuditApiKeyCreate    = "apikey.create"
+	AuditApiKeyRevoke    = "apikey.revoke"
+
+	AuditUserTwoFactorEnable  = "user.twofactorenable"
+	AuditUserTwoFactorDisable = "user.twofactordisable"
+	AuditTeamRequireTwoFactor = "team.requiretwofactor"
+
+	AuditUserImpersonateStart = "user.impersonatestart"
+	AuditUserImpersonateStop  = "user.impersonatestop"
+
+	AuditSignupReviewApprove = "signupreview.approve"
+	AuditSignupReviewReject  = "signupreview.reject"
+
+	AuditPlanCreate     = "plan.create"
+	AuditPlanUpdate     = "plan.update"
+	AuditPlanDeactivate = "plan.deactivate"
+
+	AuditEntitlementOverrideCreate = "entitlementoverride.create"
+	AuditEntitlementOverrideDelete = "entitlementoverride.delete"
+
+	AuditBillingSwitchPlan = "billing.switchplan"
+)
+
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditEvent is a row in the append-only audit_events table. Rows are
+// never updated or deleted once written.
+type AuditEvent struct {
+	Id int64 `json:"id"`
+
+	Type string `json:"type" sql:"-"`
+
+	Created time.Time `json:"created"`
+
+	ActorId    int64  `json:"actorid"`
+	Action     string `json:"action"`
+	TargetType string `json:"targettype"`
+	TargetId   int64  `json:"targetid"`
+
+	// Set when the actor was being impersonated by an admin at the time
+	ImpersonatorId int64 `json:"impersonatorid,omitempty"`
+
+	// Fields that changed, keyed by their json name
+	Changes map[string]AuditChange `json:"changes"`
+
+	// Request metadata
+	IPAddress string `json:"ipaddress"`
+	UserAgent string `json:"useragent"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+}
+
+/*
+* Private methods
+ */
+
+// Fields that change on every save and would only add noise to a diff
+var auditIgnoredFields = map[string]bool{
+	"updated": true,
+	"version": true,
+}
+
+func auditFields(value interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if value == nil {
+		return fields
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fields
+	}
+	json.Unmarshal(raw, &fields)
+	return fields
+}
+
+/*
+* Public methods
+ */
+
+// AuditDiff compares the json form of two values and returns the fields
+// that differ. Fields tagged json:"-" (passwords, tokens) never show up.
+func AuditDiff(before, after interface{}) map[string]AuditChange {
+	beforeFields := auditFields(before)
+	afterFields := auditFields(after)
+
+	changes := map[string]AuditChange{}
+	for key, value := range beforeFields {
+		if !auditIgnoredFields[key] && !reflect.DeepEqual(value, afterFields[key]) {
+			changes[key] = AuditChange{Before: value, After: afterFields[key]}
+		}
+	}
+	for key, value := range afterFields {
+		if _, ok := beforeFields[key]; !ok && !auditIgnoredFields[key] {
+			changes[key] = AuditChange{Before: nil, After: value}
+		}
+	}
+	return changes
+}
+
+// NewAuditEvent fills in an event for an action taken during r.
+func NewAuditEvent(r *http.Request, actorId int64, action string, targetType string, targetId int64, before, after interface{}) AuditEvent {
+	return AuditEvent{
+		Created:    time.Now(),
+		ActorId:    actorId,
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   targetId,
+		Changes:    AuditDiff(before, after),
+		IPAddress:  RequestIP(r),
+		UserAgent:  r.UserAgent(),
+		Method:     r.Method,
+		Path:       r.URL.Path,
+	}
+}
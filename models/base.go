@@ -13,4 +13,20 @@ type Base struct {
 
 	Created time.Time `json:"created"`
 	Updated time.Time `json:"updated"`
+
+	// Set when the row is soft deleted. List queries skip these rows.
+	Deleted *time.Time `json:"deleted,omitempty"`
+}
+
+func (b *Base) SoftDelete() {
+	now := time.Now()
+	b.Deleted = &now
+}
+
+func (b *Base) Restore() {
+	b.Deleted = nil
+}
+
+func (b *Base) IsDeleted() bool {
+	return b.Deleted != nil
 }
@@ -3,6 +3,8 @@ package models
 import (
 	"time"
 
+	"github.com/go-pg/pg/orm"
+
 	"github.com/news-ai/api-v1/db"
 )
 
@@ -17,6 +19,21 @@ type Billing struct {
 	IsAgency     bool      `json:"isagency"`
 	IsCancel     bool      `json:"iscancel"`
 
+	// The subscription Stripe webhooks are applied for
+	StripeSubscriptionId string `json:"stripesubscriptionid"`
+
+	// A cheaper Stripe plan the subscription is already on, that the user
+	// moves to when the period they paid for ends
+	PendingStripePlanId string `json:"pendingstripeplanid"`
+
+	// The invoice that paid for the current period. Only refunding it
+	// ends the period.
+	StripeInvoiceId string `json:"stripeinvoiceid"`
+
+	// When the latest Stripe event applied to the billing was created.
+	// Stripe does not send events in order, so older ones are skipped.
+	LastStripeEvent time.Time `json:"laststripeevent"`
+
 	ReasonForCancel string `json:"reasonforcancel"`
 
 	ReasonNotPurchase  string `json:"reasonnotpurchase"`
@@ -28,7 +45,8 @@ type Billing struct {
 }
 
 type BillingPostgres struct {
-	Id int64
+	Id      int64
+	Version int64
 
 	Data Billing
 }
@@ -42,9 +60,14 @@ type BillingPostgres struct {
  */
 
 func (bi *BillingPostgres) Create(currentUser UserPostgres) (*BillingPostgres, error) {
+	return bi.CreateIn(db.DB, currentUser)
+}
+
+// Same as Create, on a given connection or transaction
+func (bi *BillingPostgres) CreateIn(conn orm.DB, currentUser UserPostgres) (*BillingPostgres, error) {
 	bi.Data.CreatedBy = currentUser.Id
 	bi.Data.Created = time.Now()
-	_, err := db.DB.Model(bi).Returning("*").Insert()
+	_, err := conn.Model(bi).Returning("*").Insert()
 	return bi, err
 }
 
@@ -54,8 +77,13 @@ func (bi *BillingPostgres) Create(currentUser UserPostgres) (*BillingPostgres, e
 
 // Function to save a new billing into App Engine
 func (bi *BillingPostgres) Save() (*BillingPostgres, error) {
+	return bi.SaveIn(db.DB)
+}
+
+// Same as Save, on a given connection or transaction
+func (bi *BillingPostgres) SaveIn(conn orm.DB) (*BillingPostgres, error) {
 	// Update the Updated time
 	bi.Data.Updated = time.Now()
-	_, err := db.DB.Model(bi).Set("data = ?data").Where("id = ?id").Returning("*").Update()
+	err := saveVersioned(conn, bi, "Billing", bi.Id, &bi.Version, "data = ?data", "version = ?version")
 	return bi, err
 }
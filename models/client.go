@@ -4,11 +4,14 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/go-pg/pg/orm"
+
 	"github.com/news-ai/api-v1/db"
 )
 
 type Client struct {
 	Base
+	Version int64 `json:"version"`
 
 	Name  string   `json:"name"`
 	URL   string   `json:"url"`
@@ -45,8 +48,13 @@ func (cl *Client) Create(r *http.Request, currentUser User) (*Client, error) {
 
 // Function to save a new billing into App Engine
 func (cl *Client) Save() (*Client, error) {
+	return cl.SaveIn(db.DB)
+}
+
+// Same as Save, on a given connection or transaction
+func (cl *Client) SaveIn(conn orm.DB) (*Client, error) {
 	// Update the Updated time
 	cl.Updated = time.Now()
-	_, err := db.DB.Model(cl).Update()
+	err := saveVersioned(conn, cl, "Client", cl.Id, &cl.Version)
 	return cl, err
 }
@@ -7,6 +7,9 @@ import (
 	"github.com/news-ai/cast"
 )
 
+// Deprecated: models filled from search results get typed SetField and
+// FillStruct methods from fillgen instead. Kept for packages outside this
+// repository that still call it.
 func SetField(obj interface{}, name string, value interface{}) error {
 	if name == "id" {
 		name = "Id"
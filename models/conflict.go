@@ -0,0 +1,59 @@
+package models
+
+import (
+	"strconv"
+
+	"github.com/go-pg/pg/orm"
+)
+
+// ConflictError is returned by Save when the row was changed by someone
+// else after it was read.
+type ConflictError struct {
+	Model string
+	Id    int64
+}
+
+func (e *ConflictError) Error() string {
+	return e.Model + " " + strconv.FormatInt(e.Id, 10) + " was modified by another request"
+}
+
+func IsConflict(err error) bool {
+	_, ok := err.(*ConflictError)
+	return ok
+}
+
+// RetryOnConflict calls fn until it stops returning a ConflictError, at
+// most attempts times. fn has to re-read whatever it is about to save.
+func RetryOnConflict(attempts int, fn func() error) error {
+	err := fn()
+	for i := 1; i < attempts && IsConflict(err); i++ {
+		err = fn()
+	}
+	return err
+}
+
+// Updates a row only if its version column still matches the one that was
+// read, and bumps it. columns are passed to Set; with none the whole
+// row is written.
+func saveVersioned(conn orm.DB, model interface{}, modelName string, id int64, version *int64, columns ...string) error {
+	current := *version
+	*version = current + 1
+
+	q := conn.Model(model)
+	for _, column := range columns {
+		q = q.Set(column)
+	}
+
+	res, err := q.Where("id = ?", id).Where("version = ?", current).Returning("*").Update()
+	if err != nil {
+		*version = current
+		return err
+	}
+
+	if res.RowsAffected() == 0 {
+		*version = current
+		return &ConflictError{Model: modelName, Id: id}
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Resources a plan limits
+const (
+	EntitlementEmailsPerDay   = "emailsperday"
+	EntitlementEmailAccounts  = "emailaccounts"
+	EntitlementSocialAccounts = "socialaccounts"
+	EntitlementEnhanceCredits = "enhancecredits"
+	EntitlementMediaDatabase  = "mediadatabase"
+)
+
+var EntitlementResources = []string{EntitlementEmailsPerDay, EntitlementEmailAccounts, EntitlementSocialAccounts, EntitlementEnhanceCredits, EntitlementMediaDatabase}
+
+var entitlementNames = map[string]string{
+	EntitlementEmailsPerDay:   "emails a day",
+	EntitlementEmailAccounts:  "email accounts",
+	EntitlementSocialAccounts: "social accounts",
+	EntitlementEnhanceCredits: "enhance credits",
+}
+
+// An override with this limit lifts the limit altogether
+const EntitlementUnlimited = -1
+
+// Entitlements are the limits a user ends up with once their plan, their
+// team and any overrides are taken into account. Media database access is
+// a limit of 0 or 1.
+type Entitlements struct {
+	UserId   int64  `json:"userid"`
+	PlanName string `json:"planname"`
+	OnTrial  bool   `json:"ontrial"`
+
+	Limits map[string]int `json:"limits"`
+	Used   map[string]int `json:"used"`
+}
+
+// EntitlementOverride replaces one limit of a plan, for a single user or
+// for every member of a team. A user's own override wins over their
+// team's.
+type EntitlementOverride struct {
+	Id int64 `json:"id"`
+
+	Type string `json:"type" sql:"-"`
+
+	UserId int64 `json:"userid"`
+	TeamId int64 `json:"teamid"`
+
+	Resource string `json:"resource"`
+	Limit    int    `json:"limit"`
+	Reason   string `json:"reason"`
+
+	CreatedBy int64      `json:"createdby"`
+	Created   time.Time  `json:"created"`
+	Expires   *time.Time `json:"expires,omitempty"`
+}
+
+// LimitExceededError is returned when an action would take a user over
+// one of their limits.
+type LimitExceededError struct {
+	Resource string
+	Limit    int
+	Used     int
+
+	// When the counter starts over, for limits that reset
+	Resets time.Time
+}
+
+// PlanUsageError is returned when a user asks for a plan that allows less
+// of a resource than they already have.
+type PlanUsageError struct {
+	Plan     string
+	Resource string
+	Limit    int
+	Used     int
+}
+
+/*
+* Public methods
+ */
+
+func IsEntitlementResource(resource string) bool {
+	for i := 0; i < len(EntitlementResources); i++ {
+		if EntitlementResources[i] == resource {
+			return true
+		}
+	}
+	return false
+}
+
+// Metered resources are used up and counted per period; the others are
+// counted by what the user has at the moment.
+func IsMeteredEntitlement(resource string) bool {
+	return resource == EntitlementEmailsPerDay || resource == EntitlementEnhanceCredits
+}
+
+// EntitlementPeriod names the period a metered resource is counted in at
+// the given time, and returns when the next one starts. Emails are counted
+// per day and enhance credits per month, both in UTC.
+func EntitlementPeriod(resource string, at time.Time) (string, time.Time) {
+	at = at.UTC()
+	if resource == EntitlementEmailsPerDay {
+		day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+		return day.Format("2006-01-02"), day.AddDate(0, 0, 1)
+	}
+	month := time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return month.Format("2006-01"), month.AddDate(0, 1, 0)
+}
+
+func (o *EntitlementOverride) IsExpired(at time.Time) bool {
+	return o.Expires != nil && !o.Expires.After(at)
+}
+
+func (e *LimitExceededError) Error() string {
+	if e.Resource == EntitlementMediaDatabase {
+		return "Your plan does not include the media database"
+	}
+	message := "You have reached the limit of " + strconv.Itoa(e.Limit) + " " + entitlementNames[e.Resource] + " on your plan"
+	if !e.Resets.IsZero() {
+		message += ". It resets on " + e.Resets.Format("2006-01-02")
+	}
+	return message
+}
+
+// StatusCode is 429 for limits that reset on their own, and 402 for those
+// that only a bigger plan lifts.
+func (e *LimitExceededError) StatusCode() int {
+	if e.Resource == EntitlementEmailsPerDay {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusPaymentRequired
+}
+
+func (e *PlanUsageError) Error() string {
+	return "The " + e.Plan + " plan allows " + strconv.Itoa(e.Limit) + " " + entitlementNames[e.Resource] + " and you have " + strconv.Itoa(e.Used) + ". Please remove some before switching"
+}
+
+func IsLimitExceeded(err error) bool {
+	_, ok := err.(*LimitExceededError)
+	return ok
+}
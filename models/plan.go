@@ -1,8 +1,84 @@
 package models
 
+import (
+	"strings"
+	"time"
+)
+
+// Plan is one row of the plan catalog. StripeId is the id of its monthly
+// plan in Stripe; the annual one is StripeId + "-yearly". Aliases are the
+// older ids a billing profile may still carry, like "bronze" for
+// "personal".
 type Plan struct {
-	Name     string
-	StripeId string
+	Id int64 `json:"id"`
+
+	Type string `json:"type" sql:"-"`
+
+	Name     string   `json:"name"`
+	StripeId string   `json:"stripeid"`
+	Aliases  []string `json:"aliases"`
+
+	// AnnualPrice is what a month costs when billed annually
+	MonthlyPrice float64 `json:"monthlyprice"`
+	AnnualPrice  float64 `json:"annualprice"`
+
+	EmailAccounts  int `json:"emailaccounts"`
+	EmailsPerDay   int `json:"emailsperday"`
+	SocialAccounts int `json:"socialaccounts"`
+	EnhanceCredits int `json:"enhancecredits"`
+
+	MediaDatabase bool `json:"mediadatabase"`
+
+	// Plans that are not active can't be picked anymore, but users already
+	// on them keep their limits.
+	Active bool `json:"active"`
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+/*
+* Public methods
+ */
+
+// HasId tells whether id names this plan, by its Stripe id or an alias.
+func (p *Plan) HasId(id string) bool {
+	id = strings.ToLower(id)
+	if strings.ToLower(p.StripeId) == id {
+		return true
+	}
+	for i := 0; i < len(p.Aliases); i++ {
+		if strings.ToLower(p.Aliases[i]) == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Price is what the plan is billed at for the duration, "monthly" or
+// "annually".
+func (p *Plan) Price(duration string) float64 {
+	if duration == "monthly" {
+		return p.MonthlyPrice
+	}
+	return p.AnnualPrice * 12
+}
 
-	Active bool
+// Limit is the plan's limit on one of the entitlement resources.
+func (p *Plan) Limit(resource string) int {
+	switch resource {
+	case EntitlementEmailsPerDay:
+		return p.EmailsPerDay
+	case EntitlementEmailAccounts:
+		return p.EmailAccounts
+	case EntitlementSocialAccounts:
+		return p.SocialAccounts
+	case EntitlementEnhanceCredits:
+		return p.EnhanceCredits
+	case EntitlementMediaDatabase:
+		if p.MediaDatabase {
+			return 1
+		}
+	}
+	return 0
 }
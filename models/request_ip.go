@@ -0,0 +1,104 @@
+package models
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Proxies whose X-Forwarded-For header is believed. Empty unless
+// SetupTrustedProxies found some in TRUSTED_PROXIES.
+var trustedProxies = []*net.IPNet{}
+
+/*
+* Private methods
+ */
+
+func parseTrustedProxies(proxies string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, proxy := range strings.Split(proxies, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return []*net.IPNet{}, errors.New("Invalid trusted proxy " + proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return []*net.IPNet{}, errors.New("Invalid trusted proxy " + proxy)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func isTrustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+* Public methods
+ */
+
+// SetupTrustedProxies reads TRUSTED_PROXIES, a comma separated list of the
+// addresses or CIDR ranges of our load balancers.
+func SetupTrustedProxies() error {
+	networks, err := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return err
+	}
+	trustedProxies = networks
+	return nil
+}
+
+// RequestIP is the address of the client behind the load balancer.
+// X-Forwarded-For is only read when the request came from a trusted proxy,
+// and then from the right, since any client can put addresses on its left:
+// the client is the last hop that is not one of our proxies.
+func RequestIP(r *http.Request) string {
+	address, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		address = r.RemoteAddr
+	}
+
+	if !isTrustedProxy(address) {
+		return address
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		address = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return address
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestRequestIP(t *testing.T) {
+	networks, err := parseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatalf("parseTrustedProxies: %v", err)
+	}
+	trustedProxies = networks
+	defer func() { trustedProxies = []*net.IPNet{} }()
+
+	tests := []struct {
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		// Clients that don't come through a proxy can't pick their address
+		{"203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"203.0.113.7:5000", "", "203.0.113.7"},
+		// Behind a proxy the client is the last hop it saw
+		{"10.0.0.2:5000", "198.51.100.1", "198.51.100.1"},
+		{"10.0.0.2:5000", "1.2.3.4, 198.51.100.1", "198.51.100.1"},
+		{"10.0.0.2:5000", "1.2.3.4, 198.51.100.1, 192.168.1.1, 10.1.1.1", "198.51.100.1"},
+		{"10.0.0.2:5000", "", "10.0.0.2"},
+		{"10.0.0.2:5000", "1.2.3.4, not-an-ip", "10.0.0.2"},
+		{"192.168.1.1:5000", "10.0.0.3", "10.0.0.3"},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if got := RequestIP(r); got != test.want {
+			t.Errorf("RequestIP from %s with %q = %s, want %s", test.remoteAddr, test.forwarded, got, test.want)
+		}
+	}
+}
+
+func TestParseTrustedProxiesInvalid(t *testing.T) {
+	for _, proxies := range []string{"10.0.0.300", "10.0.0.0/40", "proxy.internal"} {
+		if _, err := parseTrustedProxies(proxies); err == nil {
+			t.Errorf("parseTrustedProxies(%q) did not fail", proxies)
+		}
+	}
+}
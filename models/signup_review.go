@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	SignupReviewPending  = "pending"
+	SignupReviewApproved = "approved"
+	SignupReviewRejected = "rejected"
+)
+
+// SignupReview holds a signup the screening flagged until an admin looks
+// at it. The account exists, but its confirmation email is only sent once
+// the review is approved.
+type SignupReview struct {
+	Id int64 `json:"id"`
+
+	Type string `json:"type" sql:"-"`
+
+	UserId    int64    `json:"userid"`
+	Email     string   `json:"email"`
+	IPAddress string   `json:"ipaddress"`
+	Reasons   []string `json:"reasons"`
+
+	Status    string     `json:"status"`
+	Created   time.Time  `json:"created"`
+	DecidedBy int64      `json:"decidedby"`
+	Decided   *time.Time `json:"decided,omitempty"`
+}
+
+func (s *SignupReview) IsPending() bool {
+	return s.Status == SignupReviewPending
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// ProcessedStripeEvent records a Stripe webhook event that was applied, so
+// a delivery Stripe retries is only applied once.
+type ProcessedStripeEvent struct {
+	// Stripe's id of the event
+	Id   string `json:"id"`
+	Type string `json:"type"`
+
+	Processed time.Time `json:"processed"`
+}
@@ -4,11 +4,14 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/go-pg/pg/orm"
+
 	"github.com/news-ai/api-v1/db"
 )
 
 type Team struct {
 	Base
+	Version int64 `json:"version"`
 
 	Name string `json:"name"`
 
@@ -18,6 +21,9 @@ type Team struct {
 
 	Members []int64 `json:"members" apiModel:"User"`
 	Admins  []int64 `json:"admins" apiModel:"User"`
+
+	// Members can't log in with a password alone
+	RequireTwoFactor bool `json:"requiretwofactor"`
 }
 
 /*
@@ -42,8 +48,13 @@ func (t *Team) Create(r *http.Request, currentUser UserPostgres) (*Team, error)
 
 // Function to save a new team into App Engine
 func (t *Team) Save() (*Team, error) {
+	return t.SaveIn(db.DB)
+}
+
+// Same as Save, on a given connection or transaction
+func (t *Team) SaveIn(conn orm.DB) (*Team, error) {
 	// Update the Updated time
 	t.Updated = time.Now()
-	_, err := db.DB.Model(t).Update()
+	err := saveVersioned(conn, t, "Team", t.Id, &t.Version)
 	return t, err
 }
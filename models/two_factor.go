@@ -0,0 +1,161 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	twoFactorIssuer = "NewsAI"
+
+	// RFC 6238 defaults, which is what authenticator apps expect
+	totpDigits = 6
+	totpPeriod = 30
+
+	// Codes from one step either side are accepted for clock drift
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+)
+
+// What a user gets back when they start enrolling an authenticator app
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// Recovery codes are only shown once, when two-factor is turned on
+type TwoFactorRecoveryCodes struct {
+	RecoveryCodes []string `json:"recoverycodes"`
+}
+
+type TwoFactorStatus struct {
+	Enabled bool `json:"enabled"`
+
+	// Set when the user's team makes two-factor mandatory
+	Required bool `json:"required"`
+
+	RecoveryCodesLeft int `json:"recoverycodesleft"`
+}
+
+/*
+* Private methods
+ */
+
+func totpCode(secret []byte, step int64) string {
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	code := strconv.Itoa(int(value % 1000000))
+	return strings.Repeat("0", totpDigits-len(code)) + code
+}
+
+func decodeTwoFactorSecret(secret string) ([]byte, error) {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.Replace(code, "-", "", -1))))
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+* Public methods
+ */
+
+// NewTwoFactorSecret returns a random base32 secret for an authenticator app.
+func NewTwoFactorSecret() (string, error) {
+	raw := make([]byte, 20)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw), nil
+}
+
+// TwoFactorURI is the otpauth:// URI that authenticator apps read from a
+// QR code.
+func TwoFactorURI(email string, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", twoFactorIssuer)
+	values.Set("digits", strconv.Itoa(totpDigits))
+	values.Set("period", strconv.Itoa(totpPeriod))
+
+	label := url.PathEscape(twoFactorIssuer + ":" + email)
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
+
+// CheckTwoFactorCode returns the time step a code matched, or 0 when it
+// did not match. Steps at or before lastStep are refused so that a code
+// can't be used twice.
+func CheckTwoFactorCode(secret string, code string, lastStep int64) int64 {
+	return checkTwoFactorCodeAt(secret, code, lastStep, time.Now())
+}
+
+func checkTwoFactorCodeAt(secret string, code string, lastStep int64, now time.Time) int64 {
+	key, err := decodeTwoFactorSecret(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step
+		}
+	}
+	return 0
+}
+
+// NewRecoveryCodes returns the codes to show the user and the hashes to
+// store for them.
+func NewRecoveryCodes() ([]string, []string, error) {
+	codes := []string{}
+	hashes := []string{}
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 5)
+		_, err := rand.Read(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		code := hex.EncodeToString(raw)
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// UseRecoveryCode removes a matching recovery code from the user. The
+// caller has to save the user for the code to be spent.
+func (u *User) UseRecoveryCode(code string) bool {
+	hash := hashRecoveryCode(strings.TrimSpace(code))
+	for i, stored := range u.TwoFactorRecoveryCodes {
+		if hmac.Equal([]byte(stored), []byte(hash)) {
+			u.TwoFactorRecoveryCodes = append(u.TwoFactorRecoveryCodes[:i], u.TwoFactorRecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
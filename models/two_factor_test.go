@@ -0,0 +1,100 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// The RFC 6238 test secret, "12345678901234567890", in base32
+const testTwoFactorSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTotpCode(t *testing.T) {
+	key, err := decodeTwoFactorSecret(strings.ToLower(testTwoFactorSecret))
+	if err != nil {
+		t.Fatalf("decodeTwoFactorSecret: %v", err)
+	}
+
+	// The last 6 digits of the SHA1 vectors of RFC 6238
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, test := range tests {
+		if got := totpCode(key, test.unix/totpPeriod); got != test.want {
+			t.Errorf("totpCode at %d = %s, want %s", test.unix, got, test.want)
+		}
+	}
+}
+
+func TestCheckTwoFactorCode(t *testing.T) {
+	key, _ := decodeTwoFactorSecret(testTwoFactorSecret)
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		want     int64
+	}{
+		{"current step", totpCode(key, current), 0, current},
+		{"one step behind", totpCode(key, current-1), 0, current - 1},
+		{"one step ahead", totpCode(key, current+1), 0, current + 1},
+		{"two steps behind", totpCode(key, current-2), 0, 0},
+		{"two steps ahead", totpCode(key, current+2), 0, 0},
+		{"wrong code", "000000", 0, 0},
+		{"too short", totpCode(key, current)[:5], 0, 0},
+		// A code can't be used again once its step or a later one was
+		{"replayed", totpCode(key, current), current, 0},
+		{"older than the last used", totpCode(key, current-1), current, 0},
+		{"newer than the last used", totpCode(key, current+1), current, current + 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := checkTwoFactorCodeAt(testTwoFactorSecret, test.code, test.lastStep, now); got != test.want {
+				t.Errorf("checkTwoFactorCodeAt(%s, %d) = %d, want %d", test.code, test.lastStep, got, test.want)
+			}
+		})
+	}
+
+	if got := checkTwoFactorCodeAt("not base32!", totpCode(key, current), 0, now); got != 0 {
+		t.Errorf("checkTwoFactorCodeAt with a bad secret = %d, want 0", got)
+	}
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes()
+	if err != nil {
+		t.Fatalf("NewRecoveryCodes: %v", err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("NewRecoveryCodes = %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+
+	user := User{TwoFactorRecoveryCodes: hashes}
+
+	// However the user types it in
+	typed := " " + strings.ToUpper(strings.Replace(codes[3], "-", "", -1)) + " "
+	if !user.UseRecoveryCode(typed) {
+		t.Fatalf("UseRecoveryCode(%q) = false, want true", typed)
+	}
+	if user.UseRecoveryCode(codes[3]) {
+		t.Error("UseRecoveryCode of a used code = true, want false")
+	}
+	if len(user.TwoFactorRecoveryCodes) != recoveryCodeCount-1 {
+		t.Errorf("codes left = %d, want %d", len(user.TwoFactorRecoveryCodes), recoveryCodeCount-1)
+	}
+
+	if user.UseRecoveryCode("00000-00000") {
+		t.Error("UseRecoveryCode of an unknown code = true, want false")
+	}
+	if !user.UseRecoveryCode(codes[0]) {
+		t.Error("UseRecoveryCode of another code = false, want true")
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+
 	"github.com/news-ai/api-v1/db"
 )
 
@@ -51,13 +54,16 @@ type User struct {
 	EmailAlias string `json:"-"`
 
 	Password []byte `json:"-"`
-	ApiKey   string `json:"-"`
 
-	Employers []int64 `json:"employers" apiModel:"Agency"`
+	// Two-factor authentication. The pending secret is kept until the
+	// user confirms it with a code from their app.
+	TwoFactorEnabled       bool     `json:"twofactorenabled"`
+	TwoFactorSecret        string   `json:"-"`
+	TwoFactorPendingSecret string   `json:"-"`
+	TwoFactorLastStep      int64    `json:"-"`
+	TwoFactorRecoveryCodes []string `json:"-"`
 
-	ResetPasswordCode      string `json:"-"`
-	ConfirmationCode       string `json:"-"`
-	ConfirmationCodeBackup string `json:"-"`
+	Employers []int64 `json:"employers" apiModel:"Agency"`
 
 	LastLoggedIn time.Time `json:"-"`
 
@@ -113,6 +119,10 @@ type User struct {
 
 	IsAdmin bool `json:"isadmin"`
 
+	// Only filled in on /api/users/me while an admin is impersonating
+	// the user. It is never saved.
+	ImpersonatedBy int64 `json:"impersonatedby,omitempty"`
+
 	IsActive            bool `json:"isactive"`
 	IsBanned            bool `json:"isbanned"`
 	MediaDatabaseAccess bool `json:"mediadatabaseaccess"`
@@ -126,7 +136,8 @@ type User struct {
 }
 
 type UserPostgres struct {
-	Id int64
+	Id      int64
+	Version int64
 
 	Data User
 }
@@ -164,14 +175,18 @@ func (u *UserPostgres) Create() (*UserPostgres, error) {
 
 // Function to save a new user into App Engine
 func (u *UserPostgres) Save() (*UserPostgres, error) {
+	return u.SaveIn(db.DB)
+}
+
+// Same as Save, on a given connection or transaction
+func (u *UserPostgres) SaveIn(conn orm.DB) (*UserPostgres, error) {
 	u.Data.Updated = time.Now()
-	_, err := db.DB.Model(u).Set("data = ?data").Where("id = ?id").Returning("*").Update()
+	err := saveVersioned(conn, u, "User", u.Id, &u.Version, "data = ?data", "version = ?version")
 	return u, err
 }
 
 func (u *UserPostgres) ConfirmEmail() (*UserPostgres, error) {
 	u.Data.EmailConfirmed = true
-	u.Data.ConfirmationCode = ""
 	_, err := u.Save()
 	if err != nil {
 		log.Printf("%v", err)
@@ -205,18 +220,28 @@ func (u *UserPostgres) SetStripeId(currentUser UserPostgres, stripeId string, st
 	billingPostgres := BillingPostgres{}
 	billingPostgres.Data = billing
 
-	_, err := billingPostgres.Create(currentUser)
-	if err != nil {
-		log.Printf("%v", err)
-		return u, 0, err
-	}
-
-	u.Data.BillingId = billing.Id
-	u.Data.IsActive = isActive
-	_, err = u.Save()
+	// The billing row and the user pointing at it are written together,
+	// so a failed user save does not leave an orphaned billing row.
+	previousBillingId := u.Data.BillingId
+	previousIsActive := u.Data.IsActive
+	previousVersion := u.Version
+	err := db.RunInTransaction(func(tx *pg.Tx) error {
+		_, err := billingPostgres.CreateIn(tx, currentUser)
+		if err != nil {
+			return err
+		}
+
+		u.Data.BillingId = billingPostgres.Id
+		u.Data.IsActive = isActive
+		_, err = u.SaveIn(tx)
+		return err
+	})
 	if err != nil {
 		log.Printf("%v", err)
+		u.Data.BillingId = previousBillingId
+		u.Data.IsActive = previousIsActive
+		u.Version = previousVersion
 		return u, 0, err
 	}
-	return u, billing.Id, nil
+	return u, billingPostgres.Id, nil
 }
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/go-pg/pg/orm"
+
 	"github.com/news-ai/api-v1/db"
 )
 
@@ -13,6 +15,7 @@ type UserEmail struct {
 
 type UserEmailCode struct {
 	Base
+	Version int64 `json:"version"`
 
 	InviteCode string `json:"invitecode"`
 	Email      string `json:"email"`
@@ -38,8 +41,13 @@ func (uec *UserEmailCode) Create(r *http.Request, currentUser UserPostgres) (*Us
  */
 
 func (uec *UserEmailCode) Save() (*UserEmailCode, error) {
+	return uec.SaveIn(db.DB)
+}
+
+// Same as Save, on a given connection or transaction
+func (uec *UserEmailCode) SaveIn(conn orm.DB) (*UserEmailCode, error) {
 	uec.Updated = time.Now()
-	_, err := db.DB.Model(uec).Update()
+	err := saveVersioned(conn, uec, "UserEmailCode", uec.Id, &uec.Version)
 	return uec, err
 }
 
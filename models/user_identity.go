@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// UserIdentity links a user to an account at an identity provider, by the
+// provider's issuer and the subject it gives that account. Logins through
+// the provider find the user by this and not by the email it sends.
+type UserIdentity struct {
+	Id int64 `json:"id"`
+
+	UserId  int64  `json:"userid"`
+	Issuer  string `json:"issuer"`
+	Subject string `json:"subject"`
+
+	Created time.Time `json:"created"`
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/go-pg/pg/orm"
+
 	"github.com/news-ai/api-v1/db"
 )
 
@@ -14,6 +16,7 @@ type Invite struct {
 
 type UserInviteCode struct {
 	Base
+	Version int64 `json:"version"`
 
 	InviteCode string `json:"invitecode"`
 	Email      string `json:"email"`
@@ -44,12 +47,18 @@ func (uic *UserInviteCode) Create(r *http.Request, currentUser UserPostgres) (*U
 
 // Function to save a new user into App Engine
 func (uic *UserInviteCode) Save() (*UserInviteCode, error) {
+	return uic.SaveIn(db.DB)
+}
+
+// Same as Save, on a given connection or transaction
+func (uic *UserInviteCode) SaveIn(conn orm.DB) (*UserInviteCode, error) {
 	uic.Updated = time.Now()
-	_, err := db.DB.Model(uic).Update()
+	err := saveVersioned(conn, uic, "UserInviteCode", uic.Id, &uic.Version)
 	return uic, err
 }
 
-// Function to save a new user into App Engine
+// Soft deletes the invite, it stays around for the history
 func (uic *UserInviteCode) Delete() (*UserInviteCode, error) {
-	return uic, nil
+	uic.SoftDelete()
+	return uic.Save()
 }
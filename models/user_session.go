@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+// UserSession is one browser a user is logged in from. The redis session
+// holds the token; only its hash is stored here.
+type UserSession struct {
+	Id int64 `json:"id"`
+
+	Type string `json:"type" sql:"-"`
+
+	UserId    int64  `json:"userid"`
+	TokenHash string `json:"-"`
+
+	Device    string `json:"device"`
+	IPAddress string `json:"ipaddress"`
+
+	Created  time.Time  `json:"created"`
+	LastSeen time.Time  `json:"lastseen"`
+	Revoked  *time.Time `json:"revoked,omitempty"`
+
+	// Set on the session the list was requested from
+	Current bool `json:"current" sql:"-"`
+}
+
+/*
+* Public methods
+ */
+
+// NewSessionToken returns a new random session token and its hash.
+func NewSessionToken() (string, string, error) {
+	return newHashedToken()
+}
+
+func HashSessionToken(token string) string {
+	return HashToken(token)
+}
+
+func (s *UserSession) IsRevoked() bool {
+	return s.Revoked != nil
+}
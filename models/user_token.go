@@ -0,0 +1,84 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+const (
+	UserTokenResetPassword = "reset-password"
+	UserTokenConfirmEmail  = "confirm-email"
+	UserTokenMagicLink     = "magic-link"
+
+	// Refresh tokens of the token endpoint are not emailed, but are kept
+	// here by the id in their claims so they can be revoked
+	UserTokenRefresh = "refresh"
+)
+
+// UserToken is a one-time token sent to a user by email, to reset their
+// password, confirm their address or log in without a password. Only its
+// hash is stored, and it can be used once before it expires.
+type UserToken struct {
+	Id int64 `json:"id"`
+
+	UserId    int64  `json:"userid"`
+	Purpose   string `json:"purpose"`
+	TokenHash string `json:"-"`
+
+	Created time.Time  `json:"created"`
+	Expires time.Time  `json:"expires"`
+	Used    *time.Time `json:"used,omitempty"`
+}
+
+// What the expired token cleanup removed
+type UserTokenCleanup struct {
+	Type    string `json:"type"`
+	Deleted int    `json:"deleted"`
+}
+
+/*
+* Private methods
+ */
+
+func newHashedToken() (string, string, error) {
+	raw := make([]byte, 32)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", "", err
+	}
+
+	token := hex.EncodeToString(raw)
+	return token, HashToken(token), nil
+}
+
+/*
+* Public methods
+ */
+
+// NewUserToken returns a new random token for purpose, and the record to
+// store for it.
+func NewUserToken(userId int64, purpose string, lifetime time.Duration) (string, UserToken, error) {
+	token, hash, err := newHashedToken()
+	if err != nil {
+		return "", UserToken{}, err
+	}
+
+	return token, UserToken{
+		UserId:    userId,
+		Purpose:   purpose,
+		TokenHash: hash,
+		Created:   time.Now(),
+		Expires:   time.Now().Add(lifetime),
+	}, nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (t *UserToken) IsUsable() bool {
+	return t.Used == nil && time.Now().Before(t.Expires)
+}
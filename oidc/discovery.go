@@ -0,0 +1,122 @@
+package oidc
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyId   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+}
+
+/*
+* Private methods
+ */
+
+func getJSON(client *http.Client, url string, value interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("Request to " + url + " failed with " + resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(value)
+}
+
+func (p *Provider) getDiscovery() (discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if time.Since(p.discoveredAt) < discoveryLifetime {
+		return p.discovery, nil
+	}
+
+	discovery := discoveryDocument{}
+	err := getJSON(p.client, p.config.Issuer+"/.well-known/openid-configuration", &discovery)
+	if err != nil {
+		return discoveryDocument{}, err
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.config.Issuer {
+		return discoveryDocument{}, errors.New("Discovery for " + p.config.Name + " is for issuer " + discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return discoveryDocument{}, errors.New("Discovery for " + p.config.Name + " is missing endpoints")
+	}
+
+	p.discovery = discovery
+	p.discoveredAt = time.Now()
+	return discovery, nil
+}
+
+// Keys are fetched again when a token is signed with one we have not seen,
+// since that is how providers rotate them, but at most once a minute so
+// bad tokens can't make us fetch on every request.
+func (p *Provider) getKey(keyId string) (*rsa.PublicKey, error) {
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok := p.keys[keyId]
+	if (!ok && time.Since(p.keysFetchedAt) > time.Minute) || time.Since(p.keysFetchedAt) > discoveryLifetime {
+		keySet := struct {
+			Keys []jsonWebKey `json:"keys"`
+		}{}
+		err = getJSON(p.client, discovery.JWKSURI, &keySet)
+		if err != nil {
+			return nil, err
+		}
+
+		p.keys = map[string]jsonWebKey{}
+		for _, key := range keySet.Keys {
+			if key.KeyType == "RSA" && (key.Use == "" || key.Use == "sig") {
+				p.keys[key.KeyId] = key
+			}
+		}
+		p.keysFetchedAt = time.Now()
+		key, ok = p.keys[keyId]
+	}
+
+	if !ok {
+		return nil, errors.New("No key " + keyId + " for " + p.config.Name)
+	}
+
+	n, err := base64.RawURLEncoding.DecodeString(key.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(key.E)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
@@ -0,0 +1,144 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Allowed difference between our clock and the provider's
+const clockSkew = time.Minute
+
+type idTokenHeader struct {
+	Algorithm string `json:"alg"`
+	KeyId     string `json:"kid"`
+}
+
+/*
+* Private methods
+ */
+
+func (p *Provider) validIssuer(issuer string) bool {
+	if strings.TrimSuffix(issuer, "/") == p.config.Issuer {
+		return true
+	}
+	for _, accepted := range p.config.AcceptedIssuers {
+		if issuer == accepted {
+			return true
+		}
+	}
+	return false
+}
+
+// The aud claim is a string or a list of strings
+func audiences(claims map[string]interface{}) []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		values := []string{}
+		for _, value := range aud {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func timeClaim(claims map[string]interface{}, name string) (time.Time, bool) {
+	value, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(value), 0), true
+}
+
+// Only RS256 is accepted, which every provider we use signs with. In
+// particular "none" and HMAC with the public key are refused.
+func (p *Provider) verifyIDToken(idToken string, nonce string) (Identity, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return Identity{}, ErrInvalidIDToken
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return Identity{}, ErrInvalidIDToken
+	}
+	header := idTokenHeader{}
+	err = json.Unmarshal(rawHeader, &header)
+	if err != nil || header.Algorithm != "RS256" {
+		return Identity{}, ErrInvalidIDToken
+	}
+
+	key, err := p.getKey(header.KeyId)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, ErrInvalidIDToken
+	}
+	hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], signature)
+	if err != nil {
+		return Identity{}, ErrInvalidIDToken
+	}
+
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Identity{}, ErrInvalidIDToken
+	}
+	claims := map[string]interface{}{}
+	err = json.Unmarshal(rawClaims, &claims)
+	if err != nil {
+		return Identity{}, ErrInvalidIDToken
+	}
+
+	issuer := stringClaim(claims, "iss")
+	if !p.validIssuer(issuer) {
+		return Identity{}, errors.New("ID token from unexpected issuer " + issuer)
+	}
+
+	aud := audiences(claims)
+	validAudience := false
+	for _, value := range aud {
+		if value == p.config.ClientID {
+			validAudience = true
+		}
+	}
+	if !validAudience {
+		return Identity{}, errors.New("ID token is not for this client")
+	}
+	if len(aud) > 1 && stringClaim(claims, "azp") != p.config.ClientID {
+		return Identity{}, errors.New("ID token is not for this client")
+	}
+
+	expires, ok := timeClaim(claims, "exp")
+	if !ok || time.Now().Add(-clockSkew).After(expires) {
+		return Identity{}, errors.New("ID token has expired")
+	}
+	issuedAt, ok := timeClaim(claims, "iat")
+	if ok && issuedAt.After(time.Now().Add(clockSkew)) {
+		return Identity{}, errors.New("ID token is issued in the future")
+	}
+
+	if nonce == "" || stringClaim(claims, "nonce") != nonce {
+		return Identity{}, errors.New("ID token nonce does not match")
+	}
+
+	subject := stringClaim(claims, "sub")
+	if subject == "" {
+		return Identity{}, ErrInvalidIDToken
+	}
+
+	return Identity{Issuer: issuer, Subject: subject, Claims: claims}, nil
+}
@@ -0,0 +1,340 @@
+// Package oidc logs users in with an OpenID Connect identity provider. A
+// Provider is configured with the issuer URL and client credentials, and
+// finds everything else through discovery. Logins use the authorization
+// code flow with PKCE, and the ID token is checked against the provider's
+// keys and the nonce sent with the request.
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/news-ai/api-v1/models"
+)
+
+var (
+	ErrInvalidIDToken    = errors.New("Invalid ID token")
+	ErrEmailNotVerified  = errors.New("The identity provider has not verified this email")
+	ErrMissingEmailClaim = errors.New("The identity provider did not send an email")
+)
+
+// How long discovery documents and keys are cached for
+const discoveryLifetime = time.Hour
+
+// ClaimMapping names the ID token or userinfo claims that fill in a user.
+// Empty names fall back to the standard OpenID Connect claims.
+type ClaimMapping struct {
+	Email         string
+	EmailVerified string
+	FirstName     string
+	LastName      string
+}
+
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+
+	// Scopes besides openid. Defaults to email and profile.
+	Scopes []string
+
+	// Other values the iss claim may have, for providers like Google that
+	// do not always use the issuer URL.
+	AcceptedIssuers []string
+
+	Claims ClaimMapping
+
+	// Most providers say whether they checked the email. Set this for
+	// ones that never do, and only when every address they issue is
+	// trusted.
+	TrustEmail bool
+
+	// Called with the user mapped from the claims, for providers that
+	// need more than the claims saved on the user.
+	MapUser func(user *models.User, identity Identity, token Token)
+}
+
+// LoginState is what has to be kept in the session between sending the
+// user to the provider and the callback.
+type LoginState struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+
+	Expiry time.Time `json:"-"`
+}
+
+// Identity is who the provider says logged in.
+type Identity struct {
+	Issuer  string
+	Subject string
+	Claims  map[string]interface{}
+}
+
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     discoveryDocument
+	keys          map[string]jsonWebKey
+	discoveredAt  time.Time
+	keysFetchedAt time.Time
+}
+
+/*
+* Private methods
+ */
+
+func randomString() (string, error) {
+	raw := make([]byte, 32)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func claimName(name string, standard string) string {
+	if name == "" {
+		return standard
+	}
+	return name
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// email_verified is a boolean, but some providers send it as a string
+func boolClaim(claims map[string]interface{}, name string) (bool, bool) {
+	switch value := claims[name].(type) {
+	case bool:
+		return value, true
+	case string:
+		return value == "true", true
+	}
+	return false, false
+}
+
+func (p *Provider) scopes() []string {
+	scopes := p.config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email", "profile"}
+	}
+	return append([]string{"openid"}, scopes...)
+}
+
+func (p *Provider) exchange(code string, verifier string) (Token, error) {
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return Token{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("client_secret", p.config.ClientSecret)
+	form.Set("code_verifier", verifier)
+
+	resp, err := p.client.PostForm(discovery.TokenEndpoint, form)
+	if err != nil {
+		return Token{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Token{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Token{}, errors.New("Token request to " + p.config.Name + " failed with " + resp.Status + ": " + string(body))
+	}
+
+	token := Token{}
+	err = json.Unmarshal(body, &token)
+	if err != nil {
+		return Token{}, err
+	}
+	if token.IDToken == "" {
+		return Token{}, errors.New(p.config.Name + " did not return an ID token")
+	}
+	if token.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// Fills in claims the ID token left out from the userinfo endpoint. The
+// subject has to match, or the answer is about someone else.
+func (p *Provider) addUserInfo(identity *Identity, token Token) error {
+	discovery, err := p.getDiscovery()
+	if err != nil || discovery.UserInfoEndpoint == "" {
+		return err
+	}
+
+	req, _ := http.NewRequest("GET", discovery.UserInfoEndpoint, nil)
+	req.Header.Add("Authorization", "Bearer "+token.AccessToken)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("Userinfo request to " + p.config.Name + " failed with " + resp.Status)
+	}
+
+	claims := map[string]interface{}{}
+	err = json.NewDecoder(resp.Body).Decode(&claims)
+	if err != nil {
+		return err
+	}
+
+	if stringClaim(claims, "sub") != identity.Subject {
+		return errors.New("Userinfo from " + p.config.Name + " is for another subject")
+	}
+
+	for name, value := range claims {
+		if _, ok := identity.Claims[name]; !ok {
+			identity.Claims[name] = value
+		}
+	}
+	return nil
+}
+
+/*
+* Public methods
+ */
+
+func NewProvider(config Config) *Provider {
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	return &Provider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// Issuer is the configured issuer URL. Identities are kept under it and
+// not under the iss claim, which may be one of the AcceptedIssuers.
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
+
+// NewLoginState returns random values for a new login.
+func NewLoginState() (LoginState, error) {
+	values := make([]string, 3)
+	for i := range values {
+		value, err := randomString()
+		if err != nil {
+			return LoginState{}, err
+		}
+		values[i] = value
+	}
+	return LoginState{State: values[0], Nonce: values[1], Verifier: values[2]}, nil
+}
+
+// AuthCodeURL is where to send the user to log in. extra is added to the
+// query, for provider specific parameters.
+func (p *Provider) AuthCodeURL(login LoginState, extra url.Values) (string, error) {
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(login.Verifier))
+
+	query := url.Values{}
+	for name, values := range extra {
+		query[name] = values
+	}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.scopes(), " "))
+	query.Set("state", login.State)
+	query.Set("nonce", login.Nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange trades the code from the callback for tokens, and returns who
+// logged in once the ID token checks out.
+func (p *Provider) Exchange(code string, login LoginState) (Identity, Token, error) {
+	token, err := p.exchange(code, login.Verifier)
+	if err != nil {
+		return Identity{}, Token{}, err
+	}
+
+	identity, err := p.verifyIDToken(token.IDToken, login.Nonce)
+	if err != nil {
+		return Identity{}, Token{}, err
+	}
+
+	if token.AccessToken != "" {
+		err = p.addUserInfo(&identity, token)
+		if err != nil {
+			return Identity{}, Token{}, err
+		}
+	}
+
+	return identity, token, nil
+}
+
+// MapUser turns the claims into a user to register or log in.
+func (p *Provider) MapUser(identity Identity, token Token) (models.User, error) {
+	claims := p.config.Claims
+
+	user := models.User{}
+	user.Email = strings.ToLower(stringClaim(identity.Claims, claimName(claims.Email, "email")))
+	user.FirstName = stringClaim(identity.Claims, claimName(claims.FirstName, "given_name"))
+	user.LastName = stringClaim(identity.Claims, claimName(claims.LastName, "family_name"))
+
+	if user.Email == "" {
+		return models.User{}, ErrMissingEmailClaim
+	}
+
+	verified, ok := boolClaim(identity.Claims, claimName(claims.EmailVerified, "email_verified"))
+	if !p.config.TrustEmail && (!ok || !verified) {
+		return models.User{}, ErrEmailNotVerified
+	}
+	user.EmailConfirmed = true
+
+	if p.config.MapUser != nil {
+		p.config.MapUser(&user, identity, token)
+	}
+	return user, nil
+}
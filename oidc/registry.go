@@ -0,0 +1,85 @@
+package oidc
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registry holds the providers users can log in with, by name.
+type Registry struct {
+	mu        sync.RWMutex
+	providers map[string]*Provider
+}
+
+/*
+* Public methods
+ */
+
+func NewRegistry() *Registry {
+	return &Registry{providers: map[string]*Provider{}}
+}
+
+func (r *Registry) Register(provider *Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[provider.Name()] = provider
+}
+
+func (r *Registry) Get(name string) (*Provider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	provider, ok := r.providers[name]
+	return provider, ok
+}
+
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := []string{}
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ConfigsFromEnv reads the providers listed in OIDC_PROVIDERS, for example
+// OIDC_PROVIDERS=acme with OIDC_ACME_ISSUER, OIDC_ACME_CLIENT_ID and
+// OIDC_ACME_CLIENT_SECRET. OIDC_ACME_SCOPES, OIDC_ACME_CLAIM_EMAIL,
+// OIDC_ACME_CLAIM_EMAIL_VERIFIED, OIDC_ACME_CLAIM_FIRST_NAME,
+// OIDC_ACME_CLAIM_LAST_NAME and OIDC_ACME_TRUST_EMAIL are optional. The
+// redirect URL is left for the caller to fill in.
+func ConfigsFromEnv() ([]Config, error) {
+	configs := []Config{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		config := Config{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+			Claims: ClaimMapping{
+				Email:         os.Getenv(prefix + "CLAIM_EMAIL"),
+				EmailVerified: os.Getenv(prefix + "CLAIM_EMAIL_VERIFIED"),
+				FirstName:     os.Getenv(prefix + "CLAIM_FIRST_NAME"),
+				LastName:      os.Getenv(prefix + "CLAIM_LAST_NAME"),
+			},
+			TrustEmail: os.Getenv(prefix+"TRUST_EMAIL") == "true",
+		}
+
+		if config.Issuer == "" || config.ClientID == "" || config.ClientSecret == "" {
+			return nil, errors.New("OIDC provider " + name + " needs " + prefix + "ISSUER, " + prefix + "CLIENT_ID and " + prefix + "CLIENT_SECRET")
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
@@ -0,0 +1,259 @@
+package repositories
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/news-ai/api-v1/models"
+)
+
+// testStoreContract runs the behaviour every Store has to share against
+// the stores newStore returns. Rows are made unique per run, so the store
+// does not have to be empty.
+func testStoreContract(t *testing.T, newStore func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, store Store)
+	}{
+		{"create and get", testCreateAndGet},
+		{"save conflict", testSaveConflict},
+		{"list skips deleted", testListSkipsDeleted},
+		{"transaction commit", testTransactionCommit},
+		{"transaction rollback", testTransactionRollback},
+		{"token consume", testTokenConsume},
+		{"identity subject", testIdentitySubject},
+		{"usage limit", testUsageLimit},
+		{"stripe event record", testStripeEventRecord},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newStore(t))
+		})
+	}
+}
+
+func unique(prefix string) string {
+	return prefix + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+func createTeam(t *testing.T, store Store, createdBy int64, members []int64) models.Team {
+	team := models.Team{Name: unique("team-"), Members: members}
+	team.CreatedBy = createdBy
+	team.Created = time.Now()
+	if err := store.Teams.Create(&team); err != nil {
+		t.Fatalf("Teams.Create: %v", err)
+	}
+	return team
+}
+
+func testCreateAndGet(t *testing.T, store Store) {
+	user := models.UserPostgres{}
+	user.Data.Email = unique("create-") + "@example.com"
+	user.Data.Emails = []string{user.Data.Email}
+	if err := store.Users.Create(&user); err != nil {
+		t.Fatalf("Users.Create: %v", err)
+	}
+	if user.Id == 0 {
+		t.Fatal("Users.Create did not set the id")
+	}
+
+	stored, err := store.Users.Get(user.Id)
+	if err != nil {
+		t.Fatalf("Users.Get: %v", err)
+	}
+	if stored.Data.Email != user.Data.Email || len(stored.Data.Emails) != 1 {
+		t.Errorf("Users.Get = %+v, want %+v", stored.Data, user.Data)
+	}
+
+	_, err = store.Users.Get(user.Id + 1000000)
+	if err != ErrNotFound {
+		t.Errorf("Users.Get of a missing user = %v, want ErrNotFound", err)
+	}
+}
+
+func testSaveConflict(t *testing.T, store Store) {
+	team := createTeam(t, store, 1, []int64{1})
+
+	first, _ := store.Teams.Get(team.Id)
+	second, _ := store.Teams.Get(team.Id)
+
+	first.Name = unique("first-")
+	if err := store.Teams.Save(&first); err != nil {
+		t.Fatalf("Teams.Save: %v", err)
+	}
+	if first.Version != second.Version+1 {
+		t.Errorf("Teams.Save version = %d, want %d", first.Version, second.Version+1)
+	}
+
+	second.Name = unique("second-")
+	err := store.Teams.Save(&second)
+	if !models.IsConflict(err) {
+		t.Errorf("Teams.Save of a stale team = %v, want a conflict", err)
+	}
+
+	stored, _ := store.Teams.Get(team.Id)
+	if stored.Name != first.Name {
+		t.Errorf("Teams.Get name = %q, want %q", stored.Name, first.Name)
+	}
+}
+
+func testListSkipsDeleted(t *testing.T, store Store) {
+	createdBy := time.Now().UnixNano()
+	kept := createTeam(t, store, createdBy, nil)
+	deleted := createTeam(t, store, createdBy, nil)
+	deleted.SoftDelete()
+	if err := store.Teams.Save(&deleted); err != nil {
+		t.Fatalf("Teams.Save: %v", err)
+	}
+
+	teams, err := store.Teams.ListCreatedBy(createdBy)
+	if err != nil {
+		t.Fatalf("Teams.ListCreatedBy: %v", err)
+	}
+	if len(teams) != 1 || teams[0].Id != kept.Id {
+		t.Errorf("Teams.ListCreatedBy = %+v, want only team %d", teams, kept.Id)
+	}
+}
+
+func testTransactionCommit(t *testing.T, store Store) {
+	var team models.Team
+	err := store.RunInTransaction(func(tx Store) error {
+		team = createTeam(t, tx, 1, nil)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RunInTransaction: %v", err)
+	}
+
+	if _, err := store.Teams.Get(team.Id); err != nil {
+		t.Errorf("Teams.Get after commit: %v", err)
+	}
+}
+
+func testTransactionRollback(t *testing.T, store Store) {
+	team := createTeam(t, store, 1, []int64{1, 2})
+
+	var created models.Team
+	failed := errors.New("failed")
+	err := store.RunInTransaction(func(tx Store) error {
+		created = createTeam(t, tx, 1, nil)
+
+		// Change the members in place, as well as the name, so a
+		// snapshot that shares the slice would keep the change.
+		inside, err := tx.Teams.Get(team.Id)
+		if err != nil {
+			return err
+		}
+		inside.Name = unique("renamed-")
+		inside.Members[0] = 3
+		if err := tx.Teams.Save(&inside); err != nil {
+			return err
+		}
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("RunInTransaction = %v, want %v", err, failed)
+	}
+
+	stored, err := store.Teams.Get(team.Id)
+	if err != nil {
+		t.Fatalf("Teams.Get: %v", err)
+	}
+	if stored.Name != team.Name || stored.Version != team.Version {
+		t.Errorf("Teams.Get after rollback = %q version %d, want %q version %d", stored.Name, stored.Version, team.Name, team.Version)
+	}
+	if len(stored.Members) != 2 || stored.Members[0] != 1 || stored.Members[1] != 2 {
+		t.Errorf("Teams.Get members after rollback = %v, want [1 2]", stored.Members)
+	}
+
+	if _, err := store.Teams.Get(created.Id); err != ErrNotFound {
+		t.Errorf("Teams.Get of a rolled back team = %v, want ErrNotFound", err)
+	}
+}
+
+func testTokenConsume(t *testing.T, store Store) {
+	now := time.Now()
+	hash := unique("hash-")
+	token := models.UserToken{
+		UserId:    1,
+		Purpose:   "contract",
+		TokenHash: hash,
+		Created:   now,
+		Expires:   now.Add(time.Hour),
+	}
+	if err := store.Tokens.Create(&token); err != nil {
+		t.Fatalf("Tokens.Create: %v", err)
+	}
+
+	if _, err := store.Tokens.Consume(hash, "other", now); err != ErrNotFound {
+		t.Errorf("Tokens.Consume for another purpose = %v, want ErrNotFound", err)
+	}
+	consumed, err := store.Tokens.Consume(hash, "contract", now)
+	if err != nil {
+		t.Fatalf("Tokens.Consume: %v", err)
+	}
+	if consumed.Id != token.Id || consumed.Used == nil {
+		t.Errorf("Tokens.Consume = %+v, want token %d marked used", consumed, token.Id)
+	}
+	if _, err := store.Tokens.Consume(hash, "contract", now); err != ErrNotFound {
+		t.Errorf("second Tokens.Consume = %v, want ErrNotFound", err)
+	}
+}
+
+func testIdentitySubject(t *testing.T, store Store) {
+	subject := unique("subject-")
+	identity := models.UserIdentity{UserId: 1, Issuer: "https://issuer.example.com", Subject: subject, Created: time.Now()}
+	if err := store.Identities.Create(&identity); err != nil {
+		t.Fatalf("Identities.Create: %v", err)
+	}
+
+	found, err := store.Identities.FindBySubject("https://issuer.example.com", subject)
+	if err != nil || found.Id != identity.Id || found.UserId != 1 {
+		t.Errorf("Identities.FindBySubject = %+v, %v, want identity %d", found, err, identity.Id)
+	}
+	if _, err := store.Identities.FindBySubject("https://other.example.com", subject); err != ErrNotFound {
+		t.Errorf("Identities.FindBySubject at another issuer = %v, want ErrNotFound", err)
+	}
+
+	again := models.UserIdentity{UserId: 2, Issuer: "https://issuer.example.com", Subject: subject, Created: time.Now()}
+	if err := store.Identities.Create(&again); err == nil {
+		t.Error("Identities.Create of a linked identity succeeded")
+	}
+}
+
+func testUsageLimit(t *testing.T, store Store) {
+	userId := time.Now().UnixNano()
+	period := "2017-01"
+
+	used, err := store.Usage.Consume(userId, "contract", period, 2, 3)
+	if err != nil || used != 2 {
+		t.Fatalf("Usage.Consume = %d, %v, want 2", used, err)
+	}
+	if _, err := store.Usage.Consume(userId, "contract", period, 2, 3); err != ErrLimitReached {
+		t.Errorf("Usage.Consume over the limit = %v, want ErrLimitReached", err)
+	}
+	used, err = store.Usage.Used(userId, "contract", period)
+	if err != nil || used != 2 {
+		t.Errorf("Usage.Used = %d, %v, want 2", used, err)
+	}
+	used, err = store.Usage.Consume(userId, "contract", period, 5, models.EntitlementUnlimited)
+	if err != nil || used != 7 {
+		t.Errorf("unlimited Usage.Consume = %d, %v, want 7", used, err)
+	}
+}
+
+func testStripeEventRecord(t *testing.T, store Store) {
+	event := models.ProcessedStripeEvent{Id: unique("evt_"), Type: "invoice.paid", Processed: time.Now()}
+
+	recorded, err := store.Events.Record(&event)
+	if err != nil || !recorded {
+		t.Fatalf("Events.Record = %v, %v, want true", recorded, err)
+	}
+	recorded, err = store.Events.Record(&event)
+	if err != nil || recorded {
+		t.Errorf("second Events.Record = %v, %v, want false", recorded, err)
+	}
+}
@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"reflect"
+)
+
+// deepCopy returns a copy of value that shares no slices, maps or pointers
+// with it, so a snapshot can't be changed through the rows it was taken
+// from. Unexported fields, like the ones of time.Time, are copied as they
+// are.
+func deepCopy(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return copyValue(reflect.ValueOf(value)).Interface()
+}
+
+func copyValue(original reflect.Value) reflect.Value {
+	copied := reflect.New(original.Type()).Elem()
+
+	switch original.Kind() {
+	case reflect.Ptr:
+		if original.IsNil() {
+			return copied
+		}
+		pointer := reflect.New(original.Type().Elem())
+		pointer.Elem().Set(copyValue(original.Elem()))
+		copied.Set(pointer)
+
+	case reflect.Interface:
+		if original.IsNil() {
+			return copied
+		}
+		copied.Set(copyValue(original.Elem()))
+
+	case reflect.Slice:
+		if original.IsNil() {
+			return copied
+		}
+		copied.Set(reflect.MakeSlice(original.Type(), original.Len(), original.Len()))
+		for i := 0; i < original.Len(); i++ {
+			copied.Index(i).Set(copyValue(original.Index(i)))
+		}
+
+	case reflect.Map:
+		if original.IsNil() {
+			return copied
+		}
+		copied.Set(reflect.MakeMapWithSize(original.Type(), original.Len()))
+		for _, key := range original.MapKeys() {
+			copied.SetMapIndex(copyValue(key), copyValue(original.MapIndex(key)))
+		}
+
+	case reflect.Struct:
+		copied.Set(original)
+		for i := 0; i < original.NumField(); i++ {
+			if copied.Field(i).CanSet() {
+				copied.Field(i).Set(copyValue(original.Field(i)))
+			}
+		}
+
+	default:
+		copied.Set(original)
+	}
+
+	return copied
+}
@@ -0,0 +1,1390 @@
+package repositories
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/news-ai/api-v1/models"
+)
+
+// NewMemoryStore returns repositories that keep everything in process
+// memory. It is meant for tests and local development.
+func NewMemoryStore() Store {
+	users := &memoryUsers{users: map[int64]models.UserPostgres{}}
+	billings := &memoryBillings{billings: map[int64]models.BillingPostgres{}}
+	teams := &memoryTeams{teams: map[int64]models.Team{}}
+	agencies := &memoryAgencies{agencies: map[int64]models.Agency{}}
+	clients := &memoryClients{clients: map[int64]models.Client{}}
+	invites := &memoryInvites{invites: map[int64]models.UserInviteCode{}}
+	emailCodes := &memoryEmailCodes{emailCodes: map[int64]models.UserEmailCode{}}
+	auditEvents := &memoryAuditEvents{}
+	apiKeys := &memoryApiKeys{keys: map[int64]models.ApiKey{}}
+	sessions := &memoryUserSessions{sessions: map[int64]models.UserSession{}}
+	tokens := &memoryUserTokens{tokens: map[int64]models.UserToken{}}
+	identities := &memoryUserIdentities{identities: map[int64]models.UserIdentity{}}
+	reviews := &memorySignupReviews{reviews: map[int64]models.SignupReview{}}
+	plans := &memoryPlans{plans: map[int64]models.Plan{}}
+	overrides := &memoryEntitlementOverrides{overrides: map[int64]models.EntitlementOverride{}}
+	usage := &memoryEntitlementUsage{used: map[usageKey]int{}}
+	events := &memoryStripeEvents{events: map[string]models.ProcessedStripeEvent{}}
+
+	store := Store{
+		Users:       users,
+		Billings:    billings,
+		Teams:       teams,
+		Agencies:    agencies,
+		Clients:     clients,
+		Invites:     invites,
+		EmailCodes:  emailCodes,
+		AuditEvents: auditEvents,
+		ApiKeys:     apiKeys,
+		Sessions:    sessions,
+		Tokens:      tokens,
+		Identities:  identities,
+		Reviews:     reviews,
+		Plans:       plans,
+		Overrides:   overrides,
+		Usage:       usage,
+		Events:      events,
+	}
+
+	// Transactions are serialized and undone by restoring a snapshot of
+	// every table when fn fails.
+	var transactionLock sync.Mutex
+	store.transaction = func(fn func(Store) error) error {
+		transactionLock.Lock()
+		defer transactionLock.Unlock()
+
+		restores := []func(){
+			users.snapshot(),
+			billings.snapshot(),
+			teams.snapshot(),
+			agencies.snapshot(),
+			clients.snapshot(),
+			invites.snapshot(),
+			emailCodes.snapshot(),
+			auditEvents.snapshot(),
+			apiKeys.snapshot(),
+			sessions.snapshot(),
+			tokens.snapshot(),
+			identities.snapshot(),
+			reviews.snapshot(),
+			plans.snapshot(),
+			overrides.snapshot(),
+			usage.snapshot(),
+			events.snapshot(),
+		}
+
+		inner := store
+		inner.transaction = nil
+		err := fn(inner)
+		if err != nil {
+			for _, restore := range restores {
+				restore()
+			}
+		}
+		return err
+	}
+
+	return store
+}
+
+func sortedIds(ids []int64) []int64 {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+/*
+* Users
+ */
+
+type memoryUsers struct {
+	sync.Mutex
+	lastId int64
+	users  map[int64]models.UserPostgres
+}
+
+func (m *memoryUsers) snapshot() func() {
+	m.Lock()
+	defer m.Unlock()
+	lastId := m.lastId
+	saved := map[int64]models.UserPostgres{}
+	for id, value := range m.users {
+		saved[id] = deepCopy(value).(models.UserPostgres)
+	}
+	return func() {
+		m.Lock()
+		defer m.Unlock()
+		m.lastId = lastId
+		m.users = saved
+	}
+}
+
+func (m *memoryUsers) Get(id int64) (models.UserPostgres, error) {
+	m.Lock()
+	defer m.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return models.UserPostgres{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (m *memoryUsers) List() ([]models.UserPostgres, error) {
+	m.Lock()
+	defer m.Unlock()
+	ids := []int64{}
+	for id, user := range m.users {
+		if !user.Data.IsDeleted() {
+			ids = append(ids, id)
+		}
+	}
+	users := []models.UserPostgres{}
+	for _, id := range sortedIds(ids) {
+		users = append(users, m.users[id])
+	}
+	return users, nil
+}
+
+func (m *memoryUsers) Find(filter *UserFilter) ([]models.UserPostgres, error) {
+	if filter.Err() != nil {
+		return []models.UserPostgres{}, filter.Err()
+	}
+
+	all, _ := m.List()
+	users := []models.UserPostgres{}
+	for i := 0; i < len(all); i++ {
+		if filter.Matches(all[i].Data) {
+			users = append(users, all[i])
+		}
+	}
+	return filter.Page(users), nil
+}
+
+func (m *memoryUsers) Create(user *models.UserPostgres) error {
+	m.Lock()
+	defer m.Unlock()
+	m.lastId++
+	user.Id = m.lastId
+	m.users[user.Id] = *user
+	return nil
+}
+
+func (m *memoryUsers) Save(user *models.UserPostgres) error {
+	m.Lock()
+	defer m.Unlock()
+	stored, ok := m.users[user.Id]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != user.Version {
+		return &models.ConflictError{Model: "User", Id: user.Id}
+	}
+	user.Version++
+	m.users[user.Id] = *user
+	return nil
+}
+
+/*
+* Billings
+ */
+
+type memoryBillings struct {
+	sync.Mutex
+	lastId   int64
+	billings map[int64]models.BillingPostgres
+}
+
+func (m *memoryBillings) snapshot() func() {
+	m.Lock()
+	defer m.Unlock()
+	lastId := m.lastId
+	saved := map[int64]models.BillingPostgres{}
+	for id, value := range m.billings {
+		saved[id] = deepCopy(value).(models.BillingPostgres)
+	}
+	return func() {
+		m.Lock()
+		defer m.Unlock()
+		m.lastId = lastId
+		m.billings = saved
+	}
+}
+
+func (m *memoryBillings) Get(id int64) (models.BillingPostgres, error) {
+	m.Lock()
+	defer m.Unlock()
+	billing, ok := m.billings[id]
+	if !ok {
+		return models.BillingPostgres{}, ErrNotFound
+	}
+	return billing, nil
+}
+
+func (m *memoryBillings) FindByStripeId(customerId string) (models.BillingPostgres, error) {
+	m.Lock()
+	defer m.Unlock()
+	found := models.BillingPostgres{}
+	for _, billing := range m.billings {
+		if billing.Data.StripeId == customerId && billing.Id > found.Id {
+			found = billing
+		}
+	}
+	if found.Id == 0 {
+		return models.BillingPostgres{}, ErrNotFound
+	}
+	return found, nil
+}
+
+func (m *memoryBillings) Create(billing *models.BillingPostgres) error {
+	m.Lock()
+	defer m.Unlock()
+	m.lastId++
+	billing.Id = m.lastId
+	m.billings[billing.Id] = *billing
+	return nil
+}
+
+func (m *memoryBillings) Save(billing *models.BillingPostgres) error {
+	m.Lock()
+	defer m.Unlock()
+	stored, ok := m.billings[billing.Id]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != billing.Version {
+		return &models.ConflictError{Model: "Billing", Id: billing.Id}
+	}
+	billing.Version++
+	m.billings[billing.Id] = *billing
+	return nil
+}
+
+/*
+* Teams
+ */
+
+type memoryTeams struct {
+	sync.Mutex
+	lastId int64
+	teams  map[int64]models.Team
+}
+
+func (m *memoryTeams) snapshot() func() {
+	m.Lock()
+	defer m.Unlock()
+	lastId := m.lastId
+	saved := map[int64]models.Team{}
+	for id, value := range m.teams {
+		saved[id] = deepCopy(value).(models.Team)
+	}
+	return func() {
+		m.Lock()
+		defer m.Unlock()
+		m.lastId = lastId
+		m.teams = saved
+	}
+}
+
+func (m *memoryTeams) Get(id int64) (models.Team, error) {
+	m.Lock()
+	defer m.Unlock()
+	team, ok := m.teams[id]
+	if !ok {
+		return models.Team{}, ErrNotFound
+	}
+	return team, nil
+}
+
+func (m *memoryTeams) ListCreatedBy(userId int64) ([]models.Team, error) {
+	m.Lock()
+	defer m.Unlock()
+	ids := []int64{}
+	for id, team := range m.teams {
+		if team.CreatedBy == userId && !team.IsDeleted() {
+			ids = append(ids, id)
+		}
+	}
+	teams := []models.Team{}
+	for _, id := range sortedIds(ids) {
+		teams = append(teams, m.teams[id])
+	}
+	return teams, nil
+}
+
+func (m *memoryTeams) Create(team *models.Team) error {
+	m.Lock()
+	defer m.Unlock()
+	m.lastId++
+	team.Id = m.lastId
+	m.teams[team.Id] = *team
+	return nil
+}
+
+func (m *memoryTeams) Save(team *models.Team) error {
+	m.Lock()
+	defer m.Unlock()
+	stored, ok := m.teams[team.Id]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != team.Version {
+		return &models.ConflictError{Model: "Team", Id: team.Id}
+	}
+	team.Version++
+	m.teams[team.Id] = *team
+	return nil
+}
+
+/*
+* Agencies
+ */
+
+type memoryAgencies struct {
+	sync.Mutex
+	lastId   int64
+	agencies map[int64]models.Agency
+}
+
+func (m *memoryAgencies) snapshot() func() {
+	m.Lock()
+	defer m.Unlock()
+	lastId := m.lastId
+	saved := map[int64]models.Agency{}
+	for id, value := range m.agencies {
+		saved[id] = deepCopy(value).(models.Agency)
+	}
+	return func() {
+		m.Lock()
+		defer m.Unlock()
+		m.lastId = lastId
+		m.agencies = saved
+	}
+}
+
+func (m *memoryAgencies) Get(id int64) (models.Agency, error) {
+	m.Lock()
+	defer m.Unlock()
+	agency, ok := m.agencies[id]
+	if !ok {
+		return models.Agency{}, ErrNotFound
+	}
+	return agency, nil
+}
+
+func (m *memoryAgencies) FindByEmail(email string) (models.Agency, error) {
+	m.Lock()
+	defer m.Unlock()
+	ids := []int64{}
+	for id := range m.agencies {
+		ids = append(ids, id)
+	}
+	for _, id := range sortedIds(ids) {
+		if m.agencies[id].Email == email && m.agencies[id].Deleted == nil {
+			return m.agencies[id], nil
+		}
+	}
+	return models.Agency{}, ErrNotFound
+}
+
+func (m *memoryAgencies) Create(agency *models.Agency) error {
+	m.Lock()
+	defer m.Unlock()
+	m.lastId++
+	agency.Id = m.lastId
+	m.agencies[agency.Id] = *agency
+	return nil
+}
+
+func (m *memoryAgencies) Save(agency *models.Agency) error {
+	m.Lock()
+	defer m.Unlock()
+	stored, ok := m.agencies[agency.Id]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != agency.Version {
+		return &models.ConflictError{Model: "Agency", Id: agency.Id}
+	}
+	agency.Version++
+	m.agencies[agency.Id] = *agency
+	return nil
+}
+
+/*
+* Clients
+ */
+
+type memoryClients struct {
+	sync.Mutex
+	lastId  int64
+	clients map[int64]models.Client
+}
+
+func (m *memoryClients) snapshot() func() {
+	m.Lock()
+	defer m.Unlock()
+	lastId := m.lastId
+	saved := map[int64]models.Client{}
+	for id, value := range m.clients {
+		saved[id] = deepCopy(value).(models.Client)
+	}
+	return func() {
+		m.Lock()
+		defer m.Unlock()
+		m.lastId = lastId
+		m.clients = saved
+	}
+}
+
+func (m *memoryClients) Get(id int64) (models.Client, error) {
+	m.Lock()
+	defer m.Unlock()
+	client, ok := m.clients[id]
+	if !ok {
+		return models.Client{}, ErrNotFound
+	}
+	return client, nil
+}
+
+func (m *memoryClients) ListCreatedBy(userId int64) ([]models.Client, error) {
+	m.Lock()
+	defer m.Unlock()
+	ids := []int64{}
+	for id, client := range m.clients {
+		if client.CreatedBy == userId && !client.IsDeleted() {
+			ids = append(ids, id)
+		}
+	}
+	clients := []models.Client{}
+	for _, id := range sortedIds(ids) {
+		clients = append(clients, m.clients[id])
+	}
+	return clients, nil
+}
+
+func (m *memoryClients) Create(client *models.Client) error {
+	m.Lock()
+	defer m.Unlock()
+	m.lastId++
+	client.Id = m.lastId
+	m.clients[client.Id] = *client
+	return nil
+}
+
+func (m *memoryClients) Save(client *models.Client) error {
+	m.Lock()
+	defer m.Unlock()
+	stored, ok := m.clients[client.Id]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != client.Version {
+		return &models.ConflictError{Model: "Client", Id: client.Id}
+	}
+	client.Version++
+	m.clients[client.Id] = *client
+	return nil
+}
+
+/*
+* Invites
+ */
+
+type memoryInvites struct {
+	sync.Mutex
+	lastId  int64
+	invites map[int64]models.UserInviteCode
+}
+
+func (m *memoryInvites) snapshot() func() {
+	m.Lock()
+	defer m.Unlock()
+	lastId := m.lastId
+	saved := map[int64]models.UserInviteCode{}
+	for id, value := range m.invites {
+		saved[id] = deepCopy(value).(models.UserInviteCode)
+	}
+	return func() {
+		m.Lock()
+		defer m.Unlock()
+		m.lastId = lastId
+		m.invites = saved
+	}
+}
+
+func (m *memoryInvites) filter(keep func(models.UserInviteCode) bool) []models.UserInviteCode {
+	ids := []int64{}
+	for id, invite := range m.invites {
+		if keep(invite) {
+			ids = append(ids, id)
+		}
+	}
+	invites := []models.UserInviteCode{}
+	for _, id := range sortedIds(ids) {
+		invites = append(invites, m.invites[id])
+	}
+	return invites
+}
+
+func (m *memoryInvites) FindByCode(code string) (models.UserInviteCode, error) {
+	m.Lock()
+	defer m.Unlock()
+	invites := m.filter(func(invite models.UserInviteCode) bool {
+		return invite.InviteCode == code && !invite.IsDeleted()
+	})
+	if len(invites) == 0 {
+		return models.UserInviteCode{}, ErrNotFound
+	}
+	return invites[0], nil
+}
+
+func (m *memoryInvites) LockByCode(code string) (models.UserInviteCode, error) {
+	return m.FindByCode(code)
+}
+
+func (m *memoryInvites) ListByEmail(email string) ([]models.UserInviteCode, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.filter(func(invite models.UserInviteCode) bool {
+		return invite.Email == email && !invite.IsDeleted()
+	}), nil
+}
+
+func (m *memoryInvites) ListUsedCreatedBy(userId int64) ([]models.UserInviteCode, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.filter(func(invite models.UserInviteCode) bool {
+		return invite.CreatedBy == userId && invite.IsUsed && !invite.IsDeleted()
+	}), nil
+}
+
+func (m *memoryInvites) Create(invite *models.UserInviteCode) error {
+	m.Lock()
+	defer m.Unlock()
+	m.lastId++
+	invite.Id = m.lastId
+	m.invites[invite.Id] = *invite
+	return nil
+}
+
+func (m *memoryInvites) Save(invite *models.UserInviteCode) error {
+	m.Lock()
+	defer m.Unlock()
+	stored, ok := m.invites[invite.Id]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != invite.Version {
+		return &models.ConflictError{Model: "UserInviteCode", Id: invite.Id}
+	}
+	invite.Version++
+	m.invites[invite.Id] = *invite
+	return nil
+}
+
+/*
+* Email codes
+ */
+
+type memoryEmailCodes struct {
+	sync.Mutex
+	lastId     int64
+	emailCodes map[int64]models.UserEmailCode
+}
+
+func (m *memoryEmailCodes) snapshot() func() {
+	m.Lock()
+	defer m.Unlock()
+	lastId := m.lastId
+	saved := map[int64]models.UserEmailCode{}
+	for id, value := range m.emailCodes {
+		saved[id] = deepCopy(value).(models.UserEmailCode)
+	}
+	return func() {
+		m.Lock()
+		defer m.Unlock()
+		m.lastId = lastId
+		m.emailCodes = saved
+	}
+}
+
+func (m *memoryEmailCodes) FindByCode(code string) (models.UserEmailCode, error) {
+	m.Lock()
+	defer m.Unlock()
+	ids := []int64{}
+	for id := range m.emailCodes {
+		ids = append(ids, id)
+	}
+	for _, id := range sortedIds(ids) {
+		if m.emailCodes[id].InviteCode == code {
+			return m.emailCodes[id], nil
+		}
+	}
+	return models.UserEmailCode{}, ErrNotFound
+}
+
+func (m *memoryEmailCodes) Create(emailCode *models.UserEmailCode) error {
+	m.Lock()
+	defer m.Unlock()
+	m.lastId++
+	emailCode.Id = m.lastId
+	m.emailCodes[emailCode.Id] = *emailCode
+	return nil
+}
+
+func (m *memoryEmailCodes) Save(emailCode *models.UserEmailCode) error {
+	m.Lock()
+	defer m.Unlock()
+	stored, ok := m.emailCodes[emailCode.Id]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != emailCode.Version {
+		return &models.ConflictError{Model: "UserEmailCode", Id: emailCode.Id}
+	}
+	emailCode.Version++
+	m.emailCodes[emailCode.Id] = *emailCode
+	return nil
+}
+
+func (m *memoryEmailCodes) Delete(emailCode *models.UserEmailCode) error {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.emailCodes[emailCode.Id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.emailCodes, emailCode.Id)
+	return nil
+}
+
+/*
+* Audit events
+ */
+
+type memoryAuditEvents struct {
+	sync.Mutex
+	events []models.AuditEvent
+}
+
+func (m *memoryAuditEvents) snapshot() func() {
+	m.Lock()
+	defer m.Unlock()
+	length := len(m.events)
+	return func() {
+		m.Lock()
+		defer m.Unlock()
+		m.events = m.events[:length]
+	}
+}
+
+func (m *memoryAuditEvents) Create(event *models.AuditEvent) error {
+	m.Lock()
+	defer m.Unlock()
+	event.Id = int64(len(m.events) + 1)
+	m.events = append(m.events, *event)
+	return nil
+}
+
+func (m *memoryAuditEvents) Find(filter AuditFilter) ([]models.AuditEvent, error) {
+	m.Lock()
+	defer m.Unlock()
+	events := []models.AuditEvent{}
+	for i := len(m.events) - 1; i >= 0; i-- {
+		if filter.Matches(m.events[i]) {
+			events = append(events, m.events[i])
+		}
+	}
+
+	if filter.Offset >= len(events) {
+		return []models.AuditEvent{}, nil
+	}
+	events = events[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(events) {
+		events = events[:filter.Limit]
+	}
+	return events, nil
+}
+
+/*
+* API keys
+ */
+
+type memoryApiKeys struct {
+	sync.Mutex
+	lastId int64
+	keys   map[int64]models.ApiKey
+}
+
+func (m *memoryApiKeys) snapshot() func() {
+	m.Lock()
+	defer m.Unlock()
+	lastId := m.lastId
+	saved := map[int64]models.ApiKey{}
+	for id, value := range m.keys {
+		saved[id] = deepCopy(value).(models.ApiKey)
+	}
+	return func() {
+		m.Lock()
+		defer m.Unlock()
+		m.lastId = lastId
+		m.keys = saved
+	}
+}
+
+func (m *memoryApiKeys) Get(id int64) (models.ApiKey, error) {
+	m.Lock()
+	defer m.Unlock()
+	key, ok := m.keys[id]
+	if !ok {
+		return models.ApiKey{}, ErrNotFound
+	}
+	return key, nil
+}
+
+func (m *memoryApiKeys) FindByHash(hash string) (models.ApiKey, error) {
+	m.Lock()
+	defer m.Unlock()
+	for _, key := range m.keys {
+		if key.KeyHash == hash {
+			return key, nil
+		}
+	}
+	return models.ApiKey{}, ErrNotFound
+}
+
+func (m *memoryApiKeys) ListByUser(userId int64) ([]models.ApiKey, error) {
+	m.Lock()
+	defer m.Unlock()
+	ids := []int64{}
+	for id, key := range m.keys {
+		if key.UserId == userId && !key.IsDeleted() {
+			ids = append(ids, id)
+		}
+	}
+	keys := []models.ApiKey{}
+	for _, id := range sortedIds(ids) {
+		keys = append(keys, m.keys[id])
+	}
+	return keys, nil
+}
+
+func (m *memoryApiKeys) Create(key *models.ApiKey) error {
+	m.Lock()
+	defer m.Unlock()
+	m.lastId++
+	key.Id = m.lastId
+	m.keys[key.Id] = *key
+	return nil
+}
+
+func (m *memoryApiKeys) Revoke(key *models.ApiKey) error {
+	m.Lock()
+	defer m.Unlock()
+	stored, ok := m.keys[key.Id]
+	if !ok {
+		return ErrNotFound
+	}
+	now := time.Now()
+	key.Revoked = &now
+	key.Updated = now
+	stored.Revoked = key.Revoked
+	stored.Updated = now
+	m.keys[key.Id] = stored
+	return nil
+}
+
+func (m *memoryApiKeys) TouchLastUsed(id int64, at time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+	key, ok := m.keys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	key.LastUsed = at
+	m.keys[id] = key
+	return nil
+}
+
+/*
+* User sessions
+ */
+
+type memoryUserSessions struct {
+	sync.Mutex
+	lastId   int64
+	sessions map[int64]models.UserSession
+}
+
+func (m *memoryUserSessions) snapshot() func() {
+	m.Lock()
+	defer m.Unlock()
+	lastId := m.lastId
+	saved := map[int64]models.UserSession{}
+	for id, value := range m.sessions {
+		saved[id] = deepCopy(value).(models.UserSession)
+	}
+	return func() {
+		m.Lock()
+		defer m.Unlock()
+		m.lastId = lastId
+		m.sessions = saved
+	}
+}
+
+func (m *memoryUserSessions) Get(id int64) (models.UserSession, error) {
+	m.Lock()
+	defer m.Unlock()
+	session, ok := m.sessions[id]
+	if !ok {
+		return models.UserSession{}, ErrNotFound
+	}
+	return session, nil
+}
+
+func (m *memoryUserSessions) FindByTokenHash(hash string) (models.UserSession, error) {
+	m.Lock()
+	defer m.Unlock()
+	for _, session := range m.sessions {
+		if session.TokenHash == hash {
+			return session, nil
+		}
+	}
+	return models.UserSession{}, ErrNotFound
+}
+
+func (m *memoryUserSessions) ListByUser(userId int64) ([]models.UserSession, error) {
+	m.Lock()
+	defer m.Unlock()
+	ids := []int64{}
+	for id, session := range m.sessions {
+		if session.UserId == userId && !session.IsRevoked() {
+			ids = append(ids, id)
+		}
+	}
+	sessions := []models.UserSession{}
+	for _, id := range sortedIds(ids) {
+		sessions = append(sessions, m.sessions[id])
+	}
+	return sessions, nil
+}
+
+func (m *memoryUserSessions) Create(session *models.UserSession) error {
+	m.Lock()
+	defer m.Unlock()
+	m.lastId++
+	session.Id = m.lastId
+	m.sessions[session.Id] = *session
+	return nil
+}
+
+func (m *memoryUserSessions) Touch(id int64, at time.Time, ipAddress string) error {
+	m.Lock()
+	defer m.Unlock()
+	session, ok := m.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	session.LastSeen = at
+	session.IPAddress = ipAddress
+	m.sessions[id] = session
+	return nil
+}
+
+func (m *memoryUserSessions) Revoke(session *models.UserSession) error {
+	m.Lock()
+	defer m.Unlock()
+	stored, ok := m.sessions[session.Id]
+	if !ok {
+		return ErrNotFound
+	}
+	now := time.Now()
+	session.Revoked = &now
+	stored.Revoked = session.Revoked
+	m.sessions[session.Id] = stored
+	return nil
+}
+
+func (m *memoryUserSessions) RevokeAllForUser(userId int64, exceptId int64) error {
+	m.Lock()
+	defer m.Unlock()
+	now := time.Now()
+	for id, session := range m.sessions {
+		if session.UserId == userId && id != exceptId && !session.IsRevoked() {
+			session.Revoked = &now
+			m.sessions[id] = session
+		}
+	}
+	return nil
+}
+
+/*
+* User tokens
+ */
+
+type memoryUserTokens struct {
+	sync.Mutex
+	lastId int64
+	tokens map[int64]models.UserToken
+}
+
+func (m *memoryUserTokens) snapshot() func() {
+	m.Lock()
+	defer m.Unlock()
+	lastId := m.lastId
+	saved := map[int64]models.UserToken{}
+	for id, value := range m.tokens {
+		saved[id] = deepCopy(value).(models.UserToken)
+	}
+	return func() {
+		m.Lock()
+		defer m.Unlock()
+		m.lastId = lastId
+		m.tokens = saved
+	}
+}
+
+func (m *memoryUserTokens) FindByTokenHash(hash string) (models.UserToken, error) {
+	m.Lock()
+	defer m.Unlock()
+	for _, token := range m.tokens {
+		if token.TokenHash == hash {
+			return token, nil
+		}
+	}
+	return models.UserToken{}, ErrNotFound
+}
+
+func (m *memoryUserTokens) Create(token *models.UserToken) error {
+	m.Lock()
+	defer m.Unlock()
+	m.lastId++
+	token.Id = m.lastId
+	m.tokens[token.Id] = *token
+	return nil
+}
+
+func (m *memoryUserTokens) Consume(hash string, purpose string, at time.Time) (models.UserToken, error) {
+	m.Lock()
+	defer m.Unlock()
+	for id, token := range m.tokens {
+		if token.TokenHash != hash || token.Purpose != purpose {
+			continue
+		}
+		if token.Used != nil || !at.Before(token.Expires) {
+			return models.UserToken{}, ErrNotFound
+		}
+		token.Used = &at
+		m.tokens[id] = token
+		return token, nil
+	}
+	return models.UserToken{}, ErrNotFound
+}
+
+func (m *memoryUserTokens) Expire(userId int64, purpose string) error {
+	m.Lock()
+	defer m.Unlock()
+	now := time.Now()
+	for id, token := range m.tokens {
+		if token.UserId == userId && token.Purpose == purpose && token.Used == nil {
+			token.Used = &now
+			m.tokens[id] = token
+		}
+	}
+	return nil
+}
+
+func (m *memoryUserTokens) DeleteExpired(before time.Time) (int, error) {
+	m.Lock()
+	defer m.Unlock()
+	deleted := 0
+	for id, token := range m.tokens {
+		if token.Expires.Before(before) || (token.Used != nil && token.Used.Before(before)) {
+			delete(m.tokens, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+/*
+* User identities
+ */
+
+type memoryUserIdentities struct {
+	sync.Mutex
+	lastId     int64
+	identities map[int64]models.UserIdentity
+}
+
+func (m *memoryUserIdentities) snapshot() func() {
+	m.Lock()
+	defer m.Unlock()
+	lastId := m.lastId
+	saved := map[int64]models.UserIdentity{}
+	for id, value := range m.identities {
+		saved[id] = deepCopy(value).(models.UserIdentity)
+	}
+	return func() {
+		m.Lock()
+		defer m.Unlock()
+		m.lastId = lastId
+		m.identities = saved
+	}
+}
+
+func (m *memoryUserIdentities) FindBySubject(issuer string, subject string) (models.UserIdentity, error) {
+	m.Lock()
+	defer m.Unlock()
+	for _, identity := range m.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return models.UserIdentity{}, ErrNotFound
+}
+
+func (m *memoryUserIdentities) Create(identity *models.UserIdentity) error {
+	m.Lock()
+	defer m.Unlock()
+	for _, existing := range m.identities {
+		if existing.Issuer == identity.Issuer && existing.Subject == identity.Subject {
+			return errors.New("Identity is already linked")
+		}
+	}
+	m.lastId++
+	identity.Id = m.lastId
+	m.identities[identity.Id] = *identity
+	return nil
+}
+
+/*
+* Signup reviews
+ */
+
+type memorySignupReviews struct {
+	sync.Mutex
+	lastId  int64
+	reviews map[int64]models.SignupReview
+}
+
+func (m *memorySignupReviews) snapshot() func() {
+	m.Lock()
+	defer m.Unlock()
+	lastId := m.lastId
+	saved := map[int64]models.SignupReview{}
+	for id, value := range m.reviews {
+		saved[id] = deepCopy(value).(models.SignupReview)
+	}
+	return func() {
+		m.Lock()
+		defer m.Unlock()
+		m.lastId = lastId
+		m.reviews = saved
+	}
+}
+
+func (m *memorySignupReviews) Get(id int64) (models.SignupReview, error) {
+	m.Lock()
+	defer m.Unlock()
+	review, ok := m.reviews[id]
+	if !ok {
+		return models.SignupReview{}, ErrNotFound
+	}
+	return review, nil
+}
+
+func (m *memorySignupReviews) ListByStatus(status string) ([]models.SignupReview, error) {
+	m.Lock()
+	defer m.Unlock()
+	ids := []int64{}
+	for id, review := range m.reviews {
+		if status == "" || review.Status == status {
+			ids = append(ids, id)
+		}
+	}
+	reviews := []models.SignupReview{}
+	for _, id := range sortedIds(ids) {
+		reviews = append(reviews, m.reviews[id])
+	}
+	return reviews, nil
+}
+
+func (m *memorySignupReviews) FindPendingByUser(userId int64) (models.SignupReview, error) {
+	m.Lock()
+	defer m.Unlock()
+	for _, review := range m.reviews {
+		if review.UserId == userId && review.IsPending() {
+			return review, nil
+		}
+	}
+	return models.SignupReview{}, ErrNotFound
+}
+
+func (m *memorySignupReviews) Create(review *models.SignupReview) error {
+	m.Lock()
+	defer m.Unlock()
+	m.lastId++
+	review.Id = m.lastId
+	m.reviews[review.Id] = *review
+	return nil
+}
+
+func (m *memorySignupReviews) Save(review *models.SignupReview) error {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.reviews[review.Id]; !ok {
+		return ErrNotFound
+	}
+	m.reviews[review.Id] = *review
+	return nil
+}
+
+/*
+* Plans
+ */
+
+type memoryPlans struct {
+	sync.Mutex
+	lastId int64
+	plans  map[int64]models.Plan
+}
+
+func (m *memoryPlans) snapshot() func() {
+	m.Lock()
+	defer m.Unlock()
+	lastId := m.lastId
+	saved := map[int64]models.Plan{}
+	for id, value := range m.plans {
+		saved[id] = deepCopy(value).(models.Plan)
+	}
+	return func() {
+		m.Lock()
+		defer m.Unlock()
+		m.lastId = lastId
+		m.plans = saved
+	}
+}
+
+func (m *memoryPlans) Get(id int64) (models.Plan, error) {
+	m.Lock()
+	defer m.Unlock()
+	plan, ok := m.plans[id]
+	if !ok {
+		return models.Plan{}, ErrNotFound
+	}
+	return plan, nil
+}
+
+func (m *memoryPlans) List() ([]models.Plan, error) {
+	m.Lock()
+	defer m.Unlock()
+	plans := []models.Plan{}
+	for _, id := range sortedIds(m.ids()) {
+		plans = append(plans, m.plans[id])
+	}
+	sort.SliceStable(plans, func(i, j int) bool {
+		return plans[i].MonthlyPrice < plans[j].MonthlyPrice
+	})
+	return plans, nil
+}
+
+func (m *memoryPlans) FindByName(name string) (models.Plan, error) {
+	m.Lock()
+	defer m.Unlock()
+	for _, id := range sortedIds(m.ids()) {
+		if strings.EqualFold(m.plans[id].Name, name) {
+			return m.plans[id], nil
+		}
+	}
+	return models.Plan{}, ErrNotFound
+}
+
+func (m *memoryPlans) FindByAlias(id string) (models.Plan, error) {
+	m.Lock()
+	defer m.Unlock()
+	for _, planId := range sortedIds(m.ids()) {
+		plan := m.plans[planId]
+		if plan.HasId(id) {
+			return plan, nil
+		}
+	}
+	return models.Plan{}, ErrNotFound
+}
+
+func (m *memoryPlans) Create(plan *models.Plan) error {
+	m.Lock()
+	defer m.Unlock()
+	m.lastId++
+	plan.Id = m.lastId
+	m.plans[plan.Id] = *plan
+	return nil
+}
+
+func (m *memoryPlans) Save(plan *models.Plan) error {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.plans[plan.Id]; !ok {
+		return ErrNotFound
+	}
+	m.plans[plan.Id] = *plan
+	return nil
+}
+
+func (m *memoryPlans) ids() []int64 {
+	ids := []int64{}
+	for id := range m.plans {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+/*
+* Entitlements
+ */
+
+type memoryEntitlementOverrides struct {
+	sync.Mutex
+	lastId    int64
+	overrides map[int64]models.EntitlementOverride
+}
+
+func (m *memoryEntitlementOverrides) snapshot() func() {
+	m.Lock()
+	defer m.Unlock()
+	lastId := m.lastId
+	saved := map[int64]models.EntitlementOverride{}
+	for id, value := range m.overrides {
+		saved[id] = deepCopy(value).(models.EntitlementOverride)
+	}
+	return func() {
+		m.Lock()
+		defer m.Unlock()
+		m.lastId = lastId
+		m.overrides = saved
+	}
+}
+
+func (m *memoryEntitlementOverrides) Get(id int64) (models.EntitlementOverride, error) {
+	m.Lock()
+	defer m.Unlock()
+	override, ok := m.overrides[id]
+	if !ok {
+		return models.EntitlementOverride{}, ErrNotFound
+	}
+	return override, nil
+}
+
+func (m *memoryEntitlementOverrides) ListFor(userId int64, teamId int64) ([]models.EntitlementOverride, error) {
+	m.Lock()
+	defer m.Unlock()
+	ids := []int64{}
+	for id, override := range m.overrides {
+		if (userId != 0 && override.UserId == userId) || (teamId != 0 && override.TeamId == teamId) {
+			ids = append(ids, id)
+		}
+	}
+	overrides := []models.EntitlementOverride{}
+	for _, id := range sortedIds(ids) {
+		overrides = append(overrides, m.overrides[id])
+	}
+	return overrides, nil
+}
+
+func (m *memoryEntitlementOverrides) Create(override *models.EntitlementOverride) error {
+	m.Lock()
+	defer m.Unlock()
+	m.lastId++
+	override.Id = m.lastId
+	m.overrides[override.Id] = *override
+	return nil
+}
+
+func (m *memoryEntitlementOverrides) Delete(override *models.EntitlementOverride) error {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.overrides[override.Id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.overrides, override.Id)
+	return nil
+}
+
+type usageKey struct {
+	userId   int64
+	resource string
+	period   string
+}
+
+type memoryEntitlementUsage struct {
+	sync.Mutex
+	used map[usageKey]int
+}
+
+func (m *memoryEntitlementUsage) snapshot() func() {
+	m.Lock()
+	defer m.Unlock()
+	saved := map[usageKey]int{}
+	for key, value := range m.used {
+		saved[key] = value
+	}
+	return func() {
+		m.Lock()
+		defer m.Unlock()
+		m.used = saved
+	}
+}
+
+func (m *memoryEntitlementUsage) Used(userId int64, resource string, period string) (int, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.used[usageKey{userId, resource, period}], nil
+}
+
+func (m *memoryEntitlementUsage) Consume(userId int64, resource string, period string, n int, limit int) (int, error) {
+	m.Lock()
+	defer m.Unlock()
+	key := usageKey{userId, resource, period}
+	used := m.used[key] + n
+	if limit != models.EntitlementUnlimited && used > limit {
+		return 0, ErrLimitReached
+	}
+	m.used[key] = used
+	return used, nil
+}
+
+/*
+* Stripe events
+ */
+
+type memoryStripeEvents struct {
+	sync.Mutex
+	events map[string]models.ProcessedStripeEvent
+}
+
+func (m *memoryStripeEvents) snapshot() func() {
+	m.Lock()
+	defer m.Unlock()
+	saved := map[string]models.ProcessedStripeEvent{}
+	for id, value := range m.events {
+		saved[id] = deepCopy(value).(models.ProcessedStripeEvent)
+	}
+	return func() {
+		m.Lock()
+		defer m.Unlock()
+		m.events = saved
+	}
+}
+
+func (m *memoryStripeEvents) Record(event *models.ProcessedStripeEvent) (bool, error) {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.events[event.Id]; ok {
+		return false, nil
+	}
+	m.events[event.Id] = *event
+	return true, nil
+}
@@ -0,0 +1,11 @@
+package repositories
+
+import (
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testStoreContract(t, func(t *testing.T) Store {
+		return NewMemoryStore()
+	})
+}
@@ -0,0 +1,690 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+
+	"github.com/news-ai/api-v1/models"
+)
+
+// NewPostgresStore returns repositories backed by the given connection.
+// List queries go to replica, which may be the same as primary.
+func NewPostgresStore(primary *pg.DB, replica *pg.DB) Store {
+	store := newPostgresStore(primary, replica)
+	store.transaction = func(fn func(Store) error) error {
+		return primary.RunInTransaction(func(tx *pg.Tx) error {
+			// Reads inside a transaction must see its own writes, so
+			// they go to the transaction and not the replica.
+			return fn(newPostgresStore(tx, tx))
+		})
+	}
+	return store
+}
+
+// NewPostgresStoreIn returns repositories that run every query in tx.
+// Transactions run inside it.
+func NewPostgresStoreIn(tx *pg.Tx) Store {
+	return newPostgresStore(tx, tx)
+}
+
+func newPostgresStore(primary orm.DB, replica orm.DB) Store {
+	return Store{
+		Users:       &postgresUsers{db: primary, readDB: replica},
+		Billings:    &postgresBillings{db: primary},
+		Teams:       &postgresTeams{db: primary, readDB: replica},
+		Agencies:    &postgresAgencies{db: primary},
+		Clients:     &postgresClients{db: primary, readDB: replica},
+		Invites:     &postgresInvites{db: primary},
+		EmailCodes:  &postgresEmailCodes{db: primary},
+		AuditEvents: &postgresAuditEvents{db: primary, readDB: replica},
+		ApiKeys:     &postgresApiKeys{db: primary},
+		Sessions:    &postgresUserSessions{db: primary},
+		Tokens:      &postgresUserTokens{db: primary},
+		Identities:  &postgresUserIdentities{db: primary},
+		Reviews:     &postgresSignupReviews{db: primary},
+		Plans:       &postgresPlans{db: primary},
+		Overrides:   &postgresEntitlementOverrides{db: primary},
+		Usage:       &postgresEntitlementUsage{db: primary},
+		Events:      &postgresStripeEvents{db: primary},
+	}
+}
+
+func notFound(err error) error {
+	if err == pg.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+/*
+* Users
+ */
+
+type postgresUsers struct {
+	db     orm.DB
+	readDB orm.DB
+}
+
+func (p *postgresUsers) Get(id int64) (models.UserPostgres, error) {
+	user := models.UserPostgres{}
+	err := p.db.Model(&user).Where("id = ?", id).Select()
+	return user, notFound(err)
+}
+
+func (p *postgresUsers) List() ([]models.UserPostgres, error) {
+	users := []models.UserPostgres{}
+	err := p.readDB.Model(&users).Where("data->>'deleted' IS NULL").Select()
+	return users, err
+}
+
+func (p *postgresUsers) Find(filter *UserFilter) ([]models.UserPostgres, error) {
+	if filter.Err() != nil {
+		return []models.UserPostgres{}, filter.Err()
+	}
+
+	users := []models.UserPostgres{}
+	err := filter.Apply(p.db.Model(&users)).Where("data->>'deleted' IS NULL").Select()
+	return users, err
+}
+
+func (p *postgresUsers) Create(user *models.UserPostgres) error {
+	_, err := p.db.Model(user).Returning("*").Insert()
+	return err
+}
+
+func (p *postgresUsers) Save(user *models.UserPostgres) error {
+	_, err := user.SaveIn(p.db)
+	return err
+}
+
+/*
+* Billings
+ */
+
+type postgresBillings struct {
+	db orm.DB
+}
+
+func (p *postgresBillings) Get(id int64) (models.BillingPostgres, error) {
+	billing := models.BillingPostgres{}
+	err := p.db.Model(&billing).Where("id = ?", id).Select()
+	return billing, notFound(err)
+}
+
+func (p *postgresBillings) FindByStripeId(customerId string) (models.BillingPostgres, error) {
+	billing := models.BillingPostgres{}
+	err := p.db.Model(&billing).
+		Where("data->>'stripeid' = ?", customerId).
+		Order("id DESC").
+		Limit(1).
+		Select()
+	return billing, notFound(err)
+}
+
+func (p *postgresBillings) Create(billing *models.BillingPostgres) error {
+	_, err := p.db.Model(billing).Returning("*").Insert()
+	return err
+}
+
+func (p *postgresBillings) Save(billing *models.BillingPostgres) error {
+	_, err := billing.SaveIn(p.db)
+	return err
+}
+
+/*
+* Teams
+ */
+
+type postgresTeams struct {
+	db     orm.DB
+	readDB orm.DB
+}
+
+func (p *postgresTeams) Get(id int64) (models.Team, error) {
+	team := models.Team{}
+	err := p.db.Model(&team).Where("id = ?", id).Select()
+	return team, notFound(err)
+}
+
+func (p *postgresTeams) ListCreatedBy(userId int64) ([]models.Team, error) {
+	teams := []models.Team{}
+	err := p.readDB.Model(&teams).Where("created_by = ?", userId).Where("deleted IS NULL").Select()
+	return teams, err
+}
+
+func (p *postgresTeams) Create(team *models.Team) error {
+	_, err := p.db.Model(team).Returning("*").Insert()
+	return err
+}
+
+func (p *postgresTeams) Save(team *models.Team) error {
+	_, err := team.SaveIn(p.db)
+	return err
+}
+
+/*
+* Agencies
+ */
+
+type postgresAgencies struct {
+	db orm.DB
+}
+
+func (p *postgresAgencies) Get(id int64) (models.Agency, error) {
+	agency := models.Agency{}
+	err := p.db.Model(&agency).Where("id = ?", id).Select()
+	return agency, notFound(err)
+}
+
+func (p *postgresAgencies) FindByEmail(email string) (models.Agency, error) {
+	agency := models.Agency{}
+	err := p.db.Model(&agency).Where("email = ?", email).Where("deleted IS NULL").First()
+	return agency, notFound(err)
+}
+
+func (p *postgresAgencies) Create(agency *models.Agency) error {
+	_, err := p.db.Model(agency).Returning("*").Insert()
+	return err
+}
+
+func (p *postgresAgencies) Save(agency *models.Agency) error {
+	_, err := agency.SaveIn(p.db)
+	return err
+}
+
+/*
+* Clients
+ */
+
+type postgresClients struct {
+	db     orm.DB
+	readDB orm.DB
+}
+
+func (p *postgresClients) Get(id int64) (models.Client, error) {
+	client := models.Client{}
+	err := p.db.Model(&client).Where("id = ?", id).Select()
+	return client, notFound(err)
+}
+
+func (p *postgresClients) ListCreatedBy(userId int64) ([]models.Client, error) {
+	clients := []models.Client{}
+	err := p.readDB.Model(&clients).Where("created_by = ?", userId).Where("deleted IS NULL").Select()
+	return clients, err
+}
+
+func (p *postgresClients) Create(client *models.Client) error {
+	_, err := p.db.Model(client).Returning("*").Insert()
+	return err
+}
+
+func (p *postgresClients) Save(client *models.Client) error {
+	_, err := client.SaveIn(p.db)
+	return err
+}
+
+/*
+* Invites
+ */
+
+type postgresInvites struct {
+	db orm.DB
+}
+
+func (p *postgresInvites) FindByCode(code string) (models.UserInviteCode, error) {
+	invite := models.UserInviteCode{}
+	err := p.db.Model(&invite).Where("invite_code = ?", code).Where("deleted IS NULL").Select()
+	return invite, notFound(err)
+}
+
+func (p *postgresInvites) LockByCode(code string) (models.UserInviteCode, error) {
+	invite := models.UserInviteCode{}
+	err := p.db.Model(&invite).Where("invite_code = ?", code).Where("deleted IS NULL").For("UPDATE").Select()
+	return invite, notFound(err)
+}
+
+func (p *postgresInvites) ListByEmail(email string) ([]models.UserInviteCode, error) {
+	invites := []models.UserInviteCode{}
+	err := p.db.Model(&invites).Where("email = ?", email).Where("deleted IS NULL").Select()
+	return invites, err
+}
+
+func (p *postgresInvites) ListUsedCreatedBy(userId int64) ([]models.UserInviteCode, error) {
+	invites := []models.UserInviteCode{}
+	err := p.db.Model(&invites).Where("created_by = ?", userId).Where("is_used = ?", true).Where("deleted IS NULL").Select()
+	return invites, err
+}
+
+func (p *postgresInvites) Create(invite *models.UserInviteCode) error {
+	_, err := p.db.Model(invite).Returning("*").Insert()
+	return err
+}
+
+func (p *postgresInvites) Save(invite *models.UserInviteCode) error {
+	_, err := invite.SaveIn(p.db)
+	return err
+}
+
+/*
+* Email codes
+ */
+
+type postgresEmailCodes struct {
+	db orm.DB
+}
+
+func (p *postgresEmailCodes) FindByCode(code string) (models.UserEmailCode, error) {
+	emailCode := models.UserEmailCode{}
+	err := p.db.Model(&emailCode).Where("invite_code = ?", code).Select()
+	return emailCode, notFound(err)
+}
+
+func (p *postgresEmailCodes) Create(emailCode *models.UserEmailCode) error {
+	_, err := p.db.Model(emailCode).Returning("*").Insert()
+	return err
+}
+
+func (p *postgresEmailCodes) Save(emailCode *models.UserEmailCode) error {
+	_, err := emailCode.SaveIn(p.db)
+	return err
+}
+
+func (p *postgresEmailCodes) Delete(emailCode *models.UserEmailCode) error {
+	return p.db.Delete(emailCode)
+}
+
+/*
+* Audit events
+ */
+
+type postgresAuditEvents struct {
+	db     orm.DB
+	readDB orm.DB
+}
+
+func (p *postgresAuditEvents) Create(event *models.AuditEvent) error {
+	_, err := p.db.Model(event).Returning("*").Insert()
+	return err
+}
+
+func (p *postgresAuditEvents) Find(filter AuditFilter) ([]models.AuditEvent, error) {
+	events := []models.AuditEvent{}
+	q := p.readDB.Model(&events)
+	if filter.ActorId != 0 {
+		q = q.Where("actor_id = ?", filter.ActorId)
+	}
+	if filter.ImpersonatorId != 0 {
+		q = q.Where("impersonator_id = ?", filter.ImpersonatorId)
+	}
+	if filter.TargetType != "" {
+		q = q.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetId != 0 {
+		q = q.Where("target_id = ?", filter.TargetId)
+	}
+	if filter.Action != "" {
+		q = q.Where("action = ?", filter.Action)
+	}
+	q = q.Order("id DESC")
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		q = q.Offset(filter.Offset)
+	}
+	err := q.Select()
+	return events, err
+}
+
+/*
+* API keys
+ */
+
+type postgresApiKeys struct {
+	db orm.DB
+}
+
+func (p *postgresApiKeys) Get(id int64) (models.ApiKey, error) {
+	key := models.ApiKey{}
+	err := p.db.Model(&key).Where("id = ?", id).Select()
+	return key, notFound(err)
+}
+
+func (p *postgresApiKeys) FindByHash(hash string) (models.ApiKey, error) {
+	key := models.ApiKey{}
+	err := p.db.Model(&key).Where("key_hash = ?", hash).Select()
+	return key, notFound(err)
+}
+
+func (p *postgresApiKeys) ListByUser(userId int64) ([]models.ApiKey, error) {
+	keys := []models.ApiKey{}
+	err := p.db.Model(&keys).Where("user_id = ?", userId).Where("deleted IS NULL").Order("id ASC").Select()
+	return keys, err
+}
+
+func (p *postgresApiKeys) Create(key *models.ApiKey) error {
+	_, err := p.db.Model(key).Returning("*").Insert()
+	return err
+}
+
+func (p *postgresApiKeys) Revoke(key *models.ApiKey) error {
+	now := time.Now()
+	key.Revoked = &now
+	key.Updated = now
+	_, err := p.db.Model(key).Set("revoked = ?revoked, updated = ?updated").Where("id = ?id").Update()
+	return err
+}
+
+func (p *postgresApiKeys) TouchLastUsed(id int64, at time.Time) error {
+	_, err := p.db.Model(&models.ApiKey{}).Set("last_used = ?", at).Where("id = ?", id).Update()
+	return err
+}
+
+/*
+* User sessions
+ */
+
+type postgresUserSessions struct {
+	db orm.DB
+}
+
+func (p *postgresUserSessions) Get(id int64) (models.UserSession, error) {
+	session := models.UserSession{}
+	err := p.db.Model(&session).Where("id = ?", id).Select()
+	return session, notFound(err)
+}
+
+func (p *postgresUserSessions) FindByTokenHash(hash string) (models.UserSession, error) {
+	session := models.UserSession{}
+	err := p.db.Model(&session).Where("token_hash = ?", hash).Select()
+	return session, notFound(err)
+}
+
+func (p *postgresUserSessions) ListByUser(userId int64) ([]models.UserSession, error) {
+	sessions := []models.UserSession{}
+	err := p.db.Model(&sessions).Where("user_id = ?", userId).Where("revoked IS NULL").Order("id ASC").Select()
+	return sessions, err
+}
+
+func (p *postgresUserSessions) Create(session *models.UserSession) error {
+	_, err := p.db.Model(session).Returning("*").Insert()
+	return err
+}
+
+func (p *postgresUserSessions) Touch(id int64, at time.Time, ipAddress string) error {
+	_, err := p.db.Model(&models.UserSession{}).Set("last_seen = ?, ip_address = ?", at, ipAddress).Where("id = ?", id).Update()
+	return err
+}
+
+func (p *postgresUserSessions) Revoke(session *models.UserSession) error {
+	now := time.Now()
+	session.Revoked = &now
+	_, err := p.db.Model(session).Set("revoked = ?revoked").Where("id = ?id").Update()
+	return err
+}
+
+func (p *postgresUserSessions) RevokeAllForUser(userId int64, exceptId int64) error {
+	_, err := p.db.Model(&models.UserSession{}).
+		Set("revoked = ?", time.Now()).
+		Where("user_id = ?", userId).
+		Where("id != ?", exceptId).
+		Where("revoked IS NULL").
+		Update()
+	return err
+}
+
+/*
+* User tokens
+ */
+
+type postgresUserTokens struct {
+	db orm.DB
+}
+
+func (p *postgresUserTokens) FindByTokenHash(hash string) (models.UserToken, error) {
+	token := models.UserToken{}
+	err := p.db.Model(&token).Where("token_hash = ?", hash).Select()
+	return token, notFound(err)
+}
+
+func (p *postgresUserTokens) Create(token *models.UserToken) error {
+	_, err := p.db.Model(token).Returning("*").Insert()
+	return err
+}
+
+func (p *postgresUserTokens) Consume(hash string, purpose string, at time.Time) (models.UserToken, error) {
+	token := models.UserToken{}
+	_, err := p.db.Model(&token).
+		Set("used = ?", at).
+		Where("token_hash = ?", hash).
+		Where("purpose = ?", purpose).
+		Where("used IS NULL").
+		Where("expires > ?", at).
+		Returning("*").
+		Update()
+	if err != nil {
+		return token, notFound(err)
+	}
+	if token.Id == 0 {
+		return token, ErrNotFound
+	}
+	return token, nil
+}
+
+func (p *postgresUserTokens) Expire(userId int64, purpose string) error {
+	_, err := p.db.Model(&models.UserToken{}).
+		Set("used = ?", time.Now()).
+		Where("user_id = ?", userId).
+		Where("purpose = ?", purpose).
+		Where("used IS NULL").
+		Update()
+	return err
+}
+
+func (p *postgresUserTokens) DeleteExpired(before time.Time) (int, error) {
+	res, err := p.db.Model(&models.UserToken{}).
+		Where("expires < ?", before).
+		WhereOr("used < ?", before).
+		Delete()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+/*
+* User identities
+ */
+
+type postgresUserIdentities struct {
+	db orm.DB
+}
+
+func (p *postgresUserIdentities) FindBySubject(issuer string, subject string) (models.UserIdentity, error) {
+	identity := models.UserIdentity{}
+	err := p.db.Model(&identity).Where("issuer = ?", issuer).Where("subject = ?", subject).Select()
+	return identity, notFound(err)
+}
+
+func (p *postgresUserIdentities) Create(identity *models.UserIdentity) error {
+	_, err := p.db.Model(identity).Returning("*").Insert()
+	return err
+}
+
+/*
+* Signup reviews
+ */
+
+type postgresSignupReviews struct {
+	db orm.DB
+}
+
+func (p *postgresSignupReviews) Get(id int64) (models.SignupReview, error) {
+	review := models.SignupReview{}
+	err := p.db.Model(&review).Where("id = ?", id).Select()
+	return review, notFound(err)
+}
+
+func (p *postgresSignupReviews) ListByStatus(status string) ([]models.SignupReview, error) {
+	reviews := []models.SignupReview{}
+	q := p.db.Model(&reviews)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	err := q.Order("id ASC").Select()
+	return reviews, err
+}
+
+func (p *postgresSignupReviews) FindPendingByUser(userId int64) (models.SignupReview, error) {
+	review := models.SignupReview{}
+	err := p.db.Model(&review).
+		Where("user_id = ?", userId).
+		Where("status = ?", models.SignupReviewPending).
+		Limit(1).
+		Select()
+	return review, notFound(err)
+}
+
+func (p *postgresSignupReviews) Create(review *models.SignupReview) error {
+	_, err := p.db.Model(review).Returning("*").Insert()
+	return err
+}
+
+func (p *postgresSignupReviews) Save(review *models.SignupReview) error {
+	return p.db.Update(review)
+}
+
+/*
+* Plans
+ */
+
+type postgresPlans struct {
+	db orm.DB
+}
+
+func (p *postgresPlans) Get(id int64) (models.Plan, error) {
+	plan := models.Plan{}
+	err := p.db.Model(&plan).Where("id = ?", id).Select()
+	return plan, notFound(err)
+}
+
+func (p *postgresPlans) List() ([]models.Plan, error) {
+	plans := []models.Plan{}
+	err := p.db.Model(&plans).Order("monthly_price ASC", "id ASC").Select()
+	return plans, err
+}
+
+func (p *postgresPlans) FindByName(name string) (models.Plan, error) {
+	plan := models.Plan{}
+	err := p.db.Model(&plan).Where("lower(name) = lower(?)", name).Limit(1).Select()
+	return plan, notFound(err)
+}
+
+func (p *postgresPlans) FindByAlias(id string) (models.Plan, error) {
+	plan := models.Plan{}
+	err := p.db.Model(&plan).
+		Where("lower(stripe_id) = lower(?) OR aliases @> to_jsonb(lower(?))", id, id).
+		Limit(1).
+		Select()
+	return plan, notFound(err)
+}
+
+func (p *postgresPlans) Create(plan *models.Plan) error {
+	_, err := p.db.Model(plan).Returning("*").Insert()
+	return err
+}
+
+func (p *postgresPlans) Save(plan *models.Plan) error {
+	return p.db.Update(plan)
+}
+
+/*
+* Entitlements
+ */
+
+type postgresEntitlementOverrides struct {
+	db orm.DB
+}
+
+func (p *postgresEntitlementOverrides) Get(id int64) (models.EntitlementOverride, error) {
+	override := models.EntitlementOverride{}
+	err := p.db.Model(&override).Where("id = ?", id).Select()
+	return override, notFound(err)
+}
+
+func (p *postgresEntitlementOverrides) ListFor(userId int64, teamId int64) ([]models.EntitlementOverride, error) {
+	overrides := []models.EntitlementOverride{}
+	// Zero ids are stored as NULL, so 0 matches nothing here
+	err := p.db.Model(&overrides).
+		Where("user_id = ? OR team_id = ?", userId, teamId).
+		Order("id ASC").
+		Select()
+	return overrides, err
+}
+
+func (p *postgresEntitlementOverrides) Create(override *models.EntitlementOverride) error {
+	_, err := p.db.Model(override).Returning("*").Insert()
+	return err
+}
+
+func (p *postgresEntitlementOverrides) Delete(override *models.EntitlementOverride) error {
+	return p.db.Delete(override)
+}
+
+type postgresEntitlementUsage struct {
+	db orm.DB
+}
+
+func (p *postgresEntitlementUsage) Used(userId int64, resource string, period string) (int, error) {
+	used := 0
+	_, err := p.db.QueryOne(pg.Scan(&used), `SELECT used FROM entitlement_usages
+		WHERE user_id = ? AND resource = ? AND period = ?`, userId, resource, period)
+	if err == pg.ErrNoRows {
+		return 0, nil
+	}
+	return used, err
+}
+
+func (p *postgresEntitlementUsage) Consume(userId int64, resource string, period string, n int, limit int) (int, error) {
+	if limit != models.EntitlementUnlimited && n > limit {
+		return 0, ErrLimitReached
+	}
+
+	// The row is only updated when the new total fits, so two requests
+	// can't both take the last of the limit.
+	query := `INSERT INTO entitlement_usages AS u (user_id, resource, period, used, updated)
+		VALUES (?, ?, ?, ?, now())
+		ON CONFLICT (user_id, resource, period)
+		DO UPDATE SET used = u.used + EXCLUDED.used, updated = EXCLUDED.updated`
+	params := []interface{}{userId, resource, period, n}
+	if limit != models.EntitlementUnlimited {
+		query += ` WHERE u.used + EXCLUDED.used <= ?`
+		params = append(params, limit)
+	}
+	query += ` RETURNING used`
+
+	used := 0
+	_, err := p.db.QueryOne(pg.Scan(&used), query, params...)
+	if err == pg.ErrNoRows {
+		return 0, ErrLimitReached
+	}
+	return used, err
+}
+
+/*
+* Stripe events
+ */
+
+type postgresStripeEvents struct {
+	db orm.DB
+}
+
+func (p *postgresStripeEvents) Record(event *models.ProcessedStripeEvent) (bool, error) {
+	res, err := p.db.Model(event).OnConflict("(id) DO NOTHING").Insert()
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
@@ -0,0 +1,29 @@
+package repositories
+
+import (
+	"os"
+	"testing"
+
+	"github.com/go-pg/pg"
+)
+
+// TestPostgresStore needs a migrated database, named by the TEST_DATABASE_*
+// variables. It is skipped without one.
+func TestPostgresStore(t *testing.T) {
+	addr := os.Getenv("TEST_DATABASE_ADDR")
+	if addr == "" {
+		t.Skip("TEST_DATABASE_ADDR is not set")
+	}
+
+	conn := pg.Connect(&pg.Options{
+		Addr:     addr,
+		User:     os.Getenv("TEST_DATABASE_USER"),
+		Database: os.Getenv("TEST_DATABASE_NAME"),
+		Password: os.Getenv("TEST_DATABASE_PASSWORD"),
+	})
+	defer conn.Close()
+
+	testStoreContract(t, func(t *testing.T) Store {
+		return NewPostgresStore(conn, conn)
+	})
+}
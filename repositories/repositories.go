@@ -0,0 +1,232 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/news-ai/api-v1/models"
+)
+
+var ErrNotFound = errors.New("No such entity")
+
+// ErrLimitReached is returned by EntitlementUsage.Consume when the use
+// would go over the limit.
+var ErrLimitReached = errors.New("Limit reached")
+
+type Users interface {
+	Get(id int64) (models.UserPostgres, error)
+	List() ([]models.UserPostgres, error)
+	Find(filter *UserFilter) ([]models.UserPostgres, error)
+	Create(user *models.UserPostgres) error
+	Save(user *models.UserPostgres) error
+}
+
+type Billings interface {
+	Get(id int64) (models.BillingPostgres, error)
+	// FindByStripeId returns the latest billing of a Stripe customer.
+	FindByStripeId(customerId string) (models.BillingPostgres, error)
+	Create(billing *models.BillingPostgres) error
+	Save(billing *models.BillingPostgres) error
+}
+
+type Teams interface {
+	Get(id int64) (models.Team, error)
+	ListCreatedBy(userId int64) ([]models.Team, error)
+	Create(team *models.Team) error
+	Save(team *models.Team) error
+}
+
+type Agencies interface {
+	Get(id int64) (models.Agency, error)
+	FindByEmail(email string) (models.Agency, error)
+	Create(agency *models.Agency) error
+	Save(agency *models.Agency) error
+}
+
+type Clients interface {
+	Get(id int64) (models.Client, error)
+	ListCreatedBy(userId int64) ([]models.Client, error)
+	Create(client *models.Client) error
+	Save(client *models.Client) error
+}
+
+type Invites interface {
+	FindByCode(code string) (models.UserInviteCode, error)
+	// LockByCode is FindByCode that also holds the row until the
+	// surrounding transaction ends.
+	LockByCode(code string) (models.UserInviteCode, error)
+	ListByEmail(email string) ([]models.UserInviteCode, error)
+	ListUsedCreatedBy(userId int64) ([]models.UserInviteCode, error)
+	Create(invite *models.UserInviteCode) error
+	Save(invite *models.UserInviteCode) error
+}
+
+type EmailCodes interface {
+	FindByCode(code string) (models.UserEmailCode, error)
+	Create(emailCode *models.UserEmailCode) error
+	Save(emailCode *models.UserEmailCode) error
+	Delete(emailCode *models.UserEmailCode) error
+}
+
+// ApiKeys are never saved as a whole: a key can only be revoked, and
+// every request that uses it moves LastUsed.
+type ApiKeys interface {
+	Get(id int64) (models.ApiKey, error)
+	FindByHash(hash string) (models.ApiKey, error)
+	ListByUser(userId int64) ([]models.ApiKey, error)
+	Create(key *models.ApiKey) error
+	Revoke(key *models.ApiKey) error
+	TouchLastUsed(id int64, at time.Time) error
+}
+
+// UserSessions track logged in browsers. Revoked sessions are kept so the
+// middleware can tell a revoked session from one it has not seen yet.
+type UserSessions interface {
+	Get(id int64) (models.UserSession, error)
+	FindByTokenHash(hash string) (models.UserSession, error)
+	ListByUser(userId int64) ([]models.UserSession, error)
+	Create(session *models.UserSession) error
+	Touch(id int64, at time.Time, ipAddress string) error
+	Revoke(session *models.UserSession) error
+	RevokeAllForUser(userId int64, exceptId int64) error
+}
+
+// UserTokens are only ever looked at through their hash. Consume is the
+// one way to use a token, so two requests can't both use the same one.
+type UserTokens interface {
+	FindByTokenHash(hash string) (models.UserToken, error)
+	Create(token *models.UserToken) error
+	// Consume marks the token used and returns it, or ErrNotFound if it
+	// does not exist, was used already or has expired.
+	Consume(hash string, purpose string, at time.Time) (models.UserToken, error)
+	// Expire uses up every open token of purpose for the user, when a
+	// new one replaces them.
+	Expire(userId int64, purpose string) error
+	// DeleteExpired removes tokens that expired or were used before the
+	// given time, and returns how many.
+	DeleteExpired(before time.Time) (int, error)
+}
+
+// UserIdentities can't be changed once created: an identity stays linked
+// to the user it was first linked to.
+type UserIdentities interface {
+	FindBySubject(issuer string, subject string) (models.UserIdentity, error)
+	Create(identity *models.UserIdentity) error
+}
+
+type SignupReviews interface {
+	Get(id int64) (models.SignupReview, error)
+	// ListByStatus returns the oldest reviews first, or all of them when
+	// status is empty.
+	ListByStatus(status string) ([]models.SignupReview, error)
+	FindPendingByUser(userId int64) (models.SignupReview, error)
+	Create(review *models.SignupReview) error
+	Save(review *models.SignupReview) error
+}
+
+type Plans interface {
+	Get(id int64) (models.Plan, error)
+	// List returns every plan, cheapest first.
+	List() ([]models.Plan, error)
+	FindByName(name string) (models.Plan, error)
+	// FindByAlias finds the plan with id as its Stripe id or one of its
+	// aliases.
+	FindByAlias(id string) (models.Plan, error)
+	Create(plan *models.Plan) error
+	Save(plan *models.Plan) error
+}
+
+type EntitlementOverrides interface {
+	Get(id int64) (models.EntitlementOverride, error)
+	// ListFor returns the overrides of the user and those of the team,
+	// oldest first. Either id may be 0.
+	ListFor(userId int64, teamId int64) ([]models.EntitlementOverride, error)
+	Create(override *models.EntitlementOverride) error
+	Delete(override *models.EntitlementOverride) error
+}
+
+// EntitlementUsage counts metered resources per user and period.
+type EntitlementUsage interface {
+	Used(userId int64, resource string, period string) (int, error)
+	// Consume adds n to what the user used in the period and returns the
+	// new total, or ErrLimitReached if that would go over limit. The check
+	// and the update are one atomic step. A limit of
+	// models.EntitlementUnlimited is never reached.
+	Consume(userId int64, resource string, period string, n int, limit int) (int, error)
+}
+
+type StripeEvents interface {
+	// Record stores the event, and returns false if it was stored before.
+	Record(event *models.ProcessedStripeEvent) (bool, error)
+}
+
+// AuditEvents is append-only: there is no Save or Delete.
+type AuditEvents interface {
+	Create(event *models.AuditEvent) error
+	Find(filter AuditFilter) ([]models.AuditEvent, error)
+}
+
+// AuditFilter narrows down AuditEvents.Find. Zero fields are ignored.
+// Results are newest first.
+type AuditFilter struct {
+	ActorId        int64
+	ImpersonatorId int64
+	TargetType     string
+	TargetId       int64
+	Action         string
+
+	Limit  int
+	Offset int
+}
+
+func (f AuditFilter) Matches(event models.AuditEvent) bool {
+	if f.ActorId != 0 && event.ActorId != f.ActorId {
+		return false
+	}
+	if f.ImpersonatorId != 0 && event.ImpersonatorId != f.ImpersonatorId {
+		return false
+	}
+	if f.TargetType != "" && event.TargetType != f.TargetType {
+		return false
+	}
+	if f.TargetId != 0 && event.TargetId != f.TargetId {
+		return false
+	}
+	if f.Action != "" && event.Action != f.Action {
+		return false
+	}
+	return true
+}
+
+// Store groups every repository so it can be handed to the controllers
+// as one value.
+type Store struct {
+	Users       Users
+	Billings    Billings
+	Teams       Teams
+	Agencies    Agencies
+	Clients     Clients
+	Invites     Invites
+	EmailCodes  EmailCodes
+	AuditEvents AuditEvents
+	ApiKeys     ApiKeys
+	Sessions    UserSessions
+	Tokens      UserTokens
+	Identities  UserIdentities
+	Reviews     SignupReviews
+	Plans       Plans
+	Overrides   EntitlementOverrides
+	Usage       EntitlementUsage
+	Events      StripeEvents
+
+	transaction func(fn func(Store) error) error
+}
+
+// RunInTransaction calls fn with a Store whose writes are committed only
+// if fn returns nil. Calls made inside fn join the same transaction.
+func (s Store) RunInTransaction(fn func(Store) error) error {
+	if s.transaction == nil {
+		return fn(s)
+	}
+	return s.transaction(fn)
+}
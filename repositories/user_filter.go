@@ -0,0 +1,217 @@
+package repositories
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+
+	"github.com/news-ai/api-v1/models"
+)
+
+var userDataKey = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+const (
+	userFilterEquals = iota
+	userFilterIn
+	userFilterPrefix
+	userFilterRange
+	userFilterFlag
+)
+
+type userCondition struct {
+	kind int
+	key  string
+
+	values []string
+	flag   bool
+	from   time.Time
+	to     time.Time
+}
+
+// UserFilter describes a query against the JSONB data column of
+// UserPostgres. Keys are the JSON names of models.User fields and every
+// value is bound as a query parameter.
+type UserFilter struct {
+	conditions []userCondition
+
+	limit  int
+	offset int
+
+	err error
+}
+
+func NewUserFilter() *UserFilter {
+	return &UserFilter{}
+}
+
+// UserLookup is the filter of a lookup of one user by one of their
+// fields, like the email they log in with.
+func UserLookup(key, value string) *UserFilter {
+	return NewUserFilter().Equals(key, value).Limit(1)
+}
+
+func (f *UserFilter) add(condition userCondition) *UserFilter {
+	if !userDataKey.MatchString(condition.key) {
+		f.err = errors.New("Invalid user field " + condition.key)
+		return f
+	}
+	f.conditions = append(f.conditions, condition)
+	return f
+}
+
+// Equals matches users whose field equals value.
+func (f *UserFilter) Equals(key, value string) *UserFilter {
+	return f.add(userCondition{kind: userFilterEquals, key: key, values: []string{value}})
+}
+
+// In matches users whose field is one of values.
+func (f *UserFilter) In(key string, values ...string) *UserFilter {
+	return f.add(userCondition{kind: userFilterIn, key: key, values: values})
+}
+
+// Prefix matches users whose field starts with prefix.
+func (f *UserFilter) Prefix(key, prefix string) *UserFilter {
+	return f.add(userCondition{kind: userFilterPrefix, key: key, values: []string{prefix}})
+}
+
+// Between matches users whose timestamp field is within [from, to]. A zero
+// time leaves that side of the range open.
+func (f *UserFilter) Between(key string, from, to time.Time) *UserFilter {
+	return f.add(userCondition{kind: userFilterRange, key: key, from: from, to: to})
+}
+
+// Flag matches users whose boolean field is set to value. A missing field
+// counts as false.
+func (f *UserFilter) Flag(key string, value bool) *UserFilter {
+	return f.add(userCondition{kind: userFilterFlag, key: key, flag: value})
+}
+
+func (f *UserFilter) Limit(limit int) *UserFilter {
+	f.limit = limit
+	return f
+}
+
+func (f *UserFilter) Offset(offset int) *UserFilter {
+	f.offset = offset
+	return f
+}
+
+func (f *UserFilter) Err() error {
+	return f.err
+}
+
+func escapeLike(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(value)
+}
+
+// Apply adds the filter's conditions to a go-pg query.
+func (f *UserFilter) Apply(q *orm.Query) *orm.Query {
+	for _, condition := range f.conditions {
+		switch condition.kind {
+		case userFilterEquals:
+			q = q.Where("data->>? = ?", condition.key, condition.values[0])
+		case userFilterIn:
+			q = q.Where("data->>? IN (?)", condition.key, pg.In(condition.values))
+		case userFilterPrefix:
+			q = q.Where("data->>? LIKE ?", condition.key, escapeLike(condition.values[0])+"%")
+		case userFilterRange:
+			if !condition.from.IsZero() {
+				q = q.Where("(data->>?)::timestamptz >= ?", condition.key, condition.from)
+			}
+			if !condition.to.IsZero() {
+				q = q.Where("(data->>?)::timestamptz <= ?", condition.key, condition.to)
+			}
+		case userFilterFlag:
+			q = q.Where("coalesce((data->>?)::boolean, false) = ?", condition.key, condition.flag)
+		}
+	}
+
+	q = q.Order("id ASC")
+	if f.limit > 0 {
+		q = q.Limit(f.limit)
+	}
+	if f.offset > 0 {
+		q = q.Offset(f.offset)
+	}
+	return q
+}
+
+// Matches evaluates the filter against a user in memory.
+func (f *UserFilter) Matches(user models.User) bool {
+	raw, err := json.Marshal(user)
+	if err != nil {
+		return false
+	}
+
+	data := map[string]interface{}{}
+	err = json.Unmarshal(raw, &data)
+	if err != nil {
+		return false
+	}
+
+	for _, condition := range f.conditions {
+		value, ok := data[condition.key]
+
+		switch condition.kind {
+		case userFilterEquals, userFilterIn:
+			text, isString := value.(string)
+			if !ok || !isString {
+				return false
+			}
+			found := false
+			for _, candidate := range condition.values {
+				if candidate == text {
+					found = true
+				}
+			}
+			if !found {
+				return false
+			}
+		case userFilterPrefix:
+			text, isString := value.(string)
+			if !ok || !isString || !strings.HasPrefix(text, condition.values[0]) {
+				return false
+			}
+		case userFilterRange:
+			text, isString := value.(string)
+			if !ok || !isString {
+				return false
+			}
+			timestamp, err := time.Parse(time.RFC3339Nano, text)
+			if err != nil {
+				return false
+			}
+			if !condition.from.IsZero() && timestamp.Before(condition.from) {
+				return false
+			}
+			if !condition.to.IsZero() && timestamp.After(condition.to) {
+				return false
+			}
+		case userFilterFlag:
+			flag, _ := value.(bool)
+			if flag != condition.flag {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Page applies limit and offset to users that already matched.
+func (f *UserFilter) Page(users []models.UserPostgres) []models.UserPostgres {
+	if f.offset >= len(users) {
+		return []models.UserPostgres{}
+	}
+	users = users[f.offset:]
+	if f.limit > 0 && f.limit < len(users) {
+		users = users[:f.limit]
+	}
+	return users
+}
@@ -13,10 +13,23 @@ import (
 	nError "github.com/news-ai/web/errors"
 )
 
+func handleAgencyActions(r *http.Request, id string, action string) (interface{}, error) {
+	switch r.Method {
+	case "POST":
+		switch action {
+		case "restore":
+			return api.BaseSingleResponseHandler(controllers.RestoreAgency(r, id))
+		}
+	}
+	return nil, errors.New("method not implemented")
+}
+
 func handleAgency(r *http.Request, id string) (interface{}, error) {
 	switch r.Method {
 	case "GET":
 		return api.BaseSingleResponseHandler(controllers.GetAgency(id))
+	case "DELETE":
+		return api.BaseSingleResponseHandler(controllers.DeleteAgency(r, id))
 	}
 	return nil, errors.New("method not implemented")
 }
@@ -40,7 +53,7 @@ func AgenciesHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params
 	}
 
 	if err != nil {
-		nError.ReturnError(w, http.StatusInternalServerError, "Agency handling error", err.Error())
+		nError.ReturnError(w, errorStatus(err), "Agency handling error", err.Error())
 	}
 	return
 }
@@ -56,7 +69,24 @@ func AgencyHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	}
 
 	if err != nil {
-		nError.ReturnError(w, http.StatusInternalServerError, "Agency handling error", err.Error())
+		nError.ReturnError(w, errorStatus(err), "Agency handling error", err.Error())
+	}
+	return
+}
+
+// Handler for when the user wants to perform an action on the agencies
+func AgencyActionHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	id := ps.ByName("id")
+	action := ps.ByName("action")
+
+	val, err := handleAgencyActions(r, id, action)
+	if err == nil {
+		err = ffjson.NewEncoder(w).Encode(val)
+	}
+
+	if err != nil {
+		nError.ReturnError(w, errorStatus(err), "Agency handling error", err.Error())
 	}
 	return
 }
@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pquerna/ffjson/ffjson"
+
+	"github.com/news-ai/api-v1/controllers"
+
+	"github.com/news-ai/web/api"
+	nError "github.com/news-ai/web/errors"
+)
+
+func handleAuditEvents(r *http.Request) (interface{}, error) {
+	switch r.Method {
+	case "GET":
+		val, included, count, total, err := controllers.GetAuditEvents(r)
+		return api.BaseResponseHandler(val, included, count, total, err, r)
+	}
+	return nil, errors.New("method not implemented")
+}
+
+// Handler for when an admin wants to go through the audit log.
+func AuditEventsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	val, err := handleAuditEvents(r)
+
+	if err == nil {
+		err = ffjson.NewEncoder(w).Encode(val)
+	}
+
+	if err != nil {
+		nError.ReturnError(w, errorStatus(err), "Audit handling error", err.Error())
+	}
+	return
+}
@@ -13,10 +13,23 @@ import (
 	nError "github.com/news-ai/web/errors"
 )
 
+func handleClientActions(r *http.Request, id string, action string) (interface{}, error) {
+	switch r.Method {
+	case "POST":
+		switch action {
+		case "restore":
+			return api.BaseSingleResponseHandler(controllers.RestoreClient(r, id))
+		}
+	}
+	return nil, errors.New("method not implemented")
+}
+
 func handleClient(r *http.Request, id string) (interface{}, error) {
 	switch r.Method {
 	case "GET":
 		return api.BaseSingleResponseHandler(controllers.GetClient(id))
+	case "DELETE":
+		return api.BaseSingleResponseHandler(controllers.DeleteClient(r, id))
 	}
 	return nil, errors.New("method not implemented")
 }
@@ -40,7 +53,7 @@ func ClientsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 	}
 
 	if err != nil {
-		nError.ReturnError(w, http.StatusInternalServerError, "Client handling error", err.Error())
+		nError.ReturnError(w, errorStatus(err), "Client handling error", err.Error())
 	}
 	return
 }
@@ -56,7 +69,24 @@ func ClientHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	}
 
 	if err != nil {
-		nError.ReturnError(w, http.StatusInternalServerError, "Client handling error", err.Error())
+		nError.ReturnError(w, errorStatus(err), "Client handling error", err.Error())
+	}
+	return
+}
+
+// Handler for when the user wants to perform an action on the clients
+func ClientActionHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	id := ps.ByName("id")
+	action := ps.ByName("action")
+
+	val, err := handleClientActions(r, id, action)
+	if err == nil {
+		err = ffjson.NewEncoder(w).Encode(val)
+	}
+
+	if err != nil {
+		nError.ReturnError(w, errorStatus(err), "Client handling error", err.Error())
 	}
 	return
 }
@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pquerna/ffjson/ffjson"
+
+	"github.com/news-ai/api-v1/controllers"
+
+	"github.com/news-ai/web/api"
+	nError "github.com/news-ai/web/errors"
+)
+
+func handleEntitlementOverride(r *http.Request, id string) (interface{}, error) {
+	switch r.Method {
+	case "DELETE":
+		return api.BaseSingleResponseHandler(controllers.DeleteEntitlementOverride(r, id))
+	}
+	return nil, errors.New("method not implemented")
+}
+
+func handleEntitlementOverrides(r *http.Request) (interface{}, error) {
+	switch r.Method {
+	case "GET":
+		val, included, count, total, err := controllers.GetEntitlementOverrides(r)
+		return api.BaseResponseHandler(val, included, count, total, err, r)
+	case "POST":
+		return api.BaseSingleResponseHandler(controllers.CreateEntitlementOverride(r))
+	}
+	return nil, errors.New("method not implemented")
+}
+
+// Handler for admins changing the limits of a user or a team.
+func EntitlementOverridesHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	val, err := handleEntitlementOverrides(r)
+
+	if err == nil {
+		err = ffjson.NewEncoder(w).Encode(val)
+	}
+
+	if err != nil {
+		nError.ReturnError(w, errorStatus(err), "Entitlement override handling error", err.Error())
+	}
+	return
+}
+
+func EntitlementOverrideHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	val, err := handleEntitlementOverride(r, ps.ByName("id"))
+
+	if err == nil {
+		err = ffjson.NewEncoder(w).Encode(val)
+	}
+
+	if err != nil {
+		nError.ReturnError(w, errorStatus(err), "Entitlement override handling error", err.Error())
+	}
+	return
+}
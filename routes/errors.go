@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/news-ai/api-v1/models"
+)
+
+// Picks the status code to return for an error from the controllers.
+// A save that lost a race with another request is a 409, so the client
+// can reload and try again. Going over a plan limit is a 402, or a 429
+// for limits that reset on their own.
+func errorStatus(err error) int {
+	if models.IsConflict(err) {
+		return http.StatusConflict
+	}
+	if exceeded, ok := err.(*models.LimitExceededError); ok {
+		return exceeded.StatusCode()
+	}
+	return http.StatusInternalServerError
+}
@@ -38,7 +38,7 @@ func InvitesHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 	}
 
 	if err != nil {
-		nError.ReturnError(w, http.StatusInternalServerError, "Invite handling error", err.Error())
+		nError.ReturnError(w, errorStatus(err), "Invite handling error", err.Error())
 	}
 	return
 }
@@ -54,7 +54,7 @@ func InviteHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	}
 
 	if err != nil {
-		nError.ReturnError(w, http.StatusInternalServerError, "Invite handling error", err.Error())
+		nError.ReturnError(w, errorStatus(err), "Invite handling error", err.Error())
 	}
 	return
 }
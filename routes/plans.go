@@ -0,0 +1,68 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pquerna/ffjson/ffjson"
+
+	"github.com/news-ai/api-v1/controllers"
+
+	"github.com/news-ai/web/api"
+	nError "github.com/news-ai/web/errors"
+)
+
+func handlePlan(r *http.Request, id string) (interface{}, error) {
+	switch r.Method {
+	case "GET":
+		return api.BaseSingleResponseHandler(controllers.GetPlan(r, id))
+	case "PATCH":
+		return api.BaseSingleResponseHandler(controllers.UpdatePlan(r, id))
+	case "DELETE":
+		return api.BaseSingleResponseHandler(controllers.DeletePlan(r, id))
+	}
+	return nil, errors.New("method not implemented")
+}
+
+func handlePlans(r *http.Request) (interface{}, error) {
+	switch r.Method {
+	case "GET":
+		val, included, count, total, err := controllers.GetPlans(r)
+		return api.BaseResponseHandler(val, included, count, total, err, r)
+	case "POST":
+		return api.BaseSingleResponseHandler(controllers.CreatePlan(r))
+	}
+	return nil, errors.New("method not implemented")
+}
+
+// Handler for the plan catalog. Only admins can change it.
+func PlansHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	val, err := handlePlans(r)
+
+	if err == nil {
+		err = ffjson.NewEncoder(w).Encode(val)
+	}
+
+	if err != nil {
+		nError.ReturnError(w, errorStatus(err), "Plan handling error", err.Error())
+	}
+	return
+}
+
+// Handler for when there is a key present after /plans/<id> route.
+func PlanHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	id := ps.ByName("id")
+	val, err := handlePlan(r, id)
+
+	if err == nil {
+		err = ffjson.NewEncoder(w).Encode(val)
+	}
+
+	if err != nil {
+		nError.ReturnError(w, errorStatus(err), "Plan handling error", err.Error())
+	}
+	return
+}
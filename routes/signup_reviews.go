@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pquerna/ffjson/ffjson"
+
+	"github.com/news-ai/api-v1/controllers"
+
+	"github.com/news-ai/web/api"
+	nError "github.com/news-ai/web/errors"
+)
+
+func handleSignupReviewActions(r *http.Request, id string, action string) (interface{}, error) {
+	switch r.Method {
+	case "POST":
+		switch action {
+		case "approve":
+			return api.BaseSingleResponseHandler(controllers.ApproveSignupReview(r, id))
+		case "reject":
+			return api.BaseSingleResponseHandler(controllers.RejectSignupReview(r, id))
+		}
+	}
+	return nil, errors.New("method not implemented")
+}
+
+func handleSignupReviews(r *http.Request) (interface{}, error) {
+	switch r.Method {
+	case "GET":
+		val, included, count, total, err := controllers.GetSignupReviews(r)
+		return api.BaseResponseHandler(val, included, count, total, err, r)
+	}
+	return nil, errors.New("method not implemented")
+}
+
+// Handler for admins going through the signups screening held back.
+func SignupReviewsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	val, err := handleSignupReviews(r)
+
+	if err == nil {
+		err = ffjson.NewEncoder(w).Encode(val)
+	}
+
+	if err != nil {
+		nError.ReturnError(w, errorStatus(err), "Signup review handling error", err.Error())
+	}
+	return
+}
+
+func SignupReviewActionHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	val, err := handleSignupReviewActions(r, ps.ByName("id"), ps.ByName("action"))
+
+	if err == nil {
+		err = ffjson.NewEncoder(w).Encode(val)
+	}
+
+	if err != nil {
+		nError.ReturnError(w, errorStatus(err), "Signup review handling error", err.Error())
+	}
+	return
+}
@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pquerna/ffjson/ffjson"
+
+	"github.com/news-ai/api-v1/billing"
+	"github.com/news-ai/api-v1/controllers"
+
+	nError "github.com/news-ai/web/errors"
+)
+
+// Handler Stripe posts subscription events to. Anything but a 2xx makes
+// Stripe retry the event later, so only a bad signature is a 400.
+func StripeWebhookHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	err := controllers.HandleStripeWebhook(r)
+
+	if err == billing.ErrInvalidSignature {
+		nError.ReturnError(w, http.StatusBadRequest, "Stripe webhook error", err.Error())
+		return
+	}
+
+	if err != nil {
+		nError.ReturnError(w, errorStatus(err), "Stripe webhook error", err.Error())
+		return
+	}
+
+	ffjson.NewEncoder(w).Encode(map[string]bool{"received": true})
+	return
+}
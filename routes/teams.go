@@ -14,6 +14,15 @@ import (
 )
 
 func handleTeamActions(r *http.Request, id string, action string) (interface{}, error) {
+	switch r.Method {
+	case "POST":
+		switch action {
+		case "restore":
+			return api.BaseSingleResponseHandler(controllers.RestoreTeam(r, id))
+		case "require-two-factor":
+			return api.BaseSingleResponseHandler(controllers.SetTeamTwoFactor(r, id))
+		}
+	}
 	return nil, errors.New("method not implemented")
 }
 
@@ -21,6 +30,8 @@ func handleTeam(r *http.Request, id string) (interface{}, error) {
 	switch r.Method {
 	case "GET":
 		return api.BaseSingleResponseHandler(controllers.GetTeam(id))
+	case "DELETE":
+		return api.BaseSingleResponseHandler(controllers.DeleteTeam(r, id))
 	}
 	return nil, errors.New("method not implemented")
 }
@@ -46,7 +57,7 @@ func TeamsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	}
 
 	if err != nil {
-		nError.ReturnError(w, http.StatusInternalServerError, "Team handling error", err.Error())
+		nError.ReturnError(w, errorStatus(err), "Team handling error", err.Error())
 	}
 	return
 }
@@ -62,7 +73,7 @@ func TeamHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}
 
 	if err != nil {
-		nError.ReturnError(w, http.StatusInternalServerError, "Team handling error", err.Error())
+		nError.ReturnError(w, errorStatus(err), "Team handling error", err.Error())
 	}
 	return
 }
@@ -79,7 +90,7 @@ func TeamActionHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 	}
 
 	if err != nil {
-		nError.ReturnError(w, http.StatusInternalServerError, "Team handling error", err.Error())
+		nError.ReturnError(w, errorStatus(err), "Team handling error", err.Error())
 	}
 	return
 }
@@ -0,0 +1,37 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pquerna/ffjson/ffjson"
+
+	"github.com/news-ai/api-v1/controllers"
+
+	"github.com/news-ai/web/api"
+	nError "github.com/news-ai/web/errors"
+)
+
+func handleTokensCleanup(r *http.Request) (interface{}, error) {
+	switch r.Method {
+	case "POST":
+		return api.BaseSingleResponseHandler(controllers.CleanupUserTokens(r))
+	}
+	return nil, errors.New("method not implemented")
+}
+
+// Handler for the scheduled job that deletes used and expired tokens.
+func TokensCleanupHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	val, err := handleTokensCleanup(r)
+
+	if err == nil {
+		err = ffjson.NewEncoder(w).Encode(val)
+	}
+
+	if err != nil {
+		nError.ReturnError(w, errorStatus(err), "Token handling error", err.Error())
+	}
+	return
+}
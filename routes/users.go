@@ -15,6 +15,59 @@ import (
 )
 
 func handleUserActions(r *http.Request, id string, action string) (interface{}, error) {
+	switch r.Method {
+	case "GET":
+		switch action {
+		case "api-keys":
+			val, included, count, total, err := controllers.GetApiKeys(r, id)
+			return api.BaseResponseHandler(val, included, count, total, err, r)
+		case "two-factor":
+			return api.BaseSingleResponseHandler(controllers.GetTwoFactorStatus(r, id))
+		case "sessions":
+			val, included, count, total, err := controllers.GetSessions(r, id)
+			return api.BaseResponseHandler(val, included, count, total, err, r)
+		case "entitlements":
+			return api.BaseSingleResponseHandler(controllers.GetUserEntitlements(r, id))
+		}
+	case "POST":
+		switch action {
+		case "restore":
+			return api.BaseSingleResponseHandler(controllers.RestoreUser(r, id))
+		case "api-keys":
+			return api.BaseSingleResponseHandler(controllers.CreateApiKey(r, id))
+		case "two-factor":
+			return api.BaseSingleResponseHandler(controllers.EnrollTwoFactor(r, id))
+		case "two-factor-confirm":
+			return api.BaseSingleResponseHandler(controllers.ConfirmTwoFactor(r, id))
+		case "two-factor-disable":
+			return api.BaseSingleResponseHandler(controllers.DisableTwoFactor(r, id))
+		}
+	}
+	return nil, errors.New("method not implemented")
+}
+
+func handleUserApiKey(r *http.Request, id string, keyId string) (interface{}, error) {
+	switch r.Method {
+	case "DELETE":
+		return api.BaseSingleResponseHandler(controllers.RevokeApiKey(r, id, keyId))
+	}
+	return nil, errors.New("method not implemented")
+}
+
+func handleUserSessions(r *http.Request, id string) (interface{}, error) {
+	switch r.Method {
+	case "DELETE":
+		val, included, count, total, err := controllers.RevokeOtherSessions(r, id)
+		return api.BaseResponseHandler(val, included, count, total, err, r)
+	}
+	return nil, errors.New("method not implemented")
+}
+
+func handleUserSession(r *http.Request, id string, sessionId string) (interface{}, error) {
+	switch r.Method {
+	case "DELETE":
+		return api.BaseSingleResponseHandler(controllers.RevokeSession(r, id, sessionId))
+	}
 	return nil, errors.New("method not implemented")
 }
 
@@ -22,6 +75,10 @@ func handleUser(r *http.Request, id string) (interface{}, error) {
 	switch r.Method {
 	case "GET":
 		return api.BaseSingleResponseHandler(controllers.GetUser(r, id))
+	case "PATCH":
+		return api.BaseSingleResponseHandler(controllers.UpdateUser(r, id))
+	case "DELETE":
+		return api.BaseSingleResponseHandler(controllers.DeleteUser(r, id))
 	}
 	return nil, errors.New("method not implemented")
 }
@@ -35,6 +92,15 @@ func handleUsers(r *http.Request) (interface{}, error) {
 	return nil, errors.New("method not implemented")
 }
 
+func handleUserSearch(r *http.Request) (interface{}, error) {
+	switch r.Method {
+	case "GET":
+		val, included, count, total, err := controllers.SearchUsers(r)
+		return api.BaseResponseHandler(val, included, count, total, err, r)
+	}
+	return nil, errors.New("method not implemented")
+}
+
 func UsersHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	w.Header().Set("Content-Type", "application/json")
 	val, err := handleUsers(r)
@@ -46,7 +112,7 @@ func UsersHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	}
 
 	if err != nil {
-		nError.ReturnError(w, http.StatusInternalServerError, "User handling error", err.Error())
+		nError.ReturnError(w, errorStatus(err), "User handling error", err.Error())
 	}
 	return
 }
@@ -61,7 +127,7 @@ func UserHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}
 
 	if err != nil {
-		nError.ReturnError(w, http.StatusInternalServerError, "User handling error", err.Error())
+		nError.ReturnError(w, errorStatus(err), "User handling error", err.Error())
 	}
 	return
 }
@@ -83,7 +149,63 @@ func UserActionHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 	}
 
 	if err != nil {
-		nError.ReturnError(w, http.StatusInternalServerError, "User handling error", err.Error())
+		nError.ReturnError(w, errorStatus(err), "User handling error", err.Error())
+	}
+	return
+}
+
+func UserSearchHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	val, err := handleUserSearch(r)
+
+	if err == nil {
+		err = ffjson.NewEncoder(w).Encode(val)
+	}
+
+	if err != nil {
+		nError.ReturnError(w, errorStatus(err), "User handling error", err.Error())
+	}
+	return
+}
+
+func UserApiKeyHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	val, err := handleUserApiKey(r, ps.ByName("id"), ps.ByName("keyid"))
+
+	if err == nil {
+		err = ffjson.NewEncoder(w).Encode(val)
+	}
+
+	if err != nil {
+		nError.ReturnError(w, errorStatus(err), "User handling error", err.Error())
+	}
+	return
+}
+
+func UserSessionsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	val, err := handleUserSessions(r, ps.ByName("id"))
+
+	if err == nil {
+		err = ffjson.NewEncoder(w).Encode(val)
+	}
+
+	if err != nil {
+		nError.ReturnError(w, errorStatus(err), "User handling error", err.Error())
+	}
+	return
+}
+
+func UserSessionHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	val, err := handleUserSession(r, ps.ByName("id"), ps.ByName("sessionid"))
+
+	if err == nil {
+		err = ffjson.NewEncoder(w).Encode(val)
+	}
+
+	if err != nil {
+		nError.ReturnError(w, errorStatus(err), "User handling error", err.Error())
 	}
 	return
 }
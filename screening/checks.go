@@ -0,0 +1,224 @@
+package screening
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// RecaptchaCheck denies signups whose reCAPTCHA answer Google does not
+// accept.
+type RecaptchaCheck struct {
+	Secret string
+	Client *http.Client
+}
+
+// ClearbitCheck sends signups Clearbit rates as high risk to review.
+type ClearbitCheck struct {
+	APIKey string
+	Client *http.Client
+}
+
+// DomainLookup tells whether a domain hands out disposable addresses.
+type DomainLookup interface {
+	Disposable(domain string) (bool, error)
+}
+
+// KickboxLookup asks the free Kickbox disposable email API.
+type KickboxLookup struct {
+	Client *http.Client
+}
+
+// DisposableDomainCheck denies signups from disposable email domains. The
+// local list is checked first, and is all there is to go on when Lookup
+// is nil or can't be reached.
+type DisposableDomainCheck struct {
+	Local  DomainList
+	Lookup DomainLookup
+}
+
+type recaptchaResponse struct {
+	Success     bool     `json:"success"`
+	ChallengeTs string   `json:"challenge_ts"`
+	HostName    string   `json:"hostname"`
+	ErrorCodes  []string `json:"error-codes"`
+}
+
+type clearbitRiskRequest struct {
+	Email     string `json:"email"`
+	IP        string `json:"ip"`
+	GivenName string `json:"given_name"`
+}
+
+type clearbitRiskResponse struct {
+	Email struct {
+		Disposable  bool `json:"disposable"`
+		Blacklisted bool `json:"blacklisted"`
+	} `json:"email"`
+	IP struct {
+		Proxy       bool `json:"proxy"`
+		Blacklisted bool `json:"blacklisted"`
+	} `json:"ip"`
+	Risk struct {
+		Level string `json:"level"`
+		Score int    `json:"score"`
+	} `json:"risk"`
+}
+
+/*
+* Private methods
+ */
+
+func client(c *http.Client) *http.Client {
+	if c == nil {
+		return defaultClient
+	}
+	return c
+}
+
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
+
+/*
+* Public methods
+ */
+
+func (c RecaptchaCheck) Name() string {
+	return "recaptcha"
+}
+
+func (c RecaptchaCheck) Screen(signup Signup) (Result, error) {
+	resp, err := client(c.Client).PostForm("https://www.google.com/recaptcha/api/siteverify", url.Values{
+		"secret":   {c.Secret},
+		"response": {signup.Recaptcha},
+		"remoteip": {signup.IP},
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	response := recaptchaResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if !response.Success {
+		return Result{Verdict: Deny, Reasons: []string{"reCAPTCHA failed: " + strings.Join(response.ErrorCodes, ", ")}}, nil
+	}
+	return Result{Verdict: Allow}, nil
+}
+
+func (c ClearbitCheck) Name() string {
+	return "clearbit"
+}
+
+func (c ClearbitCheck) Screen(signup Signup) (Result, error) {
+	requestJson, err := json.Marshal(clearbitRiskRequest{
+		Email:     signup.Email,
+		IP:        signup.IP,
+		GivenName: signup.FirstName,
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	req, _ := http.NewRequest("POST", "https://risk.clearbit.com/v1/calculate", bytes.NewReader(requestJson))
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Authorization", "Bearer "+c.APIKey)
+
+	resp, err := client(c.Client).Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, errors.New("Clearbit answered " + resp.Status)
+	}
+
+	response := clearbitRiskResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return Result{}, err
+	}
+
+	reasons := []string{}
+	if response.Email.Blacklisted {
+		reasons = append(reasons, "Clearbit has blacklisted the email")
+	}
+	if response.IP.Blacklisted {
+		reasons = append(reasons, "Clearbit has blacklisted the ip address")
+	}
+	if response.IP.Proxy {
+		reasons = append(reasons, "Signed up through a proxy")
+	}
+
+	if response.Risk.Level == "high" {
+		reasons = append([]string{"Clearbit rates this signup as high risk"}, reasons...)
+		return Result{Verdict: Review, Reasons: reasons}, nil
+	}
+	return Result{Verdict: Allow, Reasons: reasons}, nil
+}
+
+func (l KickboxLookup) Disposable(domain string) (bool, error) {
+	resp, err := client(l.Client).Get("https://open.kickbox.io/v1/disposable/" + url.PathEscape(domain))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, errors.New("Kickbox answered " + resp.Status)
+	}
+
+	response := struct {
+		Disposable bool `json:"disposable"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	return response.Disposable, err
+}
+
+func (c DisposableDomainCheck) Name() string {
+	return "disposable"
+}
+
+// A failed lookup is not an error here, since the local list has already
+// been checked.
+func (c DisposableDomainCheck) Screen(signup Signup) (Result, error) {
+	domain := emailDomain(signup.Email)
+	if domain == "" {
+		return Result{Verdict: Deny, Reasons: []string{"The email has no domain"}}, nil
+	}
+
+	disposable := Result{Verdict: Deny, Reasons: []string{domain + " is a disposable email domain"}}
+
+	if c.Local.Contains(domain) {
+		return disposable, nil
+	}
+
+	if c.Lookup == nil {
+		return Result{Verdict: Allow}, nil
+	}
+
+	isDisposable, err := c.Lookup.Disposable(domain)
+	if err != nil {
+		return Result{Verdict: Allow, Reasons: []string{"Disposable lookup failed, only the local list was checked"}}, nil
+	}
+	if isDisposable {
+		return disposable, nil
+	}
+	return Result{Verdict: Allow}, nil
+}
@@ -0,0 +1,98 @@
+package screening
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// DomainList is a set of lowercase domains.
+type DomainList map[string]bool
+
+// Well known disposable email domains, for when there is no list file and
+// the lookup is down.
+var defaultDisposableDomains = []string{
+	"10minutemail.com",
+	"20minutemail.com",
+	"33mail.com",
+	"discard.email",
+	"dispostable.com",
+	"emailondeck.com",
+	"fakeinbox.com",
+	"getairmail.com",
+	"getnada.com",
+	"guerrillamail.com",
+	"guerrillamail.net",
+	"guerrillamailblock.com",
+	"harakirimail.com",
+	"mailcatch.com",
+	"maildrop.cc",
+	"mailinator.com",
+	"mailnesia.com",
+	"mintemail.com",
+	"mohmal.com",
+	"mytemp.email",
+	"sharklasers.com",
+	"spamgourmet.com",
+	"temp-mail.org",
+	"tempail.com",
+	"tempmail.net",
+	"tempmailaddress.com",
+	"tempr.email",
+	"throwawaymail.com",
+	"trashmail.com",
+	"yopmail.com",
+}
+
+/*
+* Public methods
+ */
+
+func NewDomainList(domains ...string) DomainList {
+	list := DomainList{}
+	for _, domain := range domains {
+		list[strings.ToLower(strings.TrimSpace(domain))] = true
+	}
+	return list
+}
+
+// DefaultDisposableDomains returns the built in list.
+func DefaultDisposableDomains() DomainList {
+	return NewDomainList(defaultDisposableDomains...)
+}
+
+// LoadDomainList reads one domain per line. Empty lines and lines starting
+// with # are skipped.
+func LoadDomainList(path string) (DomainList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := DomainList{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list[strings.ToLower(line)] = true
+	}
+	return list, scanner.Err()
+}
+
+// Contains also matches subdomains of listed domains.
+func (l DomainList) Contains(domain string) bool {
+	domain = strings.ToLower(domain)
+	for {
+		if l[domain] {
+			return true
+		}
+		dot := strings.Index(domain, ".")
+		if dot < 0 {
+			return false
+		}
+		domain = domain[dot+1:]
+	}
+}
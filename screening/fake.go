@@ -0,0 +1,53 @@
+package screening
+
+import (
+	"sync"
+)
+
+// FakeCheck gives the same result, or error, for every signup. It lets the
+// pipeline run without any network.
+type FakeCheck struct {
+	CheckName string
+	Result    Result
+	Err       error
+}
+
+// FakeDomainLookup answers from a fixed set of domains.
+type FakeDomainLookup struct {
+	Domains DomainList
+	Err     error
+}
+
+// FakeNotifier keeps what it was told.
+type FakeNotifier struct {
+	sync.Mutex
+	Signups   []Signup
+	Decisions []Decision
+}
+
+/*
+* Public methods
+ */
+
+func (c FakeCheck) Name() string {
+	return c.CheckName
+}
+
+func (c FakeCheck) Screen(signup Signup) (Result, error) {
+	return c.Result, c.Err
+}
+
+func (l FakeDomainLookup) Disposable(domain string) (bool, error) {
+	if l.Err != nil {
+		return false, l.Err
+	}
+	return l.Domains.Contains(domain), nil
+}
+
+func (n *FakeNotifier) Notify(signup Signup, decision Decision) error {
+	n.Lock()
+	defer n.Unlock()
+	n.Signups = append(n.Signups, signup)
+	n.Decisions = append(n.Decisions, decision)
+	return nil
+}
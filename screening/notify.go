@@ -0,0 +1,58 @@
+package screening
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Notifier tells someone about signups that were not allowed.
+type Notifier interface {
+	Notify(signup Signup, decision Decision) error
+}
+
+// SlackNotifier posts to a Slack incoming webhook.
+type SlackNotifier struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+/*
+* Public methods
+ */
+
+func (n SlackNotifier) Notify(signup Signup, decision Decision) error {
+	text := "Signup "
+	if decision.Verdict == Deny {
+		text += "rejected"
+	} else {
+		text += "held for review"
+	}
+	text += " for email: " + signup.Email
+	if len(decision.Reasons) > 0 {
+		text += " (" + strings.Join(decision.Reasons, "; ") + ")"
+	}
+
+	requestJson, err := json.Marshal(struct {
+		Text string `json:"text"`
+	}{text})
+	if err != nil {
+		return err
+	}
+
+	req, _ := http.NewRequest("POST", n.WebhookURL, bytes.NewReader(requestJson))
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := client(n.Client).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return errors.New("Slack answered " + resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+// Package screening decides whether a new signup may go ahead. A Pipeline
+// runs a list of checks, such as reCAPTCHA or a disposable email lookup,
+// and combines their verdicts under a Policy: the strictest verdict wins,
+// and every check says why it gave its verdict.
+package screening
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+type Verdict string
+
+const (
+	Allow  Verdict = "allow"
+	Review Verdict = "review"
+	Deny   Verdict = "deny"
+)
+
+// Signup is what a check gets to look at.
+type Signup struct {
+	Email     string
+	FirstName string
+	IP        string
+
+	// The g-recaptcha-response field of the registration form
+	Recaptcha string
+}
+
+// Result is one check's verdict on a signup.
+type Result struct {
+	Check   string   `json:"check"`
+	Verdict Verdict  `json:"verdict"`
+	Reasons []string `json:"reasons"`
+}
+
+type Check interface {
+	Name() string
+	Screen(signup Signup) (Result, error)
+}
+
+// SignupScreener decides on a signup.
+type SignupScreener interface {
+	Screen(signup Signup) Decision
+}
+
+type Decision struct {
+	Verdict Verdict
+	Reasons []string
+	Results []Result
+
+	// Checks that could not run. Each one counted as its OnError verdict.
+	Errors []error
+}
+
+// Policy adjusts what each check can do, by check name.
+type Policy struct {
+	// Strictest verdict a check may give. A check limited to Review only
+	// flags signups for an admin, and one limited to Allow only reports.
+	Limits map[string]Verdict
+
+	// Checks that are not run at all
+	Disabled map[string]bool
+
+	// What a check that fails to run counts as. Allow when not set, so an
+	// outage at a vendor does not stop signups.
+	OnError map[string]Verdict
+}
+
+type Pipeline struct {
+	policy Policy
+	checks []Check
+}
+
+/*
+* Private methods
+ */
+
+func rank(verdict Verdict) int {
+	switch verdict {
+	case Review:
+		return 1
+	case Deny:
+		return 2
+	}
+	return 0
+}
+
+func parseVerdict(value string) (Verdict, error) {
+	switch Verdict(value) {
+	case Allow, Review, Deny:
+		return Verdict(value), nil
+	}
+	return "", errors.New("Unknown verdict " + value)
+}
+
+func (p *Pipeline) limit(name string, verdict Verdict) Verdict {
+	limit, ok := p.policy.Limits[name]
+	if ok && rank(verdict) > rank(limit) {
+		return limit
+	}
+	return verdict
+}
+
+/*
+* Public methods
+ */
+
+func NewPipeline(policy Policy, checks ...Check) *Pipeline {
+	return &Pipeline{policy: policy, checks: checks}
+}
+
+// Screen runs the checks in order, and stops at the first one that denies
+// the signup since the rest can't change the outcome.
+func (p *Pipeline) Screen(signup Signup) Decision {
+	decision := Decision{Verdict: Allow}
+
+	for _, check := range p.checks {
+		name := check.Name()
+		if p.policy.Disabled[name] {
+			continue
+		}
+
+		result, err := check.Screen(signup)
+		if err != nil {
+			decision.Errors = append(decision.Errors, errors.New(name+": "+err.Error()))
+
+			onError, ok := p.policy.OnError[name]
+			if !ok {
+				onError = Allow
+			}
+			result = Result{Verdict: onError, Reasons: []string{name + " could not run"}}
+		}
+		result.Check = name
+		result.Verdict = p.limit(name, result.Verdict)
+
+		decision.Results = append(decision.Results, result)
+		if result.Verdict != Allow {
+			decision.Reasons = append(decision.Reasons, result.Reasons...)
+		}
+		if rank(result.Verdict) > rank(decision.Verdict) {
+			decision.Verdict = result.Verdict
+		}
+		if decision.Verdict == Deny {
+			break
+		}
+	}
+
+	return decision
+}
+
+// LoadPolicy reads the policy for the named checks from the environment.
+// SIGNUP_CHECK_<NAME> is the strictest verdict the check may give, or
+// "off", and SIGNUP_CHECK_<NAME>_ON_ERROR is what it counts as when it
+// can't run.
+func LoadPolicy(names []string) (Policy, error) {
+	policy := Policy{
+		Limits:   map[string]Verdict{},
+		Disabled: map[string]bool{},
+		OnError:  map[string]Verdict{},
+	}
+
+	for _, name := range names {
+		key := "SIGNUP_CHECK_" + strings.ToUpper(name)
+
+		switch value := os.Getenv(key); value {
+		case "":
+		case "off":
+			policy.Disabled[name] = true
+		default:
+			verdict, err := parseVerdict(value)
+			if err != nil {
+				return Policy{}, errors.New("Invalid value for " + key)
+			}
+			policy.Limits[name] = verdict
+		}
+
+		if value := os.Getenv(key + "_ON_ERROR"); value != "" {
+			verdict, err := parseVerdict(value)
+			if err != nil {
+				return Policy{}, errors.New("Invalid value for " + key + "_ON_ERROR")
+			}
+			policy.OnError[name] = verdict
+		}
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,216 @@
+package screening
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+var testSignup = Signup{Email: "jane@example.com", FirstName: "Jane", IP: "203.0.113.7"}
+
+func allow(name string) FakeCheck {
+	return FakeCheck{CheckName: name, Result: Result{Verdict: Allow}}
+}
+
+func flag(name string, verdict Verdict, reason string) FakeCheck {
+	return FakeCheck{CheckName: name, Result: Result{Verdict: verdict, Reasons: []string{reason}}}
+}
+
+func broken(name string) FakeCheck {
+	return FakeCheck{CheckName: name, Err: errors.New("timed out")}
+}
+
+// The checks that ran, in order
+func ran(decision Decision) []string {
+	names := []string{}
+	for _, result := range decision.Results {
+		names = append(names, result.Check)
+	}
+	return names
+}
+
+func TestPipeline(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		checks  []Check
+		verdict Verdict
+		reasons []string
+		ran     []string
+		errors  int
+	}{
+		{
+			name:    "all allow",
+			checks:  []Check{allow("a"), allow("b")},
+			verdict: Allow,
+			reasons: nil,
+			ran:     []string{"a", "b"},
+		},
+		{
+			name:    "strictest wins",
+			checks:  []Check{flag("a", Review, "risky"), allow("b"), flag("c", Review, "new domain")},
+			verdict: Review,
+			reasons: []string{"risky", "new domain"},
+			ran:     []string{"a", "b", "c"},
+		},
+		{
+			name:    "stops at the first deny",
+			checks:  []Check{flag("a", Review, "risky"), flag("b", Deny, "bot"), flag("c", Deny, "disposable")},
+			verdict: Deny,
+			reasons: []string{"risky", "bot"},
+			ran:     []string{"a", "b"},
+		},
+		{
+			name:    "limited to review",
+			policy:  Policy{Limits: map[string]Verdict{"a": Review}},
+			checks:  []Check{flag("a", Deny, "bot"), allow("b")},
+			verdict: Review,
+			reasons: []string{"bot"},
+			ran:     []string{"a", "b"},
+		},
+		{
+			name:    "limited to allow only reports",
+			policy:  Policy{Limits: map[string]Verdict{"a": Allow}},
+			checks:  []Check{flag("a", Deny, "bot")},
+			verdict: Allow,
+			reasons: nil,
+			ran:     []string{"a"},
+		},
+		{
+			name:    "disabled",
+			policy:  Policy{Disabled: map[string]bool{"a": true}},
+			checks:  []Check{flag("a", Deny, "bot"), allow("b")},
+			verdict: Allow,
+			reasons: nil,
+			ran:     []string{"b"},
+		},
+		{
+			name:    "error allows by default",
+			checks:  []Check{broken("a"), allow("b")},
+			verdict: Allow,
+			reasons: nil,
+			ran:     []string{"a", "b"},
+			errors:  1,
+		},
+		{
+			name:    "error counts as its OnError verdict",
+			policy:  Policy{OnError: map[string]Verdict{"a": Review}},
+			checks:  []Check{broken("a"), allow("b")},
+			verdict: Review,
+			reasons: []string{"a could not run"},
+			ran:     []string{"a", "b"},
+			errors:  1,
+		},
+		{
+			name:    "OnError is limited too",
+			policy:  Policy{OnError: map[string]Verdict{"a": Deny}, Limits: map[string]Verdict{"a": Review}},
+			checks:  []Check{broken("a"), allow("b")},
+			verdict: Review,
+			reasons: []string{"a could not run"},
+			ran:     []string{"a", "b"},
+			errors:  1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decision := NewPipeline(test.policy, test.checks...).Screen(testSignup)
+			if decision.Verdict != test.verdict {
+				t.Errorf("Verdict = %s, want %s", decision.Verdict, test.verdict)
+			}
+			if !reflect.DeepEqual(decision.Reasons, test.reasons) {
+				t.Errorf("Reasons = %q, want %q", decision.Reasons, test.reasons)
+			}
+			if !reflect.DeepEqual(ran(decision), test.ran) {
+				t.Errorf("checks run = %v, want %v", ran(decision), test.ran)
+			}
+			if len(decision.Errors) != test.errors {
+				t.Errorf("Errors = %v, want %d", decision.Errors, test.errors)
+			}
+		})
+	}
+}
+
+func TestDisposableDomainCheck(t *testing.T) {
+	check := DisposableDomainCheck{
+		Local:  NewDomainList("mailinator.com"),
+		Lookup: FakeDomainLookup{Domains: NewDomainList("burner.example")},
+	}
+
+	tests := []struct {
+		email   string
+		verdict Verdict
+	}{
+		{"jane@example.com", Allow},
+		{"jane@Mailinator.com", Deny},
+		{"jane@burner.example", Deny},
+		{"jane", Deny},
+	}
+	for _, test := range tests {
+		result, err := check.Screen(Signup{Email: test.email})
+		if err != nil || result.Verdict != test.verdict {
+			t.Errorf("Screen(%s) = %+v, %v, want %s", test.email, result, err, test.verdict)
+		}
+	}
+
+	// Only the local list is left when the lookup is down
+	check.Lookup = FakeDomainLookup{Err: errors.New("down")}
+	if result, _ := check.Screen(Signup{Email: "jane@burner.example"}); result.Verdict != Allow {
+		t.Errorf("Screen with the lookup down = %+v, want allow", result)
+	}
+	if result, _ := check.Screen(Signup{Email: "jane@mailinator.com"}); result.Verdict != Deny {
+		t.Errorf("Screen of a listed domain with the lookup down = %+v, want deny", result)
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	env := map[string]string{
+		"SIGNUP_CHECK_RECAPTCHA":           "off",
+		"SIGNUP_CHECK_CLEARBIT":            "review",
+		"SIGNUP_CHECK_CLEARBIT_ON_ERROR":   "review",
+		"SIGNUP_CHECK_DISPOSABLE_ON_ERROR": "deny",
+	}
+	for key, value := range env {
+		os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+
+	policy, err := LoadPolicy([]string{"recaptcha", "clearbit", "disposable"})
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	want := Policy{
+		Limits:   map[string]Verdict{"clearbit": Review},
+		Disabled: map[string]bool{"recaptcha": true},
+		OnError:  map[string]Verdict{"clearbit": Review, "disposable": Deny},
+	}
+	if !reflect.DeepEqual(policy, want) {
+		t.Errorf("LoadPolicy = %+v, want %+v", policy, want)
+	}
+
+	for key, value := range map[string]string{
+		"SIGNUP_CHECK_CLEARBIT":          "block",
+		"SIGNUP_CHECK_CLEARBIT_ON_ERROR": "off",
+	} {
+		old := os.Getenv(key)
+		os.Setenv(key, value)
+		if _, err := LoadPolicy([]string{"clearbit"}); err == nil {
+			t.Errorf("LoadPolicy with %s=%s succeeded", key, value)
+		}
+		os.Setenv(key, old)
+	}
+}
+
+func TestFakeNotifier(t *testing.T) {
+	notifier := &FakeNotifier{}
+	decision := NewPipeline(Policy{}, flag("a", Review, "risky")).Screen(testSignup)
+
+	var n Notifier = notifier
+	if err := n.Notify(testSignup, decision); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if len(notifier.Signups) != 1 || notifier.Signups[0] != testSignup || notifier.Decisions[0].Verdict != Review {
+		t.Errorf("FakeNotifier kept %+v and %+v", notifier.Signups, notifier.Decisions)
+	}
+}
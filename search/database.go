@@ -12,6 +12,7 @@ import (
 	gcontext "github.com/gorilla/context"
 	elastic "github.com/news-ai/elastic-appengine"
 
+	apiControllers "github.com/news-ai/api-v1/controllers"
 	apiModels "github.com/news-ai/api-v1/models"
 
 	pitchModels "github.com/news-ai/pitch/models"
@@ -207,6 +208,8 @@ type DatabaseResponse struct {
 	Data  interface{} `json:"data"`
 }
 
+//go:generate go run ../fillgen/main.go -type=LocationCityResponse,LocationStateResponse,LocationCountryResponse
+
 type LocationCityResponse struct {
 	Id               string `json:"id"`
 	FixedCountryName string `json:"countryName"`
@@ -214,45 +217,46 @@ type LocationCityResponse struct {
 	CityName         string `json:"cityName"`
 }
 
-func (lcr *LocationCityResponse) FillStruct(m map[string]interface{}) error {
-	for k, v := range m {
-		err := apiModels.SetField(lcr, k, v)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 type LocationStateResponse struct {
 	Id               string `json:"id"`
 	FixedCountryName string `json:"countryName"`
 	StateName        string `json:"stateName"`
 }
 
-func (lsr *LocationStateResponse) FillStruct(m map[string]interface{}) error {
-	for k, v := range m {
-		err := apiModels.SetField(lsr, k, v)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 type LocationCountryResponse struct {
 	Id          string `json:"id"`
 	CountryName string `json:"countryName"`
 }
 
-func (lcr *LocationCountryResponse) FillStruct(m map[string]interface{}) error {
-	for k, v := range m {
-		err := apiModels.SetField(lcr, k, v)
-		if err != nil {
-			return err
-		}
+// Each enhance lookup uses up one of the user's enhance credits, and is
+// not made once they have none left. The credit is only used up once
+// enhance answered, so a lookup that fails doesn't cost one.
+func checkEnhanceCredit(r *http.Request) error {
+	user, err := apiControllers.GetCurrentUser(r)
+	if err != nil {
+		log.Printf("%v", err)
+		return err
 	}
-	return nil
+	return apiControllers.CheckEntitlement(r, user, apiModels.EntitlementEnhanceCredits, 1)
+}
+
+func consumeEnhanceCredit(r *http.Request) error {
+	user, err := apiControllers.GetCurrentUser(r)
+	if err != nil {
+		log.Printf("%v", err)
+		return err
+	}
+	return apiControllers.ConsumeEntitlement(r, user, apiModels.EntitlementEnhanceCredits, 1)
+}
+
+// The media database is only searched for users whose plan includes it
+func checkMediaDatabase(r *http.Request) error {
+	user, err := apiControllers.GetCurrentUser(r)
+	if err != nil {
+		log.Printf("%v", err)
+		return err
+	}
+	return apiControllers.CheckEntitlement(r, user, apiModels.EntitlementMediaDatabase, 1)
 }
 
 func searchESMediaDatabase(elasticQuery interface{}) (interface{}, int, int, error) {
@@ -329,6 +333,11 @@ func searchESContactsDatabase(elasticQuery elastic.ElasticQuery) (interface{}, i
 }
 
 func SearchEnhanceForEmailVerification(r *http.Request, email string) (EnhanceEmailVerificationResponse, error) {
+	err := checkEnhanceCredit(r)
+	if err != nil {
+		return EnhanceEmailVerificationResponse{}, err
+	}
+
 	client := http.Client{}
 	getUrl := "https://enhance.newsai.org/verify/" + email
 
@@ -348,10 +357,20 @@ func SearchEnhanceForEmailVerification(r *http.Request, email string) (EnhanceEm
 		return EnhanceEmailVerificationResponse{}, err
 	}
 
+	err = consumeEnhanceCredit(r)
+	if err != nil {
+		return EnhanceEmailVerificationResponse{}, err
+	}
+
 	return enhanceResponse, nil
 }
 
 func SearchCompanyDatabase(r *http.Request, url string) (EnhanceFullContactCompanyResponse, error) {
+	err := checkEnhanceCredit(r)
+	if err != nil {
+		return EnhanceFullContactCompanyResponse{}, err
+	}
+
 	client := http.Client{}
 	getUrl := "https://enhance.newsai.org/company/" + url
 
@@ -371,10 +390,20 @@ func SearchCompanyDatabase(r *http.Request, url string) (EnhanceFullContactCompa
 		return EnhanceFullContactCompanyResponse{}, err
 	}
 
+	err = consumeEnhanceCredit(r)
+	if err != nil {
+		return EnhanceFullContactCompanyResponse{}, err
+	}
+
 	return enhanceResponse, nil
 }
 
 func SearchContactDatabase(r *http.Request, email string) (EnhanceFullContactProfileResponse, error) {
+	err := checkEnhanceCredit(r)
+	if err != nil {
+		return EnhanceFullContactProfileResponse{}, err
+	}
+
 	client := http.Client{}
 	getUrl := "https://enhance.newsai.org/fullcontact/" + email
 
@@ -394,10 +423,20 @@ func SearchContactDatabase(r *http.Request, email string) (EnhanceFullContactPro
 		return EnhanceFullContactProfileResponse{}, err
 	}
 
+	err = consumeEnhanceCredit(r)
+	if err != nil {
+		return EnhanceFullContactProfileResponse{}, err
+	}
+
 	return enhanceResponse, nil
 }
 
 func SearchContactVerifyDatabase(r *http.Request, email string) (EnhanceFullContactProfileVerifyResponse, error) {
+	err := checkEnhanceCredit(r)
+	if err != nil {
+		return EnhanceFullContactProfileVerifyResponse{}, err
+	}
+
 	client := http.Client{}
 	getUrl := "https://enhance.newsai.org/fullcontact2/" + email
 
@@ -417,10 +456,20 @@ func SearchContactVerifyDatabase(r *http.Request, email string) (EnhanceFullCont
 		return EnhanceFullContactProfileVerifyResponse{}, err
 	}
 
+	err = consumeEnhanceCredit(r)
+	if err != nil {
+		return EnhanceFullContactProfileVerifyResponse{}, err
+	}
+
 	return enhanceResponse, nil
 }
 
 func SearchContactDatabaseForMediaDatbase(r *http.Request, email string) (pitchModels.MediaDatabaseProfile, error) {
+	err := checkEnhanceCredit(r)
+	if err != nil {
+		return pitchModels.MediaDatabaseProfile{}, err
+	}
+
 	client := http.Client{}
 	getUrl := "https://enhance.newsai.org/fullcontact/" + email
 
@@ -440,10 +489,20 @@ func SearchContactDatabaseForMediaDatbase(r *http.Request, email string) (pitchM
 		return pitchModels.MediaDatabaseProfile{}, err
 	}
 
+	err = consumeEnhanceCredit(r)
+	if err != nil {
+		return pitchModels.MediaDatabaseProfile{}, err
+	}
+
 	return enhanceResponse, nil
 }
 
 func SearchContactInMediaDatabase(r *http.Request, email string) (pitchModels.MediaDatabaseProfile, error) {
+	err := checkMediaDatabase(r)
+	if err != nil {
+		return pitchModels.MediaDatabaseProfile{}, err
+	}
+
 	client := http.Client{}
 	getUrl := "https://enhance.newsai.org/md/" + email
 
@@ -479,6 +538,11 @@ func SearchContactInMediaDatabase(r *http.Request, email string) (pitchModels.Me
 }
 
 func SearchESMediaDatabasePublications(r *http.Request) (interface{}, int, int, error) {
+	err := checkMediaDatabase(r)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
 	offset := gcontext.Get(r, "offset").(int)
 	limit := gcontext.Get(r, "limit").(int)
 
@@ -495,6 +559,11 @@ func SearchESMediaDatabasePublications(r *http.Request) (interface{}, int, int,
 }
 
 func SearchESMediaDatabase(r *http.Request) (interface{}, int, int, error) {
+	err := checkMediaDatabase(r)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
 	offset := gcontext.Get(r, "offset").(int)
 	limit := gcontext.Get(r, "limit").(int)
 
@@ -511,6 +580,11 @@ func SearchESMediaDatabase(r *http.Request) (interface{}, int, int, error) {
 }
 
 func SearchContactsInESMediaDatabase(r *http.Request, searchQuery SearchMediaDatabaseQuery) (interface{}, int, int, error) {
+	err := checkMediaDatabase(r)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
 	offset := gcontext.Get(r, "offset").(int)
 	limit := gcontext.Get(r, "limit").(int)
 
@@ -823,6 +897,11 @@ func ESCountryLocation(r *http.Request, countryName string) (interface{}, int, i
 }
 
 func SearchPublicationInESMediaDatabase(r *http.Request, search string) ([]pitchModels.Publication, int, error) {
+	err := checkMediaDatabase(r)
+	if err != nil {
+		return []pitchModels.Publication{}, 0, err
+	}
+
 	search = url.QueryEscape(search)
 	search = "q=data.organizationName:" + search
 
@@ -0,0 +1,124 @@
+// Code generated by fillgen; DO NOT EDIT.
+
+package search
+
+import (
+	"errors"
+)
+
+// SetField sets the field of LocationCityResponse named by key from a decoded JSON value.
+func (l *LocationCityResponse) SetField(key string, value interface{}) error {
+	switch key {
+	case "CityName", "cityName":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		l.CityName = v
+		return nil
+	case "FixedCountryName", "fixedCountryName":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		l.FixedCountryName = v
+		return nil
+	case "FixedStateName", "fixedStateName":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		l.FixedStateName = v
+		return nil
+	case "Id", "id":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		l.Id = v
+		return nil
+	}
+	return errors.New("No such field:" + key + " in obj")
+}
+
+// FillStruct sets every field of LocationCityResponse present in m.
+func (l *LocationCityResponse) FillStruct(m map[string]interface{}) error {
+	for k, v := range m {
+		err := l.SetField(k, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetField sets the field of LocationStateResponse named by key from a decoded JSON value.
+func (l *LocationStateResponse) SetField(key string, value interface{}) error {
+	switch key {
+	case "FixedCountryName", "fixedCountryName":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		l.FixedCountryName = v
+		return nil
+	case "Id", "id":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		l.Id = v
+		return nil
+	case "StateName", "stateName":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		l.StateName = v
+		return nil
+	}
+	return errors.New("No such field:" + key + " in obj")
+}
+
+// FillStruct sets every field of LocationStateResponse present in m.
+func (l *LocationStateResponse) FillStruct(m map[string]interface{}) error {
+	for k, v := range m {
+		err := l.SetField(k, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetField sets the field of LocationCountryResponse named by key from a decoded JSON value.
+func (l *LocationCountryResponse) SetField(key string, value interface{}) error {
+	switch key {
+	case "CountryName", "countryName":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		l.CountryName = v
+		return nil
+	case "Id", "id":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		l.Id = v
+		return nil
+	}
+	return errors.New("No such field:" + key + " in obj")
+}
+
+// FillStruct sets every field of LocationCountryResponse present in m.
+func (l *LocationCountryResponse) FillStruct(m map[string]interface{}) error {
+	for k, v := range m {
+		err := l.SetField(k, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
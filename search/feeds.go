@@ -10,8 +10,6 @@ import (
 	gcontext "github.com/gorilla/context"
 	elastic "github.com/news-ai/elastic-appengine"
 
-	apiModels "github.com/news-ai/api-v1/models"
-
 	"github.com/news-ai/tabulae-v1/models"
 )
 
@@ -19,6 +17,8 @@ var (
 	elasticFeed *elastic.Elastic
 )
 
+//go:generate go run ../fillgen/main.go -type=Feed
+
 type Feed struct {
 	Type      string    `json:"type"`
 	CreatedAt time.Time `json:"createdat"`
@@ -50,16 +50,6 @@ type Feed struct {
 	InstagramHeight   int    `json:"instagramheight"`
 }
 
-func (f *Feed) FillStruct(m map[string]interface{}) error {
-	for k, v := range m {
-		err := apiModels.SetField(f, k, v)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 func searchFeed(elasticQuery interface{}, contacts []models.Contact, feedUrls []models.Feed) ([]Feed, int, error) {
 	hits, err := elasticFeed.QueryStruct(elasticQuery)
 	if err != nil {
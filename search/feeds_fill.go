@@ -0,0 +1,156 @@
+// Code generated by fillgen; DO NOT EDIT.
+
+package search
+
+import (
+	"errors"
+
+	"github.com/news-ai/cast"
+)
+
+// SetField sets the field of Feed named by key from a decoded JSON value.
+func (f *Feed) SetField(key string, value interface{}) error {
+	switch key {
+	case "Author":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		f.Author = v
+		return nil
+	case "CreatedAt":
+		v, err := cast.ToTime(value)
+		if err != nil {
+			return err
+		}
+		f.CreatedAt = v
+		return nil
+	case "FeedURL":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		f.FeedURL = v
+		return nil
+	case "InstagramComments":
+		f.InstagramComments = cast.ToInt(value)
+		return nil
+	case "InstagramHeight":
+		f.InstagramHeight = cast.ToInt(value)
+		return nil
+	case "InstagramId":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		f.InstagramId = v
+		return nil
+	case "InstagramImage":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		f.InstagramImage = v
+		return nil
+	case "InstagramLikes":
+		f.InstagramLikes = cast.ToInt(value)
+		return nil
+	case "InstagramLink":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		f.InstagramLink = v
+		return nil
+	case "InstagramUsername":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		f.InstagramUsername = v
+		return nil
+	case "InstagramVideo":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		f.InstagramVideo = v
+		return nil
+	case "InstagramWidth":
+		f.InstagramWidth = cast.ToInt(value)
+		return nil
+	case "PublicationId":
+		f.PublicationId = cast.ToInt64(value)
+		return nil
+	case "Summary":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		f.Summary = v
+		return nil
+	case "Text":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		f.Text = v
+		return nil
+	case "Title":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		f.Title = v
+		return nil
+	case "TweetId":
+		f.TweetId = cast.ToInt64(value)
+		return nil
+	case "TweetIdStr":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		f.TweetIdStr = v
+		return nil
+	case "TwitterLikes":
+		f.TwitterLikes = cast.ToInt(value)
+		return nil
+	case "TwitterRetweets":
+		f.TwitterRetweets = cast.ToInt(value)
+		return nil
+	case "Type":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		f.Type = v
+		return nil
+	case "Url":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		f.Url = v
+		return nil
+	case "Username":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		f.Username = v
+		return nil
+	}
+	return errors.New("No such field:" + key + " in obj")
+}
+
+// FillStruct sets every field of Feed present in m.
+func (f *Feed) FillStruct(m map[string]interface{}) error {
+	for k, v := range m {
+		err := f.SetField(k, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
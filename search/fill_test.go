@@ -0,0 +1,139 @@
+package search
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	apiModels "github.com/news-ai/api-v1/models"
+)
+
+// Documents as Elasticsearch returns them in _source. Some of them carry
+// values of the wrong type, which both paths have to reject the same way.
+var fillPayloads = []struct {
+	name    string
+	payload string
+	newObj  func() interface{}
+	lenient bool
+}{
+	{
+		name:   "feed tweet",
+		newObj: func() interface{} { return &Feed{} },
+		payload: `{"Type": "Tweet", "CreatedAt": "2017-03-14T18:02:11Z", "Text": "New issue is out",
+			"TweetId": 841700356186226688, "TweetIdStr": "841700356186226688", "Username": "newsai",
+			"TwitterLikes": 12, "TwitterRetweets": 3}`,
+	},
+	{
+		name:   "feed instagram post",
+		newObj: func() interface{} { return &Feed{} },
+		payload: `{"Type": "Instagram", "CreatedAt": "2017-03-13T09:30:00.000Z", "Text": "Launch day",
+			"InstagramUsername": "newsai", "InstagramId": "1471851227432405123_2123",
+			"InstagramImage": "https://scontent.cdninstagram.com/t51/1.jpg", "InstagramVideo": "",
+			"InstagramLink": "https://www.instagram.com/p/BRtrZ2pgPZD/", "InstagramLikes": 48,
+			"InstagramComments": 5, "InstagramWidth": 1080, "InstagramHeight": 1350}`,
+	},
+	{
+		name:   "feed headline",
+		newObj: func() interface{} { return &Feed{} },
+		payload: `{"Type": "Headline", "CreatedAt": "2017-03-12T07:00:00Z", "Title": "Markets open higher",
+			"Author": "Jane Doe", "Url": "https://example.com/markets", "Summary": "Stocks rose.",
+			"FeedURL": "https://example.com/rss", "PublicationId": 5629499534213120}`,
+	},
+	{
+		name:    "feed with a wrong type",
+		newObj:  func() interface{} { return &Feed{} },
+		payload: `{"Title": 42}`,
+	},
+	{
+		name:    "feed with an unknown field",
+		newObj:  func() interface{} { return &Feed{} },
+		payload: `{"Title": "Markets open higher", "Retweeted": true}`,
+	},
+	{
+		name:   "tweet",
+		newObj: func() interface{} { return &Tweet{} },
+		payload: `{"Type": "Tweet", "Text": "RT @newsai: New issue is out", "TweetId": 841700356186226688,
+			"TweetIdStr": "841700356186226688", "Username": "newsai", "CreatedAt": "2017-03-14T18:02:11Z",
+			"Likes": 0, "Retweets": 7, "Place": "New York, NY", "Coordinates": "", "Retweeted": true}`,
+		lenient: true,
+	},
+	{
+		// Tweets skip what they can't set, so the rest still has to match
+		name:    "tweet with bad values",
+		newObj:  func() interface{} { return &Tweet{} },
+		payload: `{"Text": "hello", "Place": 12, "Retweeted": "yes", "Entities": {"hashtags": []}, "Likes": "4"}`,
+		lenient: true,
+	},
+	{
+		name:   "headline",
+		newObj: func() interface{} { return &Headline{} },
+		payload: `{"Type": "Headline", "Title": "Markets open higher", "Author": "Jane Doe",
+			"Url": "https://example.com/markets", "Categories": ["Business", "Markets"],
+			"PublishDate": "2017-03-12T07:00:00Z", "Summary": "Stocks rose.",
+			"FeedURL": "https://example.com/rss", "PublicationId": 5629499534213120}`,
+	},
+	{
+		name:    "headline without categories",
+		newObj:  func() interface{} { return &Headline{} },
+		payload: `{"Title": "Markets open higher", "Categories": null, "PublishDate": "2017-03-12"}`,
+	},
+	{
+		name:   "twitter timeseries",
+		newObj: func() interface{} { return &TwitterTimeseries{} },
+		payload: `{"Username": "newsai", "CreatedAt": "2017-03-14T00:00:00Z", "Followers": 1520,
+			"Following": 310, "Likes": 2042, "Retweets": 118, "Posts": 932}`,
+	},
+	{
+		name:   "instagram timeseries",
+		newObj: func() interface{} { return &InstagramTimeseries{} },
+		payload: `{"Username": "newsai", "CreatedAt": "2017-03-14T00:00:00Z", "Followers": 860,
+			"Following": 112, "Likes": 3301, "Comments": 97, "Posts": 214}`,
+	},
+	{
+		name:    "instagram timeseries with a bad date",
+		newObj:  func() interface{} { return &InstagramTimeseries{} },
+		payload: `{"Username": "newsai", "CreatedAt": "yesterday"}`,
+	},
+}
+
+type filler interface {
+	FillStruct(m map[string]interface{}) error
+}
+
+// How FillStruct worked before fillgen
+func legacyFillStruct(obj interface{}, m map[string]interface{}, lenient bool) error {
+	for k, v := range m {
+		err := apiModels.SetField(obj, k, v)
+		if err != nil && !lenient {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestFillStructMatchesSetField(t *testing.T) {
+	for _, test := range fillPayloads {
+		t.Run(test.name, func(t *testing.T) {
+			m := map[string]interface{}{}
+			if err := json.Unmarshal([]byte(test.payload), &m); err != nil {
+				t.Fatalf("payload: %v", err)
+			}
+
+			legacy := test.newObj()
+			legacyErr := legacyFillStruct(legacy, m, test.lenient)
+
+			generated := test.newObj()
+			generatedErr := generated.(filler).FillStruct(m)
+
+			if (legacyErr == nil) != (generatedErr == nil) {
+				t.Fatalf("SetField error %v, FillStruct error %v", legacyErr, generatedErr)
+			}
+
+			// Failing fills stop at a field that depends on map order, so
+			// only the ones that succeed leave comparable values behind.
+			if legacyErr == nil && !reflect.DeepEqual(legacy, generated) {
+				t.Errorf("SetField filled %+v, FillStruct filled %+v", legacy, generated)
+			}
+		})
+	}
+}
@@ -9,7 +9,6 @@ import (
 
 	gcontext "github.com/gorilla/context"
 
-	apiModels "github.com/news-ai/api-v1/models"
 	elastic "github.com/news-ai/elastic-appengine"
 	"github.com/news-ai/tabulae-v1/models"
 )
@@ -18,6 +17,8 @@ var (
 	elasticHeadline *elastic.Elastic
 )
 
+//go:generate go run ../fillgen/main.go -type=Headline
+
 type Headline struct {
 	Type string `json:"type"`
 
@@ -32,16 +33,6 @@ type Headline struct {
 	PublicationId int64 `json:"publicationid"`
 }
 
-func (h *Headline) FillStruct(m map[string]interface{}) error {
-	for k, v := range m {
-		err := apiModels.SetField(h, k, v)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 func searchHeadline(elasticQuery interface{}, stringFeeds []string, feedUrls []models.Feed, checkMap bool) ([]Headline, int, error) {
 	hits, err := elasticHeadline.QueryStruct(elasticQuery)
 	if err != nil {
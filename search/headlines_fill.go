@@ -0,0 +1,82 @@
+// Code generated by fillgen; DO NOT EDIT.
+
+package search
+
+import (
+	"errors"
+
+	"github.com/news-ai/cast"
+)
+
+// SetField sets the field of Headline named by key from a decoded JSON value.
+func (h *Headline) SetField(key string, value interface{}) error {
+	switch key {
+	case "Author":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		h.Author = v
+		return nil
+	case "Categories":
+		h.Categories = cast.ToStringSlice(value)
+		return nil
+	case "FeedURL":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		h.FeedURL = v
+		return nil
+	case "PublicationId":
+		h.PublicationId = cast.ToInt64(value)
+		return nil
+	case "PublishDate":
+		v, err := cast.ToTime(value)
+		if err != nil {
+			return err
+		}
+		h.PublishDate = v
+		return nil
+	case "Summary":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		h.Summary = v
+		return nil
+	case "Title":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		h.Title = v
+		return nil
+	case "Type":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		h.Type = v
+		return nil
+	case "Url":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		h.Url = v
+		return nil
+	}
+	return errors.New("No such field:" + key + " in obj")
+}
+
+// FillStruct sets every field of Headline present in m.
+func (h *Headline) FillStruct(m map[string]interface{}) error {
+	for k, v := range m {
+		err := h.SetField(k, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -9,8 +9,6 @@ import (
 
 	gcontext "github.com/gorilla/context"
 
-	apiModels "github.com/news-ai/api-v1/models"
-
 	elastic "github.com/news-ai/elastic-appengine"
 )
 
@@ -19,6 +17,8 @@ var (
 	elasticInstagramUser *elastic.Elastic
 )
 
+//go:generate go run ../fillgen/main.go -type=InstagramPost
+
 type InstagramPost struct {
 	Type string `json:"type"`
 
@@ -44,16 +44,6 @@ type InstagramPost struct {
 	CreatedAt time.Time `json:"createdat"`
 }
 
-func (ip *InstagramPost) FillStruct(m map[string]interface{}) error {
-	for k, v := range m {
-		err := apiModels.SetField(ip, k, v)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 func searchInstagramPost(elasticQuery interface{}, usernames []string) ([]InstagramPost, int, error) {
 	hits, err := elasticInstagram.QueryStruct(elasticQuery)
 	if err != nil {
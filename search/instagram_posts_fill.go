@@ -0,0 +1,119 @@
+// Code generated by fillgen; DO NOT EDIT.
+
+package search
+
+import (
+	"errors"
+
+	"github.com/news-ai/cast"
+)
+
+// SetField sets the field of InstagramPost named by key from a decoded JSON value.
+func (i *InstagramPost) SetField(key string, value interface{}) error {
+	switch key {
+	case "Caption":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		i.Caption = v
+		return nil
+	case "Comments":
+		i.Comments = cast.ToInt(value)
+		return nil
+	case "Coordinates":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		i.Coordinates = v
+		return nil
+	case "CreatedAt":
+		v, err := cast.ToTime(value)
+		if err != nil {
+			return err
+		}
+		i.CreatedAt = v
+		return nil
+	case "Image":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		i.Image = v
+		return nil
+	case "InstagramHeight":
+		i.InstagramHeight = cast.ToInt(value)
+		return nil
+	case "InstagramId":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		i.InstagramId = v
+		return nil
+	case "InstagramWidth":
+		i.InstagramWidth = cast.ToInt(value)
+		return nil
+	case "IsDeleted":
+		v, ok := value.(bool)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		i.IsDeleted = v
+		return nil
+	case "Likes":
+		i.Likes = cast.ToInt(value)
+		return nil
+	case "Link":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		i.Link = v
+		return nil
+	case "Location":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		i.Location = v
+		return nil
+	case "Tags":
+		i.Tags = cast.ToStringSlice(value)
+		return nil
+	case "Type":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		i.Type = v
+		return nil
+	case "Username":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		i.Username = v
+		return nil
+	case "Video":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		i.Video = v
+		return nil
+	}
+	return errors.New("No such field:" + key + " in obj")
+}
+
+// FillStruct sets every field of InstagramPost present in m.
+func (i *InstagramPost) FillStruct(m map[string]interface{}) error {
+	for k, v := range m {
+		err := i.SetField(k, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
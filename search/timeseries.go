@@ -7,8 +7,6 @@ import (
 	"strings"
 	"time"
 
-	apiModels "github.com/news-ai/api-v1/models"
-
 	elastic "github.com/news-ai/elastic-appengine"
 )
 
@@ -17,6 +15,8 @@ var (
 	elasticTwitterTimeseries   *elastic.Elastic
 )
 
+//go:generate go run ../fillgen/main.go -type=TwitterTimeseries,InstagramTimeseries
+
 type TwitterTimeseries struct {
 	Username  string    `json:"Username"`
 	CreatedAt time.Time `json:"CreatedAt"`
@@ -37,26 +37,6 @@ type InstagramTimeseries struct {
 	Posts     int       `json:"Posts"`
 }
 
-func (tt *TwitterTimeseries) FillStruct(m map[string]interface{}) error {
-	for k, v := range m {
-		err := apiModels.SetField(tt, k, v)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func (it *InstagramTimeseries) FillStruct(m map[string]interface{}) error {
-	for k, v := range m {
-		err := apiModels.SetField(it, k, v)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 func searchTwitterTimeseries(elasticQuery interface{}) (interface{}, int, error) {
 	hits, err := elasticTwitterTimeseries.QueryStruct(elasticQuery)
 	if err != nil {
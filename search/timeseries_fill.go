@@ -0,0 +1,103 @@
+// Code generated by fillgen; DO NOT EDIT.
+
+package search
+
+import (
+	"errors"
+
+	"github.com/news-ai/cast"
+)
+
+// SetField sets the field of TwitterTimeseries named by key from a decoded JSON value.
+func (t *TwitterTimeseries) SetField(key string, value interface{}) error {
+	switch key {
+	case "CreatedAt":
+		v, err := cast.ToTime(value)
+		if err != nil {
+			return err
+		}
+		t.CreatedAt = v
+		return nil
+	case "Followers":
+		t.Followers = cast.ToInt(value)
+		return nil
+	case "Following":
+		t.Following = cast.ToInt(value)
+		return nil
+	case "Likes":
+		t.Likes = cast.ToInt(value)
+		return nil
+	case "Posts":
+		t.Posts = cast.ToInt(value)
+		return nil
+	case "Retweets":
+		t.Retweets = cast.ToInt(value)
+		return nil
+	case "Username":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		t.Username = v
+		return nil
+	}
+	return errors.New("No such field:" + key + " in obj")
+}
+
+// FillStruct sets every field of TwitterTimeseries present in m.
+func (t *TwitterTimeseries) FillStruct(m map[string]interface{}) error {
+	for k, v := range m {
+		err := t.SetField(k, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetField sets the field of InstagramTimeseries named by key from a decoded JSON value.
+func (i *InstagramTimeseries) SetField(key string, value interface{}) error {
+	switch key {
+	case "Comments":
+		i.Comments = cast.ToInt(value)
+		return nil
+	case "CreatedAt":
+		v, err := cast.ToTime(value)
+		if err != nil {
+			return err
+		}
+		i.CreatedAt = v
+		return nil
+	case "Followers":
+		i.Followers = cast.ToInt(value)
+		return nil
+	case "Following":
+		i.Following = cast.ToInt(value)
+		return nil
+	case "Likes":
+		i.Likes = cast.ToInt(value)
+		return nil
+	case "Posts":
+		i.Posts = cast.ToInt(value)
+		return nil
+	case "Username":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		i.Username = v
+		return nil
+	}
+	return errors.New("No such field:" + key + " in obj")
+}
+
+// FillStruct sets every field of InstagramTimeseries present in m.
+func (i *InstagramTimeseries) FillStruct(m map[string]interface{}) error {
+	for k, v := range m {
+		err := i.SetField(k, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
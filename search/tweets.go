@@ -9,8 +9,6 @@ import (
 
 	gcontext "github.com/gorilla/context"
 
-	apiModels "github.com/news-ai/api-v1/models"
-
 	elastic "github.com/news-ai/elastic-appengine"
 )
 
@@ -19,6 +17,8 @@ var (
 	elasticTwitterUser *elastic.Elastic
 )
 
+//go:generate go run ../fillgen/main.go -type=Tweet -lenient
+
 type Tweet struct {
 	Type string `json:"type"`
 
@@ -35,16 +35,6 @@ type Tweet struct {
 	Retweeted   bool   `json:"retweeted"`
 }
 
-func (t *Tweet) FillStruct(m map[string]interface{}) error {
-	for k, v := range m {
-		err := apiModels.SetField(t, k, v)
-		if err != nil {
-			// return err
-		}
-	}
-	return nil
-}
-
 func searchTweet(elasticQuery interface{}, usernames []string) ([]Tweet, int, error) {
 	hits, err := elasticTweet.QueryStruct(elasticQuery)
 	if err != nil {
@@ -0,0 +1,90 @@
+// Code generated by fillgen; DO NOT EDIT.
+
+package search
+
+import (
+	"errors"
+
+	"github.com/news-ai/cast"
+)
+
+// SetField sets the field of Tweet named by key from a decoded JSON value.
+func (t *Tweet) SetField(key string, value interface{}) error {
+	switch key {
+	case "Coordinates":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		t.Coordinates = v
+		return nil
+	case "CreatedAt":
+		v, err := cast.ToTime(value)
+		if err != nil {
+			return err
+		}
+		t.CreatedAt = v
+		return nil
+	case "Likes":
+		t.Likes = cast.ToInt(value)
+		return nil
+	case "Place":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		t.Place = v
+		return nil
+	case "Retweeted":
+		v, ok := value.(bool)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		t.Retweeted = v
+		return nil
+	case "Retweets":
+		t.Retweets = cast.ToInt(value)
+		return nil
+	case "Text":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		t.Text = v
+		return nil
+	case "TweetId":
+		t.TweetId = cast.ToInt64(value)
+		return nil
+	case "TweetIdStr":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		t.TweetIdStr = v
+		return nil
+	case "Type":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		t.Type = v
+		return nil
+	case "Username":
+		v, ok := value.(string)
+		if !ok {
+			return errors.New("Provided value type didn't match obj field type")
+		}
+		t.Username = v
+		return nil
+	}
+	return errors.New("No such field:" + key + " in obj")
+}
+
+// FillStruct sets every field of Tweet present in m.
+func (t *Tweet) FillStruct(m map[string]interface{}) error {
+	for k, v := range m {
+		// Values that can't be set are skipped
+		t.SetField(k, v)
+	}
+	return nil
+}
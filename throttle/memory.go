@@ -0,0 +1,86 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps counters in the process. It is only right for a
+// single instance, and for local development.
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string][]time.Time
+	locks    map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		attempts: map[string][]time.Time{},
+		locks:    map[string]time.Time{},
+	}
+}
+
+// Drops attempts that have slid out of the window. Callers hold the lock.
+func (m *MemoryStore) prune(key string, window time.Duration) []time.Time {
+	cutoff := time.Now().Add(-window)
+	kept := []time.Time{}
+	for _, at := range m.attempts[key] {
+		if at.After(cutoff) {
+			kept = append(kept, at)
+		}
+	}
+
+	if len(kept) == 0 {
+		delete(m.attempts, key)
+	} else {
+		m.attempts[key] = kept
+	}
+	return kept
+}
+
+func (m *MemoryStore) Hit(key string, window time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempts := append(m.prune(key, window), time.Now())
+	m.attempts[key] = attempts
+	return len(attempts), nil
+}
+
+func (m *MemoryStore) Count(key string, window time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.prune(key, window)), nil
+}
+
+func (m *MemoryStore) Reset(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, key)
+	return nil
+}
+
+func (m *MemoryStore) Lock(key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.locks[key] = until
+	return nil
+}
+
+func (m *MemoryStore) LockedUntil(key string) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	until, ok := m.locks[key]
+	if !ok {
+		return time.Time{}, nil
+	}
+	if !until.After(time.Now()) {
+		delete(m.locks, key)
+		return time.Time{}, nil
+	}
+	return until, nil
+}
@@ -0,0 +1,91 @@
+package throttle
+
+import (
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// RedisStore keeps counters in Redis so that every instance sees the same
+// attempts. Each key is a sorted set of attempt times in nanoseconds.
+type RedisStore struct {
+	pool *redis.Pool
+}
+
+// NewRedisStore uses an existing pool, such as the session store's.
+func NewRedisStore(pool *redis.Pool) *RedisStore {
+	return &RedisStore{pool: pool}
+}
+
+func lockKey(key string) string {
+	return key + ":lock"
+}
+
+func (s *RedisStore) Hit(key string, window time.Duration) (int, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	now := time.Now().UnixNano()
+	cutoff := now - int64(window)
+
+	// The member has to be unique, or two attempts in the same
+	// nanosecond would count once.
+	member := strconv.FormatInt(now, 10) + ":" + strconv.Itoa(rand.Int())
+
+	conn.Send("MULTI")
+	conn.Send("ZREMRANGEBYSCORE", key, "-inf", cutoff)
+	conn.Send("ZADD", key, now, member)
+	conn.Send("ZCARD", key)
+	conn.Send("PEXPIRE", key, int64(window/time.Millisecond))
+	values, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return 0, err
+	}
+
+	return redis.Int(values[2], nil)
+}
+
+func (s *RedisStore) Count(key string, window time.Duration) (int, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	cutoff := time.Now().UnixNano() - int64(window)
+	return redis.Int(conn.Do("ZCOUNT", key, "("+strconv.FormatInt(cutoff, 10), "+inf"))
+}
+
+func (s *RedisStore) Reset(key string) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("DEL", key)
+	return err
+}
+
+func (s *RedisStore) Lock(key string, until time.Time) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	ttl := until.Sub(time.Now())
+	if ttl <= 0 {
+		return nil
+	}
+
+	_, err := conn.Do("SET", lockKey(key), until.Unix(), "PX", int64(ttl/time.Millisecond))
+	return err
+}
+
+func (s *RedisStore) LockedUntil(key string) (time.Time, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	until, err := redis.Int64(conn.Do("GET", lockKey(key)))
+	if err == redis.ErrNil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(until, 0), nil
+}
@@ -0,0 +1,244 @@
+// Package throttle limits how often an action can be attempted, per IP
+// address and per account, over a sliding window. Repeated failures slow
+// down further attempts and end in a temporary lockout.
+package throttle
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Store keeps the counters. Keys are opaque to the store; the limiter
+// namespaces them by action and by what they count (ip or account).
+type Store interface {
+	// Hit records an attempt at now and returns the number of attempts
+	// within the window, including this one.
+	Hit(key string, window time.Duration) (int, error)
+
+	// Count returns the number of attempts within the window.
+	Count(key string, window time.Duration) (int, error)
+
+	// Reset forgets every attempt recorded for key.
+	Reset(key string) error
+
+	// Lock blocks key until the given time.
+	Lock(key string, until time.Time) error
+
+	// LockedUntil returns when the lock on key ends, or the zero time.
+	LockedUntil(key string) (time.Time, error)
+}
+
+// Limits for one action. Zero values turn the matching check off.
+type Limits struct {
+	// Attempts allowed per window before the ip or account is locked
+	MaxIPAttempts      int
+	MaxAccountAttempts int
+
+	Window          time.Duration
+	LockoutDuration time.Duration
+
+	// Attempts that go through without a delay. After that each attempt
+	// waits twice as long as the one before, up to MaxDelay.
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+}
+
+// Decision is what the caller should do with an attempt.
+type Decision struct {
+	Allowed     bool
+	Delay       time.Duration
+	LockedUntil time.Time
+}
+
+type Limiter struct {
+	store  Store
+	limits map[string]Limits
+}
+
+/*
+* Private methods
+ */
+
+func ipKey(action, ip string) string {
+	return "throttle:" + action + ":ip:" + ip
+}
+
+func accountKey(action, account string) string {
+	return "throttle:" + action + ":account:" + account
+}
+
+func (l *Limiter) delay(limits Limits, failures int) time.Duration {
+	if limits.BaseDelay == 0 || failures < limits.FreeAttempts {
+		return 0
+	}
+
+	delay := limits.BaseDelay
+	for i := limits.FreeAttempts; i < failures && (limits.MaxDelay == 0 || delay < limits.MaxDelay); i++ {
+		delay *= 2
+	}
+	if limits.MaxDelay > 0 && delay > limits.MaxDelay {
+		delay = limits.MaxDelay
+	}
+	return delay
+}
+
+// Attempts start over once a lockout ends
+func (l *Limiter) lock(key string, until time.Time) error {
+	err := l.store.Lock(key, until)
+	if err != nil {
+		return err
+	}
+	return l.store.Reset(key)
+}
+
+func (l *Limiter) lockedUntil(keys ...string) (time.Time, error) {
+	latest := time.Time{}
+	for _, key := range keys {
+		until, err := l.store.LockedUntil(key)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if until.After(latest) {
+			latest = until
+		}
+	}
+	return latest, nil
+}
+
+/*
+* Public methods
+ */
+
+func NewLimiter(store Store, limits map[string]Limits) *Limiter {
+	return &Limiter{store: store, limits: limits}
+}
+
+// Check tells whether an attempt at action may go ahead, and how long it
+// should be held back first. account may be empty when it is not known.
+func (l *Limiter) Check(action, ip, account string) (Decision, error) {
+	limits, ok := l.limits[action]
+	if !ok {
+		return Decision{Allowed: true}, nil
+	}
+
+	keys := []string{ipKey(action, ip)}
+	if account != "" {
+		keys = append(keys, accountKey(action, account))
+	}
+
+	until, err := l.lockedUntil(keys...)
+	if err != nil {
+		return Decision{}, err
+	}
+	if until.After(time.Now()) {
+		return Decision{Allowed: false, LockedUntil: until}, nil
+	}
+
+	failures := 0
+	for _, key := range keys {
+		count, err := l.store.Count(key, limits.Window)
+		if err != nil {
+			return Decision{}, err
+		}
+		if count > failures {
+			failures = count
+		}
+	}
+
+	return Decision{Allowed: true, Delay: l.delay(limits, failures)}, nil
+}
+
+// Fail records a failed (or, for actions like sending a reset email, any)
+// attempt. It returns the end of the account's lockout when this attempt
+// is the one that locked it, so the caller can tell the account owner.
+func (l *Limiter) Fail(action, ip, account string) (time.Time, error) {
+	limits, ok := l.limits[action]
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	until := time.Now().Add(limits.LockoutDuration)
+
+	count, err := l.store.Hit(ipKey(action, ip), limits.Window)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if limits.MaxIPAttempts > 0 && count >= limits.MaxIPAttempts {
+		err = l.lock(ipKey(action, ip), until)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	if account == "" {
+		return time.Time{}, nil
+	}
+
+	count, err = l.store.Hit(accountKey(action, account), limits.Window)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if limits.MaxAccountAttempts > 0 && count >= limits.MaxAccountAttempts {
+		err = l.lock(accountKey(action, account), until)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return until, nil
+	}
+
+	return time.Time{}, nil
+}
+
+// Succeed clears the account's failures after it got in. The ip counter
+// is kept, so one address can't reset itself by logging into its own
+// account in between guesses.
+func (l *Limiter) Succeed(action, account string) error {
+	if _, ok := l.limits[action]; !ok || account == "" {
+		return nil
+	}
+	return l.store.Reset(accountKey(action, account))
+}
+
+// LoadLimits fills in limits for action from the environment, for example
+// THROTTLE_LOGIN_MAX_IP_ATTEMPTS or THROTTLE_LOGIN_WINDOW=15m.
+func LoadLimits(action string, defaults Limits) (Limits, error) {
+	prefix := "THROTTLE_" + strings.ToUpper(action) + "_"
+	limits := defaults
+
+	for key, value := range map[string]*int{
+		prefix + "MAX_IP_ATTEMPTS":      &limits.MaxIPAttempts,
+		prefix + "MAX_ACCOUNT_ATTEMPTS": &limits.MaxAccountAttempts,
+		prefix + "FREE_ATTEMPTS":        &limits.FreeAttempts,
+	} {
+		if os.Getenv(key) == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(os.Getenv(key))
+		if err != nil {
+			return Limits{}, errors.New("Invalid value for " + key)
+		}
+		*value = parsed
+	}
+
+	for key, value := range map[string]*time.Duration{
+		prefix + "WINDOW":           &limits.Window,
+		prefix + "LOCKOUT_DURATION": &limits.LockoutDuration,
+		prefix + "BASE_DELAY":       &limits.BaseDelay,
+		prefix + "MAX_DELAY":        &limits.MaxDelay,
+	} {
+		if os.Getenv(key) == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(os.Getenv(key))
+		if err != nil {
+			return Limits{}, errors.New("Invalid duration for " + key)
+		}
+		*value = parsed
+	}
+
+	return limits, nil
+}
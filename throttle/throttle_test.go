@@ -0,0 +1,190 @@
+package throttle
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(limits Limits) *Limiter {
+	return NewLimiter(NewMemoryStore(), map[string]Limits{"login": limits})
+}
+
+func fail(t *testing.T, l *Limiter, ip, account string) time.Time {
+	until, err := l.Fail("login", ip, account)
+	if err != nil {
+		t.Fatalf("Fail: %v", err)
+	}
+	return until
+}
+
+func check(t *testing.T, l *Limiter, ip, account string) Decision {
+	decision, err := l.Check("login", ip, account)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	return decision
+}
+
+func TestLimiterDelay(t *testing.T) {
+	l := newTestLimiter(Limits{
+		Window:       time.Hour,
+		FreeAttempts: 2,
+		BaseDelay:    time.Second,
+		MaxDelay:     8 * time.Second,
+	})
+
+	want := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second}
+	for failures, delay := range want {
+		decision := check(t, l, "10.0.0.1", "jane@example.com")
+		if !decision.Allowed || decision.Delay != delay {
+			t.Errorf("Check after %d failures = %+v, want a delay of %v", failures, decision, delay)
+		}
+		fail(t, l, "10.0.0.1", "jane@example.com")
+	}
+
+	if decision := check(t, l, "10.0.0.2", "john@example.com"); decision.Delay != 0 {
+		t.Errorf("Check from another ip for another account = %+v, want no delay", decision)
+	}
+}
+
+func TestLimiterIPLockout(t *testing.T) {
+	l := newTestLimiter(Limits{MaxIPAttempts: 3, Window: time.Hour, LockoutDuration: time.Hour})
+
+	// Guessing a different account each time still counts against the ip
+	accounts := []string{"a@example.com", "b@example.com", "c@example.com"}
+	for _, account := range accounts {
+		if until := fail(t, l, "10.0.0.1", account); !until.IsZero() {
+			t.Errorf("Fail for %s locked the account until %v", account, until)
+		}
+	}
+
+	decision := check(t, l, "10.0.0.1", "d@example.com")
+	if decision.Allowed || decision.LockedUntil.IsZero() {
+		t.Errorf("Check from a locked ip = %+v, want it locked", decision)
+	}
+	if decision := check(t, l, "10.0.0.2", "a@example.com"); !decision.Allowed {
+		t.Errorf("Check from another ip = %+v, want it allowed", decision)
+	}
+}
+
+func TestLimiterAccountLockout(t *testing.T) {
+	l := newTestLimiter(Limits{MaxAccountAttempts: 3, Window: time.Hour, LockoutDuration: time.Hour})
+
+	// From a different ip each time, as a botnet would
+	ips := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+	var until time.Time
+	for _, ip := range ips {
+		until = fail(t, l, ip, "jane@example.com")
+	}
+	if until.IsZero() {
+		t.Fatal("Fail that reached MaxAccountAttempts did not return the lockout")
+	}
+
+	decision := check(t, l, "10.0.0.4", "jane@example.com")
+	if decision.Allowed || !decision.LockedUntil.Equal(until) {
+		t.Errorf("Check of a locked account = %+v, want it locked until %v", decision, until)
+	}
+	if decision := check(t, l, "10.0.0.4", "john@example.com"); !decision.Allowed {
+		t.Errorf("Check of another account = %+v, want it allowed", decision)
+	}
+}
+
+func TestLimiterResetAfterLockout(t *testing.T) {
+	l := newTestLimiter(Limits{
+		MaxAccountAttempts: 2,
+		Window:             time.Hour,
+		LockoutDuration:    20 * time.Millisecond,
+		FreeAttempts:       1,
+		BaseDelay:          time.Second,
+	})
+
+	fail(t, l, "10.0.0.1", "jane@example.com")
+	fail(t, l, "10.0.0.1", "jane@example.com")
+	if decision := check(t, l, "10.0.0.1", "jane@example.com"); decision.Allowed {
+		t.Fatalf("Check during the lockout = %+v, want it locked", decision)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	// The account starts over once its lockout ends
+	if decision := check(t, l, "10.0.0.2", "jane@example.com"); !decision.Allowed || decision.Delay != 0 {
+		t.Errorf("Check after the lockout = %+v, want it allowed without a delay", decision)
+	}
+	if until := fail(t, l, "10.0.0.2", "jane@example.com"); !until.IsZero() {
+		t.Errorf("first Fail after the lockout locked the account until %v", until)
+	}
+}
+
+func TestLimiterSucceed(t *testing.T) {
+	l := newTestLimiter(Limits{Window: time.Hour, FreeAttempts: 1, BaseDelay: time.Second})
+
+	fail(t, l, "10.0.0.1", "jane@example.com")
+	fail(t, l, "10.0.0.1", "jane@example.com")
+
+	if err := l.Succeed("login", "jane@example.com"); err != nil {
+		t.Fatalf("Succeed: %v", err)
+	}
+
+	// The ip keeps its failures, so logging into its own account between
+	// guesses doesn't help it
+	if decision := check(t, l, "10.0.0.2", "jane@example.com"); decision.Delay != 0 {
+		t.Errorf("Check of the account from another ip = %+v, want no delay", decision)
+	}
+	if decision := check(t, l, "10.0.0.1", "john@example.com"); decision.Delay != 2*time.Second {
+		t.Errorf("Check from the ip = %+v, want a delay of 2s", decision)
+	}
+}
+
+func TestLimiterUnknownAction(t *testing.T) {
+	l := newTestLimiter(Limits{MaxIPAttempts: 1, Window: time.Hour, LockoutDuration: time.Hour})
+
+	for i := 0; i < 3; i++ {
+		if _, err := l.Fail("reset", "10.0.0.1", "jane@example.com"); err != nil {
+			t.Fatalf("Fail: %v", err)
+		}
+	}
+	decision, err := l.Check("reset", "10.0.0.1", "jane@example.com")
+	if err != nil || !decision.Allowed {
+		t.Errorf("Check of an action without limits = %+v, %v, want it allowed", decision, err)
+	}
+}
+
+func TestLoadLimits(t *testing.T) {
+	defaults := Limits{MaxIPAttempts: 20, MaxAccountAttempts: 10, Window: 15 * time.Minute, BaseDelay: time.Second}
+
+	env := map[string]string{
+		"THROTTLE_LOGIN_MAX_IP_ATTEMPTS":  "50",
+		"THROTTLE_LOGIN_WINDOW":           "1h",
+		"THROTTLE_LOGIN_LOCKOUT_DURATION": "30m",
+	}
+	for key, value := range env {
+		os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+
+	limits, err := LoadLimits("login", defaults)
+	if err != nil {
+		t.Fatalf("LoadLimits: %v", err)
+	}
+	want := Limits{MaxIPAttempts: 50, MaxAccountAttempts: 10, Window: time.Hour, LockoutDuration: 30 * time.Minute, BaseDelay: time.Second}
+	if limits != want {
+		t.Errorf("LoadLimits = %+v, want %+v", limits, want)
+	}
+
+	// Other actions keep their defaults
+	if limits, err := LoadLimits("reset", defaults); err != nil || limits != defaults {
+		t.Errorf("LoadLimits(reset) = %+v, %v, want the defaults", limits, err)
+	}
+
+	for key, value := range map[string]string{
+		"THROTTLE_LOGIN_FREE_ATTEMPTS": "three",
+		"THROTTLE_LOGIN_MAX_DELAY":     "10",
+	} {
+		os.Setenv(key, value)
+		if _, err := LoadLimits("login", defaults); err == nil {
+			t.Errorf("LoadLimits with %s=%s succeeded", key, value)
+		}
+		os.Unsetenv(key)
+	}
+}